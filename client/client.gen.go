@@ -0,0 +1,1319 @@
+// Code generated by apigen from openapi.json. DO NOT EDIT.
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// basePath is the path prefix of the API routes
+const basePath = "/api/v1"
+
+// Client calls the JSON API of the OAuth2 test tool
+type Client struct {
+	baseURL    string // server URL followed by basePath
+	httpClient *http.Client
+}
+
+// New creates a Client for the server at serverURL, e.g. http://localhost:8080.
+// The API keeps the OAuth2 state in a session cookie, so httpClient must have
+// a cookie jar; nil uses a new client with one.
+func New(serverURL string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		jar, _ := cookiejar.New(nil)
+		httpClient = &http.Client{Jar: jar}
+	}
+	return &Client{
+		baseURL:    strings.TrimSuffix(serverURL, "/") + basePath,
+		httpClient: httpClient,
+	}
+}
+
+// HTTPClient returns the HTTP client of the Client. Follow the authorization
+// URL of a flow with it so the callback reaches the same session.
+func (c *Client) HTTPClient() *http.Client {
+	return c.httpClient
+}
+
+// Error implements the error interface
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%d %s: %s", e.Status, e.Code, e.Message)
+}
+
+// do sends a request and decodes its JSON response into out. Error responses
+// are returned as *APIError.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	target := c.baseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s %s failed: %w", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		var errResp ErrorResponse
+		if err := json.NewDecoder(resp.Body).Decode(&errResp); err != nil || errResp.Error.Code == "" {
+			return &APIError{Status: resp.StatusCode, Code: "unexpected_response", Message: resp.Status}
+		}
+		return &errResp.Error
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode %s %s response: %w", method, path, err)
+	}
+	return nil
+}
+
+// APIError is the error object of every failed response
+type APIError struct {
+	// HTTP status code
+	Status int `json:"status"`
+	// Machine-readable error code. One of: bad_request, validation_failed, not_authenticated, not_authorized, not_found, method_not_allowed, not_acceptable, unsupported_media_type, upstream_error, internal_error
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// The invalid field of a validation error
+	Field string `json:"field,omitempty"`
+}
+
+// AutoRefresh is the background refresh setting of the session
+type AutoRefresh struct {
+	Enabled bool `json:"enabled"`
+}
+
+// ClaimComparison is the claim as found in the ID token and in the userinfo response. Values are JSON encoded, except strings.
+type ClaimComparison struct {
+	Claim string `json:"claim"`
+	// Scope releasing the claim, absent when none maps it
+	Scope string `json:"scope,omitempty"`
+	// One of: match, differs, id_token_only, userinfo_only, missing
+	Status   string `json:"status"`
+	IDToken  string `json:"id_token,omitempty"`
+	Userinfo string `json:"userinfo,omitempty"`
+}
+
+// ClaimConsistencyReport is the comparison of the ID token claims with the userinfo response
+type ClaimConsistencyReport struct {
+	SubjectMatch bool   `json:"subject_match"`
+	IDTokenSub   string `json:"id_token_sub"`
+	UserinfoSub  string `json:"userinfo_sub"`
+	// Subjects match and no claim differs or is missing
+	Passed    bool                `json:"passed"`
+	Claims    []ClaimComparison   `json:"claims"`
+	Scopes    []ScopeClaimsResult `json:"scopes"`
+	CheckedAt time.Time           `json:"checked_at"`
+}
+
+// Config is the client configuration of the session. The client secret is write-only.
+type Config struct {
+	ClientID        string   `json:"client_id"`
+	HasClientSecret bool     `json:"has_client_secret"`
+	RedirectURI     string   `json:"redirect_uri"`
+	Scopes          []string `json:"scopes"`
+	// Issuer used by the session
+	BaseURL string `json:"base_url"`
+	// Issuer used when none is configured
+	DefaultBaseURL string `json:"default_base_url"`
+	// Active client profile, if any
+	ProfileID int64 `json:"profile_id,omitempty"`
+}
+
+// ConfigInput is the body of client configuration requests
+type ConfigInput struct {
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	RedirectURI  string `json:"redirect_uri"`
+	// openid is always added
+	Scopes []string `json:"scopes,omitempty"`
+	// Issuer; empty uses the server default
+	BaseURL string `json:"base_url,omitempty"`
+}
+
+// Discovery is the discovery document of the session issuer
+type Discovery struct {
+	BaseURL string `json:"base_url"`
+	// The issuer equals the base URL it was discovered from
+	IssuerMatch bool                   `json:"issuer_match"`
+	Document    map[string]interface{} `json:"document"`
+}
+
+// DiscoveryLintReport is the compliance report of a discovery document
+type DiscoveryLintReport struct {
+	// Base URL the document was discovered from
+	Issuer string `json:"issuer"`
+	// No error findings
+	Passed bool `json:"passed"`
+	// Findings, errors first
+	Findings  []LintFinding   `json:"findings"`
+	Probes    []EndpointProbe `json:"probes"`
+	CheckedAt time.Time       `json:"checked_at"`
+}
+
+// EndpointProbe is the answer of an advertised endpoint to a plain GET
+type EndpointProbe struct {
+	Field string `json:"field"`
+	URL   string `json:"url"`
+	// 0 when no response came back
+	Status     int    `json:"status"`
+	DurationMs int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+}
+
+// EndpointStats is the latency and errors of one endpoint type
+type EndpointStats struct {
+	EndpointType string `json:"endpoint_type"`
+	Count        int    `json:"count"`
+	Errors       int    `json:"errors"`
+	// Percentage
+	ErrorRate float64 `json:"error_rate"`
+	P50Ms     int64   `json:"p50_ms"`
+	P95Ms     int64   `json:"p95_ms"`
+	P99Ms     int64   `json:"p99_ms"`
+	AvgMs     int64   `json:"avg_ms"`
+	MaxMs     int64   `json:"max_ms"`
+}
+
+// ErrorResponse is the wrapper of the error object
+type ErrorResponse struct {
+	// Error object of every failed response
+	Error APIError `json:"error"`
+}
+
+// ExpiryProbe is the userinfo calls just before and just after the access token expiry
+type ExpiryProbe struct {
+	SessionID string `json:"session_id"`
+	FlowID    string `json:"flow_id"`
+	// Of the probed access token
+	Fingerprint string    `json:"fingerprint"`
+	Expiry      time.Time `json:"expiry"`
+	// How long before and after expiry the probes run (nanoseconds)
+	Margin      int64     `json:"margin"`
+	ScheduledAt time.Time `json:"scheduled_at"`
+	// Outcome of one userinfo call of an expiry probe
+	Before *ProbeResult `json:"before,omitempty"`
+	// Outcome of one userinfo call of an expiry probe
+	After *ProbeResult `json:"after,omitempty"`
+	// One of: pending, enforced, not_enforced, expired_early, failed
+	Verdict string `json:"verdict"`
+}
+
+// FieldDiff is the difference between two values at a path
+type FieldDiff struct {
+	Path string `json:"path"`
+	// One of: added, removed, changed
+	Kind  string `json:"kind"`
+	Left  string `json:"left,omitempty"`
+	Right string `json:"right,omitempty"`
+}
+
+// Flow is the started authorization flow. The user agent must visit the authorization URL; the callback completes the flow in the session.
+type Flow struct {
+	FlowID           string `json:"flow_id"`
+	AuthorizationURL string `json:"authorization_url"`
+	RedirectURI      string `json:"redirect_uri"`
+}
+
+// HistoryCount is the stored entries of an endpoint type
+type HistoryCount struct {
+	EndpointType string `json:"endpoint_type"`
+	Total        int64  `json:"total"`
+	Pinned       int64  `json:"pinned"`
+}
+
+// HistoryDiff is the structural comparison of two history entries
+type HistoryDiff struct {
+	// Logged HTTP request and response
+	Left HistoryEntry `json:"left"`
+	// Logged HTTP request and response
+	Right           HistoryEntry `json:"right"`
+	Summary         []FieldDiff  `json:"summary"`
+	QueryParams     []FieldDiff  `json:"query_params"`
+	RequestHeaders  []FieldDiff  `json:"request_headers"`
+	FormFields      []FieldDiff  `json:"form_fields"`
+	RequestBody     []FieldDiff  `json:"request_body"`
+	ResponseHeaders []FieldDiff  `json:"response_headers"`
+	ResponseBody    []FieldDiff  `json:"response_body"`
+	Tokens          []TokenDiff  `json:"tokens"`
+}
+
+// HistoryEntry is the logged HTTP request and response
+type HistoryEntry struct {
+	ID            int64  `json:"id"`
+	RequestMethod string `json:"request_method"`
+	RequestURL    string `json:"request_url"`
+	// JSON serialized
+	RequestHeaders string `json:"request_headers"`
+	RequestBody    string `json:"request_body"`
+	ResponseStatus int    `json:"response_status"`
+	// JSON serialized
+	ResponseHeaders string    `json:"response_headers"`
+	ResponseBody    string    `json:"response_body"`
+	DurationMs      int64     `json:"duration_ms"`
+	EndpointType    string    `json:"endpoint_type"`
+	FlowID          string    `json:"flow_id,omitempty"`
+	ProfileID       int64     `json:"profile_id,omitempty"`
+	ProfileName     string    `json:"profile_name,omitempty"`
+	Pinned          bool      `json:"pinned"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// HistoryFilter is the history query filter. Omitted fields match everything.
+type HistoryFilter struct {
+	EndpointType string `json:"endpoint_type,omitempty"`
+	FlowID       string `json:"flow_id,omitempty"`
+	ProfileID    int64  `json:"profile_id,omitempty"`
+}
+
+// HistoryPage is the page of history entries, newest first
+type HistoryPage struct {
+	Entries []HistoryEntry `json:"entries"`
+	Limit   int            `json:"limit"`
+	Offset  int            `json:"offset"`
+	// History query filter. Omitted fields match everything.
+	Filter HistoryFilter `json:"filter"`
+}
+
+// HistoryStats is the statistics report of a time window
+type HistoryStats struct {
+	// Length of the window (nanoseconds)
+	Window int64     `json:"window"`
+	Since  time.Time `json:"since"`
+	// Latency and errors of one endpoint type
+	Total     EndpointStats   `json:"total"`
+	Endpoints []EndpointStats `json:"endpoints"`
+	// Length of a bucket (nanoseconds)
+	BucketSize int64         `json:"bucket_size"`
+	Buckets    []StatsBucket `json:"buckets"`
+}
+
+// IDTokenValidation is the signature check of an ID token against the JWKS
+type IDTokenValidation struct {
+	Valid  bool                   `json:"valid"`
+	Claims map[string]interface{} `json:"claims,omitempty"`
+	Error  string                 `json:"error,omitempty"`
+}
+
+// JWK is the JSON Web Key
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Alg string `json:"alg"`
+}
+
+// JWKS is the key set of the issuer and the validation of the session ID token
+type JWKS struct {
+	// JSON Web Key Set
+	JWKS JWKSet `json:"jwks"`
+	// Signature check of an ID token against the JWKS
+	IDToken *IDTokenValidation `json:"id_token,omitempty"`
+}
+
+// JWKSet is the JSON Web Key Set
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// LintFinding is the problem found in a discovery document
+type LintFinding struct {
+	// One of: error, warning, info
+	Severity string `json:"severity"`
+	// Rule that found the problem, e.g. required, https, pkce
+	Rule string `json:"rule"`
+	// Metadata concerned
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+	// Specification section, e.g. OIDC Discovery §3
+	Reference string `json:"reference"`
+}
+
+// Maintenance is the retention policy, database usage and maintenance job activity
+type Maintenance struct {
+	// History retention policy
+	Policy RetentionPolicy `json:"policy"`
+	Counts []HistoryCount  `json:"counts"`
+	// Bytes
+	DatabaseSize int64            `json:"database_size"`
+	Runs         []MaintenanceRun `json:"runs"`
+}
+
+// MaintenanceRun is the execution of a maintenance job
+type MaintenanceRun struct {
+	ID int64 `json:"id"`
+	// One of: prune, purge, vacuum
+	Kind        string    `json:"kind"`
+	Trigger     string    `json:"trigger"`
+	DeletedRows int64     `json:"deleted_rows"`
+	Details     string    `json:"details"`
+	Error       string    `json:"error,omitempty"`
+	DurationMs  int64     `json:"duration_ms"`
+	StartedAt   time.Time `json:"started_at"`
+}
+
+// Monitor is the monitor configuration and latest check results
+type Monitor struct {
+	// Synthetic monitoring configuration
+	Config MonitorConfig `json:"config"`
+	// Alerts are posted to a webhook
+	Webhook bool           `json:"webhook"`
+	Checks  []MonitorCheck `json:"checks"`
+}
+
+// MonitorAlert is the notification sent to the webhook
+type MonitorAlert struct {
+	// One of: check_failed, check_recovered, content_changed
+	Event string `json:"event"`
+	// One of: discovery, jwks, grant
+	Check   string `json:"check"`
+	Message string `json:"message"`
+}
+
+// MonitorCheck is the result of a monitor check
+type MonitorCheck struct {
+	ID int64 `json:"id"`
+	// One of: discovery, jwks, grant
+	Check string `json:"check"`
+	// One of: scheduled, manual
+	Trigger string `json:"trigger"`
+	Success bool   `json:"success"`
+	// The content differs from the previous run
+	Changed bool `json:"changed"`
+	// Truncated SHA-256 of the content checked
+	Fingerprint string `json:"fingerprint,omitempty"`
+	Details     string `json:"details,omitempty"`
+	Error       string `json:"error,omitempty"`
+	DurationMs  int64  `json:"duration_ms"`
+	// Links the requests of the run in history
+	FlowID    string    `json:"flow_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// MonitorConfig is the synthetic monitoring configuration
+type MonitorConfig struct {
+	// How often the checks run, 0 when only manual runs happen (nanoseconds)
+	Interval int64 `json:"interval"`
+	// Issuer checked when the profile names none
+	Issuer string `json:"issuer"`
+	// Client profile of the grant check, by ID or name
+	Profile string `json:"profile,omitempty"`
+	// Grant of the token round trip; absent when the grant check is skipped. One of: client_credentials, refresh_token
+	Grant string `json:"grant,omitempty"`
+}
+
+// MonitorRun is the complete run of the monitor checks, also the body posted to the webhook
+type MonitorRun struct {
+	FlowID string `json:"flow_id"`
+	// One of: scheduled, manual
+	Trigger string `json:"trigger"`
+	Issuer  string `json:"issuer"`
+	// Every check succeeded
+	Healthy   bool           `json:"healthy"`
+	Checks    []MonitorCheck `json:"checks"`
+	Alerts    []MonitorAlert `json:"alerts"`
+	StartedAt time.Time      `json:"started_at"`
+}
+
+// Pin is the pinned state of a history entry
+type Pin struct {
+	Pinned bool `json:"pinned"`
+}
+
+// ProbeResult is the outcome of one userinfo call of an expiry probe
+type ProbeResult struct {
+	At     time.Time `json:"at"`
+	Status int       `json:"status,omitempty"`
+	Error  string    `json:"error,omitempty"`
+}
+
+// Profile is the saved client profile. The secret is never returned.
+type Profile struct {
+	ID          int64    `json:"id"`
+	Name        string   `json:"name"`
+	ClientID    string   `json:"client_id"`
+	RedirectURI string   `json:"redirect_uri"`
+	Scopes      []string `json:"scopes"`
+	// Issuer; empty uses the server default
+	BaseURL         string    `json:"base_url,omitempty"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+	HasClientSecret bool      `json:"has_client_secret"`
+	// The profile is the configuration of the session
+	Active bool `json:"active"`
+}
+
+// ProfileInput is the body of profile creation and update requests. An omitted secret keeps the stored one.
+type ProfileInput struct {
+	Name         string   `json:"name"`
+	ClientID     string   `json:"client_id"`
+	ClientSecret string   `json:"client_secret,omitempty"`
+	RedirectURI  string   `json:"redirect_uri"`
+	Scopes       []string `json:"scopes,omitempty"`
+	BaseURL      string   `json:"base_url,omitempty"`
+}
+
+// ProviderChange is the latest change of a field or key of the session issuer documents
+type ProviderChange struct {
+	Field string `json:"field"`
+	// One of: added, removed, changed
+	Change string `json:"change"`
+	// One of: discovery, jwks
+	Kind       string    `json:"kind"`
+	Source     string    `json:"source"`
+	Version    int       `json:"version"`
+	SnapshotID int64     `json:"snapshot_id"`
+	ChangedAt  time.Time `json:"changed_at"`
+}
+
+// ProviderChanges is the change log of the provider documents
+type ProviderChanges struct {
+	// Changes of the last 30 days of the session issuer documents, newest first
+	Recent   []ProviderChange   `json:"recent"`
+	Versions []ProviderSnapshot `json:"versions"`
+}
+
+// ProviderSnapshot is the version of a discovery document or key set, with its differences to the previous version
+type ProviderSnapshot struct {
+	ID int64 `json:"id"`
+	// One of: discovery, jwks
+	Kind string `json:"kind"`
+	// URL the document was fetched from
+	Source  string `json:"source"`
+	Version int    `json:"version"`
+	// Truncated SHA-256 of the canonical document
+	Fingerprint string `json:"fingerprint"`
+	// Canonical JSON of the document
+	Document string `json:"document"`
+	// Empty for the first version
+	Summary     []SnapshotChange `json:"summary"`
+	Diffs       []FieldDiff      `json:"diffs"`
+	FirstSeenAt time.Time        `json:"first_seen_at"`
+	LastSeenAt  time.Time        `json:"last_seen_at"`
+}
+
+// Purge is the body of purge requests
+type Purge struct {
+	// Also delete pinned entries
+	IncludePinned bool `json:"include_pinned,omitempty"`
+}
+
+// Refresh is the outcome of a refresh token grant
+type Refresh struct {
+	// Refresh token grant made for a session. Refresh tokens are identified by fingerprints.
+	Log RefreshLogEntry `json:"log"`
+	// Tokens of a session
+	Tokens Tokens `json:"tokens"`
+}
+
+// RefreshLogEntry is the refresh token grant made for a session. Refresh tokens are identified by fingerprints.
+type RefreshLogEntry struct {
+	ID        int64  `json:"id"`
+	SessionID string `json:"session_id"`
+	// One of: auto, manual, reuse_test
+	Trigger string `json:"trigger"`
+	Success bool   `json:"success"`
+	// The server issued a new refresh token
+	Rotated bool `json:"rotated"`
+	// The server returned a refresh token it had rotated out
+	Reused         bool      `json:"reused"`
+	OldFingerprint string    `json:"old_fingerprint"`
+	NewFingerprint string    `json:"new_fingerprint,omitempty"`
+	AccessExpiry   time.Time `json:"access_expiry,omitempty"`
+	Error          string    `json:"error,omitempty"`
+	FlowID         string    `json:"flow_id,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// RefreshReuseReport is the outcome of a refresh token reuse test. Steps that did not run are omitted.
+type RefreshReuseReport struct {
+	// Links the three calls in history
+	FlowID string `json:"flow_id"`
+	// Refresh token grant made for a session. Refresh tokens are identified by fingerprints.
+	Refresh RefreshLogEntry `json:"refresh"`
+	// Refresh token grant made for a session. Refresh tokens are identified by fingerprints.
+	Reuse *RefreshLogEntry `json:"reuse,omitempty"`
+	// Refresh token grant made for a session. Refresh tokens are identified by fingerprints.
+	Newest *RefreshLogEntry `json:"newest,omitempty"`
+	// One of: family_revoked, reuse_rejected, reuse_accepted, no_rotation, refresh_failed
+	Verdict string `json:"verdict"`
+}
+
+// RetentionPolicy is the history retention policy
+type RetentionPolicy struct {
+	// 0 disables pruning by age (nanoseconds)
+	MaxAge int64 `json:"max_age"`
+	// 0 disables the global row limit
+	MaxRows int `json:"max_rows"`
+	// Max rows per endpoint type
+	TypeQuotas map[string]int `json:"type_quotas"`
+	// How often the background job runs (nanoseconds)
+	Interval int64 `json:"interval"`
+	// Run VACUUM after rows are pruned
+	Vacuum bool `json:"vacuum"`
+}
+
+// ScenarioAssertion is the checked expectation of a step, e.g. target "claim sub"
+type ScenarioAssertion struct {
+	Target   string `json:"target"`
+	Expected string `json:"expected"`
+	Actual   string `json:"actual"`
+	Passed   bool   `json:"passed"`
+}
+
+// ScenarioFiles is the scenario files available to run
+type ScenarioFiles struct {
+	Files []string `json:"files"`
+}
+
+// ScenarioReport is the outcome of a scenario run
+type ScenarioReport struct {
+	Name string `json:"name"`
+	File string `json:"file,omitempty"`
+	// Groups the requests of the run in the history
+	FlowID     string               `json:"flow_id"`
+	StartedAt  time.Time            `json:"started_at"`
+	DurationMs int64                `json:"duration_ms"`
+	Passed     bool                 `json:"passed"`
+	Steps      []ScenarioStepResult `json:"steps"`
+}
+
+// ScenarioRun is the scenario to run: a file of the scenario directory or an inline YAML source
+type ScenarioRun struct {
+	File string `json:"file,omitempty"`
+	// inline YAML, where only SCENARIO_* environment variables are substituted
+	Source string `json:"source,omitempty"`
+}
+
+// ScenarioStepResult is the outcome of a scenario step
+type ScenarioStepResult struct {
+	Name string `json:"name"`
+	// One of: discovery, login, refresh, revoke, introspect, userinfo
+	Action string `json:"action"`
+	// One of: passed, failed, error, skipped
+	Outcome    string              `json:"outcome"`
+	HTTPStatus int                 `json:"http_status,omitempty"`
+	DurationMs int64               `json:"duration_ms"`
+	Error      string              `json:"error,omitempty"`
+	Assertions []ScenarioAssertion `json:"assertions,omitempty"`
+}
+
+// ScopeClaimsResult is the claims produced by a scope
+type ScopeClaimsResult struct {
+	Scope     string `json:"scope"`
+	Requested bool   `json:"requested"`
+	// The requested scopes, unless the token response says otherwise
+	Granted bool `json:"granted"`
+	// Returned in the ID token or userinfo
+	Claims []string `json:"claims"`
+	// Expected and returned by neither
+	Missing []string `json:"missing"`
+}
+
+// ScopeMatrixReport is the outcome of a scope matrix run
+type ScopeMatrixReport struct {
+	Name string `json:"name"`
+	File string `json:"file,omitempty"`
+	// Groups the requests of the run in the history
+	FlowID     string    `json:"flow_id"`
+	StartedAt  time.Time `json:"started_at"`
+	DurationMs int64     `json:"duration_ms"`
+	// No combination disclosed too much or too little
+	Passed bool `json:"passed"`
+	// Every field returned or expected, the columns of the matrix
+	Fields []string         `json:"fields"`
+	Rows   []ScopeMatrixRow `json:"rows"`
+}
+
+// ScopeMatrixRow is the outcome of the login with a scope combination of a scope matrix
+type ScopeMatrixRow struct {
+	// Scopes requested
+	Scopes []string `json:"scopes"`
+	// Scopes granted: the requested ones, unless the token response says otherwise
+	Granted []string `json:"granted"`
+	// Fields returned by the userinfo endpoint
+	Fields []string `json:"fields"`
+	// Disclosure of each field returned or expected
+	Disclosures map[string]string `json:"disclosures"`
+	// Fields returned without a granted scope releasing them
+	Over []string `json:"over"`
+	// Fields expected from a granted scope and not returned
+	Under      []string `json:"under"`
+	Passed     bool     `json:"passed"`
+	DurationMs int64    `json:"duration_ms"`
+	Error      string   `json:"error,omitempty"`
+}
+
+// ServerSession is the active server-side session
+type ServerSession struct {
+	ID         int64     `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	RemoteAddr string    `json:"remote_addr"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	// Absolute timeout
+	ExpiresAt     time.Time `json:"expires_at"`
+	ClientID      string    `json:"client_id,omitempty"`
+	ProfileID     int64     `json:"profile_id,omitempty"`
+	BaseURL       string    `json:"base_url,omitempty"`
+	Authenticated bool      `json:"authenticated"`
+	// The session of the caller
+	Current bool `json:"current"`
+}
+
+// SessionState is the authentication state of the session
+type SessionState struct {
+	Authenticated bool   `json:"authenticated"`
+	FlowID        string `json:"flow_id,omitempty"`
+	ProfileID     int64  `json:"profile_id,omitempty"`
+	Issuer        string `json:"issuer"`
+	// Tokens of a session
+	Tokens *Tokens `json:"tokens,omitempty"`
+	// Response of the userinfo endpoint
+	UserInfo    *UserInfo `json:"user_info,omitempty"`
+	AutoRefresh bool      `json:"auto_refresh"`
+}
+
+// SnapshotChange is the field of a discovery document, or key of a key set, changed from one version to the next
+type SnapshotChange struct {
+	// Field name, or "kid <id>" for keys
+	Field string `json:"field"`
+	// One of: added, removed, changed
+	Change string `json:"change"`
+}
+
+// Snippet is the copyable reproduction of a logged request
+type Snippet struct {
+	Language string   `json:"language"`
+	Label    string   `json:"label"`
+	Code     string   `json:"code"`
+	EnvVars  []string `json:"env_vars,omitempty"`
+}
+
+// Stats is the statistics of a selected window
+type Stats struct {
+	// One of: 1h, 24h, 7d, 30d
+	Window string `json:"window"`
+	// Statistics report of a time window
+	Stats HistoryStats `json:"stats"`
+}
+
+// StatsBucket is the samples of a time slice of the window
+type StatsBucket struct {
+	Start  time.Time `json:"start"`
+	Count  int       `json:"count"`
+	Errors int       `json:"errors"`
+	P95Ms  int64     `json:"p95_ms"`
+}
+
+// TokenDiff is the differences between the decoded payloads of two JWTs
+type TokenDiff struct {
+	Path    string      `json:"path"`
+	InLeft  bool        `json:"in_left"`
+	InRight bool        `json:"in_right"`
+	Diffs   []FieldDiff `json:"diffs"`
+}
+
+// TokenLifetime is the when a token was issued and expires according to one source. Omitted times are unknown.
+type TokenLifetime struct {
+	// One of: access_token, refresh_token, id_token
+	Token string `json:"token"`
+	// One of: expires_in, refresh_expires_in, assumed, claims, introspection
+	Source    string    `json:"source"`
+	IssuedAt  time.Time `json:"issued_at,omitempty"`
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+	// Introspection only
+	Active bool `json:"active,omitempty"`
+	// Expiry disagrees with the first source of the same token
+	Mismatch bool   `json:"mismatch"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Tokens is the tokens of a session
+type Tokens struct {
+	AccessToken  string    `json:"access_token"`
+	TokenType    string    `json:"token_type,omitempty"`
+	RefreshToken string    `json:"refresh_token,omitempty"`
+	IDToken      string    `json:"id_token,omitempty"`
+	Expiry       time.Time `json:"expiry,omitempty"`
+}
+
+// UserInfo is the response of the userinfo endpoint
+type UserInfo struct {
+	Sub                 string      `json:"sub"`
+	Name                string      `json:"name"`
+	CPF                 string      `json:"cpf"`
+	Email               string      `json:"email,omitempty"`
+	EmailVerified       bool        `json:"email_verified,omitempty"`
+	PhoneNumber         string      `json:"phone_number,omitempty"`
+	PhoneNumberVerified bool        `json:"phone_number_verified,omitempty"`
+	Address             interface{} `json:"address,omitempty"`
+	UnionUnit           interface{} `json:"union_unit,omitempty"`
+	MembershipStatus    string      `json:"membership_status,omitempty"`
+	EmploymentStatus    string      `json:"employment_status,omitempty"`
+	MembershipType      string      `json:"membership_type,omitempty"`
+	Permissions         []string    `json:"permissions,omitempty"`
+}
+
+// GetProviderChangesParams are the optional query parameters of GetProviderChanges. Zero values are omitted.
+type GetProviderChangesParams struct {
+	// Only versions of the document fetched from this URL
+	Source string
+	// Maximum number of items
+	Limit int
+}
+
+// GetProviderChanges calls GET /changes.
+// Versions kept of the discovery documents and key sets, and the recent changes of the session issuer.
+func (c *Client) GetProviderChanges(ctx context.Context, params *GetProviderChangesParams) (*ProviderChanges, error) {
+	query := url.Values{}
+	if params != nil {
+		if params.Source != "" {
+			query.Set("source", params.Source)
+		}
+		if params.Limit != 0 {
+			query.Set("limit", fmt.Sprint(params.Limit))
+		}
+	}
+	var out ProviderChanges
+	if err := c.do(ctx, "GET", "/changes", query, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetConfig calls GET /config.
+// Client configuration of the session.
+func (c *Client) GetConfig(ctx context.Context) (*Config, error) {
+	var out Config
+	if err := c.do(ctx, "GET", "/config", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// PutConfig calls PUT /config.
+// Replace the client configuration of the session.
+func (c *Client) PutConfig(ctx context.Context, body *ConfigInput) (*Config, error) {
+	var out Config
+	if err := c.do(ctx, "PUT", "/config", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetDiscovery calls GET /discovery.
+// Discovery document of the session issuer.
+func (c *Client) GetDiscovery(ctx context.Context) (*Discovery, error) {
+	var out Discovery
+	if err := c.do(ctx, "GET", "/discovery", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// LintDiscovery calls GET /discovery/lint.
+// Lint the discovery document of the session issuer against OIDC Discovery and RFC 8414.
+func (c *Client) LintDiscovery(ctx context.Context) (*DiscoveryLintReport, error) {
+	var out DiscoveryLintReport
+	if err := c.do(ctx, "GET", "/discovery/lint", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// StartFlow calls POST /flows.
+// Start an authorization code flow with PKCE.
+func (c *Client) StartFlow(ctx context.Context) (*Flow, error) {
+	var out Flow
+	if err := c.do(ctx, "POST", "/flows", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListHistoryParams are the optional query parameters of ListHistory. Zero values are omitted.
+type ListHistoryParams struct {
+	// Maximum number of items
+	Limit int
+	// Number of entries to skip
+	Offset int
+	// Only entries of this endpoint type
+	EndpointType string
+	// Only entries of this flow
+	Flow string
+	// Only entries of this client profile
+	Profile int64
+}
+
+// ListHistory calls GET /history.
+// Logged requests, newest first.
+func (c *Client) ListHistory(ctx context.Context, params *ListHistoryParams) (*HistoryPage, error) {
+	query := url.Values{}
+	if params != nil {
+		if params.Limit != 0 {
+			query.Set("limit", fmt.Sprint(params.Limit))
+		}
+		if params.Offset != 0 {
+			query.Set("offset", fmt.Sprint(params.Offset))
+		}
+		if params.EndpointType != "" {
+			query.Set("endpoint_type", params.EndpointType)
+		}
+		if params.Flow != "" {
+			query.Set("flow", params.Flow)
+		}
+		if params.Profile != 0 {
+			query.Set("profile", fmt.Sprint(params.Profile))
+		}
+	}
+	var out HistoryPage
+	if err := c.do(ctx, "GET", "/history", query, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DiffHistory calls GET /history/diff.
+// Compare two logged requests.
+func (c *Client) DiffHistory(ctx context.Context, a int64, b int64) (*HistoryDiff, error) {
+	query := url.Values{}
+	query.Set("a", fmt.Sprint(a))
+	query.Set("b", fmt.Sprint(b))
+	var out HistoryDiff
+	if err := c.do(ctx, "GET", "/history/diff", query, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetHistoryEntry calls GET /history/{id}.
+// Logged request.
+func (c *Client) GetHistoryEntry(ctx context.Context, id int64) (*HistoryEntry, error) {
+	var out HistoryEntry
+	if err := c.do(ctx, "GET", fmt.Sprintf("/history/%v", id), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// PinHistoryEntry calls PUT /history/{id}/pin.
+// Pin or unpin a logged request.
+func (c *Client) PinHistoryEntry(ctx context.Context, id int64, body *Pin) (*Pin, error) {
+	var out Pin
+	if err := c.do(ctx, "PUT", fmt.Sprintf("/history/%v/pin", id), nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetHistorySnippetsParams are the optional query parameters of GetHistorySnippets. Zero values are omitted.
+type GetHistorySnippetsParams struct {
+	// inline keeps secrets instead of environment variable placeholders
+	Secrets string
+}
+
+// GetHistorySnippets calls GET /history/{id}/snippets.
+// Code reproducing a logged request.
+func (c *Client) GetHistorySnippets(ctx context.Context, id int64, params *GetHistorySnippetsParams) ([]Snippet, error) {
+	query := url.Values{}
+	if params != nil {
+		if params.Secrets != "" {
+			query.Set("secrets", params.Secrets)
+		}
+	}
+	var out []Snippet
+	if err := c.do(ctx, "GET", fmt.Sprintf("/history/%v/snippets", id), query, nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GetJWKS calls GET /jwks.
+// JWKS of the session issuer and validation of the session ID token.
+func (c *Client) GetJWKS(ctx context.Context) (*JWKS, error) {
+	var out JWKS
+	if err := c.do(ctx, "GET", "/jwks", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetMaintenanceParams are the optional query parameters of GetMaintenance. Zero values are omitted.
+type GetMaintenanceParams struct {
+	// Maximum number of items
+	Limit int
+}
+
+// GetMaintenance calls GET /maintenance.
+// Retention policy, database usage and maintenance job activity.
+func (c *Client) GetMaintenance(ctx context.Context, params *GetMaintenanceParams) (*Maintenance, error) {
+	query := url.Values{}
+	if params != nil {
+		if params.Limit != 0 {
+			query.Set("limit", fmt.Sprint(params.Limit))
+		}
+	}
+	var out Maintenance
+	if err := c.do(ctx, "GET", "/maintenance", query, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// PruneHistory calls POST /maintenance/prune.
+// Apply the retention policy now.
+func (c *Client) PruneHistory(ctx context.Context) (*MaintenanceRun, error) {
+	var out MaintenanceRun
+	if err := c.do(ctx, "POST", "/maintenance/prune", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// PurgeHistory calls POST /maintenance/purge.
+// Delete the history.
+func (c *Client) PurgeHistory(ctx context.Context, body *Purge) (*MaintenanceRun, error) {
+	var out MaintenanceRun
+	if err := c.do(ctx, "POST", "/maintenance/purge", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// VacuumDatabase calls POST /maintenance/vacuum.
+// Rebuild the database file.
+func (c *Client) VacuumDatabase(ctx context.Context) (*MaintenanceRun, error) {
+	var out MaintenanceRun
+	if err := c.do(ctx, "POST", "/maintenance/vacuum", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetMonitorParams are the optional query parameters of GetMonitor. Zero values are omitted.
+type GetMonitorParams struct {
+	// Maximum number of items
+	Limit int
+}
+
+// GetMonitor calls GET /monitor.
+// Monitor configuration and latest check results.
+func (c *Client) GetMonitor(ctx context.Context, params *GetMonitorParams) (*Monitor, error) {
+	query := url.Values{}
+	if params != nil {
+		if params.Limit != 0 {
+			query.Set("limit", fmt.Sprint(params.Limit))
+		}
+	}
+	var out Monitor
+	if err := c.do(ctx, "GET", "/monitor", query, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// RunMonitor calls POST /monitor/run.
+// Run every monitor check now.
+func (c *Client) RunMonitor(ctx context.Context) (*MonitorRun, error) {
+	var out MonitorRun
+	if err := c.do(ctx, "POST", "/monitor/run", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListProfiles calls GET /profiles.
+// Saved client profiles.
+func (c *Client) ListProfiles(ctx context.Context) ([]Profile, error) {
+	var out []Profile
+	if err := c.do(ctx, "GET", "/profiles", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// CreateProfile calls POST /profiles.
+// Save a new client profile.
+func (c *Client) CreateProfile(ctx context.Context, body *ProfileInput) (*Profile, error) {
+	var out Profile
+	if err := c.do(ctx, "POST", "/profiles", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetProfile calls GET /profiles/{id}.
+// Client profile.
+func (c *Client) GetProfile(ctx context.Context, id int64) (*Profile, error) {
+	var out Profile
+	if err := c.do(ctx, "GET", fmt.Sprintf("/profiles/%v", id), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// UpdateProfile calls PUT /profiles/{id}.
+// Replace a client profile.
+func (c *Client) UpdateProfile(ctx context.Context, id int64, body *ProfileInput) (*Profile, error) {
+	var out Profile
+	if err := c.do(ctx, "PUT", fmt.Sprintf("/profiles/%v", id), nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeleteProfile calls DELETE /profiles/{id}.
+// Remove a client profile.
+func (c *Client) DeleteProfile(ctx context.Context, id int64) error {
+	return c.do(ctx, "DELETE", fmt.Sprintf("/profiles/%v", id), nil, nil, nil)
+}
+
+// UseProfile calls POST /profiles/{id}/use.
+// Make a profile the client configuration of the session.
+func (c *Client) UseProfile(ctx context.Context, id int64) (*Config, error) {
+	var out Config
+	if err := c.do(ctx, "POST", fmt.Sprintf("/profiles/%v/use", id), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListScenarios calls GET /scenarios.
+// List the scenario files of the scenario directory.
+func (c *Client) ListScenarios(ctx context.Context) (*ScenarioFiles, error) {
+	var out ScenarioFiles
+	if err := c.do(ctx, "GET", "/scenarios", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListScopeMatrices calls GET /scenarios/matrix.
+// List the scope matrix files of the matrix subdirectory of the scenario directory.
+func (c *Client) ListScopeMatrices(ctx context.Context) (*ScenarioFiles, error) {
+	var out ScenarioFiles
+	if err := c.do(ctx, "GET", "/scenarios/matrix", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// RunScopeMatrix calls POST /scenarios/matrix/run.
+// Log in with each scope combination of a matrix and check the userinfo claims released.
+func (c *Client) RunScopeMatrix(ctx context.Context, body *ScenarioRun) (*ScopeMatrixReport, error) {
+	var out ScopeMatrixReport
+	if err := c.do(ctx, "POST", "/scenarios/matrix/run", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// RunScenario calls POST /scenarios/run.
+// Run a scenario file or an inline YAML scenario.
+func (c *Client) RunScenario(ctx context.Context, body *ScenarioRun) (*ScenarioReport, error) {
+	var out ScenarioReport
+	if err := c.do(ctx, "POST", "/scenarios/run", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetSession calls GET /session.
+// Authentication state, tokens and user info of the session.
+func (c *Client) GetSession(ctx context.Context) (*SessionState, error) {
+	var out SessionState
+	if err := c.do(ctx, "GET", "/session", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListSessions calls GET /sessions.
+// Active server-side sessions.
+func (c *Client) ListSessions(ctx context.Context) ([]ServerSession, error) {
+	var out []ServerSession
+	if err := c.do(ctx, "GET", "/sessions", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// TerminateSession calls DELETE /sessions/{id}.
+// End a session and drop its tokens.
+func (c *Client) TerminateSession(ctx context.Context, id int64) error {
+	return c.do(ctx, "DELETE", fmt.Sprintf("/sessions/%v", id), nil, nil, nil)
+}
+
+// GetStatsParams are the optional query parameters of GetStats. Zero values are omitted.
+type GetStatsParams struct {
+	// Time window
+	Window string
+}
+
+// GetStats calls GET /stats.
+// Latency and error-rate statistics per endpoint type.
+func (c *Client) GetStats(ctx context.Context, params *GetStatsParams) (*Stats, error) {
+	query := url.Values{}
+	if params != nil {
+		if params.Window != "" {
+			query.Set("window", params.Window)
+		}
+	}
+	var out Stats
+	if err := c.do(ctx, "GET", "/stats", query, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetAutoRefresh calls GET /tokens/auto-refresh.
+// Whether background refresh is enabled.
+func (c *Client) GetAutoRefresh(ctx context.Context) (*AutoRefresh, error) {
+	var out AutoRefresh
+	if err := c.do(ctx, "GET", "/tokens/auto-refresh", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// SetAutoRefresh calls PUT /tokens/auto-refresh.
+// Turn background refresh on or off.
+func (c *Client) SetAutoRefresh(ctx context.Context, body *AutoRefresh) (*AutoRefresh, error) {
+	var out AutoRefresh
+	if err := c.do(ctx, "PUT", "/tokens/auto-refresh", nil, body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CompareClaims calls GET /tokens/claims.
+// Compare the claims of the session ID token with the ones returned by userinfo.
+func (c *Client) CompareClaims(ctx context.Context) (*ClaimConsistencyReport, error) {
+	var out ClaimConsistencyReport
+	if err := c.do(ctx, "GET", "/tokens/claims", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetExpiryProbe calls GET /tokens/expiry-probe.
+// Last expiry probe of the session.
+func (c *Client) GetExpiryProbe(ctx context.Context) (*ExpiryProbe, error) {
+	var out ExpiryProbe
+	if err := c.do(ctx, "GET", "/tokens/expiry-probe", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ScheduleExpiryProbe calls POST /tokens/expiry-probe.
+// Schedule userinfo calls around the access token expiry.
+func (c *Client) ScheduleExpiryProbe(ctx context.Context) (*ExpiryProbe, error) {
+	var out ExpiryProbe
+	if err := c.do(ctx, "POST", "/tokens/expiry-probe", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// RefreshTokens calls POST /tokens/refresh.
+// Exchange the refresh token for new tokens.
+func (c *Client) RefreshTokens(ctx context.Context) (*Refresh, error) {
+	var out Refresh
+	if err := c.do(ctx, "POST", "/tokens/refresh", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetRefreshLogParams are the optional query parameters of GetRefreshLog. Zero values are omitted.
+type GetRefreshLogParams struct {
+	// Maximum number of items
+	Limit int
+}
+
+// GetRefreshLog calls GET /tokens/refresh-log.
+// Refresh token grants of the session, newest first.
+func (c *Client) GetRefreshLog(ctx context.Context, params *GetRefreshLogParams) ([]RefreshLogEntry, error) {
+	query := url.Values{}
+	if params != nil {
+		if params.Limit != 0 {
+			query.Set("limit", fmt.Sprint(params.Limit))
+		}
+	}
+	var out []RefreshLogEntry
+	if err := c.do(ctx, "GET", "/tokens/refresh-log", query, nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// TestRefreshReuse calls POST /tokens/refresh-reuse.
+// Run the refresh token reuse detection scenario.
+func (c *Client) TestRefreshReuse(ctx context.Context) (*RefreshReuseReport, error) {
+	var out RefreshReuseReport
+	if err := c.do(ctx, "POST", "/tokens/refresh-reuse", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// RevokeTokens calls POST /tokens/revoke.
+// Revoke the access token and sign the session out.
+func (c *Client) RevokeTokens(ctx context.Context) error {
+	return c.do(ctx, "POST", "/tokens/revoke", nil, nil, nil)
+}
+
+// GetTokenTimelineParams are the optional query parameters of GetTokenTimeline. Zero values are omitted.
+type GetTokenTimelineParams struct {
+	// Also ask the introspection endpoint
+	Introspect bool
+}
+
+// GetTokenTimeline calls GET /tokens/timeline.
+// Lifetimes of the session tokens.
+func (c *Client) GetTokenTimeline(ctx context.Context, params *GetTokenTimelineParams) ([]TokenLifetime, error) {
+	query := url.Values{}
+	if params != nil {
+		if params.Introspect {
+			query.Set("introspect", "true")
+		}
+	}
+	var out []TokenLifetime
+	if err := c.do(ctx, "GET", "/tokens/timeline", query, nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
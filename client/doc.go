@@ -0,0 +1,17 @@
+// Package client is a typed Go client of the JSON API of the OAuth2 test tool,
+// generated from openapi/openapi.json.
+//
+// The API keeps the OAuth2 state in a server-side session, so a Client holds
+// a cookie jar and each Client is one session of the tool:
+//
+//	c := client.New("http://localhost:8080", nil)
+//	_, err := c.PutConfig(ctx, &client.ConfigInput{ClientID: "...", ClientSecret: "...", RedirectURI: "..."})
+//	flow, err := c.StartFlow(ctx)
+//	// visit flow.AuthorizationURL with c.HTTPClient(), then
+//	state, err := c.GetSession(ctx)
+//
+// Failed calls return an *APIError carrying the status and code of the API
+// error object.
+package client
+
+//go:generate go run ../cmd/apigen -spec ../openapi/openapi.json -out client.gen.go
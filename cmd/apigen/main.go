@@ -0,0 +1,645 @@
+// Command apigen generates the Go client of the JSON API from its OpenAPI
+// description. It understands the subset of OpenAPI 3.1 used by
+// openapi/openapi.json: named object schemas, $ref, arrays, maps, path and query
+// parameters, JSON request bodies and a single JSON success response.
+//
+// Usage:
+//
+//	apigen -spec ../openapi/openapi.json -out client.gen.go [-package client]
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/format"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// spec is the part of an OpenAPI document the generator reads
+type spec struct {
+	Servers []struct {
+		URL string `json:"url"`
+	} `json:"servers"`
+	Paths      map[string]*pathItem `json:"paths"`
+	Components struct {
+		Schemas    map[string]*schema    `json:"schemas"`
+		Parameters map[string]*parameter `json:"parameters"`
+	} `json:"components"`
+}
+
+type pathItem struct {
+	Parameters []*parameter `json:"parameters"`
+	Get        *operation   `json:"get"`
+	Put        *operation   `json:"put"`
+	Post       *operation   `json:"post"`
+	Delete     *operation   `json:"delete"`
+}
+
+type operation struct {
+	OperationID string               `json:"operationId"`
+	Summary     string               `json:"summary"`
+	Parameters  []*parameter         `json:"parameters"`
+	RequestBody *body                `json:"requestBody"`
+	Responses   map[string]*response `json:"responses"`
+}
+
+type parameter struct {
+	Ref         string  `json:"$ref"`
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description"`
+	Required    bool    `json:"required"`
+	Schema      *schema `json:"schema"`
+}
+
+type body struct {
+	Content map[string]struct {
+		Schema *schema `json:"schema"`
+	} `json:"content"`
+}
+
+type response struct {
+	Ref     string `json:"$ref"`
+	Content map[string]struct {
+		Schema *schema `json:"schema"`
+	} `json:"content"`
+}
+
+type schema struct {
+	Ref                  string          `json:"$ref"`
+	Type                 string          `json:"type"`
+	Format               string          `json:"format"`
+	Description          string          `json:"description"`
+	Enum                 []string        `json:"enum"`
+	Properties           properties      `json:"properties"`
+	Required             []string        `json:"required"`
+	Items                *schema         `json:"items"`
+	AdditionalProperties json.RawMessage `json:"additionalProperties"`
+}
+
+// properties keeps the declaration order of schema properties, so struct
+// fields follow the document
+type properties struct {
+	names  []string
+	byName map[string]*schema
+}
+
+func (p *properties) UnmarshalJSON(data []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if _, err := decoder.Token(); err != nil {
+		return err
+	}
+	p.byName = make(map[string]*schema)
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		name, _ := token.(string)
+		var s schema
+		if err := decoder.Decode(&s); err != nil {
+			return fmt.Errorf("property %s: %w", name, err)
+		}
+		p.names = append(p.names, name)
+		p.byName[name] = &s
+	}
+	return nil
+}
+
+// initialisms are written in upper case in Go identifiers
+var initialisms = map[string]bool{
+	"api": true, "cpf": true, "http": true, "id": true, "json": true,
+	"jwk": true, "jwks": true, "uri": true, "url": true,
+}
+
+// methods are the HTTP methods generated, in output order
+var methods = []string{"Get", "Post", "Put", "Delete"}
+
+func main() {
+	specPath := flag.String("spec", "../openapi/openapi.json", "path of the OpenAPI document")
+	outPath := flag.String("out", "client.gen.go", "path of the generated Go file")
+	pkg := flag.String("package", "client", "package name of the generated file")
+	flag.Parse()
+
+	data, err := os.ReadFile(*specPath)
+	if err != nil {
+		log.Fatalf("Failed to read spec: %v", err)
+	}
+	var doc spec
+	if err := json.Unmarshal(data, &doc); err != nil {
+		log.Fatalf("Failed to parse spec: %v", err)
+	}
+
+	g := &generator{doc: &doc}
+	source, err := g.generate(*pkg, filepath.Base(*specPath))
+	if err != nil {
+		log.Fatalf("Failed to generate client: %v", err)
+	}
+	if err := os.WriteFile(*outPath, source, 0644); err != nil {
+		log.Fatalf("Failed to write client: %v", err)
+	}
+}
+
+// generator writes the client source
+type generator struct {
+	doc     *spec
+	buf     bytes.Buffer
+	useTime bool
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&g.buf, format, args...)
+}
+
+// generate returns the formatted source of the client
+func (g *generator) generate(pkg, specName string) ([]byte, error) {
+	basePath := ""
+	if len(g.doc.Servers) > 0 {
+		basePath = strings.TrimSuffix(g.doc.Servers[0].URL, "/")
+	}
+	if _, ok := g.doc.Components.Schemas["APIError"]; !ok {
+		return nil, fmt.Errorf("the spec must define the APIError schema")
+	}
+	if _, ok := g.doc.Components.Schemas["ErrorResponse"]; !ok {
+		return nil, fmt.Errorf("the spec must define the ErrorResponse schema")
+	}
+
+	// Body first, so the imports are known
+	g.printf("// basePath is the path prefix of the API routes\nconst basePath = %q\n\n", basePath)
+	g.printf("%s", clientSource)
+
+	names := make([]string, 0, len(g.doc.Components.Schemas))
+	for name := range g.doc.Components.Schemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := g.schemaType(name, g.doc.Components.Schemas[name]); err != nil {
+			return nil, fmt.Errorf("schema %s: %w", name, err)
+		}
+	}
+
+	paths := make([]string, 0, len(g.doc.Paths))
+	for path := range g.doc.Paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		item := g.doc.Paths[path]
+		for _, method := range methods {
+			op := map[string]*operation{"Get": item.Get, "Post": item.Post, "Put": item.Put, "Delete": item.Delete}[method]
+			if op == nil {
+				continue
+			}
+			if err := g.operation(strings.ToUpper(method), path, item, op); err != nil {
+				return nil, fmt.Errorf("%s %s: %w", strings.ToUpper(method), path, err)
+			}
+		}
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// Code generated by apigen from %s. DO NOT EDIT.\n\n", specName)
+	fmt.Fprintf(&out, "package %s\n\nimport (\n", pkg)
+	for _, imp := range []string{"bytes", "context", "encoding/json", "fmt", "io", "net/http", "net/http/cookiejar", "net/url", "strings"} {
+		fmt.Fprintf(&out, "\t%q\n", imp)
+	}
+	if g.useTime {
+		fmt.Fprintf(&out, "\t%q\n", "time")
+	}
+	out.WriteString(")\n\n")
+	out.Write(g.buf.Bytes())
+
+	source, err := format.Source(out.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("generated invalid Go: %w", err)
+	}
+	return source, nil
+}
+
+// schemaType writes the struct of a named object schema
+func (g *generator) schemaType(name string, s *schema) error {
+	if s.Type != "object" || len(s.Properties.names) == 0 {
+		return fmt.Errorf("only object schemas with properties can be named")
+	}
+
+	g.printf("%s", docComment(name+" is the "+lowerFirst(s.Description), ""))
+	g.printf("type %s struct {\n", name)
+	for _, prop := range s.Properties.names {
+		ps := g.resolve(s.Properties.byName[prop])
+		required := contains(s.Required, prop)
+		goType, err := g.goType(s.Properties.byName[prop], !required)
+		if err != nil {
+			return fmt.Errorf("property %s: %w", prop, err)
+		}
+
+		comment := ps.Description
+		if len(ps.Enum) > 0 {
+			comment = strings.TrimSpace(strings.TrimSuffix(comment, ".") + ". One of: " + strings.Join(ps.Enum, ", "))
+			comment = strings.TrimPrefix(comment, ". ")
+		}
+		if comment != "" {
+			g.printf("%s", docComment(comment, "\t"))
+		}
+
+		tag := prop
+		if !required {
+			tag += ",omitempty"
+		}
+		g.printf("\t%s %s `json:%q`\n", exported(prop), goType, tag)
+	}
+	g.printf("}\n\n")
+	return nil
+}
+
+// operation writes the client method of an operation
+func (g *generator) operation(method, path string, item *pathItem, op *operation) error {
+	name := exported(op.OperationID)
+	params := append(append([]*parameter{}, item.Parameters...), op.Parameters...)
+
+	var args, pathArgs, requiredQuery []string
+	var optional []*parameter
+	args = append(args, "ctx context.Context")
+	pathFormat := path
+	for _, p := range params {
+		p = g.parameter(p)
+		goType, err := g.goType(p.Schema, false)
+		if err != nil {
+			return fmt.Errorf("parameter %s: %w", p.Name, err)
+		}
+		arg := unexported(p.Name)
+		switch {
+		case p.In == "path":
+			args = append(args, arg+" "+goType)
+			pathFormat = strings.Replace(pathFormat, "{"+p.Name+"}", "%v", 1)
+			if goType == "string" {
+				arg = "url.PathEscape(" + arg + ")"
+			}
+			pathArgs = append(pathArgs, arg)
+		case p.In == "query" && p.Required:
+			args = append(args, arg+" "+goType)
+			requiredQuery = append(requiredQuery, fmt.Sprintf("query.Set(%q, fmt.Sprint(%s))\n", p.Name, arg))
+		case p.In == "query":
+			optional = append(optional, p)
+		default:
+			return fmt.Errorf("unsupported parameter location %q", p.In)
+		}
+	}
+
+	if len(optional) > 0 {
+		g.printf("// %sParams are the optional query parameters of %s. Zero values are omitted.\n", name, name)
+		g.printf("type %sParams struct {\n", name)
+		for _, p := range optional {
+			goType, _ := g.goType(p.Schema, false)
+			if p.Description != "" {
+				g.printf("%s", docComment(p.Description, "\t"))
+			}
+			g.printf("\t%s %s\n", exported(p.Name), goType)
+		}
+		g.printf("}\n\n")
+		args = append(args, "params *"+name+"Params")
+	}
+
+	bodyArg := "nil"
+	if op.RequestBody != nil {
+		content, ok := op.RequestBody.Content["application/json"]
+		if !ok || content.Schema == nil || content.Schema.Ref == "" {
+			return fmt.Errorf("request bodies must reference a JSON schema")
+		}
+		args = append(args, "body *"+refName(content.Schema.Ref))
+		bodyArg = "body"
+	}
+
+	// The first success response with content gives the result type
+	var result *schema
+	var statuses []string
+	for status := range op.Responses {
+		statuses = append(statuses, status)
+	}
+	sort.Strings(statuses)
+	for _, status := range statuses {
+		if !strings.HasPrefix(status, "2") {
+			continue
+		}
+		if content, ok := op.Responses[status].Content["application/json"]; ok {
+			result = content.Schema
+			break
+		}
+	}
+
+	resultType, zero, outArg := "", "", "nil"
+	if result != nil {
+		goType, err := g.goType(result, false)
+		if err != nil {
+			return fmt.Errorf("response: %w", err)
+		}
+		resultType = goType
+		zero = "nil"
+		outArg = "&out"
+		if result.Ref != "" {
+			resultType = "*" + goType
+		}
+	}
+
+	comment := fmt.Sprintf("%s calls %s %s.", name, method, path)
+	if op.Summary != "" {
+		comment += "\n" + strings.TrimSuffix(op.Summary, ".") + "."
+	}
+	g.printf("%s", docComment(comment, ""))
+	if resultType != "" {
+		g.printf("func (c *Client) %s(%s) (%s, error) {\n", name, strings.Join(args, ", "), resultType)
+	} else {
+		g.printf("func (c *Client) %s(%s) error {\n", name, strings.Join(args, ", "))
+	}
+
+	queryArg := "nil"
+	if len(requiredQuery) > 0 || len(optional) > 0 {
+		queryArg = "query"
+		g.printf("query := url.Values{}\n")
+		for _, line := range requiredQuery {
+			g.printf("%s", line)
+		}
+		if len(optional) > 0 {
+			g.printf("if params != nil {\n")
+			for _, p := range optional {
+				goType, _ := g.goType(p.Schema, false)
+				field := "params." + exported(p.Name)
+				switch goType {
+				case "string":
+					g.printf("if %s != \"\" {\nquery.Set(%q, %s)\n}\n", field, p.Name, field)
+				case "bool":
+					g.printf("if %s {\nquery.Set(%q, \"true\")\n}\n", field, p.Name)
+				default:
+					g.printf("if %s != 0 {\nquery.Set(%q, fmt.Sprint(%s))\n}\n", field, p.Name, field)
+				}
+			}
+			g.printf("}\n")
+		}
+	}
+
+	pathExpr := fmt.Sprintf("%q", path)
+	if len(pathArgs) > 0 {
+		pathExpr = fmt.Sprintf("fmt.Sprintf(%q, %s)", pathFormat, strings.Join(pathArgs, ", "))
+	}
+	call := fmt.Sprintf("c.do(ctx, %q, %s, %s, %s, %s)", method, pathExpr, queryArg, bodyArg, outArg)
+
+	if resultType == "" {
+		g.printf("return %s\n}\n\n", call)
+		return nil
+	}
+	g.printf("var out %s\n", strings.TrimPrefix(resultType, "*"))
+	g.printf("if err := %s; err != nil {\nreturn %s, err\n}\n", call, zero)
+	if strings.HasPrefix(resultType, "*") {
+		g.printf("return &out, nil\n}\n\n")
+	} else {
+		g.printf("return out, nil\n}\n\n")
+	}
+	return nil
+}
+
+// goType returns the Go type of a schema. Optional references to objects are
+// pointers, so they can be omitted.
+func (g *generator) goType(s *schema, optional bool) (string, error) {
+	if s == nil {
+		return "", fmt.Errorf("missing schema")
+	}
+	if s.Ref != "" {
+		name := refName(s.Ref)
+		target, ok := g.doc.Components.Schemas[name]
+		if !ok {
+			return "", fmt.Errorf("unknown schema %s", s.Ref)
+		}
+		if optional && target.Type == "object" {
+			return "*" + name, nil
+		}
+		return name, nil
+	}
+
+	switch s.Type {
+	case "string":
+		if s.Format == "date-time" {
+			g.useTime = true
+			return "time.Time", nil
+		}
+		return "string", nil
+	case "integer":
+		if s.Format == "int32" {
+			return "int", nil
+		}
+		return "int64", nil
+	case "number":
+		return "float64", nil
+	case "boolean":
+		return "bool", nil
+	case "array":
+		item, err := g.goType(s.Items, false)
+		if err != nil {
+			return "", err
+		}
+		return "[]" + item, nil
+	case "object":
+		if len(s.Properties.names) > 0 {
+			return "", fmt.Errorf("inline object schemas are not supported, use a $ref")
+		}
+		var values schema
+		if err := json.Unmarshal(s.AdditionalProperties, &values); err == nil && values.Type != "" {
+			value, err := g.goType(&values, false)
+			if err != nil {
+				return "", err
+			}
+			return "map[string]" + value, nil
+		}
+		return "map[string]interface{}", nil
+	case "":
+		return "interface{}", nil
+	}
+	return "", fmt.Errorf("unsupported type %q", s.Type)
+}
+
+// resolve follows a schema reference
+func (g *generator) resolve(s *schema) *schema {
+	if s.Ref != "" {
+		if target, ok := g.doc.Components.Schemas[refName(s.Ref)]; ok {
+			return target
+		}
+	}
+	return s
+}
+
+// parameter follows a parameter reference
+func (g *generator) parameter(p *parameter) *parameter {
+	if p.Ref != "" {
+		if target, ok := g.doc.Components.Parameters[refName(p.Ref)]; ok {
+			return target
+		}
+	}
+	return p
+}
+
+// refName returns the last segment of a $ref
+func refName(ref string) string {
+	return ref[strings.LastIndex(ref, "/")+1:]
+}
+
+// exported turns a snake_case, kebab-case or camelCase name into an exported Go identifier
+func exported(name string) string {
+	var b strings.Builder
+	for _, word := range splitWords(name) {
+		if initialisms[strings.ToLower(word)] {
+			b.WriteString(strings.ToUpper(word))
+			continue
+		}
+		b.WriteString(strings.ToUpper(word[:1]) + word[1:])
+	}
+	return b.String()
+}
+
+// unexported turns a name into an unexported Go identifier
+func unexported(name string) string {
+	words := splitWords(name)
+	words[0] = strings.ToLower(words[0])
+	for i := 1; i < len(words); i++ {
+		words[i] = exported(words[i])
+	}
+	return strings.Join(words, "")
+}
+
+// splitWords splits a name on separators and lower-to-upper case changes
+func splitWords(name string) []string {
+	var words []string
+	var current []rune
+	runes := []rune(name)
+	for i, r := range runes {
+		if r == '_' || r == '-' {
+			if len(current) > 0 {
+				words = append(words, string(current))
+			}
+			current = nil
+			continue
+		}
+		if unicode.IsUpper(r) && i > 0 && unicode.IsLower(runes[i-1]) && len(current) > 0 {
+			words = append(words, string(current))
+			current = nil
+		}
+		current = append(current, r)
+	}
+	if len(current) > 0 {
+		words = append(words, string(current))
+	}
+	return words
+}
+
+// lowerFirst lowers the first letter of a sentence, unless it starts an acronym
+func lowerFirst(s string) string {
+	runes := []rune(s)
+	if len(runes) < 2 || unicode.IsUpper(runes[1]) {
+		return s
+	}
+	runes[0] = unicode.ToLower(runes[0])
+	return string(runes)
+}
+
+// docComment formats text as a // comment with the given indentation
+func docComment(text, indent string) string {
+	var b strings.Builder
+	for _, line := range strings.Split(text, "\n") {
+		b.WriteString(indent + "// " + line + "\n")
+	}
+	return b.String()
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// clientSource is the hand-written part of the generated client
+const clientSource = `// Client calls the JSON API of the OAuth2 test tool
+type Client struct {
+	baseURL    string // server URL followed by basePath
+	httpClient *http.Client
+}
+
+// New creates a Client for the server at serverURL, e.g. http://localhost:8080.
+// The API keeps the OAuth2 state in a session cookie, so httpClient must have
+// a cookie jar; nil uses a new client with one.
+func New(serverURL string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		jar, _ := cookiejar.New(nil)
+		httpClient = &http.Client{Jar: jar}
+	}
+	return &Client{
+		baseURL:    strings.TrimSuffix(serverURL, "/") + basePath,
+		httpClient: httpClient,
+	}
+}
+
+// HTTPClient returns the HTTP client of the Client. Follow the authorization
+// URL of a flow with it so the callback reaches the same session.
+func (c *Client) HTTPClient() *http.Client {
+	return c.httpClient
+}
+
+// Error implements the error interface
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%d %s: %s", e.Status, e.Code, e.Message)
+}
+
+// do sends a request and decodes its JSON response into out. Error responses
+// are returned as *APIError.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	target := c.baseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s %s failed: %w", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		var errResp ErrorResponse
+		if err := json.NewDecoder(resp.Body).Decode(&errResp); err != nil || errResp.Error.Code == "" {
+			return &APIError{Status: resp.StatusCode, Code: "unexpected_response", Message: resp.Status}
+		}
+		return &errResp.Error
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode %s %s response: %w", method, path, err)
+	}
+	return nil
+}
+
+`
@@ -0,0 +1,80 @@
+// Command keys manages the master keys that encrypt secrets at rest.
+//
+// Usage:
+//
+//	keys generate
+//	keys [-db path | -url postgres://...] rotate
+//
+// To rotate, generate a new key and put it first in ENCRYPTION_KEY (or in
+// the first line of ENCRYPTION_KEY_FILE), keeping the old keys after it.
+// rotate re-encrypts every stored value with the new key, and encrypts the
+// values stored in clear text; the old keys can be removed afterwards.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/pericles-luz/oauth2-test/internal/secrets"
+	"github.com/pericles-luz/oauth2-test/internal/storage"
+)
+
+func main() {
+	dbPath := flag.String("db", getEnv("DATABASE_PATH", "./oauth2-test.db"), "path of the SQLite database")
+	dbURL := flag.String("url", getEnv("DATABASE_URL", ""), "PostgreSQL URL, used instead of -db when set")
+	keyFile := flag.String("key-file", getEnv("ENCRYPTION_KEY_FILE", ""), "file with the master keys, used when ENCRYPTION_KEY is not set")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s generate | [-db path | -url postgres://...] rotate\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() < 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	switch flag.Arg(0) {
+	case "generate":
+		key, err := secrets.GenerateKey()
+		if err != nil {
+			log.Fatalf("Failed to generate key: %v", err)
+		}
+		fmt.Println(key)
+	case "rotate":
+		keyring, err := secrets.LoadKeyring(os.Getenv("ENCRYPTION_KEY"), *keyFile)
+		if err != nil {
+			log.Fatalf("Failed to load encryption keys: %v", err)
+		}
+		if keyring == nil {
+			log.Fatalf("No master key configured: set ENCRYPTION_KEY or ENCRYPTION_KEY_FILE")
+		}
+
+		db, err := storage.Open(*dbURL, *dbPath)
+		if err != nil {
+			log.Fatalf("Failed to initialize database: %v", err)
+		}
+		defer db.Close()
+		db.SetKeyring(keyring)
+
+		updated, err := db.RotateKeys()
+		if err != nil {
+			db.Close()
+			log.Fatalf("Key rotation failed after %d rows: %v", updated, err)
+		}
+		fmt.Printf("%d rows re-encrypted with key %s\n", updated, keyring.PrimaryID())
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
+
+// getEnv gets an environment variable with a default value
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
@@ -0,0 +1,101 @@
+// Command migrate inspects and changes the schema version of the database.
+//
+// Usage:
+//
+//	migrate [-db path | -url postgres://...] status
+//	migrate [-db path | -url postgres://...] up
+//	migrate [-db path | -url postgres://...] down [-steps n]
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/pericles-luz/oauth2-test/internal/storage"
+	"github.com/pericles-luz/oauth2-test/migrations"
+)
+
+func main() {
+	dbPath := flag.String("db", getEnv("DATABASE_PATH", "./oauth2-test.db"), "path of the SQLite database")
+	dbURL := flag.String("url", getEnv("DATABASE_URL", ""), "PostgreSQL URL, used instead of -db when set")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [-db path | -url postgres://...] status|up|down [-steps n]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() < 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	db, err := storage.Open(*dbURL, *dbPath)
+	if err != nil {
+		log.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Close()
+
+	schemaMigrations, err := storage.LoadMigrations(migrations.For(db.Driver()))
+	if err != nil {
+		db.Close()
+		log.Fatalf("Failed to load migrations: %v", err)
+	}
+
+	switch flag.Arg(0) {
+	case "status":
+		err = printStatus(db, schemaMigrations)
+	case "up":
+		err = db.Migrate(schemaMigrations)
+		if err == nil {
+			err = printStatus(db, schemaMigrations)
+		}
+	case "down":
+		downFlags := flag.NewFlagSet("down", flag.ExitOnError)
+		steps := downFlags.Int("steps", 1, "number of migrations to revert")
+		downFlags.Parse(flag.Args()[1:])
+
+		err = db.MigrateDown(schemaMigrations, *steps)
+		if err == nil {
+			err = printStatus(db, schemaMigrations)
+		}
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err != nil {
+		db.Close()
+		log.Fatalf("Migration failed: %v", err)
+	}
+}
+
+// printStatus lists every known migration and whether it is applied
+func printStatus(db storage.Store, schemaMigrations []storage.Migration) error {
+	statuses, err := db.MigrationStatus(schemaMigrations)
+	if err != nil {
+		return err
+	}
+
+	for _, status := range statuses {
+		state := "pending"
+		if status.Applied {
+			state = "applied " + status.AppliedAt.Format("2006-01-02 15:04:05")
+		}
+		if status.Modified {
+			state += " (modified since applied)"
+		}
+		fmt.Printf("%03d  %-24s %s\n", status.Version, status.Name, state)
+	}
+
+	return nil
+}
+
+// getEnv gets an environment variable with a default value
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
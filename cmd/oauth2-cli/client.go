@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pericles-luz/oauth2-test/internal/models"
+	"github.com/pericles-luz/oauth2-test/internal/services"
+	"github.com/pericles-luz/oauth2-test/internal/storage"
+)
+
+// clientFlags select the authorization server and the client credentials
+type clientFlags struct {
+	issuer       string
+	clientID     string
+	clientSecret string
+	scopes       string
+	profile      string
+}
+
+// register adds the client flags to a flag set
+func (f *clientFlags) register(flags *flag.FlagSet) {
+	flags.StringVar(&f.issuer, "issuer", getEnv("OAUTH2_BASE_URL", defaultBaseURL), "base URL of the authorization server")
+	flags.StringVar(&f.clientID, "client-id", os.Getenv("OAUTH2_CLIENT_ID"), "client ID")
+	flags.StringVar(&f.clientSecret, "client-secret", os.Getenv("OAUTH2_CLIENT_SECRET"), "client secret")
+	flags.StringVar(&f.scopes, "scopes", "openid profile", "space-separated scopes; openid is always requested")
+	flags.StringVar(&f.profile, "profile", "", "saved client profile (ID or name) to use instead of the client flags")
+}
+
+// config builds the client configuration and resolves the issuer endpoints
+// through discovery. The returned context carries the profile ID, if any.
+func (f *clientFlags) config(ctx context.Context, db storage.Store, historyService *services.HistoryService) (*models.OAuthConfig, context.Context, error) {
+	config := &models.OAuthConfig{
+		ClientID:     f.clientID,
+		ClientSecret: f.clientSecret,
+		Scopes:       strings.Fields(f.scopes),
+		BaseURL:      f.issuer,
+	}
+	if f.profile != "" {
+		profile, err := findProfile(services.NewProfileService(db), f.profile)
+		if err != nil {
+			return nil, ctx, err
+		}
+		config.ClientID = profile.ClientID
+		config.ClientSecret = profile.ClientSecret
+		config.Scopes = profile.Scopes
+		if profile.BaseURL != "" {
+			config.BaseURL = profile.BaseURL
+		}
+		ctx = services.WithProfileID(ctx, profile.ID)
+	}
+
+	baseURL, err := models.NormalizeBaseURL(config.BaseURL)
+	if err != nil {
+		return nil, ctx, fmt.Errorf("invalid issuer: %w", err)
+	}
+	config.BaseURL = baseURL
+	if !containsScope(config.Scopes, "openid") {
+		config.Scopes = append([]string{"openid"}, config.Scopes...)
+	}
+
+	config.Endpoints = services.NewIssuerService(historyService, time.Minute).Endpoints(ctx, config.BaseURL)
+	return config, ctx, nil
+}
+
+// newFlowContext returns a context tagging the requests of one command with a
+// new flow ID, so they are grouped in the history
+func newFlowContext(ctx context.Context) (context.Context, string, error) {
+	flowID, err := services.GenerateFlowID()
+	if err != nil {
+		return ctx, "", fmt.Errorf("failed to generate flow ID: %w", err)
+	}
+	return services.WithFlowID(ctx, flowID), flowID, nil
+}
+
+// findProfile looks a saved profile up by ID or name
+func findProfile(profileService *services.ProfileService, ref string) (*models.ClientProfile, error) {
+	profile, err := profileService.Find(ref)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch profile: %w", err)
+	}
+	if profile == nil {
+		return nil, fmt.Errorf("client profile %q not found", ref)
+	}
+	return profile, nil
+}
+
+// containsScope reports whether scopes holds scope
+func containsScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/pericles-luz/oauth2-test/internal/models"
+	"github.com/pericles-luz/oauth2-test/internal/services"
+)
+
+// decodeResult is the output of the decode command
+type decodeResult struct {
+	Header    map[string]interface{} `json:"header"`
+	Claims    jwt.MapClaims          `json:"claims"`
+	IssuedAt  *time.Time             `json:"issued_at,omitempty"`
+	ExpiresAt *time.Time             `json:"expires_at,omitempty"`
+	Expired   bool                   `json:"expired"`
+}
+
+// verifyResult is the output of the verify command
+type verifyResult struct {
+	Valid  bool          `json:"valid"`
+	Kid    string        `json:"kid,omitempty"`
+	Alg    string        `json:"alg,omitempty"`
+	JWKS   string        `json:"jwks"` // URL or file the keys came from
+	Claims jwt.MapClaims `json:"claims,omitempty"`
+	Error  string        `json:"error,omitempty"`
+}
+
+// decode prints the header and claims of a JWT without validating its
+// signature. An expired token is a negative verdict.
+func (c *cli) decode(args []string) error {
+	flags := flag.NewFlagSet("decode", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s decode [flags] [token | -]\n\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	format := registerOutput(flags)
+	positional := parseArgs(flags, args)
+
+	token, err := readToken(flags, positional)
+	if err != nil {
+		return err
+	}
+
+	header, err := services.ParseTokenHeader(token)
+	if err != nil {
+		return err
+	}
+	claims, err := services.ParseTokenWithoutValidation(token)
+	if err != nil {
+		return err
+	}
+
+	result := decodeResult{Header: header, Claims: claims}
+	if iat, err := claims.GetIssuedAt(); err == nil && iat != nil {
+		result.IssuedAt = &iat.Time
+	}
+	if exp, err := claims.GetExpirationTime(); err == nil && exp != nil {
+		result.ExpiresAt = &exp.Time
+		result.Expired = time.Now().After(exp.Time)
+	}
+
+	// Tables show the claims next to the header fields
+	table := make(map[string]interface{}, len(claims)+len(header))
+	for key, value := range claims {
+		table[key] = value
+	}
+	for key, value := range header {
+		table["header."+key] = value
+	}
+	if err := format.print(result, table); err != nil {
+		return err
+	}
+
+	if result.Expired {
+		return rejected("token expired at %s", result.ExpiresAt.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// verify validates the signature and the time claims of a JWT against a key
+// set. An invalid token is a negative verdict.
+func (c *cli) verify(args []string) error {
+	flags := flag.NewFlagSet("verify", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s verify [flags] [token | -]\n\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	issuer := flags.String("issuer", getEnv("OAUTH2_BASE_URL", defaultBaseURL), "issuer whose advertised JWKS is used when -jwks and -jwks-file are not set")
+	jwksURL := flags.String("jwks", "", "URL of the JWKS")
+	jwksFile := flags.String("jwks-file", "", "file with the JWKS")
+	format := registerOutput(flags)
+	positional := parseArgs(flags, args)
+
+	if *jwksURL != "" && *jwksFile != "" {
+		return usageError(flags, "-jwks and -jwks-file are mutually exclusive")
+	}
+	token, err := readToken(flags, positional)
+	if err != nil {
+		return err
+	}
+
+	keys, source, err := c.loadJWKS(*issuer, *jwksURL, *jwksFile)
+	if err != nil {
+		return err
+	}
+
+	result := verifyResult{JWKS: source}
+	if header, err := services.ParseTokenHeader(token); err == nil {
+		result.Kid, _ = header["kid"].(string)
+		result.Alg, _ = header["alg"].(string)
+	}
+	claims, err := services.NewStaticJWKSService(keys).GetTokenClaims(token)
+	if err != nil {
+		result.Error = err.Error()
+		// Still show what the token claims, to help find out why it failed
+		result.Claims, _ = services.ParseTokenWithoutValidation(token)
+	} else {
+		result.Valid = true
+		result.Claims = claims
+	}
+
+	table := map[string]interface{}{"valid": result.Valid, "kid": result.Kid, "alg": result.Alg, "jwks": result.JWKS}
+	if result.Error != "" {
+		table["error"] = result.Error
+	}
+	for key, value := range result.Claims {
+		table["claims."+key] = value
+	}
+	if err := format.print(result, table); err != nil {
+		return err
+	}
+
+	if !result.Valid {
+		return rejected("token is invalid: %s", result.Error)
+	}
+	return nil
+}
+
+// loadJWKS reads the key set from a file or fetches it from a URL, by default
+// the one advertised by the issuer, and returns where it came from
+func (c *cli) loadJWKS(issuer, jwksURL, jwksFile string) (*services.JWKSet, string, error) {
+	if jwksFile != "" {
+		data, err := os.ReadFile(jwksFile)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to read JWKS file: %w", err)
+		}
+		keys, err := services.ParseJWKS(data)
+		return keys, jwksFile, err
+	}
+
+	db, historyService, err := c.openHistory()
+	if err != nil {
+		return nil, "", err
+	}
+	defer db.Close()
+
+	ctx, _, err := newFlowContext(context.Background())
+	if err != nil {
+		return nil, "", err
+	}
+	if jwksURL == "" {
+		baseURL, err := models.NormalizeBaseURL(issuer)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid issuer: %w", err)
+		}
+		jwksURL = services.NewIssuerService(historyService, time.Minute).Endpoints(ctx, baseURL).JWKS
+	}
+
+	keys, err := services.NewJWKSService(jwksURL, historyService).WithContext(ctx).FetchJWKS()
+	return keys, jwksURL, err
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"html/template"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"os/signal"
+	"runtime"
+	"strconv"
+	"time"
+
+	"golang.org/x/oauth2"
+
+	"github.com/pericles-luz/oauth2-test/internal/models"
+	"github.com/pericles-luz/oauth2-test/internal/services"
+)
+
+// loginResult is the output of the login command
+type loginResult struct {
+	FlowID        string           `json:"flow_id"` // groups the requests of the login in the history
+	RedirectURI   string           `json:"redirect_uri"`
+	Token         loginToken       `json:"token"`
+	UserInfo      *models.UserInfo `json:"user_info,omitempty"`
+	UserInfoError string           `json:"user_info_error,omitempty"`
+}
+
+// loginToken is the token response of the code exchange
+type loginToken struct {
+	AccessToken  string    `json:"access_token"`
+	TokenType    string    `json:"token_type,omitempty"`
+	RefreshToken string    `json:"refresh_token,omitempty"`
+	IDToken      string    `json:"id_token,omitempty"`
+	Scope        string    `json:"scope,omitempty"`
+	Expiry       time.Time `json:"expiry,omitempty"`
+}
+
+// callbackResult is what the loopback listener received
+type callbackResult struct {
+	code string
+	err  error
+}
+
+// callbackPage is shown in the browser once the redirect reached the CLI
+var callbackPage = template.Must(template.New("callback").Parse(`<!DOCTYPE html>
+<html lang="pt-BR">
+<head><meta charset="utf-8"><title>OAuth2 CLI</title></head>
+<body style="font-family: sans-serif; padding: 2rem;">
+{{if .}}<h2>Falha na autorização</h2><p>{{.}}</p>{{else}}<h2>Autorização recebida</h2><p>Você pode fechar esta janela e voltar ao terminal.</p>{{end}}
+</body>
+</html>
+`))
+
+// login runs the authorization code flow with PKCE: it listens on a loopback
+// redirect URI, sends the user to the authorization endpoint and exchanges
+// the code it receives
+func (c *cli) login(args []string) error {
+	flags := flag.NewFlagSet("login", flag.ExitOnError)
+	var client clientFlags
+	client.register(flags)
+	redirectURI := flags.String("redirect-uri", "", "loopback redirect URI registered for the client (default http://127.0.0.1:<port>/callback)")
+	port := flags.Int("port", 0, "loopback port when -redirect-uri is not set; 0 picks a free port")
+	noBrowser := flags.Bool("no-browser", false, "only print the authorization URL")
+	timeout := flags.Duration("timeout", 5*time.Minute, "how long to wait for the redirect")
+	flags.Parse(args)
+
+	db, historyService, err := c.openHistory()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	ctx, flowID, err := newFlowContext(ctx)
+	if err != nil {
+		return err
+	}
+	config, ctx, err := client.config(ctx, db, historyService)
+	if err != nil {
+		return err
+	}
+
+	listener, callbackPath, err := listenLoopback(*redirectURI, *port)
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+	config.RedirectURI = *redirectURI
+	if config.RedirectURI == "" {
+		config.RedirectURI = "http://" + listener.Addr().String() + callbackPath
+	}
+
+	if err := config.Validate(); err != nil {
+		return fmt.Errorf("invalid OAuth configuration: %w", err)
+	}
+
+	oauthService := services.NewOAuthService(config, historyService).WithContext(ctx)
+	state, err := services.GenerateRandomState()
+	if err != nil {
+		return fmt.Errorf("failed to generate state: %w", err)
+	}
+	authURL, verifier, err := oauthService.GenerateAuthURL(state)
+	if err != nil {
+		return fmt.Errorf("failed to generate authorization URL: %w", err)
+	}
+
+	// Serve the redirect
+	results := make(chan callbackResult, 1)
+	mux := http.NewServeMux()
+	mux.HandleFunc(callbackPath, func(w http.ResponseWriter, r *http.Request) {
+		result := readCallback(r, state)
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		message := ""
+		if result.err != nil {
+			message = result.err.Error()
+			w.WriteHeader(http.StatusBadRequest)
+		}
+		callbackPage.Execute(w, message)
+		select {
+		case results <- result:
+		default:
+		}
+	})
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go server.Serve(listener)
+	defer server.Close()
+
+	log.Printf("Flow %s, waiting for the redirect on %s", flowID, config.RedirectURI)
+	fmt.Fprintf(os.Stderr, "\nOpen this URL to sign in:\n\n  %s\n\n", authURL)
+	if !*noBrowser {
+		if err := openBrowser(authURL); err != nil {
+			log.Printf("Could not open the browser: %v", err)
+		}
+	}
+
+	var result callbackResult
+	select {
+	case result = <-results:
+	case <-time.After(*timeout):
+		return fmt.Errorf("no redirect received within %s", *timeout)
+	case <-ctx.Done():
+		return errors.New("interrupted")
+	}
+	if result.err != nil {
+		return result.err
+	}
+
+	token, err := oauthService.ExchangeCode(result.code, verifier)
+	if err != nil {
+		return err
+	}
+
+	output := loginResult{
+		FlowID:      flowID,
+		RedirectURI: config.RedirectURI,
+		Token:       newLoginToken(token),
+	}
+	if userInfo, err := oauthService.GetUserInfo(token.AccessToken); err != nil {
+		output.UserInfoError = err.Error()
+	} else {
+		output.UserInfo = userInfo
+	}
+
+	return printJSON(output)
+}
+
+// listenLoopback listens on the host and port of a loopback redirect URI, or
+// on 127.0.0.1:port when no URI is given, and returns the callback path
+func listenLoopback(redirectURI string, port int) (net.Listener, string, error) {
+	if redirectURI == "" {
+		listener, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to listen for the redirect: %w", err)
+		}
+		return listener, "/callback", nil
+	}
+
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid redirect URI: %w", err)
+	}
+	if u.Scheme != "http" {
+		return nil, "", errors.New("the redirect URI must use http (loopback redirects do not need TLS)")
+	}
+	switch u.Hostname() {
+	case "127.0.0.1", "::1", "localhost":
+	default:
+		return nil, "", fmt.Errorf("the redirect URI must point to a loopback address, not %s", u.Hostname())
+	}
+	if u.Port() == "" {
+		return nil, "", errors.New("the redirect URI must include a port")
+	}
+
+	listener, err := net.Listen("tcp", u.Host)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to listen for the redirect: %w", err)
+	}
+	path := u.Path
+	if path == "" {
+		path = "/"
+	}
+	return listener, path, nil
+}
+
+// readCallback checks the state of a redirect and extracts its code
+func readCallback(r *http.Request, state string) callbackResult {
+	query := r.URL.Query()
+	if errorCode := query.Get("error"); errorCode != "" {
+		return callbackResult{err: fmt.Errorf("authorization failed: %s %s", errorCode, query.Get("error_description"))}
+	}
+	if query.Get("state") != state {
+		return callbackResult{err: errors.New("invalid state parameter (CSRF check failed)")}
+	}
+	code := query.Get("code")
+	if code == "" {
+		return callbackResult{err: errors.New("authorization code not found in the redirect")}
+	}
+	return callbackResult{code: code}
+}
+
+// openBrowser opens a URL in the default browser
+func openBrowser(target string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", target)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", target)
+	default:
+		cmd = exec.Command("xdg-open", target)
+	}
+	return cmd.Start()
+}
+
+// newLoginToken extracts the fields of a token response
+func newLoginToken(token *oauth2.Token) loginToken {
+	result := loginToken{
+		AccessToken:  token.AccessToken,
+		TokenType:    token.TokenType,
+		RefreshToken: token.RefreshToken,
+		Expiry:       token.Expiry,
+	}
+	result.IDToken, _ = token.Extra("id_token").(string)
+	result.Scope, _ = token.Extra("scope").(string)
+	return result
+}
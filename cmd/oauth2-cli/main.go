@@ -0,0 +1,163 @@
+// Command oauth2-cli runs OAuth2 flows against an authorization server from
+// the terminal. Requests are logged to the same history database as the web
+// UI, so they can be inspected there afterwards.
+//
+// Usage:
+//
+//	oauth2-cli [-db path | -url postgres://...] login [flags]
+//	oauth2-cli decode [-o json|table] [token | -]
+//	oauth2-cli verify [-jwks url | -jwks-file path] [-o json|table] [token | -]
+//	oauth2-cli introspect [flags] [token | -]
+//	oauth2-cli userinfo [flags] [access-token | -]
+//	oauth2-cli discovery [-issuer url] [-lint] [-o json|table]
+//	oauth2-cli scenario [-junit path] [-json path] file.yaml...
+//	oauth2-cli matrix [-issuer url] [-json path] file.yaml...
+//
+// Tokens are read from stdin when no argument, or "-", is given. Results are
+// printed to stdout as JSON, or as a KEY/VALUE table with -o table; progress
+// and errors go to stderr. The exit status is 0 on success, 1 when the command
+// fails, 2 on usage errors and 3 on a negative verdict: an expired (decode),
+// invalid (verify) or inactive (introspect) token, one refused by the
+// userinfo endpoint, a discovery document with lint errors, a failed
+// scenario, or a scope matrix with over- or under-disclosed claims.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/pericles-luz/oauth2-test/internal/secrets"
+	"github.com/pericles-luz/oauth2-test/internal/services"
+	"github.com/pericles-luz/oauth2-test/internal/storage"
+	"github.com/pericles-luz/oauth2-test/migrations"
+)
+
+// defaultBaseURL is the issuer used when neither -issuer nor OAUTH2_BASE_URL is set
+const defaultBaseURL = "https://api.sindireceita.org.br"
+
+// cli holds the global flags shared by the subcommands
+type cli struct {
+	dbPath  string
+	dbURL   string
+	keyFile string
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("oauth2-cli: ")
+
+	var c cli
+	flag.StringVar(&c.dbPath, "db", getEnv("DATABASE_PATH", "./oauth2-test.db"), "path of the SQLite history database")
+	flag.StringVar(&c.dbURL, "url", getEnv("DATABASE_URL", ""), "PostgreSQL URL, used instead of -db when set")
+	flag.StringVar(&c.keyFile, "key-file", getEnv("ENCRYPTION_KEY_FILE", ""), "file with the master keys, used when ENCRYPTION_KEY is not set")
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() < 1 {
+		flag.Usage()
+		os.Exit(exitUsage)
+	}
+
+	var err error
+	args := flag.Args()[1:]
+	switch flag.Arg(0) {
+	case "login":
+		err = c.login(args)
+	case "decode":
+		err = c.decode(args)
+	case "verify":
+		err = c.verify(args)
+	case "introspect":
+		err = c.introspect(args)
+	case "userinfo":
+		err = c.userinfo(args)
+	case "discovery":
+		err = c.discovery(args)
+	case "scenario":
+		err = c.scenario(args)
+	case "matrix":
+		err = c.matrix(args)
+	default:
+		flag.Usage()
+		os.Exit(exitUsage)
+	}
+
+	if err != nil {
+		log.Print(err)
+		var exitErr *exitError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.status)
+		}
+		os.Exit(exitFailure)
+	}
+}
+
+// usage prints the global usage
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s [-db path | -url postgres://...] <command> [flags]\n\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "Commands:\n")
+	fmt.Fprintf(os.Stderr, "  login       run the authorization code flow with PKCE through a loopback redirect\n")
+	fmt.Fprintf(os.Stderr, "  decode      print the header and claims of a JWT without validating it\n")
+	fmt.Fprintf(os.Stderr, "  verify      validate a JWT against a JWKS URL or file\n")
+	fmt.Fprintf(os.Stderr, "  introspect  ask the introspection endpoint about a token\n")
+	fmt.Fprintf(os.Stderr, "  userinfo    call the userinfo endpoint with an access token\n")
+	fmt.Fprintf(os.Stderr, "  discovery   print the discovery document of the issuer, or lint it\n")
+	fmt.Fprintf(os.Stderr, "  scenario    run YAML test scenarios and write JUnit XML or JSON reports\n")
+	fmt.Fprintf(os.Stderr, "  matrix      log in with each scope combination and check the userinfo claims released\n\n")
+	fmt.Fprintf(os.Stderr, "Run '%s <command> -h' for the flags of a command.\n\nGlobal flags:\n", os.Args[0])
+	flag.PrintDefaults()
+}
+
+// openStore opens and migrates the history database shared with the web UI
+func (c *cli) openStore() (storage.Store, error) {
+	keyring, err := secrets.LoadKeyring(os.Getenv("ENCRYPTION_KEY"), c.keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load encryption keys: %w", err)
+	}
+
+	db, err := storage.Open(c.dbURL, c.dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize database: %w", err)
+	}
+	db.SetKeyring(keyring)
+
+	schemaMigrations, err := storage.LoadMigrations(migrations.For(db.Driver()))
+	if err == nil {
+		err = db.Migrate(schemaMigrations)
+	}
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to run migrations: %w", err)
+	}
+
+	return db, nil
+}
+
+// openHistory opens the database and returns the history service logging to it
+func (c *cli) openHistory() (storage.Store, *services.HistoryService, error) {
+	db, err := c.openStore()
+	if err != nil {
+		return nil, nil, err
+	}
+	return db, services.NewHistoryService(db), nil
+}
+
+// printJSON writes v to stdout as indented JSON
+func printJSON(v interface{}) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.SetEscapeHTML(false)
+	return encoder.Encode(v)
+}
+
+// getEnv gets an environment variable with a default value
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/pericles-luz/oauth2-test/internal/models"
+	"github.com/pericles-luz/oauth2-test/internal/services"
+)
+
+// matrix runs scope matrix files and writes their reports. A field returned
+// without a scope releasing it, or missing from a granted scope, is a
+// negative verdict.
+func (c *cli) matrix(args []string) error {
+	flags := flag.NewFlagSet("matrix", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s matrix [flags] file.yaml...\n\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	issuer := flags.String("issuer", getEnv("OAUTH2_BASE_URL", defaultBaseURL), "issuer of the matrices that name none")
+	jsonPath := flags.String("json", "", "write a JSON report to this file (- for stdout)")
+	files := parseArgs(flags, args)
+
+	if len(files) == 0 {
+		return usageError(flags, "no scope matrix files given")
+	}
+
+	// Parse everything first, so a typo does not leave a half-run suite
+	matrices := make([]*models.ScopeMatrix, len(files))
+	for i, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		if matrices[i], err = services.ParseScopeMatrix(data, services.TrustedVariables); err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+	}
+
+	db, historyService, err := c.openHistory()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	profileService := services.NewProfileService(db)
+	issuerService := services.NewIssuerService(historyService, time.Minute)
+	scenarioService := services.NewScenarioService(historyService, profileService, issuerService, *issuer, "")
+
+	// The summary goes to stderr when stdout carries the report
+	summary := io.Writer(os.Stdout)
+	if *jsonPath == "-" {
+		summary = os.Stderr
+	}
+
+	var reports []models.ScopeMatrixReport
+	failed := 0
+	for i, matrix := range matrices {
+		report, err := scenarioService.RunMatrix(ctx, matrix)
+		if err != nil {
+			return fmt.Errorf("%s: %w", files[i], err)
+		}
+		report.File = files[i]
+		printMatrixSummary(summary, report)
+		if !report.Passed {
+			failed++
+		}
+		reports = append(reports, *report)
+	}
+
+	if *jsonPath != "" {
+		if err := writeReport(*jsonPath, func(w io.Writer) error {
+			encoder := json.NewEncoder(w)
+			encoder.SetIndent("", "  ")
+			encoder.SetEscapeHTML(false)
+			return encoder.Encode(reports)
+		}); err != nil {
+			return err
+		}
+	}
+
+	if failed > 0 {
+		return rejected("%d of %d scope matrices failed", failed, len(reports))
+	}
+	return nil
+}
+
+// printMatrixSummary prints one line per scope combination of a matrix run
+func printMatrixSummary(w io.Writer, report *models.ScopeMatrixReport) {
+	verdict := "PASS"
+	if !report.Passed {
+		verdict = "FAIL"
+	}
+	fmt.Fprintf(w, "%s %s (%s, flow %s, %dms)\n", verdict, report.Name, report.File, report.FlowID, report.DurationMs)
+	for _, row := range report.Rows {
+		outcome := "PASS"
+		switch {
+		case row.Error != "":
+			outcome = "ERROR"
+		case !row.Passed:
+			outcome = "FAIL"
+		}
+		fmt.Fprintf(w, "  %-7s %s (%dms)\n", outcome, strings.Join(row.Scopes, " "), row.DurationMs)
+		if len(row.Over) > 0 {
+			fmt.Fprintf(w, "          over-disclosed: %s\n", strings.Join(row.Over, ", "))
+		}
+		if len(row.Under) > 0 {
+			fmt.Fprintf(w, "          under-disclosed: %s\n", strings.Join(row.Under, ", "))
+		}
+		if row.Error != "" {
+			fmt.Fprintf(w, "          %s\n", row.Error)
+		}
+	}
+}
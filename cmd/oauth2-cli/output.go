@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Exit statuses of the commands
+const (
+	exitFailure  = 1 // the command could not run: network, configuration or input errors
+	exitUsage    = 2
+	exitRejected = 3 // the command ran, but the token is expired, invalid, inactive or refused
+)
+
+// exitError ends a command with a specific exit status
+type exitError struct {
+	status  int
+	message string
+}
+
+func (e *exitError) Error() string {
+	return e.message
+}
+
+// rejected reports a negative verdict. The reason goes to stderr, after the
+// result, if any, was printed to stdout.
+func rejected(format string, args ...interface{}) error {
+	return &exitError{status: exitRejected, message: fmt.Sprintf(format, args...)}
+}
+
+// timeClaims are the claims holding NumericDate values
+var timeClaims = map[string]bool{"exp": true, "iat": true, "nbf": true, "auth_time": true}
+
+// outputFormat is the -o flag of the commands printing a result
+type outputFormat string
+
+// String implements flag.Value
+func (f *outputFormat) String() string {
+	return string(*f)
+}
+
+// Set implements flag.Value
+func (f *outputFormat) Set(value string) error {
+	switch value {
+	case "json", "table":
+		*f = outputFormat(value)
+		return nil
+	}
+	return errors.New("must be json or table")
+}
+
+// registerOutput adds the -o flag to a flag set
+func registerOutput(flags *flag.FlagSet) *outputFormat {
+	format := outputFormat("json")
+	flags.Var(&format, "o", "output `format`: json or table")
+	return &format
+}
+
+// print writes a result in the chosen format. Tables list the fields of table,
+// or of v when table is nil, as KEY/VALUE rows sorted by key.
+func (f outputFormat) print(v, table interface{}) error {
+	if f != "table" {
+		return printJSON(v)
+	}
+	if table == nil {
+		table = v
+	}
+
+	// Go through JSON so structs and maps are flattened the same way
+	data, err := json.Marshal(table)
+	if err != nil {
+		return err
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "KEY\tVALUE")
+	for _, key := range keys {
+		fmt.Fprintf(w, "%s\t%s\n", key, formatValue(key, fields[key]))
+	}
+	return w.Flush()
+}
+
+// formatValue renders a table cell: time claims as RFC 3339, nested values as
+// compact JSON
+func formatValue(key string, value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "-"
+	case string:
+		return v
+	case float64:
+		// Prefixed keys, e.g. "claims.exp", are claims too
+		if timeClaims[key[strings.LastIndex(key, ".")+1:]] {
+			return time.Unix(int64(v), 0).UTC().Format(time.RFC3339)
+		}
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return fmt.Sprint(v)
+	}
+	data, _ := json.Marshal(value)
+	return string(data)
+}
+
+// parseArgs parses the flags of a command, allowing them after the positional
+// arguments as well, e.g. "decode <token> -o table"
+func parseArgs(flags *flag.FlagSet, args []string) []string {
+	var positional []string
+	for {
+		flags.Parse(args)
+		if flags.NArg() == 0 {
+			return positional
+		}
+		positional = append(positional, flags.Arg(0))
+		args = flags.Args()[1:]
+	}
+}
+
+// readToken returns the token given as positional argument or, when it is
+// missing or "-", the first line of stdin
+func readToken(flags *flag.FlagSet, args []string) (string, error) {
+	if len(args) > 1 {
+		return "", usageError(flags, "expected a single token")
+	}
+	if len(args) == 1 && args[0] != "-" {
+		return strings.TrimSpace(args[0]), nil
+	}
+
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", fmt.Errorf("failed to read the token from stdin: %w", err)
+	}
+	token := strings.TrimSpace(line)
+	if token == "" {
+		return "", usageError(flags, "no token given")
+	}
+	return token, nil
+}
+
+// usageError prints the flags of a command after a usage problem
+func usageError(flags *flag.FlagSet, message string) error {
+	flags.Usage()
+	return &exitError{status: exitUsage, message: flags.Name() + ": " + message}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/pericles-luz/oauth2-test/internal/models"
+	"github.com/pericles-luz/oauth2-test/internal/services"
+)
+
+// scenario runs YAML scenario files and writes their reports. A scenario with
+// a failed step is a negative verdict.
+func (c *cli) scenario(args []string) error {
+	flags := flag.NewFlagSet("scenario", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s scenario [flags] file.yaml...\n\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	issuer := flags.String("issuer", getEnv("OAUTH2_BASE_URL", defaultBaseURL), "issuer of the scenarios that name none")
+	junitPath := flags.String("junit", "", "write a JUnit XML report to this file (- for stdout)")
+	jsonPath := flags.String("json", "", "write a JSON report to this file (- for stdout)")
+	files := parseArgs(flags, args)
+
+	if len(files) == 0 {
+		return usageError(flags, "no scenario files given")
+	}
+	if *junitPath == "-" && *jsonPath == "-" {
+		return usageError(flags, "only one report can go to stdout")
+	}
+
+	// Parse everything first, so a typo does not leave a half-run suite
+	scenarios := make([]*models.Scenario, len(files))
+	for i, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		if scenarios[i], err = services.ParseScenario(data, services.TrustedVariables); err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+	}
+
+	db, historyService, err := c.openHistory()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	profileService := services.NewProfileService(db)
+	issuerService := services.NewIssuerService(historyService, time.Minute)
+	scenarioService := services.NewScenarioService(historyService, profileService, issuerService, *issuer, "")
+
+	// The summary goes to stderr when stdout carries a report
+	summary := io.Writer(os.Stdout)
+	if *junitPath == "-" || *jsonPath == "-" {
+		summary = os.Stderr
+	}
+
+	var reports []models.ScenarioReport
+	failed := 0
+	for i, scenario := range scenarios {
+		report, err := scenarioService.Run(ctx, scenario)
+		if err != nil {
+			return fmt.Errorf("%s: %w", files[i], err)
+		}
+		report.File = files[i]
+		printScenarioSummary(summary, report)
+		if !report.Passed {
+			failed++
+		}
+		reports = append(reports, *report)
+	}
+
+	if *junitPath != "" {
+		if err := writeReport(*junitPath, func(w io.Writer) error {
+			return services.WriteJUnitReport(w, reports)
+		}); err != nil {
+			return err
+		}
+	}
+	if *jsonPath != "" {
+		if err := writeReport(*jsonPath, func(w io.Writer) error {
+			encoder := json.NewEncoder(w)
+			encoder.SetIndent("", "  ")
+			encoder.SetEscapeHTML(false)
+			return encoder.Encode(reports)
+		}); err != nil {
+			return err
+		}
+	}
+
+	if failed > 0 {
+		return rejected("%d of %d scenarios failed", failed, len(reports))
+	}
+	return nil
+}
+
+// printScenarioSummary prints one line per step of a scenario run
+func printScenarioSummary(w io.Writer, report *models.ScenarioReport) {
+	verdict := "PASS"
+	if !report.Passed {
+		verdict = "FAIL"
+	}
+	fmt.Fprintf(w, "%s %s (%s, flow %s, %dms)\n", verdict, report.Name, report.File, report.FlowID, report.DurationMs)
+	for _, step := range report.Steps {
+		fmt.Fprintf(w, "  %-7s %s (%dms)\n", strings.ToUpper(step.Outcome), step.Name, step.DurationMs)
+		for _, assertion := range step.Assertions {
+			if !assertion.Passed {
+				fmt.Fprintf(w, "          %s: expected %s, got %s\n", assertion.Target, assertion.Expected, assertion.Actual)
+			}
+		}
+		if step.Error != "" && step.Outcome != models.ScenarioStepPassed {
+			fmt.Fprintf(w, "          %s\n", step.Error)
+		}
+	}
+}
+
+// writeReport writes a report to a file, or to stdout for "-"
+func writeReport(path string, write func(io.Writer) error) error {
+	if path == "-" {
+		return write(os.Stdout)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create report: %w", err)
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+	return f.Close()
+}
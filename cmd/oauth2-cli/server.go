@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pericles-luz/oauth2-test/internal/models"
+	"github.com/pericles-luz/oauth2-test/internal/services"
+)
+
+// introspect asks the introspection endpoint (RFC 7662) about a token. An
+// inactive token is a negative verdict.
+func (c *cli) introspect(args []string) error {
+	flags := flag.NewFlagSet("introspect", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s introspect [flags] [token | -]\n\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	var client clientFlags
+	client.register(flags)
+	hint := flags.String("hint", "", "token_type_hint: access_token or refresh_token")
+	format := registerOutput(flags)
+	positional := parseArgs(flags, args)
+
+	token, err := readToken(flags, positional)
+	if err != nil {
+		return err
+	}
+	oauthService, closeDB, err := c.oauthService(&client)
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+
+	result, err := oauthService.IntrospectToken(token, *hint)
+	if err != nil {
+		return err
+	}
+	if err := format.print(result, nil); err != nil {
+		return err
+	}
+
+	if active, _ := result["active"].(bool); !active {
+		return rejected("token is not active")
+	}
+	return nil
+}
+
+// userinfo calls the userinfo endpoint with an access token. A token refused
+// by the server (401 or 403) is a negative verdict.
+func (c *cli) userinfo(args []string) error {
+	flags := flag.NewFlagSet("userinfo", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s userinfo [flags] [access-token | -]\n\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	var client clientFlags
+	client.register(flags)
+	format := registerOutput(flags)
+	positional := parseArgs(flags, args)
+
+	token, err := readToken(flags, positional)
+	if err != nil {
+		return err
+	}
+	oauthService, closeDB, err := c.oauthService(&client)
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+
+	userInfo, err := oauthService.GetUserInfo(token)
+	var statusErr *services.StatusError
+	if errors.As(err, &statusErr) && (statusErr.Status == http.StatusUnauthorized || statusErr.Status == http.StatusForbidden) {
+		return rejected("the server refused the token with status %d", statusErr.Status)
+	}
+	if err != nil {
+		return err
+	}
+	return format.print(userInfo, nil)
+}
+
+// discovery prints the discovery document of an issuer
+func (c *cli) discovery(args []string) error {
+	flags := flag.NewFlagSet("discovery", flag.ExitOnError)
+	issuer := flags.String("issuer", getEnv("OAUTH2_BASE_URL", defaultBaseURL), "base URL of the authorization server")
+	lint := flags.Bool("lint", false, "check the document against OIDC Discovery and RFC 8414 and probe its endpoints")
+	format := registerOutput(flags)
+	flags.Parse(args)
+
+	baseURL, err := models.NormalizeBaseURL(*issuer)
+	if err != nil {
+		return fmt.Errorf("invalid issuer: %w", err)
+	}
+
+	db, historyService, err := c.openHistory()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx, _, err := newFlowContext(context.Background())
+	if err != nil {
+		return err
+	}
+	discovery, err := services.NewIssuerService(historyService, time.Minute).Discover(ctx, baseURL)
+	if err != nil {
+		return err
+	}
+	if !*lint {
+		return format.print(discovery, nil)
+	}
+
+	report := services.LintDiscovery(ctx, historyService, baseURL, discovery)
+	if *format == "table" {
+		printLintReport(os.Stdout, report)
+	} else if err := format.print(report, nil); err != nil {
+		return err
+	}
+	if !report.Passed {
+		return rejected("discovery document has %d errors", report.Count(models.SeverityError))
+	}
+	return nil
+}
+
+// printLintReport prints one line per finding and per endpoint probe
+func printLintReport(w io.Writer, report *models.DiscoveryLintReport) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SEVERITY\tFIELD\tMESSAGE\tREFERENCE")
+	for _, finding := range report.Findings {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", strings.ToUpper(finding.Severity), finding.Field, finding.Message, finding.Reference)
+	}
+	fmt.Fprintln(tw)
+	fmt.Fprintln(tw, "ENDPOINT\tSTATUS\tDURATION\tURL")
+	for _, probe := range report.Probes {
+		status := strconv.Itoa(probe.Status)
+		if probe.Error != "" {
+			status = probe.Error
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%dms\t%s\n", probe.Field, status, probe.DurationMs, probe.URL)
+	}
+	tw.Flush()
+
+	fmt.Fprintf(w, "\n%d errors, %d warnings, %d info\n",
+		report.Count(models.SeverityError), report.Count(models.SeverityWarning), report.Count(models.SeverityInfo))
+}
+
+// oauthService opens the history database and returns an OAuthService for the
+// client selected by the flags, along with a function closing the database
+func (c *cli) oauthService(client *clientFlags) (*services.OAuthService, func() error, error) {
+	db, historyService, err := c.openHistory()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ctx, _, err := newFlowContext(context.Background())
+	if err != nil {
+		db.Close()
+		return nil, nil, err
+	}
+	config, ctx, err := client.config(ctx, db, historyService)
+	if err != nil {
+		db.Close()
+		return nil, nil, err
+	}
+	return services.NewOAuthService(config, historyService).WithContext(ctx), db.Close, nil
+}
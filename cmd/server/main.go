@@ -2,25 +2,29 @@ package main
 
 import (
 	"encoding/gob"
+	"fmt"
 	"html/template"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
-	"github.com/gorilla/sessions"
 
 	"github.com/pericles-luz/oauth2-test/internal/handlers"
 	"github.com/pericles-luz/oauth2-test/internal/models"
+	"github.com/pericles-luz/oauth2-test/internal/secrets"
 	"github.com/pericles-luz/oauth2-test/internal/services"
 	"github.com/pericles-luz/oauth2-test/internal/storage"
+	"github.com/pericles-luz/oauth2-test/migrations"
 )
 
 func init() {
-	// Register types for gob encoding (used by gorilla/sessions)
+	// Register types for gob encoding (used by the session store)
 	gob.Register(&models.UserInfo{})
 	gob.Register(map[string]interface{}{})
 	gob.Register([]interface{}{})
@@ -31,39 +35,82 @@ func main() {
 	config := loadConfig()
 
 	// Initialize database
-	db, err := storage.NewSQLiteDB(config.DatabasePath)
+	db, err := storage.Open(config.DatabaseURL, config.DatabasePath)
 	if err != nil {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
 	defer db.Close()
 
+	// Master keys for the secrets stored in the database
+	keyring, err := secrets.LoadKeyring(config.EncryptionKey, config.EncryptionKeyFile)
+	if err != nil {
+		log.Fatalf("Failed to load encryption keys: %v", err)
+	}
+	if keyring == nil {
+		log.Printf("WARNING: ENCRYPTION_KEY not set, secrets are stored in clear text")
+	}
+	db.SetKeyring(keyring)
+
 	// Run migrations
-	migrationPath := filepath.Join("migrations", "001_initial.sql")
-	if err := db.RunMigrations(migrationPath); err != nil {
+	schemaMigrations, err := storage.LoadMigrations(migrations.For(db.Driver()))
+	if err != nil {
+		log.Fatalf("Failed to load migrations: %v", err)
+	}
+	if err := db.Migrate(schemaMigrations); err != nil {
 		log.Fatalf("Failed to run migrations: %v", err)
 	}
-	log.Println("Database migrations completed successfully")
+	log.Printf("Database migrations completed successfully (%s)", db.Driver())
+
+	// Initialize session store; the cookie only carries an opaque token
+	sessionStore := services.NewSessionStore(db, config.SessionSecret, config.SessionIdleTimeout, config.SessionMaxAge)
+	sessionStore.Options.Secure = false // Set to true in production with HTTPS
+	sessionStore.Start(15 * time.Minute)
+	defer sessionStore.Stop()
 
-	// Initialize session store
-	sessionStore := sessions.NewCookieStore([]byte(config.SessionSecret))
-	sessionStore.Options = &sessions.Options{
-		Path:     "/",
-		MaxAge:   86400 * 7, // 7 days
-		HttpOnly: true,
-		Secure:   false, // Set to true in production with HTTPS
-		SameSite: http.SameSiteLaxMode,
+	// Initialize token store, reloading the tokens of ongoing sessions
+	tokenStore := services.NewTokenStore(db, config.RefreshTokenLifetime)
+	if loaded, err := tokenStore.Load(); err != nil {
+		log.Printf("Failed to load persisted tokens: %v", err)
+	} else {
+		log.Printf("Loaded %d persisted tokens", loaded)
 	}
+	tokenStore.Start(time.Hour)
+	defer tokenStore.Stop()
 
 	// Initialize services
 	historyService := services.NewHistoryService(db)
+	retentionService := services.NewRetentionService(db, config.Retention)
+	retentionService.Start()
+	defer retentionService.Stop()
+	statsService := services.NewStatsService(db)
+	profileService := services.NewProfileService(db)
+	issuerService := services.NewIssuerService(historyService, config.DiscoveryTTL)
+	refreshService := services.NewRefreshService(db, tokenStore, historyService, config.AutoRefreshInterval, config.AutoRefreshLead)
+	refreshService.Start()
+	defer refreshService.Stop()
+	lifetimeService := services.NewLifetimeService(tokenStore, historyService, config.ExpiryProbeMargin)
+	defer lifetimeService.Stop()
+	scenarioService := services.NewScenarioService(historyService, profileService, issuerService, config.BaseURL, config.ScenariosDir)
+	monitorService := services.NewMonitorService(db, historyService, profileService, issuerService, config.Monitor)
+	monitorService.Start()
+	defer monitorService.Stop()
 
 	// Initialize templates
-	tmpl := loadTemplates()
+	tmpl := loadTemplates(config.AdminToken != "")
 
 	// Initialize handlers
 	h := handlers.NewHandlers(
 		sessionStore,
+		tokenStore,
+		refreshService,
+		lifetimeService,
 		historyService,
+		retentionService,
+		statsService,
+		profileService,
+		issuerService,
+		scenarioService,
+		monitorService,
 		tmpl,
 		config.BaseURL,
 	)
@@ -84,7 +131,7 @@ func main() {
 	r.Handle("/static/*", http.StripPrefix("/static/", fileServer))
 
 	// Routes
-	setupRoutes(r, h)
+	setupRoutes(r, h, config.AdminToken)
 
 	// Start server
 	port := config.ServerPort
@@ -97,19 +144,81 @@ func main() {
 
 // Config holds application configuration
 type Config struct {
-	BaseURL       string
+	BaseURL       string        // default issuer, overridable per profile
+	DiscoveryTTL  time.Duration // how long issuer discovery documents are cached
 	SessionSecret string
-	ServerPort    string
-	DatabasePath  string
+	// Sessions end after SessionIdleTimeout without requests, or SessionMaxAge after creation
+	SessionIdleTimeout time.Duration
+	SessionMaxAge      time.Duration
+	// Lifetime assumed for refresh tokens when the server does not send refresh_expires_in
+	RefreshTokenLifetime time.Duration
+	// Sessions that opt in get their tokens refreshed AutoRefreshLead before expiry
+	AutoRefreshInterval time.Duration
+	AutoRefreshLead     time.Duration
+	// Expiry probes call userinfo this long before and after the access token expires
+	ExpiryProbeMargin time.Duration
+	ServerPort        string
+	ScenariosDir      string // YAML test scenarios listed on /scenarios
+	// Token of the sessions and maintenance pages, which are disabled without it
+	AdminToken   string
+	DatabasePath string
+	DatabaseURL  string // PostgreSQL URL; SQLite at DatabasePath when empty
+	// Base64 master keys (first one encrypts) or a file with one key per line
+	EncryptionKey     string
+	EncryptionKeyFile string
+	Retention         models.RetentionPolicy
+	Monitor           models.MonitorConfig
 }
 
 // loadConfig loads configuration from environment variables
 func loadConfig() *Config {
+	quotas, err := services.ParseTypeQuotas(getEnv("HISTORY_TYPE_QUOTAS", ""))
+	if err != nil {
+		log.Fatalf("Invalid HISTORY_TYPE_QUOTAS: %v", err)
+	}
+
+	baseURL, err := models.NormalizeBaseURL(getEnv("OAUTH2_BASE_URL", "https://api.sindireceita.org.br"))
+	if err != nil {
+		log.Fatalf("Invalid OAUTH2_BASE_URL: %v", err)
+	}
+
+	monitor := models.MonitorConfig{
+		Interval:     getEnvDuration("MONITOR_INTERVAL", 0),
+		Issuer:       baseURL,
+		Profile:      getEnv("MONITOR_PROFILE", ""),
+		Grant:        getEnv("MONITOR_GRANT", ""),
+		RefreshToken: getEnv("MONITOR_REFRESH_TOKEN", ""),
+		WebhookURL:   getEnv("MONITOR_WEBHOOK_URL", ""),
+	}
+	if err := monitor.Validate(); err != nil {
+		log.Fatalf("Invalid monitor configuration: %v", err)
+	}
+
 	return &Config{
-		BaseURL:       getEnv("OAUTH2_BASE_URL", "https://api.sindireceita.org.br"),
-		SessionSecret: getEnv("SESSION_SECRET", "change-this-secret-in-production-32bytes!!"),
-		ServerPort:    getEnv("SERVER_PORT", "8080"),
-		DatabasePath:  getEnv("DATABASE_PATH", "./oauth2-test.db"),
+		BaseURL:              baseURL,
+		DiscoveryTTL:         getEnvDuration("ISSUER_DISCOVERY_TTL", 10*time.Minute),
+		SessionSecret:        getEnv("SESSION_SECRET", "change-this-secret-in-production-32bytes!!"),
+		SessionIdleTimeout:   getEnvDuration("SESSION_IDLE_TIMEOUT", 2*time.Hour),
+		SessionMaxAge:        getEnvDuration("SESSION_MAX_AGE", 24*time.Hour),
+		RefreshTokenLifetime: getEnvDuration("REFRESH_TOKEN_LIFETIME", 24*time.Hour),
+		AutoRefreshInterval:  getEnvDuration("AUTO_REFRESH_INTERVAL", 15*time.Second),
+		AutoRefreshLead:      getEnvDuration("AUTO_REFRESH_LEAD", time.Minute),
+		ExpiryProbeMargin:    getEnvDuration("EXPIRY_PROBE_MARGIN", 5*time.Second),
+		ServerPort:           getEnv("SERVER_PORT", "8080"),
+		ScenariosDir:         getEnv("SCENARIOS_DIR", "./scenarios"),
+		AdminToken:           getEnv("ADMIN_TOKEN", ""),
+		DatabasePath:         getEnv("DATABASE_PATH", "./oauth2-test.db"),
+		DatabaseURL:          getEnv("DATABASE_URL", ""),
+		EncryptionKey:        getEnv("ENCRYPTION_KEY", ""),
+		EncryptionKeyFile:    getEnv("ENCRYPTION_KEY_FILE", ""),
+		Retention: models.RetentionPolicy{
+			MaxAge:     time.Duration(getEnvInt("HISTORY_RETENTION_DAYS", 0)) * 24 * time.Hour,
+			MaxRows:    getEnvInt("HISTORY_MAX_ROWS", 0),
+			TypeQuotas: quotas,
+			Interval:   getEnvDuration("HISTORY_PRUNE_INTERVAL", time.Hour),
+			Vacuum:     getEnvBool("HISTORY_VACUUM", true),
+		},
+		Monitor: monitor,
 	}
 }
 
@@ -121,8 +230,82 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
-// loadTemplates loads all HTML templates
-func loadTemplates() *template.Template {
+// getEnvInt gets an integer environment variable or returns a default value
+func getEnvInt(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		log.Fatalf("Invalid %s: %v", key, err)
+	}
+	return parsed
+}
+
+// getEnvDuration gets a duration environment variable (e.g. "30m", "1h") or returns a default value
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		log.Fatalf("Invalid %s: %v", key, err)
+	}
+	return parsed
+}
+
+// getEnvBool gets a boolean environment variable or returns a default value
+func getEnvBool(key string, defaultValue bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Fatalf("Invalid %s: %v", key, err)
+	}
+	return parsed
+}
+
+// toFloat converts numeric template values to float64
+func toFloat(value interface{}) float64 {
+	switch v := value.(type) {
+	case int:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case float64:
+		return v
+	}
+	return 0
+}
+
+// formatAgo describes how long ago a time was, e.g. "há 3 dias"
+func formatAgo(t time.Time) string {
+	elapsed := time.Since(t)
+	plural := func(n int, singular, plural string) string {
+		if n == 1 {
+			return fmt.Sprintf("há 1 %s", singular)
+		}
+		return fmt.Sprintf("há %d %s", n, plural)
+	}
+
+	switch {
+	case elapsed < time.Minute:
+		return "agora mesmo"
+	case elapsed < time.Hour:
+		return plural(int(elapsed/time.Minute), "minuto", "minutos")
+	case elapsed < 24*time.Hour:
+		return plural(int(elapsed/time.Hour), "hora", "horas")
+	}
+	return plural(int(elapsed/(24*time.Hour)), "dia", "dias")
+}
+
+// loadTemplates loads all HTML templates. Links to the admin pages are only
+// shown when they are enabled.
+func loadTemplates(adminEnabled bool) *template.Template {
 	tmpl := template.New("")
 
 	// Define custom template functions
@@ -140,6 +323,26 @@ func loadTemplates() *template.Template {
 		"contains": func(s, substr string) bool {
 			return strings.Contains(s, substr)
 		},
+		"percentOf": func(value, max interface{}) float64 {
+			v, m := toFloat(value), toFloat(max)
+			if m <= 0 {
+				return 0
+			}
+			return v * 100 / m
+		},
+		"ago": formatAgo,
+		"adminEnabled": func() bool {
+			return adminEnabled
+		},
+		"dict": func(pairs ...interface{}) map[string]interface{} {
+			m := make(map[string]interface{}, len(pairs)/2)
+			for i := 0; i+1 < len(pairs); i += 2 {
+				if key, ok := pairs[i].(string); ok {
+					m[key] = pairs[i+1]
+				}
+			}
+			return m
+		},
 	}
 	tmpl.Funcs(funcMap)
 
@@ -157,26 +360,141 @@ func loadTemplates() *template.Template {
 	return tmpl
 }
 
-// setupRoutes configures all application routes
-func setupRoutes(r chi.Router, h *handlers.Handlers) {
+// setupRoutes configures all application routes. The admin routes act on
+// every session of the instance and require adminToken.
+func setupRoutes(r chi.Router, h *handlers.Handlers, adminToken string) {
 	// Home page
 	r.Get("/", h.Home)
 	r.Post("/config", h.SaveConfig)
 
+	// Client profiles
+	r.Get("/profiles", h.ProfileList)
+	r.Get("/profiles/new", h.ProfileForm)
+	r.Post("/profiles", h.ProfileSave)
+	r.Get("/profiles/{id}/edit", h.ProfileForm)
+	r.Post("/profiles/{id}", h.ProfileSave)
+	r.Post("/profiles/{id}/delete", h.ProfileDelete)
+	r.Post("/profiles/{id}/use", h.ProfileUse)
+
 	// OAuth flow
 	r.Get("/auth/login", h.OAuthLogin)
 	r.Get("/auth/callback", h.OAuthCallback)
 
 	// Dashboard (post-auth)
 	r.Get("/dashboard", h.Dashboard)
+	r.Post("/dashboard/auto-refresh", h.DashboardAutoRefresh)
+	r.Get("/dashboard/timeline", h.TokenTimeline)
+	r.Get("/dashboard/expiry-probe", h.ExpiryProbeStatus)
+	r.Post("/dashboard/expiry-probe", h.ExpiryProbeSchedule)
 
 	// Endpoint testing
 	r.Post("/test/refresh", h.TestRefresh)
+	r.Post("/test/refresh-reuse", h.TestRefreshReuse)
 	r.Post("/test/revoke", h.TestRevoke)
 	r.Get("/test/jwks", h.TestJWKS)
 	r.Get("/test/discovery", h.TestDiscovery)
+	r.Get("/test/claims", h.TestClaims)
 
 	// History
 	r.Get("/history", h.HistoryList)
+	r.Get("/history/diff", h.HistoryDiff)
+	r.Get("/history/live", h.HistoryLive)
+	r.Get("/history/stream", h.HistoryStream)
 	r.Get("/history/{id}", h.HistoryDetail)
+	r.Get("/history/{id}/snippets", h.HistorySnippets)
+	r.Post("/history/{id}/pin", h.HistoryPin)
+
+	// Statistics
+	r.Get("/stats", h.Stats)
+
+	// Test scenarios
+	r.Get("/scenarios", h.ScenarioList)
+	r.Post("/scenarios/run", h.ScenarioRun)
+	r.Get("/scenarios/matrix", h.ScopeMatrixList)
+	r.Post("/scenarios/matrix/run", h.ScopeMatrixRun)
+
+	// Synthetic monitoring
+	r.Get("/monitor", h.Monitor)
+	r.Post("/monitor/run", h.MonitorRun)
+
+	// Provider change log
+	r.Get("/changes", h.ProviderChanges)
+
+	// Maintenance
+	r.Group(func(r chi.Router) {
+		r.Use(handlers.AdminMiddleware(adminToken))
+
+		r.Get("/sessions", h.SessionList)
+		r.Post("/sessions/{id}/delete", h.SessionTerminate)
+
+		r.Get("/maintenance", h.Maintenance)
+		r.Post("/maintenance/prune", h.MaintenancePrune)
+		r.Post("/maintenance/purge", h.MaintenancePurge)
+		r.Post("/maintenance/vacuum", h.MaintenanceVacuum)
+	})
+
+	// JSON API
+	r.Get("/api/openapi.json", handlers.OpenAPISpec)
+	r.Route("/api/"+handlers.APIVersion, func(r chi.Router) {
+		r.Use(handlers.APIMiddleware)
+		r.NotFound(handlers.APINotFound)
+		r.MethodNotAllowed(handlers.APIMethodNotAllowed)
+
+		r.Get("/config", h.APIGetConfig)
+		r.Put("/config", h.APIPutConfig)
+
+		r.Get("/profiles", h.APIListProfiles)
+		r.Post("/profiles", h.APICreateProfile)
+		r.Get("/profiles/{id}", h.APIGetProfile)
+		r.Put("/profiles/{id}", h.APIUpdateProfile)
+		r.Delete("/profiles/{id}", h.APIDeleteProfile)
+		r.Post("/profiles/{id}/use", h.APIUseProfile)
+
+		r.Post("/flows", h.APIStartFlow)
+		r.Get("/session", h.APIGetSession)
+
+		r.Post("/tokens/refresh", h.APIRefresh)
+		r.Post("/tokens/refresh-reuse", h.APIRefreshReuse)
+		r.Post("/tokens/revoke", h.APIRevoke)
+		r.Get("/tokens/auto-refresh", h.APIGetAutoRefresh)
+		r.Put("/tokens/auto-refresh", h.APIPutAutoRefresh)
+		r.Get("/tokens/refresh-log", h.APIRefreshLog)
+		r.Get("/tokens/timeline", h.APITokenTimeline)
+		r.Get("/tokens/expiry-probe", h.APIGetExpiryProbe)
+		r.Post("/tokens/expiry-probe", h.APIScheduleExpiryProbe)
+		r.Get("/tokens/claims", h.APIClaims)
+
+		r.Get("/discovery", h.APIDiscovery)
+		r.Get("/discovery/lint", h.APIDiscoveryLint)
+		r.Get("/jwks", h.APIJWKS)
+
+		r.Get("/history", h.APIHistory)
+		r.Get("/history/diff", h.APIHistoryDiff)
+		r.Get("/history/{id}", h.APIHistoryEntry)
+		r.Get("/history/{id}/snippets", h.APIHistorySnippets)
+		r.Put("/history/{id}/pin", h.APIHistoryPin)
+
+		r.Get("/stats", h.APIStats)
+
+		r.Get("/scenarios", h.APIScenarios)
+		r.Post("/scenarios/run", h.APIRunScenario)
+		r.Get("/scenarios/matrix", h.APIScopeMatrices)
+		r.Post("/scenarios/matrix/run", h.APIRunScopeMatrix)
+
+		r.Get("/monitor", h.APIMonitor)
+		r.Post("/monitor/run", h.APIRunMonitor)
+		r.Get("/changes", h.APIProviderChanges)
+
+		r.Group(func(r chi.Router) {
+			r.Use(handlers.APIAdminMiddleware(adminToken))
+
+			r.Get("/sessions", h.APISessions)
+			r.Delete("/sessions/{id}", h.APITerminateSession)
+
+			r.Get("/maintenance", h.APIMaintenance)
+			r.Post("/maintenance/prune", h.APIMaintenancePrune)
+			r.Post("/maintenance/purge", h.APIMaintenancePurge)
+			r.Post("/maintenance/vacuum", h.APIMaintenanceVacuum)
+		})
+	})
 }
@@ -0,0 +1,218 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/gorilla/sessions"
+
+	"github.com/pericles-luz/oauth2-test/internal/models"
+	"github.com/pericles-luz/oauth2-test/openapi"
+)
+
+// APIVersion is the version prefix of the JSON API
+const APIVersion = "v1"
+
+// API error codes
+const (
+	APIErrorBadRequest       = "bad_request"
+	APIErrorValidation       = "validation_failed"
+	APIErrorNotAuthenticated = "not_authenticated"
+	APIErrorNotAuthorized    = "not_authorized" // the admin token is missing or wrong
+	APIErrorNotFound         = "not_found"
+	APIErrorMethodNotAllowed = "method_not_allowed"
+	APIErrorNotAcceptable    = "not_acceptable"
+	APIErrorUnsupportedMedia = "unsupported_media_type"
+	APIErrorUpstream         = "upstream_error" // the authorization server failed or refused
+	APIErrorInternal         = "internal_error"
+)
+
+// apiMaxBodyBytes limits the size of JSON request bodies
+const apiMaxBodyBytes = 1 << 20
+
+// APIError is the error object of every failed API response
+type APIError struct {
+	Status  int    `json:"status"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Field   string `json:"field,omitempty"` // the invalid field of a validation error
+}
+
+// apiErrorResponse wraps an APIError as {"error": {...}}
+type apiErrorResponse struct {
+	Error APIError `json:"error"`
+}
+
+// APIMiddleware negotiates the content of API requests: responses are JSON,
+// so clients must accept application/json, and bodies must be JSON
+func APIMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !acceptsJSON(r.Header.Get("Accept")) {
+			writeAPIError(w, http.StatusNotAcceptable, APIErrorNotAcceptable, "This API only produces application/json")
+			return
+		}
+
+		if r.ContentLength != 0 && r.Method != http.MethodGet && r.Method != http.MethodDelete {
+			mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+			if err != nil || mediaType != "application/json" {
+				writeAPIError(w, http.StatusUnsupportedMediaType, APIErrorUnsupportedMedia, "Request bodies must be application/json")
+				return
+			}
+		}
+
+		w.Header().Set("Vary", "Accept")
+		next.ServeHTTP(w, r)
+	})
+}
+
+// APIAdminMiddleware is AdminMiddleware for the JSON API: the admin token
+// goes as a Bearer token, and errors are API error objects
+func APIAdminMiddleware(token string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if token == "" {
+				writeAPIError(w, http.StatusNotFound, APIErrorNotFound, "Administration is disabled, set ADMIN_TOKEN to enable it")
+				return
+			}
+			if !adminAuthorized(r, token) {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+				writeAPIError(w, http.StatusUnauthorized, APIErrorNotAuthorized, "This route requires the admin token")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// OpenAPISpec serves the OpenAPI document of the JSON API
+func OpenAPISpec(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(openapi.Spec)
+}
+
+// APINotFound answers unknown API routes with an error object
+func APINotFound(w http.ResponseWriter, r *http.Request) {
+	writeAPIError(w, http.StatusNotFound, APIErrorNotFound, fmt.Sprintf("No API route for %s %s", r.Method, r.URL.Path))
+}
+
+// APIMethodNotAllowed answers unsupported methods with an error object
+func APIMethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	writeAPIError(w, http.StatusMethodNotAllowed, APIErrorMethodNotAllowed, fmt.Sprintf("Method %s is not allowed on %s", r.Method, r.URL.Path))
+}
+
+// acceptsJSON reports whether an Accept header allows application/json
+func acceptsJSON(accept string) bool {
+	if strings.TrimSpace(accept) == "" {
+		return true
+	}
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		if q, ok := params["q"]; ok {
+			if weight, err := strconv.ParseFloat(q, 64); err == nil && weight == 0 {
+				continue
+			}
+		}
+		switch mediaType {
+		case "application/json", "application/*", "*/*":
+			return true
+		}
+	}
+	return false
+}
+
+// writeJSON writes a JSON response
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(v); err != nil {
+		log.Printf("Error encoding API response: %v", err)
+	}
+}
+
+// writeAPIError writes an error object
+func writeAPIError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, apiErrorResponse{Error: APIError{Status: status, Code: code, Message: message}})
+}
+
+// writeAPIValidationError writes the error object of a validation failure,
+// or an internal error when err is something else
+func writeAPIValidationError(w http.ResponseWriter, err error) {
+	var validationErr *models.ValidationError
+	if !errors.As(err, &validationErr) {
+		log.Printf("API error: %v", err)
+		writeAPIError(w, http.StatusInternalServerError, APIErrorInternal, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusUnprocessableEntity, apiErrorResponse{Error: APIError{
+		Status:  http.StatusUnprocessableEntity,
+		Code:    APIErrorValidation,
+		Message: validationErr.Message,
+		Field:   validationErr.Field,
+	}})
+}
+
+// decodeAPIRequest reads a JSON request body into v. An empty body leaves v
+// untouched. It writes the error response and returns false on failure.
+func decodeAPIRequest(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, apiMaxBodyBytes))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil && !errors.Is(err, io.EOF) {
+		writeAPIError(w, http.StatusBadRequest, APIErrorBadRequest, "Invalid JSON body: "+err.Error())
+		return false
+	}
+	return true
+}
+
+// apiURLID reads the {id} URL parameter, writing the error response and
+// returning false when it is not a number
+func apiURLID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, APIErrorBadRequest, "Invalid ID")
+		return 0, false
+	}
+	return id, true
+}
+
+// apiSessionID returns the session and the ID of its tokens, writing the
+// error response and returning false when the session is not authenticated
+func (h *Handlers) apiSessionID(w http.ResponseWriter, r *http.Request) (*sessions.Session, string, bool) {
+	session, _ := h.sessionStore.Get(r, SessionName)
+
+	sessionID, _ := session.Values[KeySessionID].(string)
+	if sessionID == "" {
+		writeAPIError(w, http.StatusUnauthorized, APIErrorNotAuthenticated, "Not authenticated, complete an authorization flow first")
+		return nil, "", false
+	}
+	if _, _, ok := h.tokenStore.Get(sessionID); !ok {
+		writeAPIError(w, http.StatusUnauthorized, APIErrorNotAuthenticated, "Session expired, complete a new authorization flow")
+		return nil, "", false
+	}
+
+	return session, sessionID, true
+}
+
+// saveAPISession saves the session, writing the error response and returning
+// false on failure
+func saveAPISession(w http.ResponseWriter, r *http.Request, session *sessions.Session) bool {
+	if err := session.Save(r, w); err != nil {
+		log.Printf("Error saving session: %v", err)
+		writeAPIError(w, http.StatusInternalServerError, APIErrorInternal, "Error saving session")
+		return false
+	}
+	return true
+}
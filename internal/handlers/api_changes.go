@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/pericles-luz/oauth2-test/internal/models"
+	"github.com/pericles-luz/oauth2-test/internal/services"
+)
+
+// apiProviderChanges is the change log of the provider documents
+type apiProviderChanges struct {
+	Recent   []models.ProviderChange    `json:"recent"` // latest change of each field or key of the session issuer
+	Versions []services.SnapshotVersion `json:"versions"`
+}
+
+// APIProviderChanges returns the versions kept of the discovery documents and
+// key sets, optionally of a single source, and the recent changes of the
+// documents of the session issuer
+func (h *Handlers) APIProviderChanges(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.sessionStore.Get(r, SessionName)
+
+	versions, err := h.historyService.Snapshots().Versions(r.URL.Query().Get("source"), apiLimit(r, 100))
+	if err != nil {
+		log.Printf("Error fetching provider snapshots: %v", err)
+		writeAPIError(w, http.StatusInternalServerError, APIErrorInternal, "Error fetching provider snapshots")
+		return
+	}
+	for i := range versions {
+		if versions[i].Summary == nil {
+			versions[i].Summary = []models.SnapshotChange{}
+		}
+		if versions[i].Diffs == nil {
+			versions[i].Diffs = []services.FieldDiff{}
+		}
+	}
+	if versions == nil {
+		versions = []services.SnapshotVersion{}
+	}
+
+	recent := h.issuerChanges(session)
+	if recent == nil {
+		recent = []models.ProviderChange{}
+	}
+
+	writeJSON(w, http.StatusOK, apiProviderChanges{Recent: recent, Versions: versions})
+}
@@ -0,0 +1,244 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/sessions"
+
+	"github.com/pericles-luz/oauth2-test/internal/models"
+)
+
+// apiConfig is the client configuration of a session. The client secret is
+// write-only: responses only tell whether one is set.
+type apiConfig struct {
+	ClientID        string   `json:"client_id"`
+	HasClientSecret bool     `json:"has_client_secret"`
+	RedirectURI     string   `json:"redirect_uri"`
+	Scopes          []string `json:"scopes"`
+	BaseURL         string   `json:"base_url"`
+	DefaultBaseURL  string   `json:"default_base_url"`
+	ProfileID       int64    `json:"profile_id,omitempty"`
+}
+
+// apiConfigInput is the body of client configuration requests
+type apiConfigInput struct {
+	ClientID     string   `json:"client_id"`
+	ClientSecret string   `json:"client_secret"`
+	RedirectURI  string   `json:"redirect_uri"`
+	Scopes       []string `json:"scopes"`
+	BaseURL      string   `json:"base_url"` // empty uses the server default
+}
+
+// apiProfile is a client profile without its secret
+type apiProfile struct {
+	*models.ClientProfile
+	ClientSecret    string `json:"client_secret,omitempty"`
+	HasClientSecret bool   `json:"has_client_secret"`
+	Active          bool   `json:"active"`
+}
+
+// apiProfileInput is the body of profile creation and update requests.
+// An omitted secret keeps the stored one.
+type apiProfileInput struct {
+	Name         string   `json:"name"`
+	ClientID     string   `json:"client_id"`
+	ClientSecret string   `json:"client_secret"`
+	RedirectURI  string   `json:"redirect_uri"`
+	Scopes       []string `json:"scopes"`
+	BaseURL      string   `json:"base_url"`
+}
+
+// APIGetConfig returns the client configuration of the session
+func (h *Handlers) APIGetConfig(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.sessionStore.Get(r, SessionName)
+	writeJSON(w, http.StatusOK, h.sessionConfig(session))
+}
+
+// APIPutConfig replaces the client configuration of the session, like the home page form
+func (h *Handlers) APIPutConfig(w http.ResponseWriter, r *http.Request) {
+	var input apiConfigInput
+	if !decodeAPIRequest(w, r, &input) {
+		return
+	}
+
+	session, _ := h.sessionStore.Get(r, SessionName)
+	if err := h.setClientConfig(session.Values, input.ClientID, input.ClientSecret, input.RedirectURI, input.Scopes, input.BaseURL); err != nil {
+		writeAPIValidationError(w, err)
+		return
+	}
+	if !saveAPISession(w, r, session) {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, h.sessionConfig(session))
+}
+
+// APIListProfiles returns the saved client profiles
+func (h *Handlers) APIListProfiles(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.sessionStore.Get(r, SessionName)
+
+	profiles, err := h.profileService.List()
+	if err != nil {
+		log.Printf("Error fetching client profiles: %v", err)
+		writeAPIError(w, http.StatusInternalServerError, APIErrorInternal, "Error fetching client profiles")
+		return
+	}
+
+	active := activeProfileID(session.Values)
+	result := make([]apiProfile, 0, len(profiles))
+	for i := range profiles {
+		result = append(result, newAPIProfile(&profiles[i], active))
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// APIGetProfile returns a client profile
+func (h *Handlers) APIGetProfile(w http.ResponseWriter, r *http.Request) {
+	profile, ok := h.apiProfileFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	session, _ := h.sessionStore.Get(r, SessionName)
+	writeJSON(w, http.StatusOK, newAPIProfile(profile, activeProfileID(session.Values)))
+}
+
+// APICreateProfile saves a new client profile
+func (h *Handlers) APICreateProfile(w http.ResponseWriter, r *http.Request) {
+	h.apiSaveProfile(w, r, &models.ClientProfile{}, http.StatusCreated)
+}
+
+// APIUpdateProfile replaces a client profile
+func (h *Handlers) APIUpdateProfile(w http.ResponseWriter, r *http.Request) {
+	profile, ok := h.apiProfileFromURL(w, r)
+	if !ok {
+		return
+	}
+	h.apiSaveProfile(w, r, profile, http.StatusOK)
+}
+
+// APIDeleteProfile removes a client profile
+func (h *Handlers) APIDeleteProfile(w http.ResponseWriter, r *http.Request) {
+	profile, ok := h.apiProfileFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.profileService.Delete(profile.ID); err != nil {
+		log.Printf("Error deleting client profile: %v", err)
+		writeAPIError(w, http.StatusInternalServerError, APIErrorInternal, "Error deleting client profile")
+		return
+	}
+
+	session, _ := h.sessionStore.Get(r, SessionName)
+	if activeProfileID(session.Values) == profile.ID {
+		delete(session.Values, KeyProfileID)
+		if !saveAPISession(w, r, session) {
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// APIUseProfile makes a profile the active client configuration of the session
+func (h *Handlers) APIUseProfile(w http.ResponseWriter, r *http.Request) {
+	profile, ok := h.apiProfileFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	session, _ := h.sessionStore.Get(r, SessionName)
+	h.applyProfile(session.Values, profile)
+	if !saveAPISession(w, r, session) {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, h.sessionConfig(session))
+}
+
+// apiSaveProfile applies a profile request body and saves the profile
+func (h *Handlers) apiSaveProfile(w http.ResponseWriter, r *http.Request, profile *models.ClientProfile, status int) {
+	var input apiProfileInput
+	if !decodeAPIRequest(w, r, &input) {
+		return
+	}
+
+	profile.Name = input.Name
+	profile.ClientID = strings.TrimSpace(input.ClientID)
+	profile.RedirectURI = strings.TrimSpace(input.RedirectURI)
+	profile.BaseURL = strings.TrimSpace(input.BaseURL)
+	profile.Scopes = input.Scopes
+	if input.ClientSecret != "" || profile.ID == 0 {
+		profile.ClientSecret = input.ClientSecret
+	}
+
+	if err := h.profileService.Save(profile); err != nil {
+		writeAPIValidationError(w, err)
+		return
+	}
+
+	// Keep the session in sync when the active profile changed
+	session, _ := h.sessionStore.Get(r, SessionName)
+	active := activeProfileID(session.Values)
+	if active == profile.ID {
+		h.applyProfile(session.Values, profile)
+		if !saveAPISession(w, r, session) {
+			return
+		}
+	}
+
+	writeJSON(w, status, newAPIProfile(profile, active))
+}
+
+// apiProfileFromURL loads the profile identified by the {id} URL parameter,
+// writing the error response and returning false when it cannot
+func (h *Handlers) apiProfileFromURL(w http.ResponseWriter, r *http.Request) (*models.ClientProfile, bool) {
+	id, ok := apiURLID(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	profile, err := h.profileService.Get(id)
+	if err != nil {
+		log.Printf("Error fetching client profile: %v", err)
+		writeAPIError(w, http.StatusInternalServerError, APIErrorInternal, "Error fetching client profile")
+		return nil, false
+	}
+	if profile == nil {
+		writeAPIError(w, http.StatusNotFound, APIErrorNotFound, fmt.Sprintf("Client profile %d not found", id))
+		return nil, false
+	}
+
+	return profile, true
+}
+
+// sessionConfig returns the client configuration stored in a session
+func (h *Handlers) sessionConfig(session *sessions.Session) apiConfig {
+	clientID, _ := session.Values[KeyClientID].(string)
+	clientSecret, _ := session.Values[KeyClientSecret].(string)
+	redirectURI, _ := session.Values[KeyRedirectURI].(string)
+	scopes, _ := session.Values[KeyScopes].(string)
+
+	return apiConfig{
+		ClientID:        clientID,
+		HasClientSecret: clientSecret != "",
+		RedirectURI:     redirectURI,
+		Scopes:          strings.Fields(scopes),
+		BaseURL:         h.issuerURL(session),
+		DefaultBaseURL:  h.baseURL,
+		ProfileID:       activeProfileID(session.Values),
+	}
+}
+
+// newAPIProfile hides the secret of a profile
+func newAPIProfile(profile *models.ClientProfile, activeID int64) apiProfile {
+	return apiProfile{
+		ClientProfile:   profile,
+		HasClientSecret: profile.ClientSecret != "",
+		Active:          profile.ID != 0 && profile.ID == activeID,
+	}
+}
@@ -0,0 +1,323 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/pericles-luz/oauth2-test/internal/models"
+	"github.com/pericles-luz/oauth2-test/internal/services"
+	"github.com/pericles-luz/oauth2-test/internal/storage"
+)
+
+// apiHistoryPage is a page of history entries
+type apiHistoryPage struct {
+	Entries []models.HistoryEntry `json:"entries"`
+	Limit   int                   `json:"limit"`
+	Offset  int                   `json:"offset"`
+	Filter  models.HistoryFilter  `json:"filter"`
+}
+
+// apiPin pins or unpins a history entry
+type apiPin struct {
+	Pinned bool `json:"pinned"`
+}
+
+// apiStats is the statistics of a time window
+type apiStats struct {
+	Window string               `json:"window"`
+	Stats  *models.HistoryStats `json:"stats"`
+}
+
+// apiSessionRow is an active server-side session
+type apiSessionRow struct {
+	models.Session
+	ClientID      string `json:"client_id,omitempty"`
+	ProfileID     int64  `json:"profile_id,omitempty"`
+	BaseURL       string `json:"base_url,omitempty"`
+	Authenticated bool   `json:"authenticated"`
+	Current       bool   `json:"current"`
+}
+
+// apiMaintenance is the retention policy, database usage and maintenance job activity
+type apiMaintenance struct {
+	Policy       models.RetentionPolicy  `json:"policy"`
+	Counts       []storage.HistoryCount  `json:"counts"`
+	DatabaseSize int64                   `json:"database_size"`
+	Runs         []models.MaintenanceRun `json:"runs"`
+}
+
+// apiPurge is the body of purge requests
+type apiPurge struct {
+	IncludePinned bool `json:"include_pinned"`
+}
+
+// APIHistory returns a page of history entries, filtered like the live history
+func (h *Handlers) APIHistory(w http.ResponseWriter, r *http.Request) {
+	page := apiHistoryPage{
+		Limit:  apiLimit(r, 50),
+		Filter: historyFilterFromRequest(r),
+	}
+	if offset, err := strconv.Atoi(r.URL.Query().Get("offset")); err == nil && offset > 0 {
+		page.Offset = offset
+	}
+
+	entries, err := h.historyService.GetHistoryFiltered(page.Filter, page.Limit, page.Offset)
+	if err != nil {
+		log.Printf("Error fetching history: %v", err)
+		writeAPIError(w, http.StatusInternalServerError, APIErrorInternal, "Error fetching history")
+		return
+	}
+	page.Entries = entries
+	if page.Entries == nil {
+		page.Entries = []models.HistoryEntry{}
+	}
+
+	writeJSON(w, http.StatusOK, page)
+}
+
+// APIHistoryEntry returns a history entry
+func (h *Handlers) APIHistoryEntry(w http.ResponseWriter, r *http.Request) {
+	entry, ok := h.apiHistoryEntry(w, r, chi.URLParam(r, "id"))
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, entry)
+}
+
+// APIHistorySnippets returns the code snippets of a history entry. Secrets are
+// replaced by placeholders unless secrets=inline is given.
+func (h *Handlers) APIHistorySnippets(w http.ResponseWriter, r *http.Request) {
+	entry, ok := h.apiHistoryEntry(w, r, chi.URLParam(r, "id"))
+	if !ok {
+		return
+	}
+
+	snippets, err := services.GenerateSnippets(entry, snippetOptions(r))
+	if err != nil {
+		log.Printf("Error generating snippets: %v", err)
+		writeAPIError(w, http.StatusInternalServerError, APIErrorInternal, "Error generating snippets")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, snippets)
+}
+
+// APIHistoryDiff compares the history entries given by the a and b query parameters
+func (h *Handlers) APIHistoryDiff(w http.ResponseWriter, r *http.Request) {
+	left, ok := h.apiHistoryEntry(w, r, r.URL.Query().Get("a"))
+	if !ok {
+		return
+	}
+	right, ok := h.apiHistoryEntry(w, r, r.URL.Query().Get("b"))
+	if !ok {
+		return
+	}
+
+	diff, err := services.DiffHistoryEntries(left, right)
+	if err != nil {
+		log.Printf("Error comparing history entries: %v", err)
+		writeAPIError(w, http.StatusInternalServerError, APIErrorInternal, "Error comparing history entries")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, diff)
+}
+
+// APIHistoryPin pins or unpins a history entry
+func (h *Handlers) APIHistoryPin(w http.ResponseWriter, r *http.Request) {
+	entry, ok := h.apiHistoryEntry(w, r, chi.URLParam(r, "id"))
+	if !ok {
+		return
+	}
+
+	var input apiPin
+	if !decodeAPIRequest(w, r, &input) {
+		return
+	}
+
+	if err := h.historyService.SetPinned(entry.ID, input.Pinned); err != nil {
+		log.Printf("Error pinning history entry: %v", err)
+		writeAPIError(w, http.StatusInternalServerError, APIErrorInternal, "Error updating history entry")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, input)
+}
+
+// APIStats returns latency and error-rate statistics for the window query parameter
+func (h *Handlers) APIStats(w http.ResponseWriter, r *http.Request) {
+	window := services.FindStatsWindow(r.URL.Query().Get("window"))
+
+	stats, err := h.statsService.GetStats(window)
+	if err != nil {
+		log.Printf("Error computing stats: %v", err)
+		writeAPIError(w, http.StatusInternalServerError, APIErrorInternal, "Error computing statistics")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, apiStats{Window: window.Key, Stats: stats})
+}
+
+// APISessions returns the active server-side sessions
+func (h *Handlers) APISessions(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.sessionStore.Get(r, SessionName)
+
+	stored, err := h.sessionStore.List()
+	if err != nil {
+		log.Printf("Error fetching sessions: %v", err)
+		writeAPIError(w, http.StatusInternalServerError, APIErrorInternal, "Error fetching sessions")
+		return
+	}
+
+	rows := make([]apiSessionRow, 0, len(stored))
+	for _, s := range stored {
+		row := apiSessionRow{Session: s, Current: h.sessionStore.IsCurrent(s, session)}
+		if values, err := h.sessionStore.Values(&s); err == nil {
+			row.ClientID, _ = values[KeyClientID].(string)
+			row.BaseURL, _ = values[KeyBaseURL].(string)
+			sessionID, _ := values[KeySessionID].(string)
+			row.Authenticated = sessionID != ""
+			row.ProfileID = activeProfileID(values)
+		}
+		rows = append(rows, row)
+	}
+
+	writeJSON(w, http.StatusOK, rows)
+}
+
+// APITerminateSession ends a session and drops the tokens it holds
+func (h *Handlers) APITerminateSession(w http.ResponseWriter, r *http.Request) {
+	id, ok := apiURLID(w, r)
+	if !ok {
+		return
+	}
+
+	stored, err := h.sessionStore.Lookup(id)
+	if err != nil {
+		log.Printf("Error fetching session: %v", err)
+		writeAPIError(w, http.StatusInternalServerError, APIErrorInternal, "Error fetching session")
+		return
+	}
+	if stored == nil {
+		writeAPIError(w, http.StatusNotFound, APIErrorNotFound, fmt.Sprintf("Session %d not found", id))
+		return
+	}
+
+	if err := h.sessionStore.Terminate(id); err != nil {
+		log.Printf("Error terminating session: %v", err)
+		writeAPIError(w, http.StatusInternalServerError, APIErrorInternal, "Error terminating session")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// APIMaintenance returns the retention policy, database usage and maintenance job activity
+func (h *Handlers) APIMaintenance(w http.ResponseWriter, r *http.Request) {
+	counts, err := h.retentionService.HistoryCounts()
+	if err != nil {
+		log.Printf("Error counting history: %v", err)
+		writeAPIError(w, http.StatusInternalServerError, APIErrorInternal, "Error counting history")
+		return
+	}
+
+	runs, err := h.retentionService.RecentRuns(apiLimit(r, 50))
+	if err != nil {
+		log.Printf("Error fetching maintenance runs: %v", err)
+		writeAPIError(w, http.StatusInternalServerError, APIErrorInternal, "Error fetching maintenance runs")
+		return
+	}
+
+	size, err := h.retentionService.DatabaseSize()
+	if err != nil {
+		log.Printf("Error reading database size: %v", err)
+	}
+
+	result := apiMaintenance{
+		Policy:       h.retentionService.Policy(),
+		Counts:       counts,
+		DatabaseSize: size,
+		Runs:         runs,
+	}
+	if result.Counts == nil {
+		result.Counts = []storage.HistoryCount{}
+	}
+	if result.Runs == nil {
+		result.Runs = []models.MaintenanceRun{}
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+// APIMaintenancePrune applies the retention policy immediately
+func (h *Handlers) APIMaintenancePrune(w http.ResponseWriter, r *http.Request) {
+	run, err := h.retentionService.Prune(models.TriggerManual)
+	writeAPIMaintenanceRun(w, run, err)
+}
+
+// APIMaintenancePurge deletes all history entries, keeping pinned ones unless include_pinned is set
+func (h *Handlers) APIMaintenancePurge(w http.ResponseWriter, r *http.Request) {
+	var input apiPurge
+	if !decodeAPIRequest(w, r, &input) {
+		return
+	}
+
+	run, err := h.retentionService.Purge(input.IncludePinned)
+	writeAPIMaintenanceRun(w, run, err)
+}
+
+// APIMaintenanceVacuum rebuilds the database file
+func (h *Handlers) APIMaintenanceVacuum(w http.ResponseWriter, r *http.Request) {
+	run, err := h.retentionService.Vacuum(models.TriggerManual)
+	writeAPIMaintenanceRun(w, run, err)
+}
+
+// writeAPIMaintenanceRun writes the outcome of a manual maintenance action.
+// A failed action is still recorded, so the run is returned with its error.
+func writeAPIMaintenanceRun(w http.ResponseWriter, run *models.MaintenanceRun, err error) {
+	if err != nil {
+		log.Printf("Maintenance %s failed: %v", run.Kind, err)
+		writeAPIError(w, http.StatusInternalServerError, APIErrorInternal, fmt.Sprintf("Maintenance %s failed: %v", run.Kind, err))
+		return
+	}
+	writeJSON(w, http.StatusOK, run)
+}
+
+// apiHistoryEntry loads the history entry with the given ID, writing the
+// error response and returning false when it cannot
+func (h *Handlers) apiHistoryEntry(w http.ResponseWriter, r *http.Request, idStr string) (*models.HistoryEntry, bool) {
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, APIErrorBadRequest, fmt.Sprintf("Invalid history ID %q", idStr))
+		return nil, false
+	}
+
+	entry, err := h.historyService.GetHistoryEntry(id)
+	if err != nil {
+		log.Printf("Error fetching history entry: %v", err)
+		writeAPIError(w, http.StatusInternalServerError, APIErrorInternal, "Error fetching history entry")
+		return nil, false
+	}
+	if entry == nil {
+		writeAPIError(w, http.StatusNotFound, APIErrorNotFound, fmt.Sprintf("History entry %d not found", id))
+		return nil, false
+	}
+
+	return entry, true
+}
+
+// apiLimit reads the limit query parameter, between 1 and 500
+func apiLimit(r *http.Request, fallback int) int {
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit < 1 {
+		return fallback
+	}
+	if limit > 500 {
+		return 500
+	}
+	return limit
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/pericles-luz/oauth2-test/internal/models"
+)
+
+// apiMonitor is the monitor configuration and its latest check results
+type apiMonitor struct {
+	Config  models.MonitorConfig  `json:"config"`
+	Webhook bool                  `json:"webhook"` // alerts are posted to a webhook
+	Checks  []models.MonitorCheck `json:"checks"`
+}
+
+// APIMonitor returns the monitor configuration and its latest check results
+func (h *Handlers) APIMonitor(w http.ResponseWriter, r *http.Request) {
+	checks, err := h.monitorService.Recent(apiLimit(r, 100))
+	if err != nil {
+		log.Printf("Error fetching monitor checks: %v", err)
+		writeAPIError(w, http.StatusInternalServerError, APIErrorInternal, "Error fetching monitor checks")
+		return
+	}
+	if checks == nil {
+		checks = []models.MonitorCheck{}
+	}
+
+	config := h.monitorService.Config()
+	writeJSON(w, http.StatusOK, apiMonitor{
+		Config:  config,
+		Webhook: config.WebhookURL != "",
+		Checks:  checks,
+	})
+}
+
+// APIRunMonitor runs every monitor check immediately. Failed checks are part
+// of the run, not an error of the request.
+func (h *Handlers) APIRunMonitor(w http.ResponseWriter, r *http.Request) {
+	run, err := h.monitorService.Run(r.Context(), models.TriggerManual)
+	if err != nil {
+		log.Printf("Monitor run failed: %v", err)
+		writeAPIError(w, http.StatusInternalServerError, APIErrorInternal, "Monitor run failed")
+		return
+	}
+	if run.Alerts == nil {
+		run.Alerts = []models.MonitorAlert{}
+	}
+	writeJSON(w, http.StatusOK, run)
+}
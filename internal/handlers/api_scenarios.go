@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"os"
+
+	"github.com/pericles-luz/oauth2-test/internal/models"
+	"github.com/pericles-luz/oauth2-test/internal/services"
+)
+
+// apiScenarioFiles is the list of scenario files
+type apiScenarioFiles struct {
+	Files []string `json:"files"`
+}
+
+// apiScenarioRun selects the scenario to run: a file of the scenario
+// directory or an inline YAML source
+type apiScenarioRun struct {
+	File   string `json:"file,omitempty"`
+	Source string `json:"source,omitempty"`
+}
+
+// APIScenarios lists the scenario files
+func (h *Handlers) APIScenarios(w http.ResponseWriter, r *http.Request) {
+	files, err := h.scenarioService.Files()
+	if err != nil {
+		writeAPIValidationError(w, err)
+		return
+	}
+	if files == nil {
+		files = []string{}
+	}
+	writeJSON(w, http.StatusOK, apiScenarioFiles{Files: files})
+}
+
+// APIRunScenario runs a scenario and returns its report. Failed steps are part
+// of the report, not an error of the request.
+func (h *Handlers) APIRunScenario(w http.ResponseWriter, r *http.Request) {
+	var input apiScenarioRun
+	if !decodeAPIRequest(w, r, &input) {
+		return
+	}
+	if (input.File == "") == (input.Source == "") {
+		writeAPIValidationError(w, &models.ValidationError{Field: "file", Message: "Give either file or source"})
+		return
+	}
+
+	var scenario *models.Scenario
+	var err error
+	field := "source"
+	if input.File != "" {
+		field = "file"
+		scenario, err = h.scenarioService.LoadFile(input.File)
+		if errors.Is(err, os.ErrNotExist) {
+			writeAPIError(w, http.StatusNotFound, APIErrorNotFound, "Scenario file not found")
+			return
+		}
+	} else {
+		scenario, err = services.ParseScenario([]byte(input.Source), services.PastedVariables)
+	}
+	if err != nil {
+		writeAPIValidationError(w, &models.ValidationError{Field: field, Message: err.Error()})
+		return
+	}
+
+	report, err := h.scenarioService.Run(r.Context(), scenario)
+	if err != nil {
+		writeAPIValidationError(w, &models.ValidationError{Field: "client", Message: err.Error()})
+		return
+	}
+	report.File = input.File
+	writeJSON(w, http.StatusOK, report)
+}
+
+// APIScopeMatrices lists the scope matrix files
+func (h *Handlers) APIScopeMatrices(w http.ResponseWriter, r *http.Request) {
+	files, err := h.scenarioService.MatrixFiles()
+	if err != nil {
+		writeAPIValidationError(w, err)
+		return
+	}
+	if files == nil {
+		files = []string{}
+	}
+	writeJSON(w, http.StatusOK, apiScenarioFiles{Files: files})
+}
+
+// APIRunScopeMatrix runs a scope matrix and returns its report. Over- and
+// under-disclosure are part of the report, not an error of the request.
+func (h *Handlers) APIRunScopeMatrix(w http.ResponseWriter, r *http.Request) {
+	var input apiScenarioRun
+	if !decodeAPIRequest(w, r, &input) {
+		return
+	}
+	if (input.File == "") == (input.Source == "") {
+		writeAPIValidationError(w, &models.ValidationError{Field: "file", Message: "Give either file or source"})
+		return
+	}
+
+	var matrix *models.ScopeMatrix
+	var err error
+	field := "source"
+	if input.File != "" {
+		field = "file"
+		matrix, err = h.scenarioService.LoadMatrixFile(input.File)
+		if errors.Is(err, os.ErrNotExist) {
+			writeAPIError(w, http.StatusNotFound, APIErrorNotFound, "Scope matrix file not found")
+			return
+		}
+	} else {
+		matrix, err = services.ParseScopeMatrix([]byte(input.Source), services.PastedVariables)
+	}
+	if err != nil {
+		writeAPIValidationError(w, &models.ValidationError{Field: field, Message: err.Error()})
+		return
+	}
+
+	report, err := h.scenarioService.RunMatrix(r.Context(), matrix)
+	if err != nil {
+		writeAPIValidationError(w, &models.ValidationError{Field: "client", Message: err.Error()})
+		return
+	}
+	report.File = input.File
+	writeJSON(w, http.StatusOK, report)
+}
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAPIRunInlineSourceVariables(t *testing.T) {
+	t.Setenv("TEST_SERVER_SECRET", "server-secret")
+	h := &Handlers{}
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		source  string
+	}{
+		{
+			name:    "scenario",
+			handler: h.APIRunScenario,
+			source:  "name: Leak\nissuer: https://${TEST_SERVER_SECRET}.example\nsteps:\n  - action: discovery\n",
+		},
+		{
+			name:    "scope matrix",
+			handler: h.APIRunScopeMatrix,
+			source:  "name: Leak\nclient:\n  client_secret: ${TEST_SERVER_SECRET}\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, _ := json.Marshal(map[string]string{"source": tt.source})
+			recorder := httptest.NewRecorder()
+			tt.handler(recorder, httptest.NewRequest(http.MethodPost, "/api/v1/run", strings.NewReader(string(body))))
+
+			if recorder.Code != http.StatusUnprocessableEntity {
+				t.Errorf("status = %d, want %d", recorder.Code, http.StatusUnprocessableEntity)
+			}
+			if strings.Contains(recorder.Body.String(), "server-secret") {
+				t.Errorf("response %s discloses the server variable", recorder.Body.String())
+			}
+			if !strings.Contains(recorder.Body.String(), "undefined environment variables: TEST_SERVER_SECRET") {
+				t.Errorf("response %s does not name the refused variable", recorder.Body.String())
+			}
+		})
+	}
+}
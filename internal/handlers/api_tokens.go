@@ -0,0 +1,399 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+
+	"github.com/pericles-luz/oauth2-test/internal/models"
+	"github.com/pericles-luz/oauth2-test/internal/services"
+)
+
+// apiFlow is a started authorization flow. The user agent must visit the
+// authorization URL; the callback completes the flow in this session.
+type apiFlow struct {
+	FlowID           string `json:"flow_id"`
+	AuthorizationURL string `json:"authorization_url"`
+	RedirectURI      string `json:"redirect_uri"`
+}
+
+// apiTokens are the tokens of a session
+type apiTokens struct {
+	AccessToken  string    `json:"access_token"`
+	TokenType    string    `json:"token_type,omitempty"`
+	RefreshToken string    `json:"refresh_token,omitempty"`
+	IDToken      string    `json:"id_token,omitempty"`
+	Expiry       time.Time `json:"expiry,omitempty"`
+}
+
+// apiSession is the authentication state of the session
+type apiSession struct {
+	Authenticated bool             `json:"authenticated"`
+	FlowID        string           `json:"flow_id,omitempty"`
+	ProfileID     int64            `json:"profile_id,omitempty"`
+	Issuer        string           `json:"issuer"`
+	Tokens        *apiTokens       `json:"tokens,omitempty"`
+	UserInfo      *models.UserInfo `json:"user_info,omitempty"`
+	AutoRefresh   bool             `json:"auto_refresh"`
+}
+
+// apiRefresh is the outcome of a refresh token grant
+type apiRefresh struct {
+	Log    *models.RefreshLogEntry `json:"log"`
+	Tokens *apiTokens              `json:"tokens"`
+}
+
+// apiAutoRefresh toggles background refresh
+type apiAutoRefresh struct {
+	Enabled bool `json:"enabled"`
+}
+
+// apiDiscovery is the discovery document of the session issuer
+type apiDiscovery struct {
+	BaseURL     string                 `json:"base_url"`
+	IssuerMatch bool                   `json:"issuer_match"` // issuer equals the base URL it was discovered from
+	Document    map[string]interface{} `json:"document"`
+}
+
+// apiJWKS is the key set of the issuer and the validation of the session ID token
+type apiJWKS struct {
+	JWKS    *services.JWKSet      `json:"jwks"`
+	IDToken *apiIDTokenValidation `json:"id_token,omitempty"`
+}
+
+// apiIDTokenValidation is the signature check of an ID token against the JWKS
+type apiIDTokenValidation struct {
+	Valid  bool                   `json:"valid"`
+	Claims map[string]interface{} `json:"claims,omitempty"`
+	Error  string                 `json:"error,omitempty"`
+}
+
+// APIStartFlow starts an authorization flow, like /auth/login, returning the
+// authorization URL instead of redirecting to it
+func (h *Handlers) APIStartFlow(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.sessionStore.Get(r, SessionName)
+
+	authURL, err := h.beginAuthorization(r, session)
+	if err != nil {
+		writeAPIValidationError(w, err)
+		return
+	}
+	if !saveAPISession(w, r, session) {
+		return
+	}
+
+	flowID, _ := session.Values[KeyFlowID].(string)
+	redirectURI, _ := session.Values[KeyRedirectURI].(string)
+	writeJSON(w, http.StatusCreated, apiFlow{
+		FlowID:           flowID,
+		AuthorizationURL: authURL,
+		RedirectURI:      redirectURI,
+	})
+}
+
+// APIGetSession returns the authentication state, tokens and user info of the session
+func (h *Handlers) APIGetSession(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.sessionStore.Get(r, SessionName)
+
+	flowID, _ := session.Values[KeyFlowID].(string)
+	result := apiSession{
+		FlowID:    flowID,
+		ProfileID: activeProfileID(session.Values),
+		Issuer:    h.issuerURL(session),
+	}
+
+	if sessionID, _ := session.Values[KeySessionID].(string); sessionID != "" {
+		if data, ok := h.tokenStore.Data(sessionID); ok {
+			result.Authenticated = true
+			result.Tokens = newAPITokens(data.Token)
+			result.UserInfo, _ = data.UserInfo.(*models.UserInfo)
+			result.AutoRefresh = data.AutoRefresh != nil
+		}
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+// APIRefresh exchanges the refresh token of the session for new tokens
+func (h *Handlers) APIRefresh(w http.ResponseWriter, r *http.Request) {
+	session, sessionID, ok := h.apiSessionID(w, r)
+	if !ok {
+		return
+	}
+
+	entry, token, err := h.refreshService.Refresh(flowContext(r, session), sessionID, h.oauthConfig(r, session), models.RefreshTriggerManual)
+	if errors.Is(err, services.ErrNoRefreshToken) {
+		writeAPIError(w, http.StatusBadRequest, APIErrorBadRequest, "No refresh token available")
+		return
+	}
+	if err != nil {
+		writeAPIError(w, http.StatusBadGateway, APIErrorUpstream, "Token refresh failed: "+err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, apiRefresh{Log: entry, Tokens: newAPITokens(token)})
+}
+
+// APIRefreshReuse runs the refresh token reuse detection scenario
+func (h *Handlers) APIRefreshReuse(w http.ResponseWriter, r *http.Request) {
+	session, sessionID, ok := h.apiSessionID(w, r)
+	if !ok {
+		return
+	}
+
+	flowID, err := services.GenerateFlowID()
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, APIErrorInternal, "Failed to generate flow ID")
+		return
+	}
+	ctx := services.WithFlowID(flowContext(r, session), flowID)
+
+	report, err := h.refreshService.TestReuse(ctx, sessionID, h.oauthConfig(r, session))
+	if errors.Is(err, services.ErrNoRefreshToken) {
+		writeAPIError(w, http.StatusBadRequest, APIErrorBadRequest, "No refresh token available")
+		return
+	}
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, APIErrorInternal, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, report)
+}
+
+// APIRevoke revokes the access token of the session and signs it out
+func (h *Handlers) APIRevoke(w http.ResponseWriter, r *http.Request) {
+	session, sessionID, ok := h.apiSessionID(w, r)
+	if !ok {
+		return
+	}
+
+	token, _, _ := h.tokenStore.Get(sessionID)
+	if err := h.revokeSession(r, session, sessionID, token.AccessToken); err != nil {
+		writeAPIError(w, http.StatusBadGateway, APIErrorUpstream, "Token revocation failed: "+err.Error())
+		return
+	}
+	if !saveAPISession(w, r, session) {
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// APIGetAutoRefresh tells whether background refresh is enabled for the session
+func (h *Handlers) APIGetAutoRefresh(w http.ResponseWriter, r *http.Request) {
+	_, sessionID, ok := h.apiSessionID(w, r)
+	if !ok {
+		return
+	}
+
+	data, _ := h.tokenStore.Data(sessionID)
+	writeJSON(w, http.StatusOK, apiAutoRefresh{Enabled: data.AutoRefresh != nil})
+}
+
+// APIPutAutoRefresh turns background refresh on or off for the session
+func (h *Handlers) APIPutAutoRefresh(w http.ResponseWriter, r *http.Request) {
+	session, sessionID, ok := h.apiSessionID(w, r)
+	if !ok {
+		return
+	}
+
+	var input apiAutoRefresh
+	if !decodeAPIRequest(w, r, &input) {
+		return
+	}
+
+	var settings *services.AutoRefresh
+	if input.Enabled {
+		flowID, _ := session.Values[KeyFlowID].(string)
+		settings = &services.AutoRefresh{
+			Client:    *h.oauthConfig(r, session),
+			FlowID:    flowID,
+			ProfileID: activeProfileID(session.Values),
+		}
+	}
+	h.tokenStore.SetAutoRefresh(sessionID, settings)
+
+	writeJSON(w, http.StatusOK, input)
+}
+
+// APIRefreshLog returns the refresh token grants of the session
+func (h *Handlers) APIRefreshLog(w http.ResponseWriter, r *http.Request) {
+	_, sessionID, ok := h.apiSessionID(w, r)
+	if !ok {
+		return
+	}
+
+	entries, err := h.refreshService.Log(sessionID, apiLimit(r, 50))
+	if err != nil {
+		log.Printf("Error fetching refresh log: %v", err)
+		writeAPIError(w, http.StatusInternalServerError, APIErrorInternal, "Error fetching refresh log")
+		return
+	}
+	if entries == nil {
+		entries = []models.RefreshLogEntry{}
+	}
+
+	writeJSON(w, http.StatusOK, entries)
+}
+
+// APITokenTimeline returns the lifetimes of the session tokens; with
+// introspect=true it also asks the introspection endpoint
+func (h *Handlers) APITokenTimeline(w http.ResponseWriter, r *http.Request) {
+	session, sessionID, ok := h.apiSessionID(w, r)
+	if !ok {
+		return
+	}
+
+	timeline, err := h.lifetimeService.Timeline(flowContext(r, session), sessionID, h.oauthConfig(r, session), r.URL.Query().Get("introspect") == "true")
+	if err != nil {
+		writeAPIError(w, http.StatusUnauthorized, APIErrorNotAuthenticated, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, timeline)
+}
+
+// APIGetExpiryProbe returns the expiry probe of the session
+func (h *Handlers) APIGetExpiryProbe(w http.ResponseWriter, r *http.Request) {
+	_, sessionID, ok := h.apiSessionID(w, r)
+	if !ok {
+		return
+	}
+
+	probe := h.lifetimeService.Probe(sessionID)
+	if probe == nil {
+		writeAPIError(w, http.StatusNotFound, APIErrorNotFound, "No expiry probe scheduled for this session")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, probe)
+}
+
+// APIScheduleExpiryProbe schedules userinfo calls around the access token expiry
+func (h *Handlers) APIScheduleExpiryProbe(w http.ResponseWriter, r *http.Request) {
+	session, sessionID, ok := h.apiSessionID(w, r)
+	if !ok {
+		return
+	}
+
+	probe, err := h.lifetimeService.ScheduleProbe(flowContext(r, session), sessionID, h.oauthConfig(r, session))
+	if err != nil {
+		writeAPIError(w, http.StatusUnprocessableEntity, APIErrorValidation, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, probe)
+}
+
+// APIDiscovery fetches the discovery document of the session issuer
+func (h *Handlers) APIDiscovery(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.sessionStore.Get(r, SessionName)
+	baseURL := h.issuerURL(session)
+
+	discovery, err := h.issuerService.Discover(flowContext(r, session), baseURL)
+	if err != nil {
+		writeAPIError(w, http.StatusBadGateway, APIErrorUpstream, "Discovery fetch failed: "+err.Error())
+		return
+	}
+
+	issuer, _ := discovery["issuer"].(string)
+	writeJSON(w, http.StatusOK, apiDiscovery{
+		BaseURL:     baseURL,
+		IssuerMatch: strings.TrimSuffix(issuer, "/") == baseURL,
+		Document:    discovery,
+	})
+}
+
+// APIDiscoveryLint lints the discovery document of the session issuer against
+// OIDC Discovery and RFC 8414 and probes its endpoints. Findings are part of
+// the report, not an error of the request.
+func (h *Handlers) APIDiscoveryLint(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.sessionStore.Get(r, SessionName)
+	baseURL := h.issuerURL(session)
+	ctx := flowContext(r, session)
+
+	discovery, err := h.issuerService.Discover(ctx, baseURL)
+	if err != nil {
+		writeAPIError(w, http.StatusBadGateway, APIErrorUpstream, "Discovery fetch failed: "+err.Error())
+		return
+	}
+
+	report := services.LintDiscovery(ctx, h.historyService, baseURL, discovery)
+	if report.Findings == nil {
+		report.Findings = []models.LintFinding{}
+	}
+	if report.Probes == nil {
+		report.Probes = []models.EndpointProbe{}
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+// APIClaims compares the claims of the session ID token with the ones
+// returned by userinfo. Differences are part of the report, not an error of
+// the request.
+func (h *Handlers) APIClaims(w http.ResponseWriter, r *http.Request) {
+	session, sessionID, ok := h.apiSessionID(w, r)
+	if !ok {
+		return
+	}
+
+	report, err := h.claimConsistency(r, session, sessionID)
+	if errors.Is(err, errNoIDToken) {
+		writeAPIError(w, http.StatusBadRequest, APIErrorBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		writeAPIError(w, http.StatusBadGateway, APIErrorUpstream, "Claim comparison failed: "+err.Error())
+		return
+	}
+	if report.Claims == nil {
+		report.Claims = []models.ClaimComparison{}
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+// APIJWKS fetches the JWKS of the session issuer and validates the ID token of the session, if any
+func (h *Handlers) APIJWKS(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.sessionStore.Get(r, SessionName)
+
+	jwksService := services.NewJWKSService(h.oauthConfig(r, session).ResolvedEndpoints().JWKS, h.historyService).WithContext(flowContext(r, session))
+	jwks, err := jwksService.FetchJWKS()
+	if err != nil {
+		writeAPIError(w, http.StatusBadGateway, APIErrorUpstream, "JWKS fetch failed: "+err.Error())
+		return
+	}
+
+	result := apiJWKS{JWKS: jwks}
+	if sessionID, _ := session.Values[KeySessionID].(string); sessionID != "" {
+		if token, _, ok := h.tokenStore.Get(sessionID); ok {
+			if idToken, _ := token.Extra("id_token").(string); idToken != "" {
+				result.IDToken = &apiIDTokenValidation{}
+				if claims, err := jwksService.GetTokenClaims(idToken); err != nil {
+					result.IDToken.Error = err.Error()
+				} else {
+					result.IDToken.Valid = true
+					result.IDToken.Claims = claims
+				}
+			}
+		}
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+// newAPITokens exposes the tokens of an oauth2.Token
+func newAPITokens(token *oauth2.Token) *apiTokens {
+	tokens := &apiTokens{
+		AccessToken:  token.AccessToken,
+		TokenType:    token.TokenType,
+		RefreshToken: token.RefreshToken,
+		Expiry:       token.Expiry,
+	}
+	tokens.IDToken, _ = token.Extra("id_token").(string)
+	return tokens
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/sessions"
+
+	"github.com/pericles-luz/oauth2-test/internal/models"
+)
+
+// providerChangesWindow is how far back the home page highlights provider changes
+const providerChangesWindow = 30 * 24 * time.Hour
+
+// ProviderChanges displays the versions kept of the discovery documents and
+// key sets, with the differences of each one to the previous version.
+// The source query parameter limits the log to a single document.
+func (h *Handlers) ProviderChanges(w http.ResponseWriter, r *http.Request) {
+	source := r.URL.Query().Get("source")
+
+	versions, err := h.historyService.Snapshots().Versions(source, 100)
+	if err != nil {
+		log.Printf("Error fetching provider snapshots: %v", err)
+	}
+
+	data := map[string]interface{}{
+		"Source":   source,
+		"Versions": versions,
+	}
+
+	if err := h.templates.ExecuteTemplate(w, "changes", data); err != nil {
+		log.Printf("Error rendering changes template: %v", err)
+		http.Error(w, "Error rendering page", http.StatusInternalServerError)
+	}
+}
+
+// issuerChanges returns the recent changes of the documents of the session issuer
+func (h *Handlers) issuerChanges(session *sessions.Session) []models.ProviderChange {
+	changes, err := h.historyService.Snapshots().IssuerChanges(h.issuerURL(session), time.Now().Add(-providerChangesWindow))
+	if err != nil {
+		log.Printf("Error fetching provider changes: %v", err)
+	}
+	return changes
+}
@@ -21,7 +21,7 @@ func (h *Handlers) Dashboard(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get tokens and user info from token store
-	tokenStore := services.GetTokenStore()
+	tokenStore := h.tokenStore
 	token, userInfoData, ok := tokenStore.Get(sessionID)
 	if !ok || token == nil {
 		http.Error(w, "Session expired. Please login again.", http.StatusUnauthorized)
@@ -52,10 +52,62 @@ func (h *Handlers) Dashboard(w http.ResponseWriter, r *http.Request) {
 		"IDToken":      idToken,
 		"UserInfo":     userInfo,
 		"Scopes":       scopesStr,
+		"BaseURL":      h.issuerURL(session),
+		"AccessExpiry": token.Expiry,
+		"AutoRefresh":  false,
+		"RefreshLead":  h.refreshService.Lead(),
 	}
 
+	if tokenData, ok := tokenStore.Data(sessionID); ok {
+		data["AutoRefresh"] = tokenData.AutoRefresh != nil
+	}
+
+	timeline, err := h.lifetimeService.Timeline(flowContext(r, session), sessionID, h.oauthConfig(r, session), false)
+	if err != nil {
+		log.Printf("Error building token timeline: %v", err)
+	}
+	data["Timeline"] = timeline
+	data["ExpiryProbe"] = map[string]interface{}{
+		"Probe":  h.lifetimeService.Probe(sessionID),
+		"Margin": h.lifetimeService.Margin(),
+	}
+
+	refreshLog, err := h.refreshService.Log(sessionID, 20)
+	if err != nil {
+		log.Printf("Error fetching refresh log: %v", err)
+	}
+	data["RefreshLog"] = refreshLog
+
 	if err := h.templates.ExecuteTemplate(w, "dashboard", data); err != nil {
 		log.Printf("Error rendering dashboard template: %v", err)
 		http.Error(w, "Error rendering page", http.StatusInternalServerError)
 	}
 }
+
+// DashboardAutoRefresh turns background token refresh on or off for the session
+func (h *Handlers) DashboardAutoRefresh(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.sessionStore.Get(r, SessionName)
+
+	sessionID, _ := session.Values[KeySessionID].(string)
+	if sessionID == "" {
+		http.Error(w, "Not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	var settings *services.AutoRefresh
+	if r.FormValue("enabled") == "true" {
+		flowID, _ := session.Values[KeyFlowID].(string)
+		settings = &services.AutoRefresh{
+			Client:    *h.oauthConfig(r, session),
+			FlowID:    flowID,
+			ProfileID: activeProfileID(session.Values),
+		}
+	}
+
+	if !h.tokenStore.SetAutoRefresh(sessionID, settings) {
+		http.Error(w, "Session expired", http.StatusUnauthorized)
+		return
+	}
+
+	http.Redirect(w, r, "/dashboard", http.StatusSeeOther)
+}
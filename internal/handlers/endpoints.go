@@ -2,10 +2,14 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"html/template"
 	"log"
 	"net/http"
 	"strings"
 
+	"github.com/gorilla/sessions"
+
 	"github.com/pericles-luz/oauth2-test/internal/models"
 	"github.com/pericles-luz/oauth2-test/internal/services"
 )
@@ -22,8 +26,7 @@ func (h *Handlers) TestRefresh(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get token from token store
-	tokenStore := services.GetTokenStore()
-	token, userInfo, ok := tokenStore.Get(sessionID)
+	token, _, ok := h.tokenStore.Get(sessionID)
 	if !ok || token == nil {
 		http.Error(w, "Session expired", http.StatusUnauthorized)
 		return
@@ -34,35 +37,15 @@ func (h *Handlers) TestRefresh(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get OAuth config
-	clientID, _ := session.Values[KeyClientID].(string)
-	clientSecret, _ := session.Values[KeyClientSecret].(string)
-	redirectURI, _ := session.Values[KeyRedirectURI].(string)
-	scopesStr, _ := session.Values[KeyScopes].(string)
-	scopes := strings.Split(scopesStr, " ")
-
-	oauthConfig := &models.OAuthConfig{
-		ClientID:     clientID,
-		ClientSecret: clientSecret,
-		RedirectURI:  redirectURI,
-		Scopes:       scopes,
-		BaseURL:      h.baseURL,
-	}
-
-	oauthService := services.NewOAuthService(oauthConfig, h.historyService)
-
-	// Refresh token
-	newToken, err := oauthService.RefreshToken(token.RefreshToken)
+	// Refresh token, recording the grant in the refresh log
+	entry, newToken, err := h.refreshService.Refresh(flowContext(r, session), sessionID, h.oauthConfig(r, session), models.RefreshTriggerManual)
 	if err != nil {
 		log.Printf("Token refresh failed: %v", err)
 		w.Header().Set("Content-Type", "text/html")
-		w.Write([]byte(`<div class="error">Token refresh falhou: ` + err.Error() + `</div>`))
+		w.Write([]byte(`<div class="error">Token refresh falhou: ` + template.HTMLEscapeString(err.Error()) + `</div>`))
 		return
 	}
 
-	// Update token store with new tokens
-	tokenStore.Store(sessionID, newToken, userInfo)
-
 	// Return success with new token info
 	w.Header().Set("Content-Type", "text/html")
 	tokenJSON, _ := json.MarshalIndent(map[string]interface{}{
@@ -72,15 +55,54 @@ func (h *Handlers) TestRefresh(w http.ResponseWriter, r *http.Request) {
 		"token_type":    "Bearer",
 	}, "", "  ")
 
+	rotation := "Refresh token mantido pelo servidor (sem rotação)"
+	if entry.Rotated {
+		rotation = "Refresh token rotacionado: " + entry.OldFingerprint + " → " + entry.NewFingerprint
+	}
+
 	w.Write([]byte(`
 		<div class="success">
 			✓ Token atualizado com sucesso!
+			<p>` + rotation + `</p>
 			<pre>` + string(tokenJSON) + `</pre>
 			<button onclick="location.reload()">Recarregar Dashboard</button>
 		</div>
 	`))
 }
 
+// TestRefreshReuse checks the refresh token rotation policy: it refreshes,
+// presents the old refresh token again, then tries the newest one. The three
+// calls share a flow ID so they can be followed in history.
+func (h *Handlers) TestRefreshReuse(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.sessionStore.Get(r, SessionName)
+
+	sessionID, _ := session.Values[KeySessionID].(string)
+	if sessionID == "" {
+		http.Error(w, "Not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	flowID, err := services.GenerateFlowID()
+	if err != nil {
+		http.Error(w, "Failed to generate flow ID", http.StatusInternalServerError)
+		return
+	}
+	ctx := services.WithFlowID(flowContext(r, session), flowID)
+
+	report, err := h.refreshService.TestReuse(ctx, sessionID, h.oauthConfig(r, session))
+	if err != nil {
+		log.Printf("Refresh token reuse test failed: %v", err)
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<div class="error">Teste de reuso falhou: ` + template.HTMLEscapeString(err.Error()) + `</div>`))
+		return
+	}
+
+	if err := h.templates.ExecuteTemplate(w, "refresh_reuse_result", report); err != nil {
+		log.Printf("Error rendering refresh reuse template: %v", err)
+		http.Error(w, "Error rendering page", http.StatusInternalServerError)
+	}
+}
+
 // TestRevoke tests token revocation
 func (h *Handlers) TestRevoke(w http.ResponseWriter, r *http.Request) {
 	session, _ := h.sessionStore.Get(r, SessionName)
@@ -93,7 +115,7 @@ func (h *Handlers) TestRevoke(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get token from token store
-	tokenStore := services.GetTokenStore()
+	tokenStore := h.tokenStore
 	token, _, ok := tokenStore.Get(sessionID)
 	if !ok || token == nil {
 		http.Error(w, "Session expired", http.StatusUnauthorized)
@@ -105,34 +127,13 @@ func (h *Handlers) TestRevoke(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get OAuth config
-	clientID, _ := session.Values[KeyClientID].(string)
-	clientSecret, _ := session.Values[KeyClientSecret].(string)
-	redirectURI, _ := session.Values[KeyRedirectURI].(string)
-	scopesStr, _ := session.Values[KeyScopes].(string)
-	scopes := strings.Split(scopesStr, " ")
-
-	oauthConfig := &models.OAuthConfig{
-		ClientID:     clientID,
-		ClientSecret: clientSecret,
-		RedirectURI:  redirectURI,
-		Scopes:       scopes,
-		BaseURL:      h.baseURL,
-	}
-
-	oauthService := services.NewOAuthService(oauthConfig, h.historyService)
-
 	// Revoke token
-	if err := oauthService.RevokeToken(token.AccessToken); err != nil {
+	if err := h.revokeSession(r, session, sessionID, token.AccessToken); err != nil {
 		log.Printf("Token revocation failed: %v", err)
 		w.Header().Set("Content-Type", "text/html")
 		w.Write([]byte(`<div class="error">Token revocation falhou: ` + err.Error() + `</div>`))
 		return
 	}
-
-	// Clear token store and session
-	tokenStore.Delete(sessionID)
-	delete(session.Values, KeySessionID)
 	session.Save(r, w)
 
 	// Return success
@@ -145,6 +146,20 @@ func (h *Handlers) TestRevoke(w http.ResponseWriter, r *http.Request) {
 	`))
 }
 
+// revokeSession revokes the access token of a session, then drops its tokens
+// and signs it out; the caller saves the session
+func (h *Handlers) revokeSession(r *http.Request, session *sessions.Session, sessionID, accessToken string) error {
+	oauthService := services.NewOAuthService(h.oauthConfig(r, session), h.historyService).WithContext(flowContext(r, session))
+	if err := oauthService.RevokeToken(accessToken); err != nil {
+		return err
+	}
+
+	// Clear token store and session
+	h.tokenStore.Delete(sessionID)
+	delete(session.Values, KeySessionID)
+	return nil
+}
+
 // TestJWKS tests JWKS fetching and JWT validation
 func (h *Handlers) TestJWKS(w http.ResponseWriter, r *http.Request) {
 	session, _ := h.sessionStore.Get(r, SessionName)
@@ -155,7 +170,7 @@ func (h *Handlers) TestJWKS(w http.ResponseWriter, r *http.Request) {
 	var idToken string
 	if sessionID != "" {
 		// Get token from token store
-		tokenStore := services.GetTokenStore()
+		tokenStore := h.tokenStore
 		token, _, ok := tokenStore.Get(sessionID)
 		if ok && token != nil {
 			if idTokenVal, ok := token.Extra("id_token").(string); ok {
@@ -164,7 +179,7 @@ func (h *Handlers) TestJWKS(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	jwksService := services.NewJWKSService(h.baseURL, h.historyService)
+	jwksService := services.NewJWKSService(h.oauthConfig(r, session).ResolvedEndpoints().JWKS, h.historyService).WithContext(flowContext(r, session))
 
 	// Fetch JWKS
 	jwks, err := jwksService.FetchJWKS()
@@ -196,40 +211,32 @@ func (h *Handlers) TestJWKS(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// TestDiscovery tests OIDC discovery endpoint
+// TestDiscovery fetches the OIDC discovery document and lints it against
+// OIDC Discovery and RFC 8414
 func (h *Handlers) TestDiscovery(w http.ResponseWriter, r *http.Request) {
-	// Get OAuth config
 	session, _ := h.sessionStore.Get(r, SessionName)
-	clientID, _ := session.Values[KeyClientID].(string)
-	clientSecret, _ := session.Values[KeyClientSecret].(string)
-	redirectURI, _ := session.Values[KeyRedirectURI].(string)
-	scopesStr, _ := session.Values[KeyScopes].(string)
-	scopes := strings.Split(scopesStr, " ")
-
-	oauthConfig := &models.OAuthConfig{
-		ClientID:     clientID,
-		ClientSecret: clientSecret,
-		RedirectURI:  redirectURI,
-		Scopes:       scopes,
-		BaseURL:      h.baseURL,
-	}
-
-	oauthService := services.NewOAuthService(oauthConfig, h.historyService)
+	baseURL := h.issuerURL(session)
 
-	// Fetch discovery document
-	discovery, err := oauthService.FetchDiscovery()
+	// Fetch discovery document, refreshing the endpoints cached for the issuer
+	discovery, err := h.issuerService.Discover(flowContext(r, session), baseURL)
 	if err != nil {
 		log.Printf("Discovery fetch failed: %v", err)
 		http.Error(w, "Discovery fetch failed: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	// Check the document against the specifications and probe its endpoints
+	report := services.LintDiscovery(flowContext(r, session), h.historyService, baseURL, discovery)
+
 	// Pretty print JSON
 	discoveryJSON, _ := json.MarshalIndent(discovery, "", "  ")
 
 	data := map[string]interface{}{
 		"Discovery":     discovery,
 		"DiscoveryJSON": string(discoveryJSON),
+		"BaseURL":       baseURL,
+		"Lint":          report,
+		"Severities":    models.Severities,
 	}
 
 	if err := h.templates.ExecuteTemplate(w, "discovery", data); err != nil {
@@ -237,3 +244,57 @@ func (h *Handlers) TestDiscovery(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Error rendering page", http.StatusInternalServerError)
 	}
 }
+
+// errNoIDToken is returned when the session tokens include no ID token
+var errNoIDToken = errors.New("the session has no ID token, request the openid scope")
+
+// claimConsistency fetches userinfo with the access token of a session and
+// compares its claims with the ID token. A failed userinfo request is
+// returned as a *services.StatusError or a plain error.
+func (h *Handlers) claimConsistency(r *http.Request, session *sessions.Session, sessionID string) (*models.ClaimConsistencyReport, error) {
+	token, _, ok := h.tokenStore.Get(sessionID)
+	if !ok || token == nil {
+		return nil, errors.New("session expired")
+	}
+	idToken, _ := token.Extra("id_token").(string)
+	if idToken == "" {
+		return nil, errNoIDToken
+	}
+
+	oauthService := services.NewOAuthService(h.oauthConfig(r, session), h.historyService).WithContext(flowContext(r, session))
+	userInfo, err := oauthService.UserInfoClaims(token.AccessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	scopes, _ := session.Values[KeyScopes].(string)
+	requested := strings.Fields(scopes)
+	tokenScope, _ := token.Extra("scope").(string)
+
+	return services.CompareClaims(idToken, userInfo, requested, services.GrantedScopes(requested, tokenScope), models.DefaultScopeClaims)
+}
+
+// TestClaims compares the claims of the ID token with the ones returned by
+// userinfo, and shows which scope produced each one
+func (h *Handlers) TestClaims(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.sessionStore.Get(r, SessionName)
+
+	sessionID, _ := session.Values[KeySessionID].(string)
+	if sessionID == "" {
+		http.Error(w, "Not authenticated. Please login first.", http.StatusUnauthorized)
+		return
+	}
+
+	data := map[string]interface{}{}
+	report, err := h.claimConsistency(r, session, sessionID)
+	if err != nil {
+		log.Printf("Claim consistency check failed: %v", err)
+		data["Error"] = err.Error()
+	}
+	data["Report"] = report
+
+	if err := h.templates.ExecuteTemplate(w, "claims", data); err != nil {
+		log.Printf("Error rendering claims template: %v", err)
+		http.Error(w, "Error rendering page", http.StatusInternalServerError)
+	}
+}
@@ -1,33 +1,75 @@
 package handlers
 
 import (
+	"context"
 	"html/template"
+	"net/http"
+	"strings"
 
 	"github.com/gorilla/sessions"
 
+	"github.com/pericles-luz/oauth2-test/internal/models"
 	"github.com/pericles-luz/oauth2-test/internal/services"
 )
 
 // Handlers holds all HTTP handlers
 type Handlers struct {
-	sessionStore   *sessions.CookieStore
-	historyService *services.HistoryService
-	templates      *template.Template
-	baseURL        string
+	sessionStore     *services.SessionStore
+	tokenStore       *services.TokenStore
+	refreshService   *services.RefreshService
+	lifetimeService  *services.LifetimeService
+	historyService   *services.HistoryService
+	retentionService *services.RetentionService
+	statsService     *services.StatsService
+	profileService   *services.ProfileService
+	issuerService    *services.IssuerService
+	scenarioService  *services.ScenarioService
+	monitorService   *services.MonitorService
+	templates        *template.Template
+	baseURL          string // default issuer, used when the session selects none
 }
 
 // NewHandlers creates a new Handlers instance
 func NewHandlers(
-	sessionStore *sessions.CookieStore,
+	sessionStore *services.SessionStore,
+	tokenStore *services.TokenStore,
+	refreshService *services.RefreshService,
+	lifetimeService *services.LifetimeService,
 	historyService *services.HistoryService,
+	retentionService *services.RetentionService,
+	statsService *services.StatsService,
+	profileService *services.ProfileService,
+	issuerService *services.IssuerService,
+	scenarioService *services.ScenarioService,
+	monitorService *services.MonitorService,
 	templates *template.Template,
 	baseURL string,
 ) *Handlers {
-	return &Handlers{
-		sessionStore:   sessionStore,
-		historyService: historyService,
-		templates:      templates,
-		baseURL:        baseURL,
+	h := &Handlers{
+		sessionStore:     sessionStore,
+		tokenStore:       tokenStore,
+		refreshService:   refreshService,
+		lifetimeService:  lifetimeService,
+		historyService:   historyService,
+		retentionService: retentionService,
+		statsService:     statsService,
+		profileService:   profileService,
+		issuerService:    issuerService,
+		scenarioService:  scenarioService,
+		monitorService:   monitorService,
+		templates:        templates,
+		baseURL:          baseURL,
+	}
+
+	// Tokens go with the session holding them, however it ends
+	sessionStore.OnEnd(h.dropSessionTokens)
+	return h
+}
+
+// dropSessionTokens deletes the tokens referenced by the values of a session
+func (h *Handlers) dropSessionTokens(values map[interface{}]interface{}) {
+	if sessionID, _ := values[KeySessionID].(string); sessionID != "" {
+		h.tokenStore.Delete(sessionID)
 	}
 }
 
@@ -41,4 +83,47 @@ const (
 	KeyCodeVerifier = "code_verifier"
 	KeyState        = "state"
 	KeySessionID    = "session_id"
+	KeyFlowID       = "flow_id"
+	KeyProfileID    = "profile_id"
+	KeyBaseURL      = "base_url"
 )
+
+// flowContext returns the request context tagged with the flow ID and client profile
+// of the session, so that every outgoing request made on its behalf is grouped in the history
+func flowContext(r *http.Request, session *sessions.Session) context.Context {
+	flowID, _ := session.Values[KeyFlowID].(string)
+	return services.WithProfileID(services.WithFlowID(r.Context(), flowID), activeProfileID(session.Values))
+}
+
+// activeProfileID returns the client profile selected in a session, or 0
+func activeProfileID(values map[interface{}]interface{}) int64 {
+	profileID, _ := values[KeyProfileID].(int64)
+	return profileID
+}
+
+// issuerURL returns the issuer base URL selected in a session, or the default one
+func (h *Handlers) issuerURL(session *sessions.Session) string {
+	if baseURL, _ := session.Values[KeyBaseURL].(string); baseURL != "" {
+		return baseURL
+	}
+	return h.baseURL
+}
+
+// oauthConfig builds the client configuration stored in a session,
+// with the endpoints discovered for its issuer
+func (h *Handlers) oauthConfig(r *http.Request, session *sessions.Session) *models.OAuthConfig {
+	clientID, _ := session.Values[KeyClientID].(string)
+	clientSecret, _ := session.Values[KeyClientSecret].(string)
+	redirectURI, _ := session.Values[KeyRedirectURI].(string)
+	scopesStr, _ := session.Values[KeyScopes].(string)
+	baseURL := h.issuerURL(session)
+
+	return &models.OAuthConfig{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RedirectURI:  redirectURI,
+		Scopes:       strings.Split(scopesStr, " "),
+		BaseURL:      baseURL,
+		Endpoints:    h.issuerService.Endpoints(flowContext(r, session), baseURL),
+	}
+}
@@ -7,6 +7,8 @@ import (
 	"strconv"
 
 	"github.com/go-chi/chi/v5"
+
+	"github.com/pericles-luz/oauth2-test/internal/services"
 )
 
 // HistoryList displays all HTTP request/response history
@@ -97,12 +99,114 @@ func (h *Handlers) HistoryDetail(w http.ResponseWriter, r *http.Request) {
 		data["PrettyResponseBody"] = string(prettyRespJSON)
 	}
 
+	// Generate copyable reproductions of the request
+	snippets, err := services.GenerateSnippets(entry, snippetOptions(r))
+	if err != nil {
+		log.Printf("Error generating snippets: %v", err)
+	}
+	data["Snippets"] = snippets
+	data["UsePlaceholders"] = snippetOptions(r).UsePlaceholders
+
 	if err := h.templates.ExecuteTemplate(w, "history_detail", data); err != nil {
 		log.Printf("Error rendering history detail template: %v", err)
 		http.Error(w, "Error rendering page", http.StatusInternalServerError)
 	}
 }
 
+// HistorySnippets renders the code snippets of a history entry (HTMX fragment)
+func (h *Handlers) HistorySnippets(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	entry, err := h.historyService.GetHistoryEntry(id)
+	if err != nil {
+		log.Printf("Error fetching history entry: %v", err)
+		http.Error(w, "Error fetching history entry", http.StatusInternalServerError)
+		return
+	}
+
+	if entry == nil {
+		http.Error(w, "History entry not found", http.StatusNotFound)
+		return
+	}
+
+	opts := snippetOptions(r)
+	snippets, err := services.GenerateSnippets(entry, opts)
+	if err != nil {
+		log.Printf("Error generating snippets: %v", err)
+		http.Error(w, "Error generating snippets", http.StatusInternalServerError)
+		return
+	}
+
+	data := map[string]interface{}{
+		"Entry":           entry,
+		"Snippets":        snippets,
+		"UsePlaceholders": opts.UsePlaceholders,
+	}
+
+	if err := h.templates.ExecuteTemplate(w, "history_snippets", data); err != nil {
+		log.Printf("Error rendering snippets template: %v", err)
+		http.Error(w, "Error rendering page", http.StatusInternalServerError)
+	}
+}
+
+// HistoryDiff displays a structural comparison between two history entries
+func (h *Handlers) HistoryDiff(w http.ResponseWriter, r *http.Request) {
+	leftID, errLeft := strconv.ParseInt(r.URL.Query().Get("a"), 10, 64)
+	rightID, errRight := strconv.ParseInt(r.URL.Query().Get("b"), 10, 64)
+	if errLeft != nil || errRight != nil {
+		http.Error(w, "Two valid history IDs are required (a and b)", http.StatusBadRequest)
+		return
+	}
+
+	left, err := h.historyService.GetHistoryEntry(leftID)
+	if err != nil {
+		log.Printf("Error fetching history entry: %v", err)
+		http.Error(w, "Error fetching history entry", http.StatusInternalServerError)
+		return
+	}
+	right, err := h.historyService.GetHistoryEntry(rightID)
+	if err != nil {
+		log.Printf("Error fetching history entry: %v", err)
+		http.Error(w, "Error fetching history entry", http.StatusInternalServerError)
+		return
+	}
+
+	if left == nil || right == nil {
+		http.Error(w, "History entry not found", http.StatusNotFound)
+		return
+	}
+
+	diff, err := services.DiffHistoryEntries(left, right)
+	if err != nil {
+		log.Printf("Error comparing history entries: %v", err)
+		http.Error(w, "Error comparing history entries", http.StatusInternalServerError)
+		return
+	}
+
+	data := map[string]interface{}{
+		"Diff":           diff,
+		"HasDifferences": diff.HasDifferences(),
+	}
+
+	if err := h.templates.ExecuteTemplate(w, "history_diff", data); err != nil {
+		log.Printf("Error rendering history diff template: %v", err)
+		http.Error(w, "Error rendering page", http.StatusInternalServerError)
+	}
+}
+
+// snippetOptions reads snippet options from the query string.
+// Secrets are replaced by placeholders unless secrets=inline is given.
+func snippetOptions(r *http.Request) services.SnippetOptions {
+	return services.SnippetOptions{
+		UsePlaceholders: r.URL.Query().Get("secrets") != "inline",
+	}
+}
+
 // isJSON checks if a string is valid JSON
 func isJSON(s string) bool {
 	var js interface{}
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pericles-luz/oauth2-test/internal/models"
+)
+
+// sseHeartbeat keeps idle connections open through proxies
+const sseHeartbeat = 15 * time.Second
+
+// historyFilterFromRequest reads the endpoint_type, flow and profile query parameters
+func historyFilterFromRequest(r *http.Request) models.HistoryFilter {
+	profileID, _ := strconv.ParseInt(r.URL.Query().Get("profile"), 10, 64)
+	return models.HistoryFilter{
+		EndpointType: r.URL.Query().Get("endpoint_type"),
+		FlowID:       r.URL.Query().Get("flow"),
+		ProfileID:    profileID,
+	}
+}
+
+// HistoryLive displays the live tail of the history, updated over Server-Sent Events
+func (h *Handlers) HistoryLive(w http.ResponseWriter, r *http.Request) {
+	filter := historyFilterFromRequest(r)
+
+	entries, err := h.historyService.GetHistoryFiltered(filter, 20, 0)
+	if err != nil {
+		log.Printf("Error fetching history: %v", err)
+		http.Error(w, "Error fetching history", http.StatusInternalServerError)
+		return
+	}
+
+	endpointTypes, err := h.historyService.GetEndpointTypes()
+	if err != nil {
+		log.Printf("Error fetching endpoint types: %v", err)
+	}
+
+	profiles, err := h.profileService.List()
+	if err != nil {
+		log.Printf("Error fetching client profiles: %v", err)
+	}
+
+	data := map[string]interface{}{
+		"Entries":       entries,
+		"Filter":        filter,
+		"EndpointTypes": endpointTypes,
+		"Profiles":      profiles,
+		"StreamQuery":   r.URL.RawQuery,
+	}
+
+	if err := h.templates.ExecuteTemplate(w, "history_live", data); err != nil {
+		log.Printf("Error rendering history live template: %v", err)
+		http.Error(w, "Error rendering page", http.StatusInternalServerError)
+	}
+}
+
+// HistoryStream streams newly logged history entries as Server-Sent Events.
+// Each event named "history" carries a rendered table row.
+func (h *Handlers) HistoryStream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	filter := historyFilterFromRequest(r)
+
+	entries, unsubscribe := h.historyService.Subscribe()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(sseHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+			flusher.Flush()
+		case entry, ok := <-entries:
+			if !ok {
+				return
+			}
+			if !filter.Matches(&entry) {
+				continue
+			}
+
+			var row bytes.Buffer
+			if err := h.templates.ExecuteTemplate(&row, "history_live_row", entry); err != nil {
+				log.Printf("Error rendering history row: %v", err)
+				continue
+			}
+
+			writeSSE(w, "history", strings.TrimSpace(row.String()))
+			flusher.Flush()
+		}
+	}
+}
+
+// writeSSE writes one event, splitting multi-line payloads into data fields
+func writeSSE(w http.ResponseWriter, event, payload string) {
+	fmt.Fprintf(w, "event: %s\n", event)
+	for _, line := range strings.Split(payload, "\n") {
+		fmt.Fprintf(w, "data: %s\n", line)
+	}
+	fmt.Fprint(w, "\n")
+}
@@ -1,11 +1,31 @@
 package handlers
 
 import (
+	"errors"
+	"html/template"
 	"log"
 	"net/http"
 	"strings"
+
+	"github.com/pericles-luz/oauth2-test/internal/models"
 )
 
+// availableScopes lists the scopes offered by the configuration forms
+var availableScopes = []struct {
+	Value    string
+	Label    string
+	Required bool
+}{
+	{"openid", "openid (obrigatório)", true},
+	{"profile", "profile - Perfil básico (nome, CPF)", false},
+	{"email", "email - Endereço de email", false},
+	{"phone", "phone - Número de telefone", false},
+	{"address", "address - Endereço", false},
+	{"membership", "membership - Status de filiação", false},
+	{"permissions", "permissions - Permissões do usuário", false},
+	{"union_unit", "union_unit - Detalhes da seccional", false},
+}
+
 // Home renders the home/configuration page
 func (h *Handlers) Home(w http.ResponseWriter, r *http.Request) {
 	session, _ := h.sessionStore.Get(r, SessionName)
@@ -16,24 +36,23 @@ func (h *Handlers) Home(w http.ResponseWriter, r *http.Request) {
 		"ClientSecret": session.Values[KeyClientSecret],
 		"RedirectURI":  session.Values[KeyRedirectURI],
 		"Scopes":       session.Values[KeyScopes],
-		"BaseURL":      h.baseURL,
+		"BaseURL":      session.Values[KeyBaseURL],
 	}
 
-	// Available scopes
-	data["AvailableScopes"] = []struct {
-		Value    string
-		Label    string
-		Required bool
-	}{
-		{"openid", "openid (obrigatório)", true},
-		{"profile", "profile - Perfil básico (nome, CPF)", false},
-		{"email", "email - Endereço de email", false},
-		{"phone", "phone - Número de telefone", false},
-		{"address", "address - Endereço", false},
-		{"membership", "membership - Status de filiação", false},
-		{"permissions", "permissions - Permissões do usuário", false},
-		{"union_unit", "union_unit - Detalhes da seccional", false},
+	data["DefaultBaseURL"] = h.baseURL
+
+	data["AvailableScopes"] = availableScopes
+
+	// Saved client profiles
+	profiles, err := h.profileService.List()
+	if err != nil {
+		log.Printf("Error fetching client profiles: %v", err)
 	}
+	data["Profiles"] = profiles
+	data["ActiveProfileID"] = activeProfileID(session.Values)
+
+	// Recent changes of the provider documents
+	data["ProviderChanges"] = h.issuerChanges(session)
 
 	if err := h.templates.ExecuteTemplate(w, "home", data); err != nil {
 		log.Printf("Error rendering home template: %v", err)
@@ -48,42 +67,25 @@ func (h *Handlers) SaveConfig(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	clientID := r.FormValue("client_id")
-	clientSecret := r.FormValue("client_secret")
-	redirectURI := r.FormValue("redirect_uri")
-	scopesStr := r.FormValue("scopes")
-
-	// Validate required fields
-	if clientID == "" || clientSecret == "" || redirectURI == "" {
-		w.Header().Set("Content-Type", "text/html")
-		w.Write([]byte(`<div class="error">Todos os campos são obrigatórios</div>`))
-		return
-	}
-
 	// Parse scopes
 	scopes := []string{}
-	if scopesStr != "" {
+	if scopesStr := r.FormValue("scopes"); scopesStr != "" {
 		scopes = strings.Split(scopesStr, ",")
 	}
 
-	// Ensure openid scope is present
-	hasOpenID := false
-	for _, scope := range scopes {
-		if strings.TrimSpace(scope) == "openid" {
-			hasOpenID = true
-			break
-		}
-	}
-	if !hasOpenID {
-		scopes = append([]string{"openid"}, scopes...)
-	}
-
 	// Save to session
 	session, _ := h.sessionStore.Get(r, SessionName)
-	session.Values[KeyClientID] = clientID
-	session.Values[KeyClientSecret] = clientSecret
-	session.Values[KeyRedirectURI] = redirectURI
-	session.Values[KeyScopes] = strings.Join(scopes, " ")
+	err := h.setClientConfig(session.Values, r.FormValue("client_id"), r.FormValue("client_secret"), r.FormValue("redirect_uri"), scopes, r.FormValue("base_url"))
+	if err != nil {
+		message := "Todos os campos são obrigatórios"
+		var validationErr *models.ValidationError
+		if errors.As(err, &validationErr) && validationErr.Field == "base_url" {
+			message = "Base URL inválida: " + validationErr.Message
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<div class="error">` + template.HTMLEscapeString(message) + `</div>`))
+		return
+	}
 
 	if err := session.Save(r, w); err != nil {
 		log.Printf("Error saving session: %v", err)
@@ -102,3 +104,52 @@ func (h *Handlers) SaveConfig(w http.ResponseWriter, r *http.Request) {
 		</div>
 	`))
 }
+
+// setClientConfig validates a manual client configuration and stores it in
+// the session values. An empty or default base URL uses the server default.
+func (h *Handlers) setClientConfig(values map[interface{}]interface{}, clientID, clientSecret, redirectURI string, scopes []string, baseURL string) error {
+	// Validate required fields
+	if clientID == "" || clientSecret == "" || redirectURI == "" {
+		return &models.ValidationError{Field: "client_id", Message: "client_id, client_secret and redirect_uri are required"}
+	}
+
+	// Validate the issuer; empty uses the server default
+	baseURL = strings.TrimSpace(baseURL)
+	if baseURL != "" {
+		normalized, err := models.NormalizeBaseURL(baseURL)
+		if err != nil {
+			return err
+		}
+		baseURL = normalized
+	}
+
+	// Ensure openid scope is present
+	cleaned := []string{}
+	hasOpenID := false
+	for _, scope := range scopes {
+		scope = strings.TrimSpace(scope)
+		if scope == "" {
+			continue
+		}
+		if scope == "openid" {
+			hasOpenID = true
+		}
+		cleaned = append(cleaned, scope)
+	}
+	if !hasOpenID {
+		cleaned = append([]string{"openid"}, cleaned...)
+	}
+
+	values[KeyClientID] = clientID
+	values[KeyClientSecret] = clientSecret
+	values[KeyRedirectURI] = redirectURI
+	values[KeyScopes] = strings.Join(cleaned, " ")
+	if baseURL == "" || baseURL == h.baseURL {
+		delete(values, KeyBaseURL)
+	} else {
+		values[KeyBaseURL] = baseURL
+	}
+	delete(values, KeyProfileID) // manual configuration, no profile
+
+	return nil
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+)
+
+// TokenTimeline renders the lifetimes of the session tokens; with
+// introspect=true it also asks the introspection endpoint
+func (h *Handlers) TokenTimeline(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.sessionStore.Get(r, SessionName)
+
+	sessionID, _ := session.Values[KeySessionID].(string)
+	if sessionID == "" {
+		http.Error(w, "Not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	timeline, err := h.lifetimeService.Timeline(flowContext(r, session), sessionID, h.oauthConfig(r, session), r.URL.Query().Get("introspect") == "true")
+	if err != nil {
+		http.Error(w, "Session expired", http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.templates.ExecuteTemplate(w, "token_timeline", timeline); err != nil {
+		log.Printf("Error rendering token timeline template: %v", err)
+		http.Error(w, "Error rendering page", http.StatusInternalServerError)
+	}
+}
+
+// ExpiryProbeStatus renders the expiry probe of the session
+func (h *Handlers) ExpiryProbeStatus(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.sessionStore.Get(r, SessionName)
+
+	sessionID, _ := session.Values[KeySessionID].(string)
+	if sessionID == "" {
+		http.Error(w, "Not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	h.renderExpiryProbe(w, sessionID)
+}
+
+// ExpiryProbeSchedule schedules userinfo calls just before and just after
+// the access token of the session expires
+func (h *Handlers) ExpiryProbeSchedule(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.sessionStore.Get(r, SessionName)
+
+	sessionID, _ := session.Values[KeySessionID].(string)
+	if sessionID == "" {
+		http.Error(w, "Not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	if _, err := h.lifetimeService.ScheduleProbe(flowContext(r, session), sessionID, h.oauthConfig(r, session)); err != nil {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<div class="error">Não foi possível agendar a verificação: ` + template.HTMLEscapeString(err.Error()) + `</div>`))
+		return
+	}
+
+	h.renderExpiryProbe(w, sessionID)
+}
+
+// renderExpiryProbe renders the expiry_probe fragment
+func (h *Handlers) renderExpiryProbe(w http.ResponseWriter, sessionID string) {
+	data := map[string]interface{}{
+		"Probe":  h.lifetimeService.Probe(sessionID),
+		"Margin": h.lifetimeService.Margin(),
+	}
+
+	if err := h.templates.ExecuteTemplate(w, "expiry_probe", data); err != nil {
+		log.Printf("Error rendering expiry probe template: %v", err)
+		http.Error(w, "Error rendering page", http.StatusInternalServerError)
+	}
+}
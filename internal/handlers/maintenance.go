@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/pericles-luz/oauth2-test/internal/models"
+)
+
+// Maintenance displays the retention policy, database usage and maintenance job activity
+func (h *Handlers) Maintenance(w http.ResponseWriter, r *http.Request) {
+	counts, err := h.retentionService.HistoryCounts()
+	if err != nil {
+		log.Printf("Error counting history: %v", err)
+		http.Error(w, "Error counting history", http.StatusInternalServerError)
+		return
+	}
+
+	runs, err := h.retentionService.RecentRuns(50)
+	if err != nil {
+		log.Printf("Error fetching maintenance runs: %v", err)
+		http.Error(w, "Error fetching maintenance runs", http.StatusInternalServerError)
+		return
+	}
+
+	size, err := h.retentionService.DatabaseSize()
+	if err != nil {
+		log.Printf("Error reading database size: %v", err)
+	}
+
+	var total, pinned int64
+	for _, count := range counts {
+		total += count.Total
+		pinned += count.Pinned
+	}
+
+	data := map[string]interface{}{
+		"Policy":       h.retentionService.Policy(),
+		"Counts":       counts,
+		"Total":        total,
+		"Pinned":       pinned,
+		"DatabaseSize": size,
+		"Runs":         runs,
+	}
+
+	if err := h.templates.ExecuteTemplate(w, "maintenance", data); err != nil {
+		log.Printf("Error rendering maintenance template: %v", err)
+		http.Error(w, "Error rendering page", http.StatusInternalServerError)
+	}
+}
+
+// MaintenancePrune applies the retention policy immediately
+func (h *Handlers) MaintenancePrune(w http.ResponseWriter, r *http.Request) {
+	run, err := h.retentionService.Prune(models.TriggerManual)
+	h.renderMaintenanceResult(w, run, err)
+}
+
+// MaintenancePurge deletes all history entries
+func (h *Handlers) MaintenancePurge(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Failed to parse form", http.StatusBadRequest)
+		return
+	}
+
+	run, err := h.retentionService.Purge(r.FormValue("include_pinned") == "true")
+	h.renderMaintenanceResult(w, run, err)
+}
+
+// MaintenanceVacuum rebuilds the database file
+func (h *Handlers) MaintenanceVacuum(w http.ResponseWriter, r *http.Request) {
+	run, err := h.retentionService.Vacuum(models.TriggerManual)
+	h.renderMaintenanceResult(w, run, err)
+}
+
+// renderMaintenanceResult renders the outcome of a manual maintenance action (HTMX fragment)
+func (h *Handlers) renderMaintenanceResult(w http.ResponseWriter, run *models.MaintenanceRun, err error) {
+	if err != nil {
+		log.Printf("Maintenance %s failed: %v", run.Kind, err)
+	}
+
+	data := map[string]interface{}{
+		"Run": run,
+	}
+
+	if err := h.templates.ExecuteTemplate(w, "maintenance_result", data); err != nil {
+		log.Printf("Error rendering maintenance result template: %v", err)
+		http.Error(w, "Error rendering page", http.StatusInternalServerError)
+	}
+}
+
+// HistoryPin pins or unpins a history entry (HTMX fragment)
+func (h *Handlers) HistoryPin(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Failed to parse form", http.StatusBadRequest)
+		return
+	}
+
+	pinned := r.FormValue("pinned") == "true"
+	if err := h.historyService.SetPinned(id, pinned); err != nil {
+		log.Printf("Error pinning history entry: %v", err)
+		http.Error(w, "Error updating history entry", http.StatusInternalServerError)
+		return
+	}
+
+	data := map[string]interface{}{
+		"ID":     id,
+		"Pinned": pinned,
+	}
+
+	if err := h.templates.ExecuteTemplate(w, "history_pin", data); err != nil {
+		log.Printf("Error rendering pin template: %v", err)
+		http.Error(w, "Error rendering page", http.StatusInternalServerError)
+	}
+}
@@ -2,8 +2,10 @@ package handlers
 
 import (
 	"context"
+	"crypto/subtle"
 	"log"
 	"net/http"
+	"strings"
 	"time"
 )
 
@@ -61,6 +63,13 @@ func (rw *responseWriter) WriteHeader(code int) {
 	rw.ResponseWriter.WriteHeader(code)
 }
 
+// Flush implements http.Flusher so streaming handlers (SSE) work behind the logger
+func (rw *responseWriter) Flush() {
+	if flusher, ok := rw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
 // RecoveryMiddleware recovers from panics and logs them
 func RecoveryMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -73,3 +82,34 @@ func RecoveryMiddleware(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// AdminMiddleware restricts pages that act on every session of the instance
+// to requests carrying the admin token, as the password of HTTP Basic
+// authentication or as a Bearer token. Without a token the pages are disabled.
+func AdminMiddleware(token string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if token == "" {
+				http.NotFound(w, r)
+				return
+			}
+			if !adminAuthorized(r, token) {
+				w.Header().Set("WWW-Authenticate", `Basic realm="admin", charset="UTF-8"`)
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// adminAuthorized reports whether a request carries the admin token
+func adminAuthorized(r *http.Request, token string) bool {
+	presented, ok := "", false
+	if _, password, basic := r.BasicAuth(); basic {
+		presented, ok = password, true
+	} else if bearer, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); found {
+		presented, ok = strings.TrimSpace(bearer), true
+	}
+	return ok && subtle.ConstantTimeCompare([]byte(presented), []byte(token)) == 1
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAdminMiddleware(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("admin"))
+	})
+
+	tests := []struct {
+		name      string
+		token     string
+		authorize func(r *http.Request)
+		status    int
+		apiCode   string
+	}{
+		{"disabled", "", func(r *http.Request) { r.SetBasicAuth("admin", "") }, http.StatusNotFound, APIErrorNotFound},
+		{"no credentials", "secret", func(r *http.Request) {}, http.StatusUnauthorized, APIErrorNotAuthorized},
+		{"wrong password", "secret", func(r *http.Request) { r.SetBasicAuth("admin", "guess") }, http.StatusUnauthorized, APIErrorNotAuthorized},
+		{"wrong bearer", "secret", func(r *http.Request) { r.Header.Set("Authorization", "Bearer secrets") }, http.StatusUnauthorized, APIErrorNotAuthorized},
+		{"basic", "secret", func(r *http.Request) { r.SetBasicAuth("anyone", "secret") }, http.StatusOK, ""},
+		{"bearer", "secret", func(r *http.Request) { r.Header.Set("Authorization", "Bearer secret") }, http.StatusOK, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			middlewares := []struct {
+				api        bool
+				middleware func(string) func(http.Handler) http.Handler
+			}{
+				{false, AdminMiddleware},
+				{true, APIAdminMiddleware},
+			}
+			for _, m := range middlewares {
+				req := httptest.NewRequest(http.MethodPost, "/maintenance/purge", nil)
+				tt.authorize(req)
+				rec := httptest.NewRecorder()
+				m.middleware(tt.token)(ok).ServeHTTP(rec, req)
+
+				if rec.Code != tt.status {
+					t.Fatalf("api = %v: status = %d, want %d", m.api, rec.Code, tt.status)
+				}
+				body := rec.Body.String()
+				if reached := body == "admin"; reached != (tt.status == http.StatusOK) {
+					t.Errorf("api = %v: body = %q, handler reached = %v", m.api, body, reached)
+				}
+				if m.api && tt.apiCode != "" && !strings.Contains(body, `"code": "`+tt.apiCode+`"`) {
+					t.Errorf("api = %v: body = %q, want code %s", m.api, body, tt.apiCode)
+				}
+			}
+		})
+	}
+}
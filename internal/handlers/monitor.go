@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/pericles-luz/oauth2-test/internal/models"
+)
+
+// Monitor displays the monitor configuration and the latest check results
+func (h *Handlers) Monitor(w http.ResponseWriter, r *http.Request) {
+	h.renderMonitor(w, map[string]interface{}{})
+}
+
+// MonitorRun runs every monitor check immediately and displays the outcome
+func (h *Handlers) MonitorRun(w http.ResponseWriter, r *http.Request) {
+	data := map[string]interface{}{}
+
+	run, err := h.monitorService.Run(r.Context(), models.TriggerManual)
+	if err != nil {
+		log.Printf("Monitor run failed: %v", err)
+		data["Error"] = err.Error()
+	}
+	data["Run"] = run
+
+	h.renderMonitor(w, data)
+}
+
+// renderMonitor renders the monitor page with the recent check results
+func (h *Handlers) renderMonitor(w http.ResponseWriter, data map[string]interface{}) {
+	checks, err := h.monitorService.Recent(100)
+	if err != nil {
+		log.Printf("Error fetching monitor checks: %v", err)
+	}
+	config := h.monitorService.Config()
+	data["Config"] = config
+	data["Webhook"] = config.WebhookURL != ""
+	data["Checks"] = checks
+
+	if err := h.templates.ExecuteTemplate(w, "monitor", data); err != nil {
+		log.Printf("Error rendering monitor template: %v", err)
+		http.Error(w, "Error rendering page", http.StatusInternalServerError)
+	}
+}
@@ -1,9 +1,12 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
-	"strings"
+
+	"github.com/gorilla/sessions"
 
 	"github.com/pericles-luz/oauth2-test/internal/models"
 	"github.com/pericles-luz/oauth2-test/internal/services"
@@ -13,33 +16,61 @@ import (
 func (h *Handlers) OAuthLogin(w http.ResponseWriter, r *http.Request) {
 	session, _ := h.sessionStore.Get(r, SessionName)
 
+	authURL, err := h.beginAuthorization(r, session)
+	if err != nil {
+		var validationErr *models.ValidationError
+		if errors.As(err, &validationErr) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Printf("Failed to start authorization: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := session.Save(r, w); err != nil {
+		log.Printf("Failed to save session: %v", err)
+		http.Error(w, "Failed to save session", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Redirecting to authorization URL: %s", authURL)
+
+	// Redirect to authorization URL
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// beginAuthorization starts a new authorization flow in the session: a flow
+// ID, state and PKCE verifier. It returns the authorization URL; the caller
+// saves the session. Configuration problems are *models.ValidationError.
+func (h *Handlers) beginAuthorization(r *http.Request, session *sessions.Session) (string, error) {
 	// Get OAuth config from session
 	clientID, _ := session.Values[KeyClientID].(string)
 	clientSecret, _ := session.Values[KeyClientSecret].(string)
 	redirectURI, _ := session.Values[KeyRedirectURI].(string)
-	scopesStr, _ := session.Values[KeyScopes].(string)
 
 	if clientID == "" || clientSecret == "" || redirectURI == "" {
-		http.Error(w, "OAuth2 configuration not found. Please configure first.", http.StatusBadRequest)
-		return
+		return "", &models.ValidationError{Field: "client_id", Message: "OAuth2 configuration not found. Please configure first."}
 	}
 
-	// Parse scopes
-	scopes := strings.Split(scopesStr, " ")
+	// Generate a flow ID grouping the requests of this authorization in the history,
+	// including the discovery of the issuer endpoints
+	flowID, err := services.GenerateFlowID()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate flow ID: %w", err)
+	}
+	session.Values[KeyFlowID] = flowID
 
 	// Create OAuth config
-	oauthConfig := &models.OAuthConfig{
-		ClientID:     clientID,
-		ClientSecret: clientSecret,
-		RedirectURI:  redirectURI,
-		Scopes:       scopes,
-		BaseURL:      h.baseURL,
-	}
+	oauthConfig := h.oauthConfig(r, session)
 
 	// Validate config
 	if err := oauthConfig.Validate(); err != nil {
-		http.Error(w, "Invalid OAuth configuration: "+err.Error(), http.StatusBadRequest)
-		return
+		var validationErr *models.ValidationError
+		if errors.As(err, &validationErr) {
+			return "", &models.ValidationError{Field: validationErr.Field, Message: "Invalid OAuth configuration: " + validationErr.Message}
+		}
+		return "", err
 	}
 
 	// Create OAuth service
@@ -48,32 +79,20 @@ func (h *Handlers) OAuthLogin(w http.ResponseWriter, r *http.Request) {
 	// Generate state for CSRF protection
 	state, err := services.GenerateRandomState()
 	if err != nil {
-		log.Printf("Failed to generate state: %v", err)
-		http.Error(w, "Failed to generate state", http.StatusInternalServerError)
-		return
+		return "", fmt.Errorf("failed to generate state: %w", err)
 	}
 
 	// Generate auth URL with PKCE
 	authURL, verifier, err := oauthService.GenerateAuthURL(state)
 	if err != nil {
-		log.Printf("Failed to generate auth URL: %v", err)
-		http.Error(w, "Failed to generate authorization URL", http.StatusInternalServerError)
-		return
+		return "", fmt.Errorf("failed to generate authorization URL: %w", err)
 	}
 
 	// Store state and verifier in session
 	session.Values[KeyState] = state
 	session.Values[KeyCodeVerifier] = verifier
-	if err := session.Save(r, w); err != nil {
-		log.Printf("Failed to save session: %v", err)
-		http.Error(w, "Failed to save session", http.StatusInternalServerError)
-		return
-	}
-
-	log.Printf("Redirecting to authorization URL: %s", authURL)
 
-	// Redirect to authorization URL
-	http.Redirect(w, r, authURL, http.StatusFound)
+	return authURL, nil
 }
 
 // OAuthCallback handles the OAuth2 callback
@@ -113,23 +132,11 @@ func (h *Handlers) OAuthCallback(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get OAuth config from session
-	clientID, _ := session.Values[KeyClientID].(string)
-	clientSecret, _ := session.Values[KeyClientSecret].(string)
-	redirectURI, _ := session.Values[KeyRedirectURI].(string)
-	scopesStr, _ := session.Values[KeyScopes].(string)
-	scopes := strings.Split(scopesStr, " ")
-
-	oauthConfig := &models.OAuthConfig{
-		ClientID:     clientID,
-		ClientSecret: clientSecret,
-		RedirectURI:  redirectURI,
-		Scopes:       scopes,
-		BaseURL:      h.baseURL,
-	}
+	// Get OAuth config
+	oauthConfig := h.oauthConfig(r, session)
 
 	// Create OAuth service
-	oauthService := services.NewOAuthService(oauthConfig, h.historyService)
+	oauthService := services.NewOAuthService(oauthConfig, h.historyService).WithContext(flowContext(r, session))
 
 	// Exchange code for tokens
 	log.Printf("Exchanging code for tokens...")
@@ -163,10 +170,10 @@ func (h *Handlers) OAuthCallback(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Store tokens and user info in token store
-	tokenStore := services.GetTokenStore()
+	tokenStore := h.tokenStore
 	tokenStore.Store(sessionID, token, userInfo)
 
-	// Store only the session ID in the cookie session
+	// Store only the session ID in the session
 	session.Values[KeySessionID] = sessionID
 
 	if err := session.Save(r, w); err != nil {
@@ -0,0 +1,218 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/pericles-luz/oauth2-test/internal/models"
+)
+
+// ProfileList displays the saved client profiles
+func (h *Handlers) ProfileList(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.sessionStore.Get(r, SessionName)
+
+	profiles, err := h.profileService.List()
+	if err != nil {
+		log.Printf("Error fetching client profiles: %v", err)
+		http.Error(w, "Error fetching client profiles", http.StatusInternalServerError)
+		return
+	}
+
+	data := map[string]interface{}{
+		"Profiles":        profiles,
+		"ActiveProfileID": activeProfileID(session.Values),
+		"DefaultBaseURL":  h.baseURL,
+	}
+
+	if err := h.templates.ExecuteTemplate(w, "profiles", data); err != nil {
+		log.Printf("Error rendering profiles template: %v", err)
+		http.Error(w, "Error rendering page", http.StatusInternalServerError)
+	}
+}
+
+// ProfileForm displays the form to create a profile, or to edit one when the URL has an ID
+func (h *Handlers) ProfileForm(w http.ResponseWriter, r *http.Request) {
+	profile := &models.ClientProfile{
+		RedirectURI: "http://localhost:8080/auth/callback",
+		Scopes:      []string{"openid"},
+	}
+
+	if chi.URLParam(r, "id") != "" {
+		var ok bool
+		if profile, ok = h.profileFromURL(w, r); !ok {
+			return
+		}
+	}
+
+	h.renderProfileForm(w, profile, "")
+}
+
+// ProfileSave creates or updates a profile from the submitted form
+func (h *Handlers) ProfileSave(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Failed to parse form", http.StatusBadRequest)
+		return
+	}
+
+	profile := &models.ClientProfile{}
+	if chi.URLParam(r, "id") != "" {
+		var ok bool
+		if profile, ok = h.profileFromURL(w, r); !ok {
+			return
+		}
+	}
+
+	profile.Name = r.FormValue("name")
+	profile.ClientID = strings.TrimSpace(r.FormValue("client_id"))
+	profile.RedirectURI = strings.TrimSpace(r.FormValue("redirect_uri"))
+	profile.BaseURL = strings.TrimSpace(r.FormValue("base_url"))
+	profile.Scopes = append(r.Form["scopes"], r.FormValue("extra_scopes"))
+
+	// An empty secret on edit keeps the stored one
+	if secret := r.FormValue("client_secret"); secret != "" || profile.ID == 0 {
+		profile.ClientSecret = secret
+	}
+
+	if err := h.profileService.Save(profile); err != nil {
+		var validationErr *models.ValidationError
+		if errors.As(err, &validationErr) {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			h.renderProfileForm(w, profile, validationErr.Message)
+			return
+		}
+		log.Printf("Error saving client profile: %v", err)
+		http.Error(w, "Error saving client profile", http.StatusInternalServerError)
+		return
+	}
+
+	// Keep the session in sync when the active profile changed
+	session, _ := h.sessionStore.Get(r, SessionName)
+	if activeProfileID(session.Values) == profile.ID {
+		h.applyProfile(session.Values, profile)
+		if err := session.Save(r, w); err != nil {
+			log.Printf("Error saving session: %v", err)
+		}
+	}
+
+	http.Redirect(w, r, "/profiles", http.StatusSeeOther)
+}
+
+// ProfileDelete removes a profile
+func (h *Handlers) ProfileDelete(w http.ResponseWriter, r *http.Request) {
+	profile, ok := h.profileFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.profileService.Delete(profile.ID); err != nil {
+		log.Printf("Error deleting client profile: %v", err)
+		http.Error(w, "Error deleting client profile", http.StatusInternalServerError)
+		return
+	}
+
+	session, _ := h.sessionStore.Get(r, SessionName)
+	if activeProfileID(session.Values) == profile.ID {
+		delete(session.Values, KeyProfileID)
+		if err := session.Save(r, w); err != nil {
+			log.Printf("Error saving session: %v", err)
+		}
+	}
+
+	http.Redirect(w, r, "/profiles", http.StatusSeeOther)
+}
+
+// ProfileUse makes a profile the active client configuration of the session
+func (h *Handlers) ProfileUse(w http.ResponseWriter, r *http.Request) {
+	profile, ok := h.profileFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	session, _ := h.sessionStore.Get(r, SessionName)
+	h.applyProfile(session.Values, profile)
+	if err := session.Save(r, w); err != nil {
+		log.Printf("Error saving session: %v", err)
+		http.Error(w, "Error saving configuration", http.StatusInternalServerError)
+		return
+	}
+
+	redirect := r.FormValue("redirect")
+	if redirect != "/auth/login" {
+		redirect = "/"
+	}
+	http.Redirect(w, r, redirect, http.StatusSeeOther)
+}
+
+// applyProfile copies a profile into the client configuration keys of a session
+func (h *Handlers) applyProfile(values map[interface{}]interface{}, profile *models.ClientProfile) {
+	values[KeyProfileID] = profile.ID
+	values[KeyClientID] = profile.ClientID
+	values[KeyClientSecret] = profile.ClientSecret
+	values[KeyRedirectURI] = profile.RedirectURI
+	values[KeyScopes] = profile.ScopeString()
+	if profile.BaseURL != "" {
+		values[KeyBaseURL] = profile.BaseURL
+	} else {
+		delete(values, KeyBaseURL)
+	}
+}
+
+// profileFromURL loads the profile identified by the {id} URL parameter,
+// writing an error response and returning false when it cannot
+func (h *Handlers) profileFromURL(w http.ResponseWriter, r *http.Request) (*models.ClientProfile, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	profile, err := h.profileService.Get(id)
+	if err != nil {
+		log.Printf("Error fetching client profile: %v", err)
+		http.Error(w, "Error fetching client profile", http.StatusInternalServerError)
+		return nil, false
+	}
+	if profile == nil {
+		http.Error(w, fmt.Sprintf("Client profile %d not found", id), http.StatusNotFound)
+		return nil, false
+	}
+
+	return profile, true
+}
+
+// renderProfileForm renders the profile form with an optional error message
+func (h *Handlers) renderProfileForm(w http.ResponseWriter, profile *models.ClientProfile, errorMessage string) {
+	// Scopes that are not offered as checkboxes go to the free text field
+	var extraScopes []string
+	for _, scope := range profile.Scopes {
+		known := false
+		for _, available := range availableScopes {
+			if available.Value == scope {
+				known = true
+				break
+			}
+		}
+		if !known {
+			extraScopes = append(extraScopes, scope)
+		}
+	}
+
+	data := map[string]interface{}{
+		"Profile":         profile,
+		"AvailableScopes": availableScopes,
+		"ExtraScopes":     strings.Join(extraScopes, " "),
+		"DefaultBaseURL":  h.baseURL,
+		"Error":           errorMessage,
+	}
+
+	if err := h.templates.ExecuteTemplate(w, "profile_form", data); err != nil {
+		log.Printf("Error rendering profile form template: %v", err)
+		http.Error(w, "Error rendering page", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"html/template"
+	"log"
+	"net/http"
+
+	"github.com/pericles-luz/oauth2-test/internal/models"
+	"github.com/pericles-luz/oauth2-test/internal/services"
+)
+
+// ScenarioList displays the scenario files and a form to run a pasted scenario
+func (h *Handlers) ScenarioList(w http.ResponseWriter, r *http.Request) {
+	h.renderScenarios(w, map[string]interface{}{})
+}
+
+// ScenarioRun runs a scenario file, or the YAML pasted in the form, and
+// displays its report
+func (h *Handlers) ScenarioRun(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+
+	file := r.FormValue("file")
+	source := r.FormValue("source")
+	data := map[string]interface{}{
+		"File":   file,
+		"Source": source,
+	}
+
+	var scenario *models.Scenario
+	var err error
+	if file != "" {
+		scenario, err = h.scenarioService.LoadFile(file)
+	} else {
+		scenario, err = services.ParseScenario([]byte(source), services.PastedVariables)
+	}
+	var report *models.ScenarioReport
+	if err == nil {
+		report, err = h.scenarioService.Run(r.Context(), scenario)
+	}
+	if err != nil {
+		data["Error"] = err.Error()
+		h.renderScenarios(w, data)
+		return
+	}
+
+	report.File = file
+	data["Report"] = report
+	data["JUnitURL"], data["JSONURL"] = scenarioDownloads(report)
+	h.renderScenarios(w, data)
+}
+
+// renderScenarios renders the scenarios page with the files available
+func (h *Handlers) renderScenarios(w http.ResponseWriter, data map[string]interface{}) {
+	files, err := h.scenarioService.Files()
+	if err != nil {
+		log.Printf("Error listing scenario files: %v", err)
+	}
+	data["Files"] = files
+	data["Actions"] = models.ScenarioActions
+
+	if err := h.templates.ExecuteTemplate(w, "scenarios", data); err != nil {
+		log.Printf("Error rendering scenarios template: %v", err)
+		http.Error(w, "Error rendering page", http.StatusInternalServerError)
+	}
+}
+
+// scenarioDownloads returns data URLs with the JUnit XML and JSON reports of a
+// run, so they can be downloaded without storing them
+func scenarioDownloads(report *models.ScenarioReport) (junitURL, jsonURL template.URL) {
+	reports := []models.ScenarioReport{*report}
+
+	var junit bytes.Buffer
+	if err := services.WriteJUnitReport(&junit, reports); err != nil {
+		log.Printf("Error writing JUnit report: %v", err)
+	}
+	encoded, err := json.MarshalIndent(reports, "", "  ")
+	if err != nil {
+		log.Printf("Error writing JSON report: %v", err)
+	}
+
+	junitURL = template.URL("data:application/xml;base64," + base64.StdEncoding.EncodeToString(junit.Bytes()))
+	jsonURL = template.URL("data:application/json;base64," + base64.StdEncoding.EncodeToString(encoded))
+	return junitURL, jsonURL
+}
+
+// ScopeMatrixList displays the scope matrix files and a form to run a pasted matrix
+func (h *Handlers) ScopeMatrixList(w http.ResponseWriter, r *http.Request) {
+	h.renderScopeMatrix(w, map[string]interface{}{})
+}
+
+// ScopeMatrixRun runs a scope matrix file, or the YAML pasted in the form,
+// and displays the disclosure of each scope combination
+func (h *Handlers) ScopeMatrixRun(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+
+	file := r.FormValue("file")
+	source := r.FormValue("source")
+	data := map[string]interface{}{
+		"File":   file,
+		"Source": source,
+	}
+
+	var matrix *models.ScopeMatrix
+	var err error
+	if file != "" {
+		matrix, err = h.scenarioService.LoadMatrixFile(file)
+	} else {
+		matrix, err = services.ParseScopeMatrix([]byte(source), services.PastedVariables)
+	}
+	var report *models.ScopeMatrixReport
+	if err == nil {
+		report, err = h.scenarioService.RunMatrix(r.Context(), matrix)
+	}
+	if err != nil {
+		data["Error"] = err.Error()
+		h.renderScopeMatrix(w, data)
+		return
+	}
+
+	report.File = file
+	data["Report"] = report
+	encoded, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		log.Printf("Error writing JSON report: %v", err)
+	}
+	data["JSONURL"] = template.URL("data:application/json;base64," + base64.StdEncoding.EncodeToString(encoded))
+	h.renderScopeMatrix(w, data)
+}
+
+// renderScopeMatrix renders the scope matrix page with the files available
+func (h *Handlers) renderScopeMatrix(w http.ResponseWriter, data map[string]interface{}) {
+	files, err := h.scenarioService.MatrixFiles()
+	if err != nil {
+		log.Printf("Error listing scope matrix files: %v", err)
+	}
+	data["Files"] = files
+
+	if err := h.templates.ExecuteTemplate(w, "scope_matrix", data); err != nil {
+		log.Printf("Error rendering scope matrix template: %v", err)
+		http.Error(w, "Error rendering page", http.StatusInternalServerError)
+	}
+}
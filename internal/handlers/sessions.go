@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/pericles-luz/oauth2-test/internal/models"
+)
+
+// sessionRow is an active session as shown on the sessions page
+type sessionRow struct {
+	models.Session
+	ClientID      string
+	ProfileName   string
+	BaseURL       string
+	Authenticated bool
+	Current       bool
+}
+
+// SessionList displays the active server-side sessions
+func (h *Handlers) SessionList(w http.ResponseWriter, r *http.Request) {
+	session, _ := h.sessionStore.Get(r, SessionName)
+
+	stored, err := h.sessionStore.List()
+	if err != nil {
+		log.Printf("Error fetching sessions: %v", err)
+		http.Error(w, "Error fetching sessions", http.StatusInternalServerError)
+		return
+	}
+
+	rows := make([]sessionRow, 0, len(stored))
+	for _, s := range stored {
+		row := sessionRow{Session: s, Current: h.sessionStore.IsCurrent(s, session)}
+		if values, err := h.sessionStore.Values(&s); err == nil {
+			row.ClientID, _ = values[KeyClientID].(string)
+			row.BaseURL, _ = values[KeyBaseURL].(string)
+			sessionID, _ := values[KeySessionID].(string)
+			row.Authenticated = sessionID != ""
+			if id := activeProfileID(values); id != 0 {
+				if profile, err := h.profileService.Get(id); err == nil && profile != nil {
+					row.ProfileName = profile.Name
+				}
+			}
+		}
+		rows = append(rows, row)
+	}
+
+	data := map[string]interface{}{
+		"Sessions":        rows,
+		"IdleTimeout":     h.sessionStore.IdleTimeout,
+		"AbsoluteTimeout": h.sessionStore.AbsoluteTimeout,
+		"DefaultBaseURL":  h.baseURL,
+	}
+
+	if err := h.templates.ExecuteTemplate(w, "sessions", data); err != nil {
+		log.Printf("Error rendering sessions template: %v", err)
+		http.Error(w, "Error rendering page", http.StatusInternalServerError)
+	}
+}
+
+// SessionTerminate ends a session and drops the tokens it holds
+func (h *Handlers) SessionTerminate(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	stored, err := h.sessionStore.Lookup(id)
+	if err != nil {
+		log.Printf("Error fetching session: %v", err)
+		http.Error(w, "Error fetching session", http.StatusInternalServerError)
+		return
+	}
+	if stored == nil {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+
+	if err := h.sessionStore.Terminate(id); err != nil {
+		log.Printf("Error terminating session: %v", err)
+		http.Error(w, "Error terminating session", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/sessions", http.StatusSeeOther)
+}
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/pericles-luz/oauth2-test/internal/services"
+)
+
+// Stats displays latency and error-rate statistics per endpoint type
+func (h *Handlers) Stats(w http.ResponseWriter, r *http.Request) {
+	window := services.FindStatsWindow(r.URL.Query().Get("window"))
+
+	stats, err := h.statsService.GetStats(window)
+	if err != nil {
+		log.Printf("Error computing stats: %v", err)
+		http.Error(w, "Error computing statistics", http.StatusInternalServerError)
+		return
+	}
+
+	// Scale references for the charts
+	var maxCount int
+	for _, bucket := range stats.Buckets {
+		if bucket.Count > maxCount {
+			maxCount = bucket.Count
+		}
+	}
+	var maxLatency int64
+	for _, endpoint := range stats.Endpoints {
+		if endpoint.P99 > maxLatency {
+			maxLatency = endpoint.P99
+		}
+	}
+
+	data := map[string]interface{}{
+		"Stats":      stats,
+		"Window":     window,
+		"Windows":    services.StatsWindows,
+		"MaxCount":   maxCount,
+		"MaxLatency": maxLatency,
+	}
+
+	if err := h.templates.ExecuteTemplate(w, "stats", data); err != nil {
+		log.Printf("Error rendering stats template: %v", err)
+		http.Error(w, "Error rendering page", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,78 @@
+package models
+
+import "time"
+
+// ScopeClaims are the claims released by a scope: Expected ones must come
+// back when the scope is granted, Optional ones may
+type ScopeClaims struct {
+	Scope    string   `yaml:"scope" json:"scope"`
+	Expected []string `yaml:"expected" json:"expected"`
+	Optional []string `yaml:"optional" json:"optional,omitempty"`
+}
+
+// DefaultScopeClaims maps the scopes offered by the Sindireceita server to
+// the claims each one releases
+var DefaultScopeClaims = []ScopeClaims{
+	{Scope: "openid", Expected: []string{"sub"}},
+	{Scope: "profile", Expected: []string{"name", "cpf"}, Optional: []string{
+		"given_name", "family_name", "middle_name", "nickname", "preferred_username",
+		"profile", "picture", "website", "gender", "birthdate", "zoneinfo", "locale", "updated_at",
+	}},
+	{Scope: "email", Expected: []string{"email", "email_verified"}},
+	{Scope: "phone", Expected: []string{"phone_number", "phone_number_verified"}},
+	{Scope: "address", Expected: []string{"address"}},
+	{Scope: "membership", Expected: []string{"membership_status", "membership_type", "employment_status"}},
+	{Scope: "permissions", Expected: []string{"permissions"}},
+	{Scope: "union_unit", Expected: []string{"union_unit"}},
+}
+
+// Claim comparison outcomes
+const (
+	ClaimMatch        = "match"         // same value in the ID token and userinfo
+	ClaimDiffers      = "differs"       // different values in the ID token and userinfo
+	ClaimIDTokenOnly  = "id_token_only" // only in the ID token
+	ClaimUserInfoOnly = "userinfo_only" // only in the userinfo response
+	ClaimMissing      = "missing"       // expected from a granted scope, in neither
+)
+
+// ClaimComparison is a claim as found in the ID token and in the userinfo response.
+// Values are JSON encoded, except strings.
+type ClaimComparison struct {
+	Claim    string `json:"claim"`
+	Scope    string `json:"scope,omitempty"` // scope releasing the claim, empty when none maps it
+	Status   string `json:"status"`
+	IDToken  string `json:"id_token,omitempty"`
+	UserInfo string `json:"userinfo,omitempty"`
+}
+
+// ScopeClaimsResult is what a scope produced
+type ScopeClaimsResult struct {
+	Scope     string   `json:"scope"`
+	Requested bool     `json:"requested"`
+	Granted   bool     `json:"granted"` // the requested scopes, unless the token response says otherwise
+	Claims    []string `json:"claims"`  // returned in the ID token or userinfo
+	Missing   []string `json:"missing"` // expected and returned by neither
+}
+
+// ClaimConsistencyReport compares the claims of the ID token with the ones
+// returned by userinfo. OIDC Core §5.3.2 requires the same sub in both.
+type ClaimConsistencyReport struct {
+	SubjectMatch bool                `json:"subject_match"`
+	IDTokenSub   string              `json:"id_token_sub"`
+	UserInfoSub  string              `json:"userinfo_sub"`
+	Passed       bool                `json:"passed"` // subjects match, no claim differs or is missing
+	Claims       []ClaimComparison   `json:"claims"`
+	Scopes       []ScopeClaimsResult `json:"scopes"`
+	CheckedAt    time.Time           `json:"checked_at"`
+}
+
+// Count returns the number of claims with a comparison outcome
+func (r *ClaimConsistencyReport) Count(status string) int {
+	count := 0
+	for _, claim := range r.Claims {
+		if claim.Status == status {
+			count++
+		}
+	}
+	return count
+}
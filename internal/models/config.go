@@ -1,12 +1,89 @@
 package models
 
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
 // OAuthConfig holds the OAuth2 client configuration
 type OAuthConfig struct {
-	ClientID     string   `json:"client_id"`
-	ClientSecret string   `json:"client_secret"`
-	RedirectURI  string   `json:"redirect_uri"`
-	Scopes       []string `json:"scopes"`
-	BaseURL      string   `json:"base_url"`
+	ClientID     string          `json:"client_id"`
+	ClientSecret string          `json:"client_secret"`
+	RedirectURI  string          `json:"redirect_uri"`
+	Scopes       []string        `json:"scopes"`
+	BaseURL      string          `json:"base_url"`
+	Endpoints    IssuerEndpoints `json:"endpoints"` // empty fields use DefaultEndpoints(BaseURL)
+}
+
+// IssuerEndpoints holds the endpoint URLs of an authorization server
+type IssuerEndpoints struct {
+	Authorization string `json:"authorization_endpoint"`
+	Token         string `json:"token_endpoint"`
+	UserInfo      string `json:"userinfo_endpoint"`
+	Revocation    string `json:"revocation_endpoint"`
+	Introspection string `json:"introspection_endpoint"`
+	JWKS          string `json:"jwks_uri"`
+}
+
+// DefaultEndpoints returns the Sindireceita endpoint layout under a base URL
+func DefaultEndpoints(baseURL string) IssuerEndpoints {
+	return IssuerEndpoints{
+		Authorization: baseURL + "/oauth2/authorize",
+		Token:         baseURL + "/oauth2/token",
+		UserInfo:      baseURL + "/oauth2/userinfo",
+		Revocation:    baseURL + "/oauth2/revoke",
+		Introspection: baseURL + "/oauth2/introspect",
+		JWKS:          baseURL + "/oauth2/jwks",
+	}
+}
+
+// Merge fills the empty endpoints with those of defaults
+func (e IssuerEndpoints) Merge(defaults IssuerEndpoints) IssuerEndpoints {
+	pick := func(value, fallback string) string {
+		if value != "" {
+			return value
+		}
+		return fallback
+	}
+	return IssuerEndpoints{
+		Authorization: pick(e.Authorization, defaults.Authorization),
+		Token:         pick(e.Token, defaults.Token),
+		UserInfo:      pick(e.UserInfo, defaults.UserInfo),
+		Revocation:    pick(e.Revocation, defaults.Revocation),
+		Introspection: pick(e.Introspection, defaults.Introspection),
+		JWKS:          pick(e.JWKS, defaults.JWKS),
+	}
+}
+
+// ResolvedEndpoints returns the configured endpoints, completed with the defaults of BaseURL
+func (c *OAuthConfig) ResolvedEndpoints() IssuerEndpoints {
+	return c.Endpoints.Merge(DefaultEndpoints(c.BaseURL))
+}
+
+// NormalizeBaseURL validates an issuer base URL and removes its trailing slash.
+// It must be an absolute http(s) URL without query string or fragment.
+func NormalizeBaseURL(raw string) (string, error) {
+	raw = strings.TrimRight(strings.TrimSpace(raw), "/")
+	if raw == "" {
+		return "", &ValidationError{Field: "base_url", Message: "Base URL is required"}
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", &ValidationError{Field: "base_url", Message: fmt.Sprintf("Invalid base URL: %v", err)}
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", &ValidationError{Field: "base_url", Message: "Base URL must use http or https"}
+	}
+	if u.Host == "" {
+		return "", &ValidationError{Field: "base_url", Message: "Base URL must include a host"}
+	}
+	if u.RawQuery != "" || u.Fragment != "" {
+		return "", &ValidationError{Field: "base_url", Message: "Base URL must not have a query string or fragment"}
+	}
+
+	return raw, nil
 }
 
 // Validate checks if the configuration is valid
@@ -20,6 +97,11 @@ func (c *OAuthConfig) Validate() error {
 	if c.RedirectURI == "" {
 		return &ValidationError{Field: "redirect_uri", Message: "Redirect URI is required"}
 	}
+	if c.BaseURL != "" {
+		if _, err := NormalizeBaseURL(c.BaseURL); err != nil {
+			return err
+		}
+	}
 	if len(c.Scopes) == 0 {
 		return &ValidationError{Field: "scopes", Message: "At least one scope is required"}
 	}
@@ -0,0 +1,53 @@
+package models
+
+import "time"
+
+// Lint finding severities, from the most serious
+const (
+	SeverityError   = "error"   // breaks a MUST of the specifications
+	SeverityWarning = "warning" // breaks a SHOULD or a security recommendation
+	SeverityInfo    = "info"    // worth knowing, e.g. a default applied to a missing field
+)
+
+// Severities lists the lint finding severities, from the most serious
+var Severities = []string{SeverityError, SeverityWarning, SeverityInfo}
+
+// LintFinding is a problem found in a discovery document
+type LintFinding struct {
+	Severity  string `json:"severity"`
+	Rule      string `json:"rule"` // e.g. "required", "https", "pkce"
+	Field     string `json:"field,omitempty"`
+	Message   string `json:"message"`
+	Reference string `json:"reference"` // specification section, e.g. "OIDC Discovery §3"
+}
+
+// EndpointProbe is how an advertised endpoint answered a plain GET.
+// Status is 0 when no response came back.
+type EndpointProbe struct {
+	Field      string `json:"field"`
+	URL        string `json:"url"`
+	Status     int    `json:"status"`
+	DurationMs int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+}
+
+// DiscoveryLintReport is the compliance report of a discovery document
+// against OpenID Connect Discovery 1.0 and RFC 8414
+type DiscoveryLintReport struct {
+	Issuer    string          `json:"issuer"` // base URL the document was discovered from
+	Passed    bool            `json:"passed"` // no error findings
+	Findings  []LintFinding   `json:"findings"`
+	Probes    []EndpointProbe `json:"probes"`
+	CheckedAt time.Time       `json:"checked_at"`
+}
+
+// Count returns the number of findings with a severity
+func (r *DiscoveryLintReport) Count(severity string) int {
+	count := 0
+	for _, finding := range r.Findings {
+		if finding.Severity == severity {
+			count++
+		}
+	}
+	return count
+}
@@ -7,12 +7,37 @@ type HistoryEntry struct {
 	ID              int64     `json:"id"`
 	RequestMethod   string    `json:"request_method"`
 	RequestURL      string    `json:"request_url"`
-	RequestHeaders  string    `json:"request_headers"`   // JSON serialized
+	RequestHeaders  string    `json:"request_headers"` // JSON serialized
 	RequestBody     string    `json:"request_body"`
 	ResponseStatus  int       `json:"response_status"`
-	ResponseHeaders string    `json:"response_headers"`  // JSON serialized
+	ResponseHeaders string    `json:"response_headers"` // JSON serialized
 	ResponseBody    string    `json:"response_body"`
 	DurationMs      int64     `json:"duration_ms"`
 	EndpointType    string    `json:"endpoint_type"`
+	FlowID          string    `json:"flow_id,omitempty"` // groups the calls of one OAuth flow
+	ProfileID       int64     `json:"profile_id,omitempty"`
+	ProfileName     string    `json:"profile_name,omitempty"` // empty when the profile was deleted
+	Pinned          bool      `json:"pinned"`
 	CreatedAt       time.Time `json:"created_at"`
 }
+
+// HistoryFilter narrows down history queries. Empty fields match everything.
+type HistoryFilter struct {
+	EndpointType string `json:"endpoint_type,omitempty"`
+	FlowID       string `json:"flow_id,omitempty"`
+	ProfileID    int64  `json:"profile_id,omitempty"`
+}
+
+// Matches reports whether an entry satisfies the filter
+func (f HistoryFilter) Matches(entry *HistoryEntry) bool {
+	if f.EndpointType != "" && entry.EndpointType != f.EndpointType {
+		return false
+	}
+	if f.FlowID != "" && entry.FlowID != f.FlowID {
+		return false
+	}
+	if f.ProfileID != 0 && entry.ProfileID != f.ProfileID {
+		return false
+	}
+	return true
+}
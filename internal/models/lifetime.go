@@ -0,0 +1,74 @@
+package models
+
+import "time"
+
+// Token kinds shown on the lifetime timeline
+const (
+	TokenKindAccess  = "access_token"
+	TokenKindRefresh = "refresh_token"
+	TokenKindID      = "id_token"
+)
+
+// Sources of token lifetimes
+const (
+	LifetimeSourceExpiresIn        = "expires_in"
+	LifetimeSourceRefreshExpiresIn = "refresh_expires_in"
+	LifetimeSourceAssumed          = "assumed" // REFRESH_TOKEN_LIFETIME, the server did not say
+	LifetimeSourceClaims           = "claims"  // iat/exp of a JWT
+	LifetimeSourceIntrospection    = "introspection"
+)
+
+// TokenLifetime is when a token was issued and expires according to one source.
+// Zero times are unknown.
+type TokenLifetime struct {
+	Token     string    `json:"token"`
+	Source    string    `json:"source"`
+	IssuedAt  time.Time `json:"issued_at,omitempty"`
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+	Active    bool      `json:"active,omitempty"` // introspection only
+	Mismatch  bool      `json:"mismatch"`         // expiry disagrees with the first source of the same token
+	Error     string    `json:"error,omitempty"`
+}
+
+// Lifetime returns how long the token is valid for, or 0 if unknown
+func (l TokenLifetime) Lifetime() time.Duration {
+	if l.IssuedAt.IsZero() || l.ExpiresAt.IsZero() {
+		return 0
+	}
+	return l.ExpiresAt.Sub(l.IssuedAt).Round(time.Second)
+}
+
+// Expiry probe verdicts
+const (
+	ProbeVerdictPending      = "pending"
+	ProbeVerdictEnforced     = "enforced"      // accepted before expiry, refused after
+	ProbeVerdictNotEnforced  = "not_enforced"  // still accepted after expiry
+	ProbeVerdictExpiredEarly = "expired_early" // refused before the advertised expiry
+	ProbeVerdictFailed       = "failed"        // a probe could not reach the server
+)
+
+// ExpiryProbe checks that the server enforces the advertised access token
+// lifetime by calling userinfo just before and just after expiry
+type ExpiryProbe struct {
+	SessionID   string        `json:"session_id"`
+	FlowID      string        `json:"flow_id"`
+	Fingerprint string        `json:"fingerprint"` // of the probed access token
+	Expiry      time.Time     `json:"expiry"`
+	Margin      time.Duration `json:"margin"`
+	ScheduledAt time.Time     `json:"scheduled_at"`
+	Before      *ProbeResult  `json:"before,omitempty"`
+	After       *ProbeResult  `json:"after,omitempty"`
+	Verdict     string        `json:"verdict"`
+}
+
+// ProbeResult is the outcome of one userinfo call of an expiry probe
+type ProbeResult struct {
+	At     time.Time `json:"at"`
+	Status int       `json:"status,omitempty"`
+	Error  string    `json:"error,omitempty"`
+}
+
+// Accepted reports whether the server accepted the access token
+func (r *ProbeResult) Accepted() bool {
+	return r != nil && r.Status == 200
+}
@@ -0,0 +1,42 @@
+package models
+
+import "time"
+
+// RetentionPolicy controls how http_history is pruned
+type RetentionPolicy struct {
+	MaxAge     time.Duration  `json:"max_age"`     // 0 disables pruning by age
+	MaxRows    int            `json:"max_rows"`    // 0 disables the global row limit
+	TypeQuotas map[string]int `json:"type_quotas"` // max rows per endpoint_type
+	Interval   time.Duration  `json:"interval"`    // how often the background job runs
+	Vacuum     bool           `json:"vacuum"`      // run VACUUM after rows are pruned
+}
+
+// Enabled reports whether any pruning rule is configured
+func (p RetentionPolicy) Enabled() bool {
+	return p.MaxAge > 0 || p.MaxRows > 0 || len(p.TypeQuotas) > 0
+}
+
+// Maintenance run kinds
+const (
+	MaintenancePrune  = "prune"
+	MaintenancePurge  = "purge"
+	MaintenanceVacuum = "vacuum"
+)
+
+// Maintenance run triggers
+const (
+	TriggerScheduled = "scheduled"
+	TriggerManual    = "manual"
+)
+
+// MaintenanceRun records an execution of the history maintenance job
+type MaintenanceRun struct {
+	ID          int64     `json:"id"`
+	Kind        string    `json:"kind"`
+	Trigger     string    `json:"trigger"`
+	DeletedRows int64     `json:"deleted_rows"`
+	Details     string    `json:"details"`
+	Error       string    `json:"error,omitempty"`
+	DurationMs  int64     `json:"duration_ms"`
+	StartedAt   time.Time `json:"started_at"`
+}
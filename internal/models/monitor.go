@@ -0,0 +1,90 @@
+package models
+
+import "time"
+
+// Monitor checks
+const (
+	MonitorCheckDiscovery = "discovery" // discovery document fetched and well formed
+	MonitorCheckJWKS      = "jwks"      // key set fetched and well formed
+	MonitorCheckGrant     = "grant"     // token obtained with the configured grant
+)
+
+// Grants the monitor can use for its token round trip
+const (
+	MonitorGrantClientCredentials = "client_credentials"
+	MonitorGrantRefreshToken      = "refresh_token"
+)
+
+// MonitorGrants lists the grants accepted by MonitorConfig.Grant
+var MonitorGrants = []string{MonitorGrantClientCredentials, MonitorGrantRefreshToken}
+
+// Monitor webhook events
+const (
+	MonitorEventFailed    = "check_failed"
+	MonitorEventRecovered = "check_recovered"
+	MonitorEventChanged   = "content_changed"
+)
+
+// MonitorConfig controls the synthetic monitoring of the provider
+type MonitorConfig struct {
+	Interval     time.Duration `json:"interval"`          // 0 disables the scheduled runs
+	Issuer       string        `json:"issuer"`            // used when the profile names none
+	Profile      string        `json:"profile,omitempty"` // client profile of the grant check, by ID or name
+	Grant        string        `json:"grant,omitempty"`   // empty skips the grant check
+	RefreshToken string        `json:"-"`                 // first refresh token of the refresh_token grant
+	WebhookURL   string        `json:"-"`                 // receives the alerts; empty disables them
+}
+
+// Enabled reports whether the monitor runs on a schedule
+func (c MonitorConfig) Enabled() bool {
+	return c.Interval > 0
+}
+
+// Validate checks the grant and its requirements
+func (c MonitorConfig) Validate() error {
+	switch c.Grant {
+	case "":
+		return nil
+	case MonitorGrantClientCredentials, MonitorGrantRefreshToken:
+	default:
+		return &ValidationError{Field: "grant", Message: "Grant must be client_credentials or refresh_token"}
+	}
+	if c.Profile == "" {
+		return &ValidationError{Field: "profile", Message: "The grant check needs a client profile"}
+	}
+	return nil
+}
+
+// MonitorCheck is the result of one check of a monitor run
+type MonitorCheck struct {
+	ID          int64     `json:"id"`
+	Check       string    `json:"check"`
+	Trigger     string    `json:"trigger"`
+	Success     bool      `json:"success"`
+	Changed     bool      `json:"changed"`               // the content differs from the previous run
+	Fingerprint string    `json:"fingerprint,omitempty"` // truncated SHA-256 of the content checked
+	Details     string    `json:"details,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	DurationMs  int64     `json:"duration_ms"`
+	FlowID      string    `json:"flow_id,omitempty"` // links the requests of the run in history
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// MonitorRun is a complete run of the monitor checks
+type MonitorRun struct {
+	FlowID    string         `json:"flow_id"`
+	Trigger   string         `json:"trigger"`
+	Issuer    string         `json:"issuer"`
+	Healthy   bool           `json:"healthy"` // every check succeeded
+	Checks    []MonitorCheck `json:"checks"`
+	Alerts    []MonitorAlert `json:"alerts"`
+	StartedAt time.Time      `json:"started_at"`
+}
+
+// MonitorAlert is a notification sent to the webhook: a check started
+// failing, recovered, or found content changed since the previous run
+type MonitorAlert struct {
+	Event   string `json:"event"`
+	Check   string `json:"check"`
+	Message string `json:"message"`
+}
@@ -0,0 +1,50 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// ClientProfile is a named, persistent OAuth2 client configuration
+type ClientProfile struct {
+	ID           int64     `json:"id"`
+	Name         string    `json:"name"`
+	ClientID     string    `json:"client_id"`
+	ClientSecret string    `json:"client_secret"`
+	RedirectURI  string    `json:"redirect_uri"`
+	Scopes       []string  `json:"scopes"`
+	BaseURL      string    `json:"base_url,omitempty"` // issuer; empty uses the server default
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// ScopeString returns the scopes separated by spaces, as sent to the authorization server
+func (p *ClientProfile) ScopeString() string {
+	return strings.Join(p.Scopes, " ")
+}
+
+// HasScope reports whether the profile requests a scope
+func (p *ClientProfile) HasScope(scope string) bool {
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks if the profile is valid
+func (p *ClientProfile) Validate() error {
+	if strings.TrimSpace(p.Name) == "" {
+		return &ValidationError{Field: "name", Message: "Profile name is required"}
+	}
+
+	config := OAuthConfig{
+		ClientID:     p.ClientID,
+		ClientSecret: p.ClientSecret,
+		RedirectURI:  p.RedirectURI,
+		Scopes:       p.Scopes,
+		BaseURL:      p.BaseURL,
+	}
+	return config.Validate()
+}
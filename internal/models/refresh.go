@@ -0,0 +1,47 @@
+package models
+
+import "time"
+
+// Refresh triggers
+const (
+	RefreshTriggerAuto      = "auto"
+	RefreshTriggerManual    = "manual"
+	RefreshTriggerReuseTest = "reuse_test"
+)
+
+// Refresh token reuse test verdicts
+const (
+	ReuseVerdictFamilyRevoked = "family_revoked" // old token rejected and its successor revoked, as the BCP recommends
+	ReuseVerdictReuseRejected = "reuse_rejected" // old token rejected but its successor still works
+	ReuseVerdictReuseAccepted = "reuse_accepted" // the server accepted a rotated-out refresh token
+	ReuseVerdictNoRotation    = "no_rotation"    // the server does not rotate, so there is nothing to reuse
+	ReuseVerdictRefreshFailed = "refresh_failed" // the first refresh failed
+)
+
+// RefreshLogEntry records a refresh token grant made for a session.
+// Refresh tokens are identified by fingerprints, never stored.
+type RefreshLogEntry struct {
+	ID             int64     `json:"id"`
+	SessionID      string    `json:"session_id"`
+	Trigger        string    `json:"trigger"`
+	Success        bool      `json:"success"`
+	Rotated        bool      `json:"rotated"` // the server issued a new refresh token
+	Reused         bool      `json:"reused"`  // the server returned a refresh token it had rotated out
+	OldFingerprint string    `json:"old_fingerprint"`
+	NewFingerprint string    `json:"new_fingerprint,omitempty"`
+	AccessExpiry   time.Time `json:"access_expiry,omitempty"`
+	Error          string    `json:"error,omitempty"`
+	FlowID         string    `json:"flow_id,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// RefreshReuseReport is the outcome of a refresh token reuse test: refresh
+// once, present the old refresh token again, then try the newest one.
+// Steps that did not run are nil.
+type RefreshReuseReport struct {
+	FlowID  string           `json:"flow_id"` // links the three calls in history
+	Refresh *RefreshLogEntry `json:"refresh"`
+	Reuse   *RefreshLogEntry `json:"reuse,omitempty"`
+	Newest  *RefreshLogEntry `json:"newest,omitempty"`
+	Verdict string           `json:"verdict"`
+}
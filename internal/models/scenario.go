@@ -0,0 +1,113 @@
+package models
+
+import "time"
+
+// Scenario step actions
+const (
+	ScenarioActionDiscovery  = "discovery"
+	ScenarioActionLogin      = "login"
+	ScenarioActionRefresh    = "refresh"
+	ScenarioActionRevoke     = "revoke"
+	ScenarioActionIntrospect = "introspect"
+	ScenarioActionUserInfo   = "userinfo"
+)
+
+// ScenarioActions lists the actions a step can run
+var ScenarioActions = []string{
+	ScenarioActionDiscovery,
+	ScenarioActionLogin,
+	ScenarioActionRefresh,
+	ScenarioActionRevoke,
+	ScenarioActionIntrospect,
+	ScenarioActionUserInfo,
+}
+
+// Scenario step outcomes, named after the JUnit ones
+const (
+	ScenarioStepPassed  = "passed"
+	ScenarioStepFailed  = "failed"  // an assertion did not hold
+	ScenarioStepError   = "error"   // the step could not run, or failed with no assertion expecting it
+	ScenarioStepSkipped = "skipped" // a token the step needs was never obtained
+)
+
+// Scenario is a declarative acceptance test: a client and the steps run with it, in order
+type Scenario struct {
+	Name   string         `yaml:"name" json:"name"`
+	Issuer string         `yaml:"issuer" json:"issuer,omitempty"` // defaults to the profile's, then to the server's
+	Client ScenarioClient `yaml:"client" json:"client"`
+	Steps  []ScenarioStep `yaml:"steps" json:"steps"`
+}
+
+// ScenarioClient is the client a scenario runs as, given inline or as a saved profile
+type ScenarioClient struct {
+	Profile      string   `yaml:"profile" json:"profile,omitempty"` // ID or name of a saved profile
+	ClientID     string   `yaml:"client_id" json:"client_id,omitempty"`
+	ClientSecret string   `yaml:"client_secret" json:"-"`
+	RedirectURI  string   `yaml:"redirect_uri" json:"redirect_uri,omitempty"`
+	Scopes       []string `yaml:"scopes" json:"scopes,omitempty"`
+}
+
+// ScenarioStep is one call of a scenario and what its response must look like
+type ScenarioStep struct {
+	Name   string `yaml:"name" json:"name,omitempty"`
+	Action string `yaml:"action" json:"action"`
+	// Token sent by revoke and introspect: access_token (default), refresh_token or id_token
+	Token string `yaml:"token" json:"token,omitempty"`
+	// Pre-obtained authorization code for login; without it, login follows the
+	// authorization redirects unattended, which only works with mock servers
+	Code         string         `yaml:"code" json:"code,omitempty"`
+	CodeVerifier string         `yaml:"code_verifier" json:"code_verifier,omitempty"`
+	Expect       ScenarioExpect `yaml:"expect" json:"expect"`
+}
+
+// ScenarioExpect holds the assertions of a step. Header and claim matchers are
+// either a value, compared for equality, or a map with any of equals, present,
+// contains and matches (a regular expression).
+type ScenarioExpect struct {
+	Status  int                    `yaml:"status" json:"status,omitempty"`
+	Headers map[string]interface{} `yaml:"headers" json:"headers,omitempty"`
+	// Claims of the ID token for login and refresh, fields of the response
+	// document for the other actions. Dots select nested fields.
+	Claims map[string]interface{} `yaml:"claims" json:"claims,omitempty"`
+}
+
+// ScenarioReport is the outcome of a scenario run
+type ScenarioReport struct {
+	Name       string               `json:"name"`
+	File       string               `json:"file,omitempty"`
+	FlowID     string               `json:"flow_id"` // groups the requests of the run in the history
+	StartedAt  time.Time            `json:"started_at"`
+	DurationMs int64                `json:"duration_ms"`
+	Passed     bool                 `json:"passed"`
+	Steps      []ScenarioStepResult `json:"steps"`
+}
+
+// Count returns how many steps ended with an outcome
+func (r *ScenarioReport) Count(outcome string) int {
+	count := 0
+	for _, step := range r.Steps {
+		if step.Outcome == outcome {
+			count++
+		}
+	}
+	return count
+}
+
+// ScenarioStepResult is the outcome of a step
+type ScenarioStepResult struct {
+	Name       string              `json:"name"`
+	Action     string              `json:"action"`
+	Outcome    string              `json:"outcome"`
+	HTTPStatus int                 `json:"http_status,omitempty"` // of the last request the step made
+	DurationMs int64               `json:"duration_ms"`
+	Error      string              `json:"error,omitempty"`
+	Assertions []ScenarioAssertion `json:"assertions,omitempty"`
+}
+
+// ScenarioAssertion is a checked expectation, e.g. target "claim sub"
+type ScenarioAssertion struct {
+	Target   string `json:"target"`
+	Expected string `json:"expected"`
+	Actual   string `json:"actual"`
+	Passed   bool   `json:"passed"`
+}
@@ -0,0 +1,56 @@
+package models
+
+import "time"
+
+// Disclosure of a userinfo field in a scope matrix row
+const (
+	DisclosureExpected = "expected" // returned, expected from a granted scope
+	DisclosureAllowed  = "allowed"  // returned, optional for a granted scope
+	DisclosureOver     = "over"     // returned without a granted scope releasing it
+	DisclosureUnder    = "under"    // expected from a granted scope, not returned
+)
+
+// ScopeMatrix is a scope-to-claims conformance test: the client logs in with
+// each scope combination, and the userinfo fields returned are compared with
+// the claims each scope should release
+type ScopeMatrix struct {
+	Name   string         `yaml:"name" json:"name"`
+	Issuer string         `yaml:"issuer" json:"issuer,omitempty"` // defaults to the profile's, then to the server's
+	Client ScenarioClient `yaml:"client" json:"client"`           // its scopes are ignored
+	// Cookie sent to the authorization endpoint: a user session whose consent
+	// to the client is stored, so the logins need no interaction. Mock servers
+	// need none.
+	Cookie string `yaml:"cookie" json:"-"`
+	// Scope combinations to log in with, openid added to each. Empty means
+	// openid alone, openid with each scope, and all scopes together.
+	Combinations [][]string `yaml:"combinations" json:"combinations,omitempty"`
+	// Exhaustive logs in with every combination of the scopes instead
+	Exhaustive bool `yaml:"exhaustive" json:"exhaustive,omitempty"`
+	// Scopes maps each scope to the claims it releases; DefaultScopeClaims when empty
+	Scopes []ScopeClaims `yaml:"scopes" json:"scopes"`
+}
+
+// ScopeMatrixRow is the outcome of the login with a scope combination
+type ScopeMatrixRow struct {
+	Scopes      []string          `json:"scopes"`  // requested
+	Granted     []string          `json:"granted"` // the requested ones, unless the token response says otherwise
+	Fields      []string          `json:"fields"`  // returned by userinfo
+	Disclosures map[string]string `json:"disclosures"`
+	Over        []string          `json:"over"`  // returned without a granted scope releasing them
+	Under       []string          `json:"under"` // expected from a granted scope and not returned
+	Passed      bool              `json:"passed"`
+	DurationMs  int64             `json:"duration_ms"`
+	Error       string            `json:"error,omitempty"`
+}
+
+// ScopeMatrixReport is the outcome of a scope matrix run
+type ScopeMatrixReport struct {
+	Name       string           `json:"name"`
+	File       string           `json:"file,omitempty"`
+	FlowID     string           `json:"flow_id"` // groups the requests of the run in the history
+	StartedAt  time.Time        `json:"started_at"`
+	DurationMs int64            `json:"duration_ms"`
+	Passed     bool             `json:"passed"`
+	Fields     []string         `json:"fields"` // every field returned or expected, the columns of the matrix
+	Rows       []ScopeMatrixRow `json:"rows"`
+}
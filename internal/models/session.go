@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// Session is a server-side session. The browser cookie only carries an opaque
+// token; TokenHash identifies the row without storing the token itself.
+type Session struct {
+	ID         int64     `json:"id"`
+	TokenHash  string    `json:"-"`
+	Data       string    `json:"-"` // encoded session values
+	UserAgent  string    `json:"user_agent"`
+	RemoteAddr string    `json:"remote_addr"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"` // absolute timeout
+}
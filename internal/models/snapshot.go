@@ -0,0 +1,42 @@
+package models
+
+import "time"
+
+// Kinds of provider documents kept as snapshots
+const (
+	SnapshotDiscovery = "discovery"
+	SnapshotJWKS      = "jwks"
+)
+
+// SnapshotChange is a field of a discovery document, or a key of a key set,
+// that changed from one version to the next
+type SnapshotChange struct {
+	Field  string `json:"field"`  // e.g. userinfo_endpoint, or "kid abc" for keys
+	Change string `json:"change"` // added/removed/changed
+}
+
+// ProviderSnapshot is a version of a discovery document or key set, kept
+// from the first to the last fetch that returned the same content
+type ProviderSnapshot struct {
+	ID          int64            `json:"id"`
+	Kind        string           `json:"kind"`   // discovery/jwks
+	Source      string           `json:"source"` // URL the document was fetched from
+	Version     int              `json:"version"`
+	Fingerprint string           `json:"fingerprint"`
+	Document    string           `json:"document"` // canonical JSON
+	Summary     []SnapshotChange `json:"summary"`  // empty for the first version
+	Changes     string           `json:"-"`        // differences to the previous version, JSON encoded
+	FirstSeenAt time.Time        `json:"first_seen_at"`
+	LastSeenAt  time.Time        `json:"last_seen_at"`
+}
+
+// ProviderChange is a change of a provider document, as highlighted on the
+// home page, e.g. userinfo_endpoint changed 3 days ago
+type ProviderChange struct {
+	SnapshotChange
+	Kind       string    `json:"kind"`
+	Source     string    `json:"source"`
+	Version    int       `json:"version"`
+	SnapshotID int64     `json:"snapshot_id"`
+	ChangedAt  time.Time `json:"changed_at"`
+}
@@ -0,0 +1,47 @@
+package models
+
+import "time"
+
+// HistorySample is the subset of a history entry needed for statistics
+type HistorySample struct {
+	EndpointType   string
+	ResponseStatus int
+	DurationMs     int64
+	CreatedAt      time.Time
+}
+
+// IsError reports whether the sample is a transport failure or an HTTP error status
+func (s HistorySample) IsError() bool {
+	return s.ResponseStatus == 0 || s.ResponseStatus >= 400
+}
+
+// EndpointStats aggregates latency and errors of one endpoint type
+type EndpointStats struct {
+	EndpointType string  `json:"endpoint_type"`
+	Count        int     `json:"count"`
+	Errors       int     `json:"errors"`
+	ErrorRate    float64 `json:"error_rate"` // percentage
+	P50          int64   `json:"p50_ms"`
+	P95          int64   `json:"p95_ms"`
+	P99          int64   `json:"p99_ms"`
+	Avg          int64   `json:"avg_ms"`
+	Max          int64   `json:"max_ms"`
+}
+
+// StatsBucket aggregates the samples of a time slice of the window
+type StatsBucket struct {
+	Start  time.Time `json:"start"`
+	Count  int       `json:"count"`
+	Errors int       `json:"errors"`
+	P95    int64     `json:"p95_ms"`
+}
+
+// HistoryStats is the statistics report of a time window
+type HistoryStats struct {
+	Window     time.Duration   `json:"window"`
+	Since      time.Time       `json:"since"`
+	Total      EndpointStats   `json:"total"`
+	Endpoints  []EndpointStats `json:"endpoints"`
+	BucketSize time.Duration   `json:"bucket_size"`
+	Buckets    []StatsBucket   `json:"buckets"`
+}
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// StoredToken is the persisted form of the tokens obtained by a session
+type StoredToken struct {
+	ID        int64     `json:"id"`
+	SessionID string    `json:"session_id"`
+	Data      string    `json:"-"` // JSON tokens and user info
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -0,0 +1,157 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pericles-luz/oauth2-test/internal/models"
+)
+
+// idTokenProtocolClaims describe the authentication itself and have no
+// userinfo counterpart (OIDC Core §2)
+var idTokenProtocolClaims = map[string]bool{
+	"iss": true, "aud": true, "exp": true, "iat": true, "nbf": true, "jti": true,
+	"auth_time": true, "nonce": true, "acr": true, "amr": true, "azp": true,
+	"at_hash": true, "c_hash": true, "sid": true,
+}
+
+// CompareClaims decodes an ID token and compares its claims with a userinfo
+// response. Each claim is attributed to the scope releasing it in mapping,
+// and the expected claims of the granted scopes must be returned.
+func CompareClaims(idToken string, userInfo map[string]interface{}, requested, granted []string, mapping []models.ScopeClaims) (*models.ClaimConsistencyReport, error) {
+	idClaims, err := ParseTokenWithoutValidation(idToken)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode ID token: %w", err)
+	}
+
+	report := &models.ClaimConsistencyReport{CheckedAt: time.Now()}
+	report.IDTokenSub, _ = idClaims["sub"].(string)
+	report.UserInfoSub, _ = userInfo["sub"].(string)
+	report.SubjectMatch = report.IDTokenSub != "" && report.IDTokenSub == report.UserInfoSub
+
+	isRequested := stringSet(requested)
+	isGranted := stringSet(granted)
+
+	// Scope releasing each claim, and its position to sort the claims
+	scopeOf := make(map[string]string)
+	scopeOrder := make(map[string]int)
+	for i, scope := range mapping {
+		scopeOrder[scope.Scope] = i
+		for _, claims := range [][]string{scope.Expected, scope.Optional} {
+			for _, claim := range claims {
+				if _, ok := scopeOf[claim]; !ok {
+					scopeOf[claim] = scope.Scope
+				}
+			}
+		}
+	}
+
+	// Every claim returned, and the expected ones of the granted scopes
+	names := make(map[string]bool)
+	for claim := range idClaims {
+		if !idTokenProtocolClaims[claim] {
+			names[claim] = true
+		}
+	}
+	for claim := range userInfo {
+		names[claim] = true
+	}
+	for _, scope := range mapping {
+		if isGranted[scope.Scope] {
+			for _, claim := range scope.Expected {
+				names[claim] = true
+			}
+		}
+	}
+
+	for name := range names {
+		idValue, inIDToken := idClaims[name]
+		userInfoValue, inUserInfo := userInfo[name]
+
+		comparison := models.ClaimComparison{Claim: name, Scope: scopeOf[name]}
+		if inIDToken {
+			comparison.IDToken = jsonString(idValue)
+		}
+		if inUserInfo {
+			comparison.UserInfo = jsonString(userInfoValue)
+		}
+		switch {
+		case inIDToken && inUserInfo && jsonEqual(idValue, userInfoValue):
+			comparison.Status = models.ClaimMatch
+		case inIDToken && inUserInfo:
+			comparison.Status = models.ClaimDiffers
+		case inIDToken:
+			comparison.Status = models.ClaimIDTokenOnly
+		case inUserInfo:
+			comparison.Status = models.ClaimUserInfoOnly
+		default:
+			comparison.Status = models.ClaimMissing
+		}
+		report.Claims = append(report.Claims, comparison)
+	}
+	sort.Slice(report.Claims, func(i, j int) bool {
+		a, b := report.Claims[i], report.Claims[j]
+		if a.Scope != b.Scope {
+			// Claims no scope maps go last
+			orderA, mappedA := scopeOrder[a.Scope]
+			orderB, mappedB := scopeOrder[b.Scope]
+			if mappedA != mappedB {
+				return mappedA
+			}
+			return orderA < orderB
+		}
+		return a.Claim < b.Claim
+	})
+
+	for _, scope := range mapping {
+		result := models.ScopeClaimsResult{
+			Scope:     scope.Scope,
+			Requested: isRequested[scope.Scope],
+			Granted:   isGranted[scope.Scope],
+			Claims:    []string{},
+			Missing:   []string{},
+		}
+		for _, claims := range [][]string{scope.Expected, scope.Optional} {
+			for _, claim := range claims {
+				_, inIDToken := idClaims[claim]
+				_, inUserInfo := userInfo[claim]
+				if inIDToken || inUserInfo {
+					result.Claims = append(result.Claims, claim)
+				}
+			}
+		}
+		if result.Granted {
+			for _, claim := range scope.Expected {
+				_, inIDToken := idClaims[claim]
+				_, inUserInfo := userInfo[claim]
+				if !inIDToken && !inUserInfo {
+					result.Missing = append(result.Missing, claim)
+				}
+			}
+		}
+		report.Scopes = append(report.Scopes, result)
+	}
+
+	report.Passed = report.SubjectMatch && report.Count(models.ClaimDiffers) == 0 && report.Count(models.ClaimMissing) == 0
+	return report, nil
+}
+
+// GrantedScopes returns the scopes granted to a token: the scope of the token
+// response, or the requested ones when the server omitted it (RFC 6749 §5.1)
+func GrantedScopes(requested []string, tokenScope string) []string {
+	if tokenScope == "" {
+		return requested
+	}
+	return strings.Fields(tokenScope)
+}
+
+// stringSet builds a lookup set of strings
+func stringSet(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, value := range values {
+		set[value] = true
+	}
+	return set
+}
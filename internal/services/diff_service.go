@@ -0,0 +1,333 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pericles-luz/oauth2-test/internal/models"
+)
+
+// Diff kinds
+const (
+	DiffAdded   = "added"
+	DiffRemoved = "removed"
+	DiffChanged = "changed"
+)
+
+// FieldDiff is a single difference between two values at a given path
+type FieldDiff struct {
+	Path  string `json:"path"`
+	Kind  string `json:"kind"`
+	Left  string `json:"left,omitempty"`
+	Right string `json:"right,omitempty"`
+}
+
+// TokenDiff holds the differences between the decoded payloads of two JWTs
+type TokenDiff struct {
+	Path    string      `json:"path"`
+	InLeft  bool        `json:"in_left"`
+	InRight bool        `json:"in_right"`
+	Diffs   []FieldDiff `json:"diffs"`
+}
+
+// HistoryDiff is the structural comparison of two history entries
+type HistoryDiff struct {
+	Left            *models.HistoryEntry `json:"left"`
+	Right           *models.HistoryEntry `json:"right"`
+	Summary         []FieldDiff          `json:"summary"`
+	QueryParams     []FieldDiff          `json:"query_params"`
+	RequestHeaders  []FieldDiff          `json:"request_headers"`
+	FormFields      []FieldDiff          `json:"form_fields"`
+	RequestBody     []FieldDiff          `json:"request_body"`
+	ResponseHeaders []FieldDiff          `json:"response_headers"`
+	ResponseBody    []FieldDiff          `json:"response_body"`
+	Tokens          []TokenDiff          `json:"tokens"`
+}
+
+// volatileHeaders change on every response and are ignored by the diff
+var volatileHeaders = map[string]bool{
+	"Date":           true,
+	"Content-Length": true,
+	"X-Request-Id":   true,
+}
+
+// DiffHistoryEntries compares two history entries field by field
+func DiffHistoryEntries(left, right *models.HistoryEntry) (*HistoryDiff, error) {
+	diff := &HistoryDiff{Left: left, Right: right}
+
+	// Summary of scalar fields
+	diff.Summary = diffStrings(map[string]string{
+		"method":        left.RequestMethod,
+		"endpoint_type": left.EndpointType,
+		"status":        strconv.Itoa(left.ResponseStatus),
+	}, map[string]string{
+		"method":        right.RequestMethod,
+		"endpoint_type": right.EndpointType,
+		"status":        strconv.Itoa(right.ResponseStatus),
+	})
+
+	// URL and query string
+	leftURL, leftQuery, _ := strings.Cut(left.RequestURL, "?")
+	rightURL, rightQuery, _ := strings.Cut(right.RequestURL, "?")
+	if leftURL != rightURL {
+		diff.Summary = append(diff.Summary, FieldDiff{Path: "url", Kind: DiffChanged, Left: leftURL, Right: rightURL})
+	}
+	diff.QueryParams = diffStrings(flattenValues(leftQuery), flattenValues(rightQuery))
+
+	// Headers
+	leftReqHeaders, err := parseStoredHeaders(left.RequestHeaders)
+	if err != nil {
+		return nil, err
+	}
+	rightReqHeaders, err := parseStoredHeaders(right.RequestHeaders)
+	if err != nil {
+		return nil, err
+	}
+	diff.RequestHeaders = diffStrings(leftReqHeaders, rightReqHeaders)
+
+	leftRespHeaders, err := parseStoredHeaders(left.ResponseHeaders)
+	if err != nil {
+		return nil, err
+	}
+	rightRespHeaders, err := parseStoredHeaders(right.ResponseHeaders)
+	if err != nil {
+		return nil, err
+	}
+	diff.ResponseHeaders = diffStrings(leftRespHeaders, rightRespHeaders)
+
+	// Request body: form fields when urlencoded, JSON-aware otherwise
+	if isFormBody(leftReqHeaders) && isFormBody(rightReqHeaders) {
+		diff.FormFields = diffStrings(flattenValues(left.RequestBody), flattenValues(right.RequestBody))
+	} else {
+		diff.RequestBody = diffBodies(left.RequestBody, right.RequestBody)
+	}
+
+	// Response body
+	diff.ResponseBody = diffBodies(left.ResponseBody, right.ResponseBody)
+
+	// Decoded JWT payloads found in the responses
+	diff.Tokens = diffTokens(findJWTs(left.ResponseBody), findJWTs(right.ResponseBody))
+
+	return diff, nil
+}
+
+// HasDifferences reports whether any difference was found
+func (d *HistoryDiff) HasDifferences() bool {
+	if len(d.Summary)+len(d.QueryParams)+len(d.RequestHeaders)+len(d.FormFields)+
+		len(d.RequestBody)+len(d.ResponseHeaders)+len(d.ResponseBody) > 0 {
+		return true
+	}
+	for _, token := range d.Tokens {
+		if len(token.Diffs) > 0 || token.InLeft != token.InRight {
+			return true
+		}
+	}
+	return false
+}
+
+// parseStoredHeaders flattens JSON serialized headers, skipping volatile ones
+func parseStoredHeaders(data string) (map[string]string, error) {
+	flat := map[string]string{}
+	if data == "" {
+		return flat, nil
+	}
+
+	var headers map[string][]string
+	if err := json.Unmarshal([]byte(data), &headers); err != nil {
+		return nil, fmt.Errorf("failed to parse headers: %w", err)
+	}
+	for name, values := range headers {
+		if volatileHeaders[name] {
+			continue
+		}
+		flat[name] = strings.Join(values, ", ")
+	}
+	return flat, nil
+}
+
+// isFormBody checks the Content-Type of flattened headers
+func isFormBody(headers map[string]string) bool {
+	return strings.HasPrefix(headers["Content-Type"], "application/x-www-form-urlencoded")
+}
+
+// flattenValues parses a urlencoded string into name/value pairs
+func flattenValues(raw string) map[string]string {
+	flat := map[string]string{}
+	values, err := url.ParseQuery(raw)
+	if err != nil {
+		return flat
+	}
+	for name, vals := range values {
+		flat[name] = strings.Join(vals, ", ")
+	}
+	return flat
+}
+
+// diffStrings compares two flat maps and returns the differences sorted by key
+func diffStrings(left, right map[string]string) []FieldDiff {
+	var diffs []FieldDiff
+	for key, l := range left {
+		r, ok := right[key]
+		switch {
+		case !ok:
+			diffs = append(diffs, FieldDiff{Path: key, Kind: DiffRemoved, Left: l})
+		case l != r:
+			diffs = append(diffs, FieldDiff{Path: key, Kind: DiffChanged, Left: l, Right: r})
+		}
+	}
+	for key, r := range right {
+		if _, ok := left[key]; !ok {
+			diffs = append(diffs, FieldDiff{Path: key, Kind: DiffAdded, Right: r})
+		}
+	}
+	sortDiffs(diffs)
+	return diffs
+}
+
+// diffBodies compares two bodies, structurally when both are JSON
+func diffBodies(left, right string) []FieldDiff {
+	if left == right {
+		return nil
+	}
+
+	var leftJSON, rightJSON interface{}
+	if json.Unmarshal([]byte(left), &leftJSON) == nil && json.Unmarshal([]byte(right), &rightJSON) == nil {
+		var diffs []FieldDiff
+		diffJSON("$", leftJSON, rightJSON, &diffs)
+		sortDiffs(diffs)
+		return diffs
+	}
+
+	switch {
+	case left == "":
+		return []FieldDiff{{Path: "body", Kind: DiffAdded, Right: right}}
+	case right == "":
+		return []FieldDiff{{Path: "body", Kind: DiffRemoved, Left: left}}
+	}
+	return []FieldDiff{{Path: "body", Kind: DiffChanged, Left: left, Right: right}}
+}
+
+// diffJSON recursively compares two decoded JSON values
+func diffJSON(path string, left, right interface{}, diffs *[]FieldDiff) {
+	switch l := left.(type) {
+	case map[string]interface{}:
+		r, ok := right.(map[string]interface{})
+		if !ok {
+			break
+		}
+		for key, lv := range l {
+			childPath := path + "." + key
+			rv, exists := r[key]
+			if !exists {
+				*diffs = append(*diffs, FieldDiff{Path: childPath, Kind: DiffRemoved, Left: jsonString(lv)})
+				continue
+			}
+			diffJSON(childPath, lv, rv, diffs)
+		}
+		for key, rv := range r {
+			if _, exists := l[key]; !exists {
+				*diffs = append(*diffs, FieldDiff{Path: path + "." + key, Kind: DiffAdded, Right: jsonString(rv)})
+			}
+		}
+		return
+	case []interface{}:
+		r, ok := right.([]interface{})
+		if !ok {
+			break
+		}
+		for i := 0; i < len(l) || i < len(r); i++ {
+			childPath := fmt.Sprintf("%s[%d]", path, i)
+			switch {
+			case i >= len(r):
+				*diffs = append(*diffs, FieldDiff{Path: childPath, Kind: DiffRemoved, Left: jsonString(l[i])})
+			case i >= len(l):
+				*diffs = append(*diffs, FieldDiff{Path: childPath, Kind: DiffAdded, Right: jsonString(r[i])})
+			default:
+				diffJSON(childPath, l[i], r[i], diffs)
+			}
+		}
+		return
+	}
+
+	leftStr, rightStr := jsonString(left), jsonString(right)
+	if leftStr != rightStr {
+		*diffs = append(*diffs, FieldDiff{Path: path, Kind: DiffChanged, Left: leftStr, Right: rightStr})
+	}
+}
+
+// findJWTs walks a JSON body and returns decoded JWT payloads by path
+func findJWTs(body string) map[string]map[string]interface{} {
+	tokens := map[string]map[string]interface{}{}
+
+	var doc interface{}
+	if json.Unmarshal([]byte(body), &doc) != nil {
+		return tokens
+	}
+
+	var walk func(path string, value interface{})
+	walk = func(path string, value interface{}) {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			for key, child := range v {
+				walk(path+"."+key, child)
+			}
+		case []interface{}:
+			for i, child := range v {
+				walk(fmt.Sprintf("%s[%d]", path, i), child)
+			}
+		case string:
+			if strings.Count(v, ".") != 2 {
+				return
+			}
+			if claims, err := ParseTokenWithoutValidation(v); err == nil {
+				tokens[path] = claims
+			}
+		}
+	}
+	walk("$", doc)
+
+	return tokens
+}
+
+// diffTokens compares decoded token payloads found at the same path
+func diffTokens(left, right map[string]map[string]interface{}) []TokenDiff {
+	paths := map[string]bool{}
+	for path := range left {
+		paths[path] = true
+	}
+	for path := range right {
+		paths[path] = true
+	}
+
+	var result []TokenDiff
+	for path := range paths {
+		l, inLeft := left[path]
+		r, inRight := right[path]
+		token := TokenDiff{Path: path, InLeft: inLeft, InRight: inRight}
+		if inLeft && inRight {
+			diffJSON("$", map[string]interface{}(l), map[string]interface{}(r), &token.Diffs)
+			sortDiffs(token.Diffs)
+		}
+		result = append(result, token)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Path < result[j].Path })
+
+	return result
+}
+
+// jsonString renders a decoded JSON value compactly
+func jsonString(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+func sortDiffs(diffs []FieldDiff) {
+	sort.Slice(diffs, func(i, j int) bool { return diffs[i].Path < diffs[j].Path })
+}
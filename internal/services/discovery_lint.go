@@ -0,0 +1,475 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pericles-luz/oauth2-test/internal/models"
+)
+
+// Specification sections cited by the lint findings
+const (
+	refDiscoveryMetadata = "OIDC Discovery §3"
+	refDiscoveryIssuer   = "OIDC Discovery §4.3"
+	refRFC8414Metadata   = "RFC 8414 §2"
+	refRFC8414Issuer     = "RFC 8414 §3.3"
+	refPKCE              = "RFC 7636 §4.2"
+	refSecurityBCP       = "RFC 9700 §2.1"
+)
+
+// requiredDiscoveryFields are the metadata OIDC Discovery requires; RFC 8414
+// requires a subset of them
+var requiredDiscoveryFields = []string{
+	"issuer",
+	"authorization_endpoint",
+	"token_endpoint",
+	"jwks_uri",
+	"response_types_supported",
+	"subject_types_supported",
+	"id_token_signing_alg_values_supported",
+}
+
+// recommendedDiscoveryFields are the metadata OIDC Discovery recommends
+var recommendedDiscoveryFields = []string{
+	"userinfo_endpoint",
+	"scopes_supported",
+	"claims_supported",
+}
+
+// discoveryEndpointFields are the metadata holding endpoint URLs, which
+// must use TLS and are probed
+var discoveryEndpointFields = []string{
+	"authorization_endpoint",
+	"token_endpoint",
+	"userinfo_endpoint",
+	"jwks_uri",
+	"registration_endpoint",
+	"revocation_endpoint",
+	"introspection_endpoint",
+	"end_session_endpoint",
+	"device_authorization_endpoint",
+	"pushed_authorization_request_endpoint",
+	"backchannel_authentication_endpoint",
+	"check_session_iframe",
+}
+
+// discoveryBooleanFields are the *_supported metadata that are booleans;
+// the others are lists of strings
+var discoveryBooleanFields = map[string]bool{
+	"claims_parameter_supported":                     true,
+	"request_parameter_supported":                    true,
+	"request_uri_parameter_supported":                true,
+	"frontchannel_logout_supported":                  true,
+	"frontchannel_logout_session_supported":          true,
+	"backchannel_logout_supported":                   true,
+	"backchannel_logout_session_supported":           true,
+	"authorization_response_iss_parameter_supported": true,
+}
+
+// LintDiscovery checks a discovery document against OpenID Connect Discovery
+// 1.0 and RFC 8414, then probes every endpoint it advertises. The probes are
+// logged to history like any other request.
+func LintDiscovery(ctx context.Context, history *HistoryService, issuer string, discovery map[string]interface{}) *models.DiscoveryLintReport {
+	report := &models.DiscoveryLintReport{
+		Issuer:    issuer,
+		Findings:  LintDiscoveryDocument(issuer, discovery),
+		CheckedAt: time.Now(),
+	}
+
+	probes, findings := probeDiscoveryEndpoints(ctx, history, discovery)
+	report.Probes = probes
+	report.Findings = append(report.Findings, findings...)
+	sortFindings(report.Findings)
+	report.Passed = report.Count(models.SeverityError) == 0
+
+	return report
+}
+
+// LintDiscoveryDocument checks the content of a discovery document fetched
+// from issuer, without making any request
+func LintDiscoveryDocument(issuer string, discovery map[string]interface{}) []models.LintFinding {
+	l := &discoveryLinter{issuer: issuer, discovery: discovery}
+	l.lintFields()
+	l.lintIssuer()
+	l.lintEndpoints()
+	l.lintPKCE()
+	l.lintFlows()
+	l.lintSigning()
+	sortFindings(l.findings)
+	return l.findings
+}
+
+// discoveryLinter accumulates the findings of a discovery document
+type discoveryLinter struct {
+	issuer    string
+	discovery map[string]interface{}
+	findings  []models.LintFinding
+}
+
+// add records a finding
+func (l *discoveryLinter) add(severity, rule, field, reference, format string, args ...interface{}) {
+	l.findings = append(l.findings, models.LintFinding{
+		Severity:  severity,
+		Rule:      rule,
+		Field:     field,
+		Message:   fmt.Sprintf(format, args...),
+		Reference: reference,
+	})
+}
+
+// strings returns a list of strings metadata, and whether it is present
+func (l *discoveryLinter) strings(field string) ([]string, bool) {
+	values, ok := l.discovery[field].([]interface{})
+	if !ok {
+		return nil, false
+	}
+	result := make([]string, 0, len(values))
+	for _, value := range values {
+		if s, ok := value.(string); ok {
+			result = append(result, s)
+		}
+	}
+	return result, true
+}
+
+// lintFields checks that required and recommended metadata are present and
+// that every known metadata has the right type
+func (l *discoveryLinter) lintFields() {
+	for _, field := range requiredDiscoveryFields {
+		if isEmptyMetadata(l.discovery[field]) {
+			l.add(models.SeverityError, "required", field, refDiscoveryMetadata+"; "+refRFC8414Metadata, "Required metadata %s is missing", field)
+		}
+	}
+	for _, field := range recommendedDiscoveryFields {
+		if isEmptyMetadata(l.discovery[field]) {
+			l.add(models.SeverityWarning, "recommended", field, refDiscoveryMetadata, "Recommended metadata %s is missing", field)
+		}
+	}
+
+	fields := make([]string, 0, len(l.discovery))
+	for field := range l.discovery {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	for _, field := range fields {
+		value := l.discovery[field]
+		switch {
+		case discoveryBooleanFields[field]:
+			if _, ok := value.(bool); !ok {
+				l.add(models.SeverityError, "type", field, refDiscoveryMetadata, "%s must be a boolean", field)
+			}
+		case strings.HasSuffix(field, "_supported"):
+			if !isStringList(value) {
+				l.add(models.SeverityError, "type", field, refDiscoveryMetadata, "%s must be a JSON array of strings", field)
+			}
+		case field == "issuer" || strings.HasSuffix(field, "_endpoint") || strings.HasSuffix(field, "_uri") || strings.HasSuffix(field, "_iframe"):
+			if _, ok := value.(string); !ok {
+				l.add(models.SeverityError, "type", field, refDiscoveryMetadata, "%s must be a string", field)
+			}
+		}
+	}
+}
+
+// lintIssuer checks that the issuer is the URL the document was discovered
+// from, and a valid issuer identifier
+func (l *discoveryLinter) lintIssuer() {
+	issuer, _ := l.discovery["issuer"].(string)
+	if issuer == "" {
+		return
+	}
+
+	switch {
+	case issuer == l.issuer:
+	case strings.TrimSuffix(issuer, "/") == strings.TrimSuffix(l.issuer, "/"):
+		l.add(models.SeverityWarning, "issuer-match", "issuer", refDiscoveryIssuer, "Issuer %s differs from %s by a trailing slash; clients compare them exactly", issuer, l.issuer)
+	default:
+		l.add(models.SeverityError, "issuer-match", "issuer", refDiscoveryIssuer+"; "+refRFC8414Issuer, "Issuer %s is not the URL the document was discovered from (%s)", issuer, l.issuer)
+	}
+
+	parsed, err := url.Parse(issuer)
+	if err != nil || parsed.Host == "" {
+		l.add(models.SeverityError, "issuer-format", "issuer", refRFC8414Metadata, "Issuer %s is not an absolute URL", issuer)
+		return
+	}
+	if parsed.RawQuery != "" || parsed.Fragment != "" {
+		l.add(models.SeverityError, "issuer-format", "issuer", refRFC8414Metadata, "Issuer %s must not have a query or fragment", issuer)
+	}
+	l.lintHTTPS("issuer", parsed)
+}
+
+// lintEndpoints checks that every endpoint is an absolute HTTPS URL
+func (l *discoveryLinter) lintEndpoints() {
+	for _, field := range discoveryEndpointFields {
+		endpoint, ok := l.discovery[field].(string)
+		if !ok || endpoint == "" {
+			continue
+		}
+		parsed, err := url.Parse(endpoint)
+		if err != nil || !parsed.IsAbs() || parsed.Host == "" {
+			l.add(models.SeverityError, "endpoint-format", field, refRFC8414Metadata, "%s is not an absolute URL: %s", field, endpoint)
+			continue
+		}
+		if parsed.Fragment != "" {
+			l.add(models.SeverityError, "endpoint-format", field, refRFC8414Metadata, "%s must not have a fragment", field)
+		}
+		l.lintHTTPS(field, parsed)
+	}
+}
+
+// lintHTTPS reports URLs that do not use TLS. Plain HTTP on a loopback
+// address, as used by local mocks, is only a warning.
+func (l *discoveryLinter) lintHTTPS(field string, parsed *url.URL) {
+	if parsed.Scheme == "https" {
+		return
+	}
+	if isLoopbackHost(parsed.Hostname()) {
+		l.add(models.SeverityWarning, "https", field, refDiscoveryMetadata+"; "+refRFC8414Metadata, "%s uses %s; allowed for local tests only", field, parsed.Scheme)
+		return
+	}
+	l.add(models.SeverityError, "https", field, refDiscoveryMetadata+"; "+refRFC8414Metadata, "%s must use the https scheme, not %s", field, parsed.Scheme)
+}
+
+// lintPKCE checks that PKCE is advertised with the S256 method, which this
+// tool always uses
+func (l *discoveryLinter) lintPKCE() {
+	methods, ok := l.strings("code_challenge_methods_supported")
+	if !ok {
+		l.add(models.SeverityWarning, "pkce", "code_challenge_methods_supported", refRFC8414Metadata+"; "+refSecurityBCP, "PKCE support is not advertised; this tool always sends an S256 code challenge")
+		return
+	}
+	if !containsString(methods, "S256") {
+		l.add(models.SeverityError, "pkce", "code_challenge_methods_supported", refPKCE, "S256 is not among the PKCE methods (%s)", strings.Join(methods, ", "))
+	}
+	if containsString(methods, "plain") {
+		l.add(models.SeverityWarning, "pkce", "code_challenge_methods_supported", refSecurityBCP, "The plain PKCE method does not protect the code if the challenge leaks; prefer S256 only")
+	}
+}
+
+// lintFlows checks that the response types and grant types describe the same flows
+func (l *discoveryLinter) lintFlows() {
+	responseTypes, _ := l.strings("response_types_supported")
+	grantTypes, ok := l.strings("grant_types_supported")
+	if !ok {
+		grantTypes = []string{"authorization_code", "implicit"}
+		l.add(models.SeverityInfo, "grant-types", "grant_types_supported", refRFC8414Metadata, "grant_types_supported is missing, so it defaults to authorization_code and implicit")
+	}
+	if _, ok := l.discovery["token_endpoint_auth_methods_supported"]; !ok {
+		l.add(models.SeverityInfo, "client-auth", "token_endpoint_auth_methods_supported", refRFC8414Metadata, "token_endpoint_auth_methods_supported is missing, so it defaults to client_secret_basic")
+	}
+
+	hasCode, hasImplicit := false, false
+	for _, responseType := range responseTypes {
+		parts := strings.Fields(responseType)
+		if containsString(parts, "code") {
+			hasCode = true
+			if !containsString(grantTypes, "authorization_code") {
+				l.add(models.SeverityError, "flow-consistency", "grant_types_supported", refRFC8414Metadata, "Response type %q needs the authorization_code grant, which is not advertised", responseType)
+			}
+		}
+		if containsString(parts, "token") || containsString(parts, "id_token") {
+			hasImplicit = true
+			if !containsString(grantTypes, "implicit") {
+				l.add(models.SeverityError, "flow-consistency", "grant_types_supported", refRFC8414Metadata, "Response type %q issues tokens from the authorization endpoint, which needs the implicit grant", responseType)
+			}
+		}
+	}
+
+	if len(responseTypes) > 0 && !hasCode {
+		l.add(models.SeverityWarning, "flow-consistency", "response_types_supported", refDiscoveryMetadata, "The code response type is not supported, so the authorization code flow cannot be used")
+	}
+	if containsString(grantTypes, "authorization_code") && len(responseTypes) > 0 && !hasCode {
+		l.add(models.SeverityError, "flow-consistency", "response_types_supported", refRFC8414Metadata, "The authorization_code grant is advertised but no response type returns a code")
+	}
+	if ok && containsString(grantTypes, "implicit") && !hasImplicit {
+		l.add(models.SeverityWarning, "flow-consistency", "grant_types_supported", refRFC8414Metadata, "The implicit grant is advertised but no response type returns tokens")
+	}
+	if ok && containsString(grantTypes, "implicit") {
+		l.add(models.SeverityWarning, "deprecated-grant", "grant_types_supported", refSecurityBCP, "The implicit grant exposes tokens in the redirect and should not be offered")
+	}
+	if containsString(grantTypes, "password") {
+		l.add(models.SeverityWarning, "deprecated-grant", "grant_types_supported", "RFC 9700 §2.4", "The resource owner password credentials grant must not be used")
+	}
+	if _, hasTokenEndpoint := l.discovery["token_endpoint"]; containsString(grantTypes, "refresh_token") && !hasTokenEndpoint {
+		l.add(models.SeverityError, "flow-consistency", "token_endpoint", refRFC8414Metadata, "The refresh_token grant is advertised without a token endpoint")
+	}
+}
+
+// lintSigning checks the ID token signing algorithms, subject types and scopes
+func (l *discoveryLinter) lintSigning() {
+	if algs, ok := l.strings("id_token_signing_alg_values_supported"); ok {
+		if !containsString(algs, "RS256") {
+			l.add(models.SeverityError, "id-token-alg", "id_token_signing_alg_values_supported", refDiscoveryMetadata, "RS256 must be among the ID token signing algorithms (%s)", strings.Join(algs, ", "))
+		}
+		if containsString(algs, "none") {
+			l.add(models.SeverityWarning, "id-token-alg", "id_token_signing_alg_values_supported", refDiscoveryMetadata, "Unsigned ID tokens (alg none) are accepted")
+		}
+	}
+
+	if subjectTypes, ok := l.strings("subject_types_supported"); ok {
+		for _, subjectType := range subjectTypes {
+			if subjectType != "public" && subjectType != "pairwise" {
+				l.add(models.SeverityError, "subject-type", "subject_types_supported", refDiscoveryMetadata, "Unknown subject type %q; valid types are public and pairwise", subjectType)
+			}
+		}
+	}
+
+	if scopes, ok := l.strings("scopes_supported"); ok && !containsString(scopes, "openid") {
+		l.add(models.SeverityError, "openid-scope", "scopes_supported", refDiscoveryMetadata, "scopes_supported must include openid")
+	}
+	if claims, ok := l.strings("claims_supported"); ok && !containsString(claims, "sub") {
+		l.add(models.SeverityWarning, "sub-claim", "claims_supported", refDiscoveryMetadata, "claims_supported does not list sub, which every ID token carries")
+	}
+}
+
+// probeDiscoveryEndpoints sends a plain GET to every advertised endpoint.
+// Any answer below 500 shows the endpoint is served, though a 404 is
+// suspicious, except for the JWKS, which must return a key set.
+func probeDiscoveryEndpoints(ctx context.Context, history *HistoryService, discovery map[string]interface{}) ([]models.EndpointProbe, []models.LintFinding) {
+	client := NewHTTPClient(history, "lint")
+	client.Timeout = 10 * time.Second
+	client.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse // a redirect is an answer
+	}
+
+	var probes []models.EndpointProbe
+	var findings []models.LintFinding
+	add := func(severity, field, format string, args ...interface{}) {
+		findings = append(findings, models.LintFinding{
+			Severity:  severity,
+			Rule:      "endpoint-responds",
+			Field:     field,
+			Message:   fmt.Sprintf(format, args...),
+			Reference: refRFC8414Metadata,
+		})
+	}
+	fail := func(field, format string, args ...interface{}) {
+		add(models.SeverityError, field, format, args...)
+	}
+
+	for _, field := range discoveryEndpointFields {
+		endpoint, ok := discovery[field].(string)
+		if !ok {
+			continue
+		}
+		if parsed, err := url.Parse(endpoint); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+			continue
+		}
+
+		probe := models.EndpointProbe{Field: field, URL: endpoint}
+		start := time.Now()
+		body, status, err := probeEndpoint(ctx, client, endpoint)
+		probe.DurationMs = time.Since(start).Milliseconds()
+		probe.Status = status
+
+		switch {
+		case err != nil:
+			probe.Error = err.Error()
+			fail(field, "%s did not respond: %v", field, err)
+		case status >= 500:
+			fail(field, "%s answered with status %d", field, status)
+		case field == "jwks_uri" && status != http.StatusOK:
+			fail(field, "jwks_uri answered with status %d instead of a key set", status)
+		case status == http.StatusNotFound:
+			// Some servers answer 404 to methods a route does not accept
+			add(models.SeverityWarning, field, "%s answered a GET with status 404; check that it is served at this URL", field)
+		case field == "jwks_uri":
+			if jwks, err := ParseJWKS(body); err != nil {
+				probe.Error = err.Error()
+				fail(field, "jwks_uri did not return a key set: %v", err)
+			} else if len(jwks.Keys) == 0 {
+				fail(field, "jwks_uri returned a key set without keys")
+			}
+		}
+		probes = append(probes, probe)
+	}
+
+	return probes, findings
+}
+
+// probeEndpoint fetches an endpoint, returning its body and status
+func probeEndpoint(ctx context.Context, client *http.Client, endpoint string) ([]byte, int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	return body, resp.StatusCode, err
+}
+
+// sortFindings orders findings by severity, keeping the order of each severity
+func sortFindings(findings []models.LintFinding) {
+	rank := make(map[string]int, len(models.Severities))
+	for i, severity := range models.Severities {
+		rank[severity] = i
+	}
+	sort.SliceStable(findings, func(i, j int) bool {
+		return rank[findings[i].Severity] < rank[findings[j].Severity]
+	})
+}
+
+// isEmptyMetadata reports whether a metadata value is missing or empty
+func isEmptyMetadata(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case []interface{}:
+		return len(v) == 0
+	}
+	return false
+}
+
+// isStringList reports whether a decoded JSON value is an array of strings
+func isStringList(value interface{}) bool {
+	values, ok := value.([]interface{})
+	if !ok {
+		return false
+	}
+	for _, v := range values {
+		if _, ok := v.(string); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// isLoopbackHost reports whether a host name refers to the local machine
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// containsString reports whether a list holds a value
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,35 @@
+package services
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/pericles-luz/oauth2-test/internal/storage"
+	"github.com/pericles-luz/oauth2-test/migrations"
+)
+
+// newTestStore returns a migrated SQLite database, removed with the test
+func newTestStore(t *testing.T) storage.Store {
+	t.Helper()
+
+	db, err := storage.NewSQLiteDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	schemaMigrations, err := storage.LoadMigrations(migrations.For(db.Driver()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Migrate(schemaMigrations); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// newTestHistory returns a HistoryService on a migrated SQLite database
+func newTestHistory(t *testing.T) *HistoryService {
+	t.Helper()
+	return NewHistoryService(newTestStore(t))
+}
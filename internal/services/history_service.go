@@ -2,9 +2,14 @@ package services
 
 import (
 	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/pericles-luz/oauth2-test/internal/models"
@@ -13,16 +18,122 @@ import (
 
 // HistoryService handles HTTP request/response logging
 type HistoryService struct {
-	db *storage.SQLiteDB
+	db        storage.Store
+	snapshots *SnapshotService
+
+	mu          sync.RWMutex
+	subscribers map[chan models.HistoryEntry]struct{}
 }
 
 // NewHistoryService creates a new HistoryService
-func NewHistoryService(db *storage.SQLiteDB) *HistoryService {
-	return &HistoryService{db: db}
+func NewHistoryService(db storage.Store) *HistoryService {
+	return &HistoryService{
+		db:          db,
+		snapshots:   NewSnapshotService(db),
+		subscribers: make(map[chan models.HistoryEntry]struct{}),
+	}
+}
+
+// flowIDKey is the context key holding the flow ID of outgoing requests
+type flowIDKey struct{}
+
+// WithFlowID returns a context whose outgoing requests are tagged with a flow ID
+func WithFlowID(ctx context.Context, flowID string) context.Context {
+	return context.WithValue(ctx, flowIDKey{}, flowID)
+}
+
+// FlowIDFromContext returns the flow ID carried by a context, if any
+func FlowIDFromContext(ctx context.Context) string {
+	flowID, _ := ctx.Value(flowIDKey{}).(string)
+	return flowID
+}
+
+// profileIDKey is the context key holding the client profile of outgoing requests
+type profileIDKey struct{}
+
+// WithProfileID returns a context whose outgoing requests are tagged with a client profile
+func WithProfileID(ctx context.Context, profileID int64) context.Context {
+	return context.WithValue(ctx, profileIDKey{}, profileID)
+}
+
+// ProfileIDFromContext returns the client profile carried by a context, or 0
+func ProfileIDFromContext(ctx context.Context) int64 {
+	profileID, _ := ctx.Value(profileIDKey{}).(int64)
+	return profileID
+}
+
+// Exchange is a request made through a LoggingTransport and the response it got
+type Exchange struct {
+	EndpointType string
+	Method       string
+	URL          string
+	Status       int // 0 when the request failed
+	Header       http.Header
+	Body         []byte
+	Duration     time.Duration
+}
+
+// exchangeRecorderKey is the context key holding the function outgoing requests are reported to
+type exchangeRecorderKey struct{}
+
+// WithExchangeRecorder returns a context whose outgoing requests are also
+// reported to record, for callers that need the raw responses
+func WithExchangeRecorder(ctx context.Context, record func(Exchange)) context.Context {
+	return context.WithValue(ctx, exchangeRecorderKey{}, record)
+}
+
+// recordExchange reports an exchange to the recorder carried by ctx, if any
+func recordExchange(ctx context.Context, exchange Exchange) {
+	if record, ok := ctx.Value(exchangeRecorderKey{}).(func(Exchange)); ok {
+		record(exchange)
+	}
+}
+
+// GenerateFlowID generates a short random identifier for an OAuth flow
+func GenerateFlowID() (string, error) {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
 }
 
-// LogRequest logs an HTTP request and response to the database
+// Subscribe registers a listener for newly logged entries.
+// The returned function must be called to release the subscription.
+func (s *HistoryService) Subscribe() (<-chan models.HistoryEntry, func()) {
+	ch := make(chan models.HistoryEntry, 32)
+
+	s.mu.Lock()
+	s.subscribers[ch] = struct{}{}
+	s.mu.Unlock()
+
+	return ch, func() {
+		s.mu.Lock()
+		if _, ok := s.subscribers[ch]; ok {
+			delete(s.subscribers, ch)
+			close(ch)
+		}
+		s.mu.Unlock()
+	}
+}
+
+// publish notifies subscribers of a new entry. Slow subscribers miss entries instead of blocking logging.
+func (s *HistoryService) publish(entry models.HistoryEntry) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for ch := range s.subscribers {
+		select {
+		case ch <- entry:
+		default:
+		}
+	}
+}
+
+// LogRequest logs an HTTP request and response to the database.
+// The flow ID and client profile carried by ctx, if any, are stored with the entry.
 func (s *HistoryService) LogRequest(
+	ctx context.Context,
 	method, url string,
 	reqHeaders http.Header,
 	reqBody []byte,
@@ -52,9 +163,19 @@ func (s *HistoryService) LogRequest(
 		ResponseBody:    string(respBody),
 		DurationMs:      duration.Milliseconds(),
 		EndpointType:    endpointType,
+		FlowID:          FlowIDFromContext(ctx),
+		ProfileID:       ProfileIDFromContext(ctx),
 	}
 
-	return s.db.SaveHistoryEntry(entry)
+	if err := s.db.SaveHistoryEntry(entry); err != nil {
+		return err
+	}
+
+	// The database sets created_at; subscribers get the time of logging, to the second
+	entry.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	s.publish(*entry)
+
+	return nil
 }
 
 // GetHistory retrieves paginated history entries
@@ -72,6 +193,38 @@ func (s *HistoryService) GetHistoryByType(endpointType string, limit, offset int
 	return s.db.GetHistoryEntriesByType(endpointType, limit, offset)
 }
 
+// GetHistoryFiltered retrieves history entries matching a filter
+func (s *HistoryService) GetHistoryFiltered(filter models.HistoryFilter, limit, offset int) ([]models.HistoryEntry, error) {
+	return s.db.GetHistoryEntriesFiltered(filter, limit, offset)
+}
+
+// GetEndpointTypes returns the endpoint types present in the history
+func (s *HistoryService) GetEndpointTypes() ([]string, error) {
+	return s.db.GetEndpointTypes()
+}
+
+// SetPinned pins or unpins a history entry to protect it from pruning
+func (s *HistoryService) SetPinned(id int64, pinned bool) error {
+	return s.db.SetHistoryPinned(id, pinned)
+}
+
+// Snapshots returns the versions kept of the discovery documents and key
+// sets fetched through the service
+func (s *HistoryService) Snapshots() *SnapshotService {
+	return s.snapshots
+}
+
+// recordSnapshot records a fetched document, logging failures instead of
+// failing the fetch
+func (s *HistoryService) recordSnapshot(kind, source string, document []byte) {
+	if s == nil || s.snapshots == nil {
+		return
+	}
+	if _, err := s.snapshots.Record(kind, source, document); err != nil {
+		log.Printf("Error recording %s snapshot of %s: %v", kind, source, err)
+	}
+}
+
 // LoggingTransport is an HTTP transport that logs all requests and responses
 type LoggingTransport struct {
 	Transport    http.RoundTripper
@@ -104,6 +257,7 @@ func (t *LoggingTransport) RoundTrip(req *http.Request) (*http.Response, error)
 	if err != nil {
 		// Log error case
 		_ = t.History.LogRequest(
+			req.Context(),
 			req.Method,
 			req.URL.String(),
 			req.Header,
@@ -114,6 +268,14 @@ func (t *LoggingTransport) RoundTrip(req *http.Request) (*http.Response, error)
 			time.Since(start),
 			t.EndpointType,
 		)
+		recordExchange(req.Context(), Exchange{
+			EndpointType: t.EndpointType,
+			Method:       req.Method,
+			URL:          req.URL.String(),
+			Header:       http.Header{},
+			Body:         []byte(err.Error()),
+			Duration:     time.Since(start),
+		})
 		return nil, err
 	}
 
@@ -128,6 +290,7 @@ func (t *LoggingTransport) RoundTrip(req *http.Request) (*http.Response, error)
 
 	// Log to history service
 	_ = t.History.LogRequest(
+		req.Context(),
 		req.Method,
 		req.URL.String(),
 		req.Header,
@@ -138,6 +301,15 @@ func (t *LoggingTransport) RoundTrip(req *http.Request) (*http.Response, error)
 		duration,
 		t.EndpointType,
 	)
+	recordExchange(req.Context(), Exchange{
+		EndpointType: t.EndpointType,
+		Method:       req.Method,
+		URL:          req.URL.String(),
+		Status:       resp.StatusCode,
+		Header:       resp.Header,
+		Body:         respBody,
+		Duration:     duration,
+	})
 
 	return resp, nil
 }
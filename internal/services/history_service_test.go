@@ -0,0 +1,34 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestHistoryServicePublishesLoggedEntries(t *testing.T) {
+	historyService := newTestHistory(t)
+	entries, unsubscribe := historyService.Subscribe()
+	defer unsubscribe()
+
+	ctx := WithFlowID(context.Background(), "flow")
+	err := historyService.LogRequest(ctx, "POST", "https://idp.example/token", http.Header{"Accept": {"application/json"}},
+		[]byte("grant_type=refresh_token"), 200, http.Header{}, []byte(`{"access_token":"a"}`), 120*time.Millisecond, "token")
+	if err != nil {
+		t.Fatalf("LogRequest() error = %v", err)
+	}
+
+	published := <-entries
+	saved, err := historyService.GetHistoryEntry(published.ID)
+	if err != nil || saved == nil {
+		t.Fatalf("GetHistoryEntry(%d) = %v, %v, want the published entry", published.ID, saved, err)
+	}
+	if published.RequestBody != saved.RequestBody || published.ResponseBody != saved.ResponseBody ||
+		published.RequestHeaders != saved.RequestHeaders || published.FlowID != "flow" || published.DurationMs != 120 {
+		t.Errorf("published = %+v, want %+v", published, *saved)
+	}
+	if diff := saved.CreatedAt.Sub(published.CreatedAt); diff < -time.Second || diff > time.Second {
+		t.Errorf("published created at = %s, saved %s", published.CreatedAt, saved.CreatedAt)
+	}
+}
@@ -0,0 +1,88 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pericles-luz/oauth2-test/internal/models"
+)
+
+// IssuerService resolves the endpoints of each issuer from its discovery document.
+// Documents are cached per base URL, so switching issuers needs no restart.
+type IssuerService struct {
+	historyService *HistoryService
+	ttl            time.Duration
+
+	mu    sync.Mutex
+	cache map[string]issuerCacheEntry
+}
+
+// issuerCacheEntry is a discovery document fetched at a given time
+type issuerCacheEntry struct {
+	discovery map[string]interface{}
+	fetchedAt time.Time
+}
+
+// NewIssuerService creates a new IssuerService keeping discovery documents for ttl
+func NewIssuerService(historyService *HistoryService, ttl time.Duration) *IssuerService {
+	return &IssuerService{
+		historyService: historyService,
+		ttl:            ttl,
+		cache:          make(map[string]issuerCacheEntry),
+	}
+}
+
+// Discover fetches the discovery document of an issuer and refreshes the cache
+func (s *IssuerService) Discover(ctx context.Context, baseURL string) (map[string]interface{}, error) {
+	oauthService := NewOAuthService(&models.OAuthConfig{BaseURL: baseURL}, s.historyService).WithContext(ctx)
+	discovery, err := oauthService.FetchDiscovery()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.cache[baseURL] = issuerCacheEntry{discovery: discovery, fetchedAt: time.Now()}
+	s.mu.Unlock()
+
+	return discovery, nil
+}
+
+// Endpoints returns the endpoints advertised by an issuer, fetching its discovery
+// document when the cached one expired. Endpoints missing from the document, or
+// all of them when discovery fails, fall back to models.DefaultEndpoints.
+func (s *IssuerService) Endpoints(ctx context.Context, baseURL string) models.IssuerEndpoints {
+	s.mu.Lock()
+	entry, ok := s.cache[baseURL]
+	s.mu.Unlock()
+
+	discovery := entry.discovery
+	if !ok || time.Since(entry.fetchedAt) > s.ttl {
+		fetched, err := s.Discover(ctx, baseURL)
+		if err != nil {
+			// Remember the failure too, instead of retrying on every request
+			s.mu.Lock()
+			s.cache[baseURL] = issuerCacheEntry{fetchedAt: time.Now()}
+			s.mu.Unlock()
+		}
+		discovery = fetched
+	}
+
+	return EndpointsFromDiscovery(discovery).Merge(models.DefaultEndpoints(baseURL))
+}
+
+// EndpointsFromDiscovery extracts the endpoint URLs of a discovery document
+func EndpointsFromDiscovery(discovery map[string]interface{}) models.IssuerEndpoints {
+	get := func(key string) string {
+		value, _ := discovery[key].(string)
+		return value
+	}
+	return models.IssuerEndpoints{
+		Authorization: get("authorization_endpoint"),
+		Token:         get("token_endpoint"),
+		UserInfo:      get("userinfo_endpoint"),
+		Revocation:    get("revocation_endpoint"),
+		Introspection: get("introspection_endpoint"),
+		JWKS:          get("jwks_uri"),
+	}
+}
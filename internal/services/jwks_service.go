@@ -1,6 +1,7 @@
 package services
 
 import (
+	"context"
 	"crypto/rsa"
 	"encoding/base64"
 	"encoding/json"
@@ -11,20 +12,47 @@ import (
 	"strings"
 
 	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/pericles-luz/oauth2-test/internal/models"
 )
 
 // JWKSService handles JWT validation using JWKS
 type JWKSService struct {
 	jwksURL        string
+	keys           *JWKSet // validates against these keys instead of fetching jwksURL
 	historyService *HistoryService
+	ctx            context.Context
 }
 
-// NewJWKSService creates a new JWKSService
-func NewJWKSService(baseURL string, historyService *HistoryService) *JWKSService {
+// NewJWKSService creates a new JWKSService for the key set at jwksURL
+func NewJWKSService(jwksURL string, historyService *HistoryService) *JWKSService {
 	return &JWKSService{
-		jwksURL:        baseURL + "/oauth2/jwks",
+		jwksURL:        jwksURL,
 		historyService: historyService,
+		ctx:            context.Background(),
+	}
+}
+
+// NewStaticJWKSService creates a JWKSService validating against a key set
+// loaded beforehand, e.g. from a file
+func NewStaticJWKSService(keys *JWKSet) *JWKSService {
+	return &JWKSService{keys: keys, ctx: context.Background()}
+}
+
+// ParseJWKS decodes a JSON Web Key Set
+func ParseJWKS(data []byte) (*JWKSet, error) {
+	var jwks JWKSet
+	if err := json.Unmarshal(data, &jwks); err != nil {
+		return nil, fmt.Errorf("failed to decode JWKS: %w", err)
 	}
+	return &jwks, nil
+}
+
+// WithContext returns a copy of the service whose requests use ctx
+func (s *JWKSService) WithContext(ctx context.Context) *JWKSService {
+	clone := *s
+	clone.ctx = ctx
+	return &clone
 }
 
 // JWK represents a JSON Web Key
@@ -44,11 +72,15 @@ type JWKSet struct {
 
 // FetchJWKS fetches the JWKS from the server
 func (s *JWKSService) FetchJWKS() (*JWKSet, error) {
+	if s.keys != nil {
+		return s.keys, nil
+	}
+
 	// Create HTTP client with logging
 	client := NewHTTPClient(s.historyService, "jwks")
 
 	// Create request
-	req, err := http.NewRequest("GET", s.jwksURL, nil)
+	req, err := http.NewRequestWithContext(s.ctx, "GET", s.jwksURL, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create JWKS request: %w", err)
 	}
@@ -63,15 +95,22 @@ func (s *JWKSService) FetchJWKS() (*JWKSet, error) {
 	// Check status code
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("JWKS request failed with status %d: %s", resp.StatusCode, string(body))
+		return nil, &StatusError{Request: "JWKS", Status: resp.StatusCode, Body: string(body)}
 	}
 
 	// Parse response
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JWKS response: %w", err)
+	}
 	var jwks JWKSet
-	if err := json.NewDecoder(resp.Body).Decode(&jwks); err != nil {
+	if err := json.Unmarshal(body, &jwks); err != nil {
 		return nil, fmt.Errorf("failed to decode JWKS response: %w", err)
 	}
 
+	// Keep a version, to notice when the provider rotates keys
+	s.historyService.recordSnapshot(models.SnapshotJWKS, s.jwksURL, body)
+
 	return &jwks, nil
 }
 
@@ -164,6 +203,26 @@ func jwkToRSAPublicKey(jwk *JWK) (*rsa.PublicKey, error) {
 	return publicKey, nil
 }
 
+// ParseTokenHeader decodes the header of a JWT without validating it
+func ParseTokenHeader(tokenString string) (map[string]interface{}, error) {
+	parts := strings.Split(tokenString, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("invalid token format")
+	}
+
+	headerBytes, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode header: %w", err)
+	}
+
+	var header map[string]interface{}
+	if err := json.Unmarshal(headerBytes, &header); err != nil {
+		return nil, fmt.Errorf("failed to parse header: %w", err)
+	}
+
+	return header, nil
+}
+
 // ParseTokenWithoutValidation parses a JWT without validating its signature
 // Useful for inspecting token contents
 func ParseTokenWithoutValidation(tokenString string) (jwt.MapClaims, error) {
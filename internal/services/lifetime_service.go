@@ -0,0 +1,308 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/pericles-luz/oauth2-test/internal/models"
+)
+
+// lifetimeTolerance is how far two sources may disagree on an expiry
+// before the timeline flags it
+const lifetimeTolerance = time.Minute
+
+// LifetimeService reports the issue and expiry times of session tokens and
+// probes whether the server enforces the advertised access token lifetime
+type LifetimeService struct {
+	tokenStore     *TokenStore
+	historyService *HistoryService
+	margin         time.Duration // how long before and after expiry the probes run
+
+	mu     sync.Mutex
+	probes map[string]*models.ExpiryProbe // by session ID
+	timers map[string][]*time.Timer
+}
+
+// NewLifetimeService creates a new LifetimeService. The probes of a session
+// are dropped when its tokens are deleted or expire from tokenStore.
+func NewLifetimeService(tokenStore *TokenStore, historyService *HistoryService, margin time.Duration) *LifetimeService {
+	s := &LifetimeService{
+		tokenStore:     tokenStore,
+		historyService: historyService,
+		margin:         margin,
+		probes:         make(map[string]*models.ExpiryProbe),
+		timers:         make(map[string][]*time.Timer),
+	}
+	tokenStore.OnRemove(s.forget)
+	return s
+}
+
+// Timeline lists the lifetimes of the access, refresh and ID tokens of a
+// session, from the token response and JWT claims and, if asked, from the
+// introspection endpoint
+func (s *LifetimeService) Timeline(ctx context.Context, sessionID string, client *models.OAuthConfig, introspect bool) ([]models.TokenLifetime, error) {
+	data, ok := s.tokenStore.Data(sessionID)
+	if !ok {
+		return nil, fmt.Errorf("session %s has no tokens", sessionID)
+	}
+	token := data.Token
+
+	var introspector *OAuthService
+	if introspect {
+		introspector = NewOAuthService(client, s.historyService).WithContext(ctx)
+	}
+
+	var timeline []models.TokenLifetime
+
+	// Access token
+	timeline = append(timeline, models.TokenLifetime{
+		Token:     models.TokenKindAccess,
+		Source:    models.LifetimeSourceExpiresIn,
+		IssuedAt:  data.IssuedAt,
+		ExpiresAt: token.Expiry,
+	})
+	if claims, err := ParseTokenWithoutValidation(token.AccessToken); err == nil {
+		timeline = append(timeline, lifetimeFromClaims(models.TokenKindAccess, models.LifetimeSourceClaims, claims))
+	}
+	if introspector != nil {
+		timeline = append(timeline, introspectLifetime(introspector, models.TokenKindAccess, token.AccessToken))
+	}
+
+	// Refresh token
+	if token.RefreshToken != "" {
+		refresh := models.TokenLifetime{
+			Token:     models.TokenKindRefresh,
+			Source:    models.LifetimeSourceAssumed,
+			IssuedAt:  data.IssuedAt,
+			ExpiresAt: data.ExpiresAt,
+		}
+		if seconds, ok := extraSeconds(token, "refresh_expires_in"); ok && seconds > 0 && !data.IssuedAt.IsZero() {
+			refresh.Source = models.LifetimeSourceRefreshExpiresIn
+			refresh.ExpiresAt = data.IssuedAt.Add(time.Duration(seconds) * time.Second)
+		}
+		timeline = append(timeline, refresh)
+		if claims, err := ParseTokenWithoutValidation(token.RefreshToken); err == nil {
+			timeline = append(timeline, lifetimeFromClaims(models.TokenKindRefresh, models.LifetimeSourceClaims, claims))
+		}
+		if introspector != nil {
+			timeline = append(timeline, introspectLifetime(introspector, models.TokenKindRefresh, token.RefreshToken))
+		}
+	}
+
+	// ID token
+	if idToken, ok := token.Extra("id_token").(string); ok && idToken != "" {
+		if claims, err := ParseTokenWithoutValidation(idToken); err == nil {
+			timeline = append(timeline, lifetimeFromClaims(models.TokenKindID, models.LifetimeSourceClaims, claims))
+		} else {
+			timeline = append(timeline, models.TokenLifetime{Token: models.TokenKindID, Source: models.LifetimeSourceClaims, Error: err.Error()})
+		}
+	}
+
+	flagMismatches(timeline)
+	return timeline, nil
+}
+
+// ScheduleProbe arranges for userinfo to be called with the current access
+// token of a session just before and just after it expires. A probe already
+// scheduled for the session is replaced.
+func (s *LifetimeService) ScheduleProbe(ctx context.Context, sessionID string, client *models.OAuthConfig) (*models.ExpiryProbe, error) {
+	data, ok := s.tokenStore.Data(sessionID)
+	if !ok {
+		return nil, fmt.Errorf("session %s has no tokens", sessionID)
+	}
+	expiry := data.Token.Expiry
+	if expiry.IsZero() {
+		return nil, errors.New("the access token has no advertised expiry")
+	}
+	before := time.Until(expiry.Add(-s.margin))
+	if before <= 0 {
+		return nil, fmt.Errorf("the access token expires in less than %s", s.margin)
+	}
+
+	flowID, err := GenerateFlowID()
+	if err != nil {
+		return nil, err
+	}
+	probeCtx := WithProfileID(WithFlowID(context.Background(), flowID), ProfileIDFromContext(ctx))
+	accessToken := data.Token.AccessToken
+	oauthService := NewOAuthService(client, s.historyService).WithContext(probeCtx)
+
+	probe := &models.ExpiryProbe{
+		SessionID:   sessionID,
+		FlowID:      flowID,
+		Fingerprint: Fingerprint(accessToken),
+		Expiry:      expiry,
+		Margin:      s.margin,
+		ScheduledAt: time.Now(),
+		Verdict:     models.ProbeVerdictPending,
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.stopTimers(sessionID)
+	s.probes[sessionID] = probe
+	s.timers[sessionID] = []*time.Timer{
+		time.AfterFunc(before, func() {
+			s.record(probe, func(p *models.ExpiryProbe, r *models.ProbeResult) { p.Before = r }, oauthService, accessToken)
+		}),
+		time.AfterFunc(time.Until(expiry.Add(s.margin)), func() {
+			s.record(probe, func(p *models.ExpiryProbe, r *models.ProbeResult) { p.After = r }, oauthService, accessToken)
+			s.finish(probe)
+		}),
+	}
+
+	copied := *probe
+	return &copied, nil
+}
+
+// Probe returns a copy of the last expiry probe of a session, or nil
+func (s *LifetimeService) Probe(sessionID string) *models.ExpiryProbe {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	probe, exists := s.probes[sessionID]
+	if !exists {
+		return nil
+	}
+	copied := *probe
+	return &copied
+}
+
+// Margin returns how long before and after expiry the probes run
+func (s *LifetimeService) Margin() time.Duration {
+	return s.margin
+}
+
+// Stop cancels the pending probes
+func (s *LifetimeService) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for sessionID := range s.timers {
+		s.stopTimers(sessionID)
+	}
+}
+
+// record calls userinfo for a probe and stores the result with set
+func (s *LifetimeService) record(probe *models.ExpiryProbe, set func(*models.ExpiryProbe, *models.ProbeResult), oauthService *OAuthService, accessToken string) {
+	result := &models.ProbeResult{At: time.Now()}
+	status, err := oauthService.UserInfoStatus(accessToken)
+	if err != nil {
+		result.Error = err.Error()
+	}
+	result.Status = status
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	set(probe, result)
+	probe.Verdict = probeVerdict(probe)
+}
+
+// finish forgets the timers of a probe once both have fired, keeping its
+// results until the session goes away
+func (s *LifetimeService) finish(probe *models.ExpiryProbe) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.probes[probe.SessionID] == probe {
+		delete(s.timers, probe.SessionID)
+	}
+}
+
+// forget cancels the probes of a session and drops their results
+func (s *LifetimeService) forget(sessionID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.stopTimers(sessionID)
+	delete(s.probes, sessionID)
+}
+
+// stopTimers cancels the pending probes of a session; s.mu must be held
+func (s *LifetimeService) stopTimers(sessionID string) {
+	for _, timer := range s.timers[sessionID] {
+		timer.Stop()
+	}
+	delete(s.timers, sessionID)
+}
+
+// probeVerdict interprets the results gathered so far
+func probeVerdict(probe *models.ExpiryProbe) string {
+	refused := func(r *models.ProbeResult) bool {
+		return r.Status == http.StatusUnauthorized || r.Status == http.StatusForbidden
+	}
+
+	if probe.Before != nil && !probe.Before.Accepted() {
+		if refused(probe.Before) {
+			return models.ProbeVerdictExpiredEarly
+		}
+		return models.ProbeVerdictFailed
+	}
+	if probe.After == nil {
+		return models.ProbeVerdictPending
+	}
+	switch {
+	case probe.After.Accepted():
+		return models.ProbeVerdictNotEnforced
+	case refused(probe.After):
+		if probe.Before == nil {
+			return models.ProbeVerdictPending
+		}
+		return models.ProbeVerdictEnforced
+	}
+	return models.ProbeVerdictFailed
+}
+
+// lifetimeFromClaims reads the iat and exp claims of a token
+func lifetimeFromClaims(kind, source string, claims jwt.MapClaims) models.TokenLifetime {
+	lifetime := models.TokenLifetime{Token: kind, Source: source}
+	if iat, err := claims.GetIssuedAt(); err == nil && iat != nil {
+		lifetime.IssuedAt = iat.Time
+	}
+	if exp, err := claims.GetExpirationTime(); err == nil && exp != nil {
+		lifetime.ExpiresAt = exp.Time
+	}
+	return lifetime
+}
+
+// introspectLifetime asks the introspection endpoint about a token
+func introspectLifetime(oauthService *OAuthService, kind, token string) models.TokenLifetime {
+	result, err := oauthService.IntrospectToken(token, kind)
+	if err != nil {
+		return models.TokenLifetime{Token: kind, Source: models.LifetimeSourceIntrospection, Error: err.Error()}
+	}
+
+	lifetime := lifetimeFromClaims(kind, models.LifetimeSourceIntrospection, jwt.MapClaims(result))
+	lifetime.Active, _ = result["active"].(bool)
+	return lifetime
+}
+
+// flagMismatches marks the expiries that disagree with the first source of
+// the same token
+func flagMismatches(timeline []models.TokenLifetime) {
+	reference := make(map[string]time.Time)
+	for i := range timeline {
+		entry := &timeline[i]
+		if entry.ExpiresAt.IsZero() {
+			continue
+		}
+		first, seen := reference[entry.Token]
+		if !seen {
+			reference[entry.Token] = entry.ExpiresAt
+			continue
+		}
+		diff := entry.ExpiresAt.Sub(first)
+		if diff < 0 {
+			diff = -diff
+		}
+		entry.Mismatch = diff > lifetimeTolerance
+	}
+}
@@ -0,0 +1,100 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+
+	"github.com/pericles-luz/oauth2-test/internal/models"
+)
+
+func TestLifetimeServiceProbe(t *testing.T) {
+	// Accept the token once, then refuse it
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) > 1 {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"sub":"123"}`))
+	}))
+	defer server.Close()
+
+	tokenStore := NewTokenStore(nil, time.Hour)
+	lifetimeService := NewLifetimeService(tokenStore, newTestHistory(t), 50*time.Millisecond)
+	defer lifetimeService.Stop()
+
+	tokenStore.Store("session", &oauth2.Token{AccessToken: "access", Expiry: time.Now().Add(150 * time.Millisecond)}, nil)
+	client := &models.OAuthConfig{BaseURL: server.URL, Endpoints: models.IssuerEndpoints{UserInfo: server.URL}}
+	if _, err := lifetimeService.ScheduleProbe(context.Background(), "session", client); err != nil {
+		t.Fatalf("ScheduleProbe() error = %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		probe := lifetimeService.Probe("session")
+		if probe != nil && probe.Verdict != models.ProbeVerdictPending {
+			if probe.Verdict != models.ProbeVerdictEnforced {
+				t.Errorf("verdict = %s, want %s", probe.Verdict, models.ProbeVerdictEnforced)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the probe never finished")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// The timers go once both fired; the result stays until the session goes
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		lifetimeService.mu.Lock()
+		timers := len(lifetimeService.timers)
+		lifetimeService.mu.Unlock()
+		if timers == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timers = %d, want 0", timers)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if lifetimeService.Probe("session") == nil {
+		t.Error("probe result dropped while the session has tokens")
+	}
+
+	tokenStore.Delete("session")
+	if lifetimeService.Probe("session") != nil {
+		t.Error("probe kept after the session tokens were deleted")
+	}
+}
+
+func TestLifetimeServiceForgetsExpiredSessions(t *testing.T) {
+	tokenStore := NewTokenStore(nil, time.Hour)
+	clock := &fakeClock{now: time.Now()}
+	tokenStore.now = clock.Now
+	lifetimeService := NewLifetimeService(tokenStore, newTestHistory(t), time.Minute)
+	defer lifetimeService.Stop()
+
+	tokenStore.Store("session", &oauth2.Token{AccessToken: "access", Expiry: clock.Now().Add(time.Hour)}, nil)
+	client := &models.OAuthConfig{Endpoints: models.IssuerEndpoints{UserInfo: "http://127.0.0.1:0"}}
+	if _, err := lifetimeService.ScheduleProbe(context.Background(), "session", client); err != nil {
+		t.Fatalf("ScheduleProbe() error = %v", err)
+	}
+
+	clock.Advance(2 * time.Hour)
+	tokenStore.Cleanup()
+
+	if lifetimeService.Probe("session") != nil {
+		t.Error("probe kept after the session tokens expired")
+	}
+	lifetimeService.mu.Lock()
+	defer lifetimeService.mu.Unlock()
+	if len(lifetimeService.timers) != 0 {
+		t.Errorf("timers = %d, want 0", len(lifetimeService.timers))
+	}
+}
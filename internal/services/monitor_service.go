@@ -0,0 +1,426 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pericles-luz/oauth2-test/internal/models"
+	"github.com/pericles-luz/oauth2-test/internal/storage"
+)
+
+// Names of the values the monitor keeps between runs
+const (
+	monitorStateRefreshToken   = "refresh_token" // refresh token of the refresh_token grant, as rotated
+	monitorStateStatusPrefix   = "status."       // "ok" or "failed" per check
+	monitorStateSnapshotPrefix = "snapshot."     // snapshot ID of the last version seen, per source URL
+)
+
+// MonitorService probes the provider on a schedule: it validates the
+// discovery document and the key set, runs a token grant round trip, and
+// alerts a webhook when a check fails or the published content changes.
+// The requests of each run share a flow ID, so they are grouped in history.
+type MonitorService struct {
+	db             storage.Store
+	historyService *HistoryService
+	profileService *ProfileService
+	issuerService  *IssuerService
+	config         models.MonitorConfig
+	webhookClient  *http.Client
+
+	mu      sync.Mutex // one run at a time, so a refresh token is never presented twice
+	stop    chan struct{}
+	stopped sync.WaitGroup
+}
+
+// NewMonitorService creates a new MonitorService
+func NewMonitorService(db storage.Store, historyService *HistoryService, profileService *ProfileService, issuerService *IssuerService, config models.MonitorConfig) *MonitorService {
+	return &MonitorService{
+		db:             db,
+		historyService: historyService,
+		profileService: profileService,
+		issuerService:  issuerService,
+		config:         config,
+		webhookClient:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Config returns the monitor configuration
+func (s *MonitorService) Config() models.MonitorConfig {
+	return s.config
+}
+
+// Start launches the scheduled runs. It does nothing if no interval is configured.
+func (s *MonitorService) Start() {
+	if !s.config.Enabled() || s.stop != nil {
+		return
+	}
+
+	s.stop = make(chan struct{})
+	s.stopped.Add(1)
+
+	go func() {
+		defer s.stopped.Done()
+
+		ticker := time.NewTicker(s.config.Interval)
+		defer ticker.Stop()
+
+		for {
+			if _, err := s.Run(context.Background(), models.TriggerScheduled); err != nil {
+				log.Printf("Monitor run failed: %v", err)
+			}
+
+			select {
+			case <-ticker.C:
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop terminates the scheduled runs and waits for the current one to finish
+func (s *MonitorService) Stop() {
+	if s.stop == nil {
+		return
+	}
+	close(s.stop)
+	s.stopped.Wait()
+	s.stop = nil
+}
+
+// Recent returns the most recent check results
+func (s *MonitorService) Recent(limit int) ([]models.MonitorCheck, error) {
+	return s.db.GetMonitorChecks(limit)
+}
+
+// Run executes every check once, records the results and sends the alerts
+// they raise. Failed checks are part of the run, not an error.
+func (s *MonitorService) Run(ctx context.Context, trigger string) (*models.MonitorRun, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	flowID, err := GenerateFlowID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate flow ID: %w", err)
+	}
+
+	run := &models.MonitorRun{
+		FlowID:    flowID,
+		Trigger:   trigger,
+		Issuer:    s.config.Issuer,
+		Healthy:   true,
+		StartedAt: time.Now(),
+	}
+
+	// The grant check uses the issuer of its profile, and so does the rest of the run
+	var profile *models.ClientProfile
+	var profileErr error
+	if s.config.Grant != "" {
+		profile, profileErr = s.profileService.Find(s.config.Profile)
+		if profileErr == nil && profile == nil {
+			profileErr = fmt.Errorf("client profile %q not found", s.config.Profile)
+		}
+		if profile != nil && profile.BaseURL != "" {
+			run.Issuer = profile.BaseURL
+		}
+	}
+	if profile != nil {
+		ctx = WithProfileID(ctx, profile.ID)
+	}
+	ctx = WithFlowID(ctx, flowID)
+
+	var discovery map[string]interface{}
+	s.check(run, models.MonitorCheckDiscovery, func(check *models.MonitorCheck) {
+		discovery = s.checkDiscovery(ctx, run.Issuer, check)
+	})
+
+	endpoints := EndpointsFromDiscovery(discovery).Merge(models.DefaultEndpoints(run.Issuer))
+	s.check(run, models.MonitorCheckJWKS, func(check *models.MonitorCheck) {
+		s.checkJWKS(ctx, endpoints.JWKS, check)
+	})
+
+	if s.config.Grant != "" {
+		s.check(run, models.MonitorCheckGrant, func(check *models.MonitorCheck) {
+			if profileErr != nil {
+				check.Error = profileErr.Error()
+				return
+			}
+			client := &models.OAuthConfig{
+				ClientID:     profile.ClientID,
+				ClientSecret: profile.ClientSecret,
+				RedirectURI:  profile.RedirectURI,
+				Scopes:       profile.Scopes,
+				BaseURL:      run.Issuer,
+				Endpoints:    endpoints,
+			}
+			s.checkGrant(ctx, client, check)
+		})
+	}
+
+	s.notify(run)
+	return run, nil
+}
+
+// check runs a check, times it, records its result and the alerts it raises
+func (s *MonitorService) check(run *models.MonitorRun, name string, fn func(check *models.MonitorCheck)) {
+	check := &models.MonitorCheck{
+		Check:     name,
+		Trigger:   run.Trigger,
+		FlowID:    run.FlowID,
+		CreatedAt: time.Now(),
+	}
+
+	fn(check)
+	check.Success = check.Error == ""
+	check.DurationMs = time.Since(check.CreatedAt).Milliseconds()
+
+	if err := s.db.SaveMonitorCheck(check); err != nil {
+		log.Printf("Failed to save monitor check: %v", err)
+	}
+	run.Checks = append(run.Checks, *check)
+	if !check.Success {
+		run.Healthy = false
+	}
+
+	// Alert on transitions only, so a lasting outage is reported once
+	status := "ok"
+	if !check.Success {
+		status = "failed"
+	}
+	previous := s.state(monitorStateStatusPrefix + name)
+	switch {
+	case !check.Success && previous != "failed":
+		run.Alerts = append(run.Alerts, models.MonitorAlert{Event: models.MonitorEventFailed, Check: name, Message: check.Error})
+	case check.Success && previous == "failed":
+		run.Alerts = append(run.Alerts, models.MonitorAlert{Event: models.MonitorEventRecovered, Check: name, Message: check.Details})
+	}
+	if check.Changed {
+		run.Alerts = append(run.Alerts, models.MonitorAlert{Event: models.MonitorEventChanged, Check: name, Message: check.Details})
+	}
+	s.setState(monitorStateStatusPrefix+name, status)
+}
+
+// checkDiscovery fetches the discovery document of the issuer, lints it and
+// compares its version with the previous run's. The document is returned even when
+// invalid, so the endpoints it names can be checked; it is nil when the
+// fetch failed.
+func (s *MonitorService) checkDiscovery(ctx context.Context, issuer string, check *models.MonitorCheck) map[string]interface{} {
+	discovery, err := s.issuerService.Discover(ctx, issuer)
+	if err != nil {
+		check.Error = err.Error()
+		return nil
+	}
+
+	// Only errors of the linter fail the check; warnings are not a regression
+	var problems []string
+	for _, finding := range LintDiscoveryDocument(issuer, discovery) {
+		if finding.Severity == models.SeverityError {
+			problems = append(problems, finding.Message)
+		}
+	}
+	check.Error = strings.Join(problems, "; ")
+
+	check.Details = fmt.Sprintf("%d fields", len(discovery))
+	s.compareSnapshot(issuer+"/.well-known/openid-configuration", check)
+
+	return discovery
+}
+
+// checkJWKS fetches the key set, validates each key and compares its version
+// with the previous run's
+func (s *MonitorService) checkJWKS(ctx context.Context, jwksURL string, check *models.MonitorCheck) {
+	jwks, err := NewJWKSService(jwksURL, s.historyService).WithContext(ctx).FetchJWKS()
+	if err != nil {
+		check.Error = err.Error()
+		return
+	}
+
+	var problems []string
+	if len(jwks.Keys) == 0 {
+		problems = append(problems, "key set has no keys")
+	}
+	seen := make(map[string]bool)
+	for i, key := range jwks.Keys {
+		name := key.Kid
+		if name == "" {
+			name = fmt.Sprintf("#%d", i)
+			problems = append(problems, fmt.Sprintf("key %s has no kid", name))
+		} else if seen[name] {
+			problems = append(problems, fmt.Sprintf("kid %s is not unique", name))
+		}
+		seen[name] = true
+
+		switch key.Kty {
+		case "":
+			problems = append(problems, fmt.Sprintf("key %s has no kty", name))
+		case "RSA":
+			if key.N == "" || key.E == "" {
+				problems = append(problems, fmt.Sprintf("RSA key %s lacks n or e", name))
+			}
+		}
+	}
+	check.Error = strings.Join(problems, "; ")
+
+	check.Details = fmt.Sprintf("%d keys: %s", len(jwks.Keys), strings.Join(keyIDs(jwks), ", "))
+	s.compareSnapshot(jwksURL, check)
+}
+
+// compareSnapshot compares the version of a document a check just fetched,
+// as the SnapshotService recorded it, with the version a previous run saw
+// from the same URL. A new version marks the check changed, with the fields
+// or keys it touched; a URL never seen, e.g. of a new issuer, changes nothing.
+func (s *MonitorService) compareSnapshot(source string, check *models.MonitorCheck) {
+	state := monitorStateSnapshotPrefix + source
+	snapshots := s.historyService.Snapshots()
+	latest, err := snapshots.Latest(source)
+	if err != nil {
+		log.Printf("Failed to read the snapshot of %s: %v", source, err)
+		return
+	}
+	if latest == nil {
+		return
+	}
+	check.Fingerprint = latest.Fingerprint
+
+	if previousID, err := strconv.ParseInt(s.state(state), 10, 64); err == nil && previousID != latest.ID {
+		changes, err := snapshots.ChangesSince(source, previousID)
+		if err != nil {
+			log.Printf("Failed to read the changes of %s: %v", source, err)
+		} else if len(changes) > 0 {
+			check.Changed = true
+			check.Details = "changed: " + describeChanges(changes)
+		}
+	}
+	s.setState(state, strconv.FormatInt(latest.ID, 10))
+}
+
+// describeChanges lists changed fields or keys by name, prefixed with + when
+// added and - when removed
+func describeChanges(changes []models.ProviderChange) string {
+	sorted := append([]models.ProviderChange(nil), changes...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Field < sorted[j].Field })
+
+	described := make([]string, len(sorted))
+	for i, change := range sorted {
+		switch change.Change {
+		case DiffAdded:
+			described[i] = "+" + change.Field
+		case DiffRemoved:
+			described[i] = "-" + change.Field
+		default:
+			described[i] = change.Field
+		}
+	}
+	return strings.Join(described, ", ")
+}
+
+// keyIDs returns the key IDs of a key set, in order
+func keyIDs(jwks *JWKSet) []string {
+	ids := make([]string, len(jwks.Keys))
+	for i, key := range jwks.Keys {
+		ids[i] = key.Kid
+	}
+	return ids
+}
+
+// checkGrant obtains a token with the configured grant. A refresh token
+// round trip also presents the new access token to userinfo, and keeps the
+// refresh token the server rotated in for the next run.
+func (s *MonitorService) checkGrant(ctx context.Context, client *models.OAuthConfig, check *models.MonitorCheck) {
+	oauthService := NewOAuthService(client, s.historyService).WithContext(ctx)
+
+	if s.config.Grant == models.MonitorGrantClientCredentials {
+		token, err := oauthService.ClientCredentialsToken()
+		if err != nil {
+			check.Error = err.Error()
+			return
+		}
+		check.Details = tokenDetails(token.Expiry)
+		return
+	}
+
+	refreshToken := s.state(monitorStateRefreshToken)
+	if refreshToken == "" {
+		refreshToken = s.config.RefreshToken
+	}
+	if refreshToken == "" {
+		check.Error = ErrNoRefreshToken.Error()
+		return
+	}
+
+	token, err := oauthService.RefreshToken(refreshToken)
+	if err != nil {
+		check.Error = err.Error()
+		return
+	}
+	check.Details = tokenDetails(token.Expiry)
+	if token.RefreshToken != "" && token.RefreshToken != refreshToken {
+		s.setState(monitorStateRefreshToken, token.RefreshToken)
+		check.Details += ", refresh token rotated"
+	}
+
+	status, err := oauthService.UserInfoStatus(token.AccessToken)
+	if err != nil {
+		check.Error = err.Error()
+		return
+	}
+	if status != http.StatusOK {
+		check.Error = fmt.Sprintf("userinfo rejected the new access token with status %d", status)
+	}
+}
+
+// tokenDetails describes the lifetime of an access token
+func tokenDetails(expiry time.Time) string {
+	if expiry.IsZero() {
+		return "access token without expiry"
+	}
+	return fmt.Sprintf("access token expires in %s", time.Until(expiry).Round(time.Second))
+}
+
+// notify posts the run to the webhook when it raised alerts
+func (s *MonitorService) notify(run *models.MonitorRun) {
+	if s.config.WebhookURL == "" || len(run.Alerts) == 0 {
+		return
+	}
+
+	payload, err := json.Marshal(run)
+	if err != nil {
+		log.Printf("Failed to encode monitor alert: %v", err)
+		return
+	}
+
+	resp, err := s.webhookClient.Post(s.config.WebhookURL, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		log.Printf("Failed to send monitor alert: %v", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Printf("Monitor webhook answered with status %d", resp.StatusCode)
+	}
+}
+
+// state reads a value kept between runs, logging failures
+func (s *MonitorService) state(name string) string {
+	value, err := s.db.GetMonitorState(name)
+	if err != nil {
+		log.Printf("Failed to read monitor state: %v", err)
+	}
+	return value
+}
+
+// setState stores a value kept between runs, logging failures
+func (s *MonitorService) setState(name, value string) {
+	if err := s.db.SetMonitorState(name, value); err != nil {
+		log.Printf("Failed to save monitor state: %v", err)
+	}
+}
@@ -0,0 +1,186 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pericles-luz/oauth2-test/internal/models"
+)
+
+// fakeProvider serves a discovery document and a key set that tests can change
+type fakeProvider struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	userInfo string
+	keyIDs   []string
+}
+
+func newFakeProvider(t *testing.T) *fakeProvider {
+	t.Helper()
+
+	p := &fakeProvider{userInfo: "/userinfo", keyIDs: []string{"k1"}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                p.URL,
+			"authorization_endpoint":                p.URL + "/authorize",
+			"token_endpoint":                        p.URL + "/token",
+			"userinfo_endpoint":                     p.URL + p.userInfo,
+			"jwks_uri":                              p.URL + "/jwks",
+			"response_types_supported":              []string{"code"},
+			"subject_types_supported":               []string{"public"},
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+			"code_challenge_methods_supported":      []string{"S256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		keys := make([]map[string]string, len(p.keyIDs))
+		for i, kid := range p.keyIDs {
+			keys[i] = map[string]string{"kty": "RSA", "kid": kid, "use": "sig", "alg": "RS256", "n": "AQAB" + kid, "e": "AQAB"}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": keys})
+	})
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+	return p
+}
+
+func (p *fakeProvider) set(userInfo string, keyIDs ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.userInfo = userInfo
+	p.keyIDs = keyIDs
+}
+
+// changeAlerts returns the content_changed alerts of a run by check
+func changeAlerts(run *models.MonitorRun) map[string]string {
+	alerts := make(map[string]string)
+	for _, alert := range run.Alerts {
+		if alert.Event == models.MonitorEventChanged {
+			alerts[alert.Check] = alert.Message
+		}
+	}
+	return alerts
+}
+
+func newTestMonitor(t *testing.T, historyService *HistoryService, issuer string) *MonitorService {
+	t.Helper()
+	db := historyService.db
+	return NewMonitorService(db, historyService, NewProfileService(db), NewIssuerService(historyService, time.Minute), models.MonitorConfig{Issuer: issuer})
+}
+
+func TestMonitorServiceChanges(t *testing.T) {
+	provider := newFakeProvider(t)
+	historyService := newTestHistory(t)
+	monitor := newTestMonitor(t, historyService, provider.URL)
+	ctx := context.Background()
+
+	run, err := monitor.Run(ctx, models.TriggerManual)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if alerts := changeAlerts(run); len(alerts) != 0 {
+		t.Errorf("first run alerts = %v, want none", alerts)
+	}
+
+	provider.set("/v2/userinfo", "k2")
+	run, err = monitor.Run(ctx, models.TriggerManual)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	alerts := changeAlerts(run)
+	if want := "changed: userinfo_endpoint"; alerts[models.MonitorCheckDiscovery] != want {
+		t.Errorf("discovery alert = %q, want %q", alerts[models.MonitorCheckDiscovery], want)
+	}
+	if want := "changed: -kid k1, +kid k2"; alerts[models.MonitorCheckJWKS] != want {
+		t.Errorf("jwks alert = %q, want %q", alerts[models.MonitorCheckJWKS], want)
+	}
+
+	run, err = monitor.Run(ctx, models.TriggerManual)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if alerts := changeAlerts(run); len(alerts) != 0 {
+		t.Errorf("unchanged run alerts = %v, want none", alerts)
+	}
+}
+
+func TestMonitorServiceChangeSeenElsewhere(t *testing.T) {
+	provider := newFakeProvider(t)
+	historyService := newTestHistory(t)
+	monitor := newTestMonitor(t, historyService, provider.URL)
+	ctx := context.Background()
+
+	if _, err := monitor.Run(ctx, models.TriggerManual); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	// A fetch from the UI records the new version before the monitor runs
+	provider.set("/v2/userinfo", "k1")
+	if _, err := NewIssuerService(historyService, time.Minute).Discover(ctx, provider.URL); err != nil {
+		t.Fatalf("Discover() error = %v", err)
+	}
+
+	run, err := monitor.Run(ctx, models.TriggerManual)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if want := "changed: userinfo_endpoint"; changeAlerts(run)[models.MonitorCheckDiscovery] != want {
+		t.Errorf("discovery alert = %q, want %q", changeAlerts(run)[models.MonitorCheckDiscovery], want)
+	}
+}
+
+func TestMonitorServiceSwitchingIssuer(t *testing.T) {
+	first := newFakeProvider(t)
+	second := newFakeProvider(t)
+	historyService := newTestHistory(t)
+	ctx := context.Background()
+
+	runAlerts := func(provider *fakeProvider) map[string]string {
+		t.Helper()
+		run, err := newTestMonitor(t, historyService, provider.URL).Run(ctx, models.TriggerManual)
+		if err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+		return changeAlerts(run)
+	}
+
+	runAlerts(first)
+
+	// Another issuer has nothing to compare with yet
+	if alerts := runAlerts(second); len(alerts) != 0 {
+		t.Errorf("alerts after switching issuer = %v, want none", alerts)
+	}
+	second.set("/v2/userinfo", "k1")
+	if alerts := runAlerts(second); len(alerts) != 1 {
+		t.Errorf("alerts after a change = %v, want the discovery one", alerts)
+	}
+
+	// Switching back and forth reports nothing already reported
+	if alerts := runAlerts(first); len(alerts) != 0 {
+		t.Errorf("alerts after switching back = %v, want none", alerts)
+	}
+	if alerts := runAlerts(second); len(alerts) != 0 {
+		t.Errorf("alerts after switching again = %v, want none", alerts)
+	}
+
+	// Each issuer is compared with what was last seen from it
+	first.set("/v3/userinfo", "k1")
+	alerts := runAlerts(first)
+	if want := "changed: userinfo_endpoint"; alerts[models.MonitorCheckDiscovery] != want {
+		t.Errorf("discovery alert = %q, want %q", alerts[models.MonitorCheckDiscovery], want)
+	}
+	if _, ok := alerts[models.MonitorCheckJWKS]; ok {
+		t.Errorf("jwks alert = %q, want none", alerts[models.MonitorCheckJWKS])
+	}
+}
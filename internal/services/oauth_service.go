@@ -12,35 +12,62 @@ import (
 	"strings"
 
 	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
 
 	"github.com/pericles-luz/oauth2-test/internal/models"
 )
 
+// StatusError is returned when an endpoint answers with an unexpected HTTP status
+type StatusError struct {
+	Request string // what was requested, e.g. "userinfo"
+	Status  int
+	Body    string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s request failed with status %d: %s", e.Request, e.Status, e.Body)
+}
+
 // OAuthService handles OAuth2 operations
 type OAuthService struct {
 	config         *oauth2.Config
+	endpoints      models.IssuerEndpoints
+	discoveryURL   string
 	historyService *HistoryService
+	ctx            context.Context
 }
 
 // NewOAuthService creates a new OAuthService
 func NewOAuthService(oauthConfig *models.OAuthConfig, historyService *HistoryService) *OAuthService {
+	endpoints := oauthConfig.ResolvedEndpoints()
 	config := &oauth2.Config{
 		ClientID:     oauthConfig.ClientID,
 		ClientSecret: oauthConfig.ClientSecret,
 		RedirectURL:  oauthConfig.RedirectURI,
 		Scopes:       oauthConfig.Scopes,
 		Endpoint: oauth2.Endpoint{
-			AuthURL:  oauthConfig.BaseURL + "/oauth2/authorize",
-			TokenURL: oauthConfig.BaseURL + "/oauth2/token",
+			AuthURL:  endpoints.Authorization,
+			TokenURL: endpoints.Token,
 		},
 	}
 
 	return &OAuthService{
 		config:         config,
+		endpoints:      endpoints,
+		discoveryURL:   oauthConfig.BaseURL + "/.well-known/openid-configuration",
 		historyService: historyService,
+		ctx:            context.Background(),
 	}
 }
 
+// WithContext returns a copy of the service whose requests use ctx.
+// A flow ID carried by ctx tags every logged request (see WithFlowID).
+func (s *OAuthService) WithContext(ctx context.Context) *OAuthService {
+	clone := *s
+	clone.ctx = ctx
+	return &clone
+}
+
 // GenerateAuthURL generates the authorization URL with PKCE
 func (s *OAuthService) GenerateAuthURL(state string) (authURL, verifier string, err error) {
 	// Generate PKCE verifier
@@ -58,11 +85,9 @@ func (s *OAuthService) GenerateAuthURL(state string) (authURL, verifier string,
 
 // ExchangeCode exchanges the authorization code for tokens
 func (s *OAuthService) ExchangeCode(code, verifier string) (*oauth2.Token, error) {
-	ctx := context.Background()
-
 	// Create HTTP client with logging
 	client := NewHTTPClient(s.historyService, "token")
-	ctx = context.WithValue(ctx, oauth2.HTTPClient, client)
+	ctx := context.WithValue(s.ctx, oauth2.HTTPClient, client)
 
 	// Exchange code for token with PKCE verifier
 	token, err := s.config.Exchange(
@@ -82,12 +107,8 @@ func (s *OAuthService) GetUserInfo(accessToken string) (*models.UserInfo, error)
 	// Create HTTP client with logging
 	client := NewHTTPClient(s.historyService, "userinfo")
 
-	// Build userinfo URL
-	userinfoURL := s.config.Endpoint.AuthURL
-	userinfoURL = strings.Replace(userinfoURL, "/oauth2/authorize", "/oauth2/userinfo", 1)
-
 	// Create request
-	req, err := http.NewRequest("GET", userinfoURL, nil)
+	req, err := http.NewRequestWithContext(s.ctx, "GET", s.endpoints.UserInfo, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create userinfo request: %w", err)
 	}
@@ -105,7 +126,7 @@ func (s *OAuthService) GetUserInfo(accessToken string) (*models.UserInfo, error)
 	// Check status code
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("userinfo request failed with status %d: %s", resp.StatusCode, string(body))
+		return nil, &StatusError{Request: "userinfo", Status: resp.StatusCode, Body: string(body)}
 	}
 
 	// Parse response
@@ -117,13 +138,64 @@ func (s *OAuthService) GetUserInfo(accessToken string) (*models.UserInfo, error)
 	return &userInfo, nil
 }
 
+// UserInfoClaims fetches every claim returned by the userinfo endpoint,
+// including the ones models.UserInfo does not know
+func (s *OAuthService) UserInfoClaims(accessToken string) (map[string]interface{}, error) {
+	// Create HTTP client with logging
+	client := NewHTTPClient(s.historyService, "userinfo")
+
+	req, err := http.NewRequestWithContext(s.ctx, "GET", s.endpoints.UserInfo, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create userinfo request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("userinfo request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, &StatusError{Request: "userinfo", Status: resp.StatusCode, Body: string(body)}
+	}
+
+	var claims map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&claims); err != nil {
+		return nil, fmt.Errorf("failed to decode userinfo response: %w", err)
+	}
+
+	return claims, nil
+}
+
+// UserInfoStatus calls the userinfo endpoint and returns its HTTP status,
+// to check whether the server still accepts an access token
+func (s *OAuthService) UserInfoStatus(accessToken string) (int, error) {
+	// Create HTTP client with logging
+	client := NewHTTPClient(s.historyService, "userinfo")
+
+	req, err := http.NewRequestWithContext(s.ctx, "GET", s.endpoints.UserInfo, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create userinfo request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("userinfo request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	return resp.StatusCode, nil
+}
+
 // RefreshToken refreshes an access token using a refresh token
 func (s *OAuthService) RefreshToken(refreshToken string) (*oauth2.Token, error) {
-	ctx := context.Background()
-
 	// Create HTTP client with logging
 	client := NewHTTPClient(s.historyService, "refresh")
-	ctx = context.WithValue(ctx, oauth2.HTTPClient, client)
+	ctx := context.WithValue(s.ctx, oauth2.HTTPClient, client)
 
 	// Create token source
 	token := &oauth2.Token{
@@ -140,15 +212,33 @@ func (s *OAuthService) RefreshToken(refreshToken string) (*oauth2.Token, error)
 	return newToken, nil
 }
 
+// ClientCredentialsToken obtains a token for the client itself, with the
+// client_credentials grant
+func (s *OAuthService) ClientCredentialsToken() (*oauth2.Token, error) {
+	// Create HTTP client with logging
+	client := NewHTTPClient(s.historyService, "token")
+	ctx := context.WithValue(s.ctx, oauth2.HTTPClient, client)
+
+	config := &clientcredentials.Config{
+		ClientID:     s.config.ClientID,
+		ClientSecret: s.config.ClientSecret,
+		TokenURL:     s.endpoints.Token,
+		Scopes:       s.config.Scopes,
+	}
+
+	token, err := config.Token(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("client credentials grant failed: %w", err)
+	}
+
+	return token, nil
+}
+
 // RevokeToken revokes an access token
 func (s *OAuthService) RevokeToken(token string) error {
 	// Create HTTP client with logging
 	client := NewHTTPClient(s.historyService, "revoke")
 
-	// Build revoke URL
-	revokeURL := s.config.Endpoint.AuthURL
-	revokeURL = strings.Replace(revokeURL, "/oauth2/authorize", "/oauth2/revoke", 1)
-
 	// Prepare form data
 	data := url.Values{}
 	data.Set("token", token)
@@ -156,7 +246,7 @@ func (s *OAuthService) RevokeToken(token string) error {
 	data.Set("client_secret", s.config.ClientSecret)
 
 	// Create request
-	req, err := http.NewRequest("POST", revokeURL, strings.NewReader(data.Encode()))
+	req, err := http.NewRequestWithContext(s.ctx, "POST", s.endpoints.Revocation, strings.NewReader(data.Encode()))
 	if err != nil {
 		return fmt.Errorf("failed to create revoke request: %w", err)
 	}
@@ -173,23 +263,56 @@ func (s *OAuthService) RevokeToken(token string) error {
 	// RFC 7009 specifies that revocation endpoint should return 200 even if token is invalid
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("revoke request failed with status %d: %s", resp.StatusCode, string(body))
+		return &StatusError{Request: "revoke", Status: resp.StatusCode, Body: string(body)}
 	}
 
 	return nil
 }
 
+// IntrospectToken asks the introspection endpoint (RFC 7662) about a token
+func (s *OAuthService) IntrospectToken(token, tokenTypeHint string) (map[string]interface{}, error) {
+	// Create HTTP client with logging
+	client := NewHTTPClient(s.historyService, "introspect")
+
+	data := url.Values{}
+	data.Set("token", token)
+	if tokenTypeHint != "" {
+		data.Set("token_type_hint", tokenTypeHint)
+	}
+
+	req, err := http.NewRequestWithContext(s.ctx, "POST", s.endpoints.Introspection, strings.NewReader(data.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create introspection request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(s.config.ClientID), url.QueryEscape(s.config.ClientSecret))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("introspection request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, &StatusError{Request: "introspection", Status: resp.StatusCode, Body: string(body)}
+	}
+
+	var result map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode introspection response: %w", err)
+	}
+
+	return result, nil
+}
+
 // FetchDiscovery fetches the OIDC discovery document
 func (s *OAuthService) FetchDiscovery() (map[string]interface{}, error) {
 	// Create HTTP client with logging
 	client := NewHTTPClient(s.historyService, "discovery")
 
-	// Build discovery URL
-	discoveryURL := s.config.Endpoint.AuthURL
-	discoveryURL = strings.Replace(discoveryURL, "/oauth2/authorize", "/.well-known/openid-configuration", 1)
-
 	// Create request
-	req, err := http.NewRequest("GET", discoveryURL, nil)
+	req, err := http.NewRequestWithContext(s.ctx, "GET", s.discoveryURL, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create discovery request: %w", err)
 	}
@@ -204,15 +327,22 @@ func (s *OAuthService) FetchDiscovery() (map[string]interface{}, error) {
 	// Check status code
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("discovery request failed with status %d: %s", resp.StatusCode, string(body))
+		return nil, &StatusError{Request: "discovery", Status: resp.StatusCode, Body: string(body)}
 	}
 
 	// Parse response
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read discovery response: %w", err)
+	}
 	var discovery map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&discovery); err != nil {
+	if err := json.Unmarshal(body, &discovery); err != nil {
 		return nil, fmt.Errorf("failed to decode discovery response: %w", err)
 	}
 
+	// Keep a version, to notice when the provider changes it
+	s.historyService.recordSnapshot(models.SnapshotDiscovery, s.discoveryURL, body)
+
 	return discovery, nil
 }
 
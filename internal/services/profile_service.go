@@ -0,0 +1,101 @@
+package services
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pericles-luz/oauth2-test/internal/models"
+	"github.com/pericles-luz/oauth2-test/internal/storage"
+)
+
+// ProfileService manages the persistent client profiles
+type ProfileService struct {
+	db storage.Store
+}
+
+// NewProfileService creates a new ProfileService
+func NewProfileService(db storage.Store) *ProfileService {
+	return &ProfileService{db: db}
+}
+
+// List returns all profiles ordered by name
+func (s *ProfileService) List() ([]models.ClientProfile, error) {
+	return s.db.GetClientProfiles()
+}
+
+// Get returns a profile by ID, or nil if it does not exist
+func (s *ProfileService) Get(id int64) (*models.ClientProfile, error) {
+	return s.db.GetClientProfile(id)
+}
+
+// Find returns a profile by ID or, case-insensitively, by name, or nil if
+// none matches
+func (s *ProfileService) Find(ref string) (*models.ClientProfile, error) {
+	if id, err := strconv.ParseInt(ref, 10, 64); err == nil {
+		profile, err := s.Get(id)
+		if err != nil || profile != nil {
+			return profile, err
+		}
+	}
+
+	profiles, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	for i := range profiles {
+		if strings.EqualFold(profiles[i].Name, ref) {
+			return &profiles[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// Save validates and stores a profile, creating it when it has no ID.
+// The openid scope is added when missing and names must be unique.
+func (s *ProfileService) Save(profile *models.ClientProfile) error {
+	profile.Name = strings.TrimSpace(profile.Name)
+	profile.Scopes = normalizeScopes(profile.Scopes)
+	if profile.BaseURL != "" {
+		baseURL, err := models.NormalizeBaseURL(profile.BaseURL)
+		if err != nil {
+			return err
+		}
+		profile.BaseURL = baseURL
+	}
+
+	if err := profile.Validate(); err != nil {
+		return err
+	}
+
+	profiles, err := s.db.GetClientProfiles()
+	if err != nil {
+		return err
+	}
+	for _, existing := range profiles {
+		if existing.ID != profile.ID && strings.EqualFold(existing.Name, profile.Name) {
+			return &models.ValidationError{Field: "name", Message: "A profile with this name already exists"}
+		}
+	}
+
+	return s.db.SaveClientProfile(profile)
+}
+
+// Delete removes a profile. History entries remain tagged with its ID.
+func (s *ProfileService) Delete(id int64) error {
+	return s.db.DeleteClientProfile(id)
+}
+
+// normalizeScopes trims and deduplicates scopes, making sure openid comes first
+func normalizeScopes(scopes []string) []string {
+	result := []string{"openid"}
+	seen := map[string]bool{"openid": true}
+	for _, scope := range scopes {
+		for _, s := range strings.FieldsFunc(scope, func(r rune) bool { return r == ',' || r == ' ' }) {
+			if !seen[s] {
+				seen[s] = true
+				result = append(result, s)
+			}
+		}
+	}
+	return result
+}
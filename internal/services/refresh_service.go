@@ -0,0 +1,269 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+
+	"github.com/pericles-luz/oauth2-test/internal/models"
+	"github.com/pericles-luz/oauth2-test/internal/storage"
+)
+
+// ErrNoRefreshToken is returned when a session has no refresh token to use
+var ErrNoRefreshToken = errors.New("no refresh token available")
+
+// RefreshService refreshes session tokens, on demand or in the background for
+// the sessions that opted in, and keeps a log of every refresh token grant
+type RefreshService struct {
+	db             storage.Store
+	tokenStore     *TokenStore
+	historyService *HistoryService
+	interval       time.Duration // how often the worker looks for tokens about to expire
+	lead           time.Duration // how long before expiry tokens are refreshed
+
+	mu      sync.Mutex // one refresh at a time, so a refresh token is never presented twice
+	stop    chan struct{}
+	stopped sync.WaitGroup
+}
+
+// NewRefreshService creates a new RefreshService
+func NewRefreshService(db storage.Store, tokenStore *TokenStore, historyService *HistoryService, interval, lead time.Duration) *RefreshService {
+	return &RefreshService{
+		db:             db,
+		tokenStore:     tokenStore,
+		historyService: historyService,
+		interval:       interval,
+		lead:           lead,
+	}
+}
+
+// Lead returns how long before expiry the worker refreshes tokens
+func (s *RefreshService) Lead() time.Duration {
+	return s.lead
+}
+
+// Refresh exchanges the refresh token of a session for new tokens. The
+// returned entry, already saved to the refresh log, tells whether the server
+// rotated the refresh token; handing back one it had rotated out is a failure.
+func (s *RefreshService) Refresh(ctx context.Context, sessionID string, client *models.OAuthConfig, trigger string) (*models.RefreshLogEntry, *oauth2.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, ok := s.tokenStore.Data(sessionID)
+	if !ok {
+		return nil, nil, fmt.Errorf("session %s has no tokens", sessionID)
+	}
+	if data.Token.RefreshToken == "" {
+		return nil, nil, ErrNoRefreshToken
+	}
+
+	entry, newToken, err := s.grant(ctx, sessionID, client, trigger, data.Token.RefreshToken, data.RetiredRefreshTokens)
+	if newToken != nil {
+		s.storeRefreshed(sessionID, entry, newToken)
+	}
+	return entry, newToken, err
+}
+
+// TestReuse checks whether the server implements refresh token rotation with
+// reuse detection: it refreshes once, presents the old refresh token again,
+// then tries the newest one. The session keeps the last tokens obtained.
+func (s *RefreshService) TestReuse(ctx context.Context, sessionID string, client *models.OAuthConfig) (*models.RefreshReuseReport, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, ok := s.tokenStore.Data(sessionID)
+	if !ok {
+		return nil, fmt.Errorf("session %s has no tokens", sessionID)
+	}
+	if data.Token.RefreshToken == "" {
+		return nil, ErrNoRefreshToken
+	}
+
+	report := &models.RefreshReuseReport{FlowID: FlowIDFromContext(ctx)}
+	oldRefreshToken := data.Token.RefreshToken
+	retired := data.RetiredRefreshTokens
+
+	entry, current, err := s.grant(ctx, sessionID, client, models.RefreshTriggerReuseTest, oldRefreshToken, retired)
+	report.Refresh = entry
+	if current != nil {
+		s.storeRefreshed(sessionID, entry, current)
+	}
+	if err != nil {
+		report.Verdict = models.ReuseVerdictRefreshFailed
+		return report, nil
+	}
+	if !entry.Rotated {
+		report.Verdict = models.ReuseVerdictNoRotation
+		return report, nil
+	}
+	retired = append(append([]string(nil), retired...), entry.OldFingerprint)
+
+	// The old refresh token must be refused now that it was rotated out
+	entry, reused, _ := s.grant(ctx, sessionID, client, models.RefreshTriggerReuseTest, oldRefreshToken, retired)
+	report.Reuse = entry
+	if reused != nil {
+		report.Verdict = models.ReuseVerdictReuseAccepted
+	}
+
+	// After a reuse, the BCP expects the whole token family to be revoked
+	entry, newest, err := s.grant(ctx, sessionID, client, models.RefreshTriggerReuseTest, current.RefreshToken, retired)
+	report.Newest = entry
+	if newest != nil {
+		s.storeRefreshed(sessionID, entry, newest)
+	}
+
+	if report.Verdict == "" {
+		if err != nil {
+			report.Verdict = models.ReuseVerdictFamilyRevoked
+		} else {
+			report.Verdict = models.ReuseVerdictReuseRejected
+		}
+	}
+	return report, nil
+}
+
+// grant presents a refresh token and records the outcome in the refresh log.
+// Having a retired refresh token accepted, or getting one back, is reported
+// as reuse; the new tokens are returned anyway.
+func (s *RefreshService) grant(ctx context.Context, sessionID string, client *models.OAuthConfig, trigger, refreshToken string, retired []string) (*models.RefreshLogEntry, *oauth2.Token, error) {
+	entry := &models.RefreshLogEntry{
+		SessionID:      sessionID,
+		Trigger:        trigger,
+		OldFingerprint: Fingerprint(refreshToken),
+		FlowID:         FlowIDFromContext(ctx),
+		CreatedAt:      time.Now(),
+	}
+	defer s.save(entry)
+
+	oauthService := NewOAuthService(client, s.historyService).WithContext(ctx)
+	newToken, err := oauthService.RefreshToken(refreshToken)
+	if err != nil {
+		entry.Error = err.Error()
+		return entry, nil, err
+	}
+
+	entry.Success = true
+	entry.AccessExpiry = newToken.Expiry
+
+	// Servers that do not rotate may omit the refresh token; the old one stays valid
+	if newToken.RefreshToken == "" {
+		newToken.RefreshToken = refreshToken
+	}
+	entry.NewFingerprint = Fingerprint(newToken.RefreshToken)
+	entry.Rotated = entry.NewFingerprint != entry.OldFingerprint
+
+	for _, fingerprint := range retired {
+		switch fingerprint {
+		case entry.OldFingerprint:
+			entry.Error = "server accepted a refresh token that had been rotated out"
+		case entry.NewFingerprint:
+			entry.Error = "server returned a refresh token that had been rotated out"
+		default:
+			continue
+		}
+		entry.Reused = true
+		entry.Success = false
+		return entry, newToken, errors.New(entry.Error)
+	}
+
+	return entry, newToken, nil
+}
+
+// storeRefreshed keeps the tokens obtained by a grant, retiring the refresh
+// token it rotated out
+func (s *RefreshService) storeRefreshed(sessionID string, entry *models.RefreshLogEntry, token *oauth2.Token) {
+	retired := ""
+	if entry.Rotated {
+		retired = entry.OldFingerprint
+	}
+	s.tokenStore.StoreRefreshed(sessionID, token, retired)
+}
+
+// Log returns the most recent refresh token grants of a session
+func (s *RefreshService) Log(sessionID string, limit int) ([]models.RefreshLogEntry, error) {
+	return s.db.GetRefreshLog(sessionID, limit)
+}
+
+// RefreshDue refreshes the auto-refresh sessions whose access token is about
+// to expire. A failure disables auto-refresh for the session.
+func (s *RefreshService) RefreshDue() int {
+	refreshed := 0
+	for _, sessionID := range s.tokenStore.Due(s.lead) {
+		data, ok := s.tokenStore.Data(sessionID)
+		if !ok || data.AutoRefresh == nil {
+			continue
+		}
+
+		ctx := WithFlowID(context.Background(), data.AutoRefresh.FlowID)
+		ctx = WithProfileID(ctx, data.AutoRefresh.ProfileID)
+		client := data.AutoRefresh.Client
+
+		if _, _, err := s.Refresh(ctx, sessionID, &client, models.RefreshTriggerAuto); err != nil {
+			log.Printf("Auto-refresh of session %s failed, disabling it: %v", sessionID, err)
+			s.tokenStore.SetAutoRefresh(sessionID, nil)
+			continue
+		}
+		refreshed++
+	}
+	return refreshed
+}
+
+// Start launches the background refresh worker
+func (s *RefreshService) Start() {
+	if s.interval <= 0 || s.stop != nil {
+		return
+	}
+
+	s.stop = make(chan struct{})
+	s.stopped.Add(1)
+
+	go func() {
+		defer s.stopped.Done()
+
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				s.RefreshDue()
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop terminates the background refresh worker and waits for it to finish
+func (s *RefreshService) Stop() {
+	if s.stop == nil {
+		return
+	}
+	close(s.stop)
+	s.stopped.Wait()
+	s.stop = nil
+}
+
+// save records a refresh log entry, logging failures
+func (s *RefreshService) save(entry *models.RefreshLogEntry) {
+	if err := s.db.SaveRefreshLogEntry(entry); err != nil {
+		log.Printf("Failed to save refresh log entry: %v", err)
+	}
+}
+
+// Fingerprint identifies a token without revealing it: the first 12 hex
+// digits of its SHA-256
+func Fingerprint(token string) string {
+	if token == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])[:12]
+}
@@ -0,0 +1,75 @@
+package services
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+
+	"github.com/pericles-luz/oauth2-test/internal/models"
+)
+
+func TestRefreshDueStopsWithTheSession(t *testing.T) {
+	// Every refresh returns an access token already due again
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token":"access","token_type":"Bearer","expires_in":30,"refresh_token":"refresh"}`))
+	}))
+	defer server.Close()
+
+	db := newTestStore(t)
+	tokenStore := NewTokenStore(db, 24*time.Hour)
+	refreshService := NewRefreshService(db, tokenStore, newTestHistory(t), 0, time.Minute)
+	sessionStore := NewSessionStore(db, "secret", time.Hour, 24*time.Hour)
+	sessionStore.OnEnd(func(values map[interface{}]interface{}) {
+		tokenStore.Delete(values["session_id"].(string))
+	})
+
+	// A session idle past its timeout, not yet cleaned up
+	data, err := encodeSessionValues(map[interface{}]interface{}{"session_id": "session"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	idleSince := time.Now().Add(-2 * time.Hour)
+	if err := db.SaveSession(&models.Session{TokenHash: "hash", Data: data, CreatedAt: idleSince, LastSeenAt: idleSince, ExpiresAt: idleSince.Add(24 * time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+
+	tokenStore.Store("session", &oauth2.Token{AccessToken: "access", RefreshToken: "refresh", Expiry: time.Now().Add(30 * time.Second)}, nil)
+	client := models.OAuthConfig{ClientID: "client", Endpoints: models.IssuerEndpoints{Token: server.URL}}
+	tokenStore.SetAutoRefresh("session", &AutoRefresh{Client: client})
+
+	for i := 1; i <= 2; i++ {
+		if refreshed := refreshService.RefreshDue(); refreshed != 1 {
+			t.Fatalf("RefreshDue() = %d, want 1", refreshed)
+		}
+		if got := calls.Load(); got != int32(i) {
+			t.Fatalf("token endpoint called %d times, want %d", got, i)
+		}
+	}
+
+	if removed, err := sessionStore.Cleanup(); err != nil || removed != 1 {
+		t.Fatalf("Cleanup() = %d, %v, want 1, nil", removed, err)
+	}
+	if refreshed := refreshService.RefreshDue(); refreshed != 0 {
+		t.Errorf("RefreshDue() after the session ended = %d, want 0", refreshed)
+	}
+	if got := calls.Load(); got != 2 {
+		t.Errorf("token endpoint called %d times after the session ended, want 2", got)
+	}
+	if _, ok := tokenStore.Data("session"); ok {
+		t.Error("tokens of the ended session still in memory")
+	}
+	stored, err := db.GetTokens(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != 0 {
+		t.Errorf("persisted tokens = %d, want 0", len(stored))
+	}
+}
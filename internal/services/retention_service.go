@@ -0,0 +1,225 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pericles-luz/oauth2-test/internal/models"
+	"github.com/pericles-luz/oauth2-test/internal/storage"
+)
+
+// RetentionService enforces the history retention policy
+type RetentionService struct {
+	db     storage.Store
+	policy models.RetentionPolicy
+
+	mu      sync.Mutex // serializes maintenance operations
+	stop    chan struct{}
+	stopped sync.WaitGroup
+}
+
+// NewRetentionService creates a new RetentionService
+func NewRetentionService(db storage.Store, policy models.RetentionPolicy) *RetentionService {
+	return &RetentionService{
+		db:     db,
+		policy: policy,
+	}
+}
+
+// Policy returns the configured retention policy
+func (s *RetentionService) Policy() models.RetentionPolicy {
+	return s.policy
+}
+
+// Start launches the background pruning job. It does nothing if no rule is configured.
+func (s *RetentionService) Start() {
+	if !s.policy.Enabled() || s.policy.Interval <= 0 || s.stop != nil {
+		return
+	}
+
+	s.stop = make(chan struct{})
+	s.stopped.Add(1)
+
+	go func() {
+		defer s.stopped.Done()
+
+		ticker := time.NewTicker(s.policy.Interval)
+		defer ticker.Stop()
+
+		for {
+			if _, err := s.Prune(models.TriggerScheduled); err != nil {
+				log.Printf("History pruning failed: %v", err)
+			}
+
+			select {
+			case <-ticker.C:
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop terminates the background pruning job and waits for it to finish
+func (s *RetentionService) Stop() {
+	if s.stop == nil {
+		return
+	}
+	close(s.stop)
+	s.stopped.Wait()
+	s.stop = nil
+}
+
+// Prune applies the retention policy: age, per-type quotas and global row limit.
+// A VACUUM follows when rows were deleted and the policy asks for it.
+func (s *RetentionService) Prune(trigger string) (*models.MaintenanceRun, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	run := &models.MaintenanceRun{Kind: models.MaintenancePrune, Trigger: trigger, StartedAt: time.Now()}
+	var details []string
+
+	err := func() error {
+		if s.policy.MaxAge > 0 {
+			deleted, err := s.db.DeleteHistoryOlderThan(time.Now().Add(-s.policy.MaxAge))
+			if err != nil {
+				return err
+			}
+			run.DeletedRows += deleted
+			details = append(details, fmt.Sprintf("age>%s: %d", s.policy.MaxAge, deleted))
+		}
+
+		types := make([]string, 0, len(s.policy.TypeQuotas))
+		for endpointType := range s.policy.TypeQuotas {
+			types = append(types, endpointType)
+		}
+		sort.Strings(types)
+
+		for _, endpointType := range types {
+			deleted, err := s.db.TrimHistory(endpointType, s.policy.TypeQuotas[endpointType])
+			if err != nil {
+				return err
+			}
+			run.DeletedRows += deleted
+			details = append(details, fmt.Sprintf("%s>%d: %d", endpointType, s.policy.TypeQuotas[endpointType], deleted))
+		}
+
+		if s.policy.MaxRows > 0 {
+			deleted, err := s.db.TrimHistory("", s.policy.MaxRows)
+			if err != nil {
+				return err
+			}
+			run.DeletedRows += deleted
+			details = append(details, fmt.Sprintf("rows>%d: %d", s.policy.MaxRows, deleted))
+		}
+
+		return nil
+	}()
+
+	run.Details = strings.Join(details, ", ")
+	if err := s.finish(run, err); err != nil {
+		return run, err
+	}
+
+	if run.DeletedRows > 0 && s.policy.Vacuum {
+		if _, err := s.vacuum(trigger); err != nil {
+			return run, err
+		}
+	}
+
+	return run, nil
+}
+
+// Purge deletes all history entries, keeping pinned ones unless includePinned is set
+func (s *RetentionService) Purge(includePinned bool) (*models.MaintenanceRun, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	run := &models.MaintenanceRun{Kind: models.MaintenancePurge, Trigger: models.TriggerManual, StartedAt: time.Now()}
+	run.Details = "pinned entries kept"
+	if includePinned {
+		run.Details = "pinned entries included"
+	}
+
+	deleted, err := s.db.PurgeHistory(includePinned)
+	run.DeletedRows = deleted
+
+	return run, s.finish(run, err)
+}
+
+// Vacuum rebuilds the database file
+func (s *RetentionService) Vacuum(trigger string) (*models.MaintenanceRun, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.vacuum(trigger)
+}
+
+// vacuum runs VACUUM and records the size reclaimed. Callers must hold s.mu.
+func (s *RetentionService) vacuum(trigger string) (*models.MaintenanceRun, error) {
+	run := &models.MaintenanceRun{Kind: models.MaintenanceVacuum, Trigger: trigger, StartedAt: time.Now()}
+
+	before, _ := s.db.GetDatabaseSize()
+	err := s.db.Vacuum()
+	after, _ := s.db.GetDatabaseSize()
+	run.Details = fmt.Sprintf("%d → %d bytes", before, after)
+
+	return run, s.finish(run, err)
+}
+
+// finish records the run outcome in the maintenance log
+func (s *RetentionService) finish(run *models.MaintenanceRun, opErr error) error {
+	run.DurationMs = time.Since(run.StartedAt).Milliseconds()
+	if opErr != nil {
+		run.Error = opErr.Error()
+	}
+
+	if err := s.db.SaveMaintenanceRun(run); err != nil {
+		log.Printf("Failed to record maintenance run: %v", err)
+	}
+
+	return opErr
+}
+
+// RecentRuns returns the latest maintenance runs
+func (s *RetentionService) RecentRuns(limit int) ([]models.MaintenanceRun, error) {
+	return s.db.GetMaintenanceRuns(limit)
+}
+
+// HistoryCounts returns the number of stored entries per endpoint type
+func (s *RetentionService) HistoryCounts() ([]storage.HistoryCount, error) {
+	return s.db.GetHistoryCounts()
+}
+
+// DatabaseSize returns the size of the database file in bytes
+func (s *RetentionService) DatabaseSize() (int64, error) {
+	return s.db.GetDatabaseSize()
+}
+
+// ParseTypeQuotas parses per-endpoint quotas in the "token=500,jwks=100" format
+func ParseTypeQuotas(value string) (map[string]int, error) {
+	quotas := map[string]int{}
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		endpointType, limitStr, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid quota %q: expected type=limit", item)
+		}
+
+		limit, err := strconv.Atoi(strings.TrimSpace(limitStr))
+		if err != nil || limit < 0 {
+			return nil, fmt.Errorf("invalid quota limit %q for %s", limitStr, endpointType)
+		}
+		quotas[strings.TrimSpace(endpointType)] = limit
+	}
+	return quotas, nil
+}
@@ -0,0 +1,150 @@
+package services
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/pericles-luz/oauth2-test/internal/models"
+)
+
+// junitTestSuites is the root element of a JUnit XML report
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Errors   int              `xml:"errors,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+// junitTestSuite holds the steps of one scenario
+type junitTestSuite struct {
+	Name       string          `xml:"name,attr"`
+	Timestamp  string          `xml:"timestamp,attr"`
+	Tests      int             `xml:"tests,attr"`
+	Failures   int             `xml:"failures,attr"`
+	Errors     int             `xml:"errors,attr"`
+	Skipped    int             `xml:"skipped,attr"`
+	Time       string          `xml:"time,attr"`
+	Properties []junitProperty `xml:"properties>property,omitempty"`
+	Cases      []junitTestCase `xml:"testcase"`
+}
+
+// junitProperty is a name/value pair of a test suite
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+// junitTestCase is one step of a scenario
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Error     *junitMessage `xml:"error,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+}
+
+// junitMessage is the failure, error or skip reason of a test case
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr,omitempty"`
+	Text    string `xml:",chardata"`
+}
+
+// WriteJUnitReport writes scenario reports as JUnit XML, one test suite per
+// scenario and one test case per step, as CI servers expect
+func WriteJUnitReport(w io.Writer, reports []models.ScenarioReport) error {
+	root := junitTestSuites{Name: "oauth2-test"}
+	var totalMs int64
+	for _, report := range reports {
+		suite := junitTestSuite{
+			Name:      report.Name,
+			Timestamp: report.StartedAt.UTC().Format("2006-01-02T15:04:05"),
+			Tests:     len(report.Steps),
+			Failures:  report.Count(models.ScenarioStepFailed),
+			Errors:    report.Count(models.ScenarioStepError),
+			Skipped:   report.Count(models.ScenarioStepSkipped),
+			Time:      junitSeconds(report.DurationMs),
+			Properties: []junitProperty{
+				{Name: "flow_id", Value: report.FlowID},
+			},
+		}
+		if report.File != "" {
+			suite.Properties = append(suite.Properties, junitProperty{Name: "file", Value: report.File})
+		}
+
+		for _, step := range report.Steps {
+			testCase := junitTestCase{
+				Name:      step.Name,
+				ClassName: report.Name,
+				Time:      junitSeconds(step.DurationMs),
+			}
+			switch step.Outcome {
+			case models.ScenarioStepFailed:
+				testCase.Failure = &junitMessage{Message: failedAssertions(step), Type: "assertion", Text: assertionDetails(step)}
+			case models.ScenarioStepError:
+				testCase.Error = &junitMessage{Message: step.Error, Type: step.Action, Text: assertionDetails(step)}
+			case models.ScenarioStepSkipped:
+				testCase.Skipped = &junitMessage{Message: step.Error}
+			}
+			suite.Cases = append(suite.Cases, testCase)
+		}
+
+		root.Tests += suite.Tests
+		root.Failures += suite.Failures
+		root.Errors += suite.Errors
+		root.Skipped += suite.Skipped
+		totalMs += report.DurationMs
+		root.Suites = append(root.Suites, suite)
+	}
+	root.Time = junitSeconds(totalMs)
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(root); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// junitSeconds formats a duration in milliseconds as JUnit seconds
+func junitSeconds(ms int64) string {
+	return fmt.Sprintf("%.3f", float64(ms)/1000)
+}
+
+// failedAssertions summarizes the assertions of a step that did not hold
+func failedAssertions(step models.ScenarioStepResult) string {
+	var failed []string
+	for _, assertion := range step.Assertions {
+		if !assertion.Passed {
+			failed = append(failed, fmt.Sprintf("%s: expected %s, got %s", assertion.Target, assertion.Expected, assertion.Actual))
+		}
+	}
+	return strings.Join(failed, "; ")
+}
+
+// assertionDetails lists every assertion of a step, and the error of its call
+func assertionDetails(step models.ScenarioStepResult) string {
+	var lines []string
+	for _, assertion := range step.Assertions {
+		mark := "ok  "
+		if !assertion.Passed {
+			mark = "FAIL"
+		}
+		lines = append(lines, fmt.Sprintf("%s %s: expected %s, got %s", mark, assertion.Target, assertion.Expected, assertion.Actual))
+	}
+	if step.Error != "" {
+		lines = append(lines, "error: "+step.Error)
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,635 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+	"gopkg.in/yaml.v3"
+
+	"github.com/pericles-luz/oauth2-test/internal/models"
+)
+
+// ScenarioService runs declarative test scenarios through OAuthService
+type ScenarioService struct {
+	historyService *HistoryService
+	profileService *ProfileService
+	issuerService  *IssuerService
+	baseURL        string // issuer of the scenarios that name none
+	dir            string // where scenario files are looked up
+}
+
+// NewScenarioService creates a new ScenarioService reading scenario files from dir
+func NewScenarioService(historyService *HistoryService, profileService *ProfileService, issuerService *IssuerService, baseURL, dir string) *ScenarioService {
+	return &ScenarioService{
+		historyService: historyService,
+		profileService: profileService,
+		issuerService:  issuerService,
+		baseURL:        baseURL,
+		dir:            dir,
+	}
+}
+
+// scenarioVariable matches the ${NAME} and ${NAME:-default} references
+// replaced by environment variables
+var scenarioVariable = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// pastedVariablePrefix starts the only environment variables that sources
+// pasted in the UI or sent to the API can reference; the others hold the
+// secrets of the server itself
+const pastedVariablePrefix = "SCENARIO_"
+
+// VariableLookup resolves the ${NAME} references of scenarios and scope
+// matrices, reporting whether the variable is set
+type VariableLookup func(name string) (string, bool)
+
+// TrustedVariables resolves any environment variable. It is meant for the
+// files of the scenario directory and of the command line.
+func TrustedVariables(name string) (string, bool) {
+	return os.LookupEnv(name)
+}
+
+// PastedVariables resolves only the SCENARIO_* environment variables, for
+// sources supplied by whoever can reach the server
+func PastedVariables(name string) (string, bool) {
+	if !strings.HasPrefix(name, pastedVariablePrefix) {
+		return "", false
+	}
+	return os.LookupEnv(name)
+}
+
+// scenarioMatchers are the keys a matcher map can hold
+var scenarioMatchers = map[string]bool{"equals": true, "present": true, "contains": true, "matches": true}
+
+// ParseScenario decodes and validates a YAML scenario. ${NAME} references in
+// its values are replaced by the variables of lookup, so secrets can stay out
+// of the files.
+func ParseScenario(data []byte, lookup VariableLookup) (*models.Scenario, error) {
+	var scenario models.Scenario
+	if err := decodeYAML(data, &scenario, lookup); err != nil {
+		return nil, fmt.Errorf("invalid scenario: %w", err)
+	}
+
+	if scenario.Name == "" {
+		return nil, errors.New("invalid scenario: name is required")
+	}
+	if len(scenario.Steps) == 0 {
+		return nil, errors.New("invalid scenario: no steps")
+	}
+	for i := range scenario.Steps {
+		step := &scenario.Steps[i]
+		if err := validateScenarioStep(step); err != nil {
+			return nil, fmt.Errorf("invalid scenario: step %d: %w", i+1, err)
+		}
+		if step.Name == "" {
+			step.Name = step.Action
+		}
+	}
+
+	return &scenario, nil
+}
+
+// decodeYAML decodes a scenario or scope matrix file into v, rejecting unknown
+// fields. The ${NAME} references of string values are replaced after parsing,
+// so a variable cannot change the structure of the document.
+func decodeYAML(data []byte, v interface{}, lookup VariableLookup) error {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return err
+	}
+	if root.Kind != 0 {
+		if err := expandVariables(&root, lookup); err != nil {
+			return err
+		}
+		expanded, err := yaml.Marshal(&root)
+		if err != nil {
+			return err
+		}
+		data = expanded
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	return decoder.Decode(v)
+}
+
+// expandVariables replaces the ${NAME} references of the string values of a
+// document by the variables of lookup. ${NAME:-default} stands for default
+// when the variable is unset or empty; any other unset variable is an error.
+func expandVariables(node *yaml.Node, lookup VariableLookup) error {
+	var undefined []string
+	var walk func(node *yaml.Node)
+	walk = func(node *yaml.Node) {
+		if node.Kind == yaml.ScalarNode && node.ShortTag() == "!!str" {
+			node.Value = scenarioVariable.ReplaceAllStringFunc(node.Value, func(ref string) string {
+				match := scenarioVariable.FindStringSubmatch(ref)
+				value, ok := lookup(match[1])
+				if value == "" && match[2] != "" {
+					return match[3]
+				}
+				if !ok && !containsString(undefined, match[1]) {
+					undefined = append(undefined, match[1])
+				}
+				return value
+			})
+		}
+		for _, child := range node.Content {
+			walk(child)
+		}
+	}
+	walk(node)
+
+	if len(undefined) > 0 {
+		sort.Strings(undefined)
+		return fmt.Errorf("undefined environment variables: %s", strings.Join(undefined, ", "))
+	}
+	return nil
+}
+
+// validateScenarioStep checks the action, token and matchers of a step
+func validateScenarioStep(step *models.ScenarioStep) error {
+	known := false
+	for _, action := range models.ScenarioActions {
+		known = known || step.Action == action
+	}
+	if !known {
+		return fmt.Errorf("unknown action %q (expected one of %s)", step.Action, strings.Join(models.ScenarioActions, ", "))
+	}
+
+	switch step.Token {
+	case "", "access_token", "refresh_token", "id_token":
+	default:
+		return fmt.Errorf("unknown token %q (expected access_token, refresh_token or id_token)", step.Token)
+	}
+
+	for target, matchers := range map[string]map[string]interface{}{"header": step.Expect.Headers, "claim": step.Expect.Claims} {
+		for name, matcher := range matchers {
+			ops, ok := matcher.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			for op, value := range ops {
+				if !scenarioMatchers[op] {
+					return fmt.Errorf("%s %s: unknown matcher %q (expected equals, present, contains or matches)", target, name, op)
+				}
+				if op == "matches" {
+					if _, err := regexp.Compile(fmt.Sprint(value)); err != nil {
+						return fmt.Errorf("%s %s: %w", target, name, err)
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Files lists the scenario files of the scenario directory
+func (s *ScenarioService) Files() ([]string, error) {
+	return yamlFiles(s.dir)
+}
+
+// yamlFiles lists the YAML files of a directory, none when it does not exist
+func yamlFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, entry := range entries {
+		if ext := filepath.Ext(entry.Name()); !entry.IsDir() && (ext == ".yaml" || ext == ".yml") {
+			files = append(files, entry.Name())
+		}
+	}
+	return files, nil
+}
+
+// LoadFile reads and parses a file of the scenario directory
+func (s *ScenarioService) LoadFile(name string) (*models.Scenario, error) {
+	if name != filepath.Base(name) {
+		return nil, fmt.Errorf("invalid scenario file name %q", name)
+	}
+	data, err := os.ReadFile(filepath.Join(s.dir, name))
+	if err != nil {
+		return nil, err
+	}
+	return ParseScenario(data, TrustedVariables)
+}
+
+// scenarioRun is the state shared by the steps of a run
+type scenarioRun struct {
+	oauthService *OAuthService
+	config       *models.OAuthConfig
+	tokens       map[string]string // access_token, refresh_token and id_token obtained so far
+}
+
+// Run executes the steps of a scenario in order. Every step runs, except those
+// needing a token that was never obtained; the requests are tagged with a new
+// flow ID. An error is returned only when the client cannot be set up.
+func (s *ScenarioService) Run(ctx context.Context, scenario *models.Scenario) (*models.ScenarioReport, error) {
+	config, profileID, err := s.clientConfig(scenario)
+	if err != nil {
+		return nil, err
+	}
+
+	flowID, err := GenerateFlowID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate flow ID: %w", err)
+	}
+	ctx = WithProfileID(WithFlowID(ctx, flowID), profileID)
+	config.Endpoints = s.issuerService.Endpoints(ctx, config.BaseURL)
+
+	report := &models.ScenarioReport{
+		Name:      scenario.Name,
+		FlowID:    flowID,
+		StartedAt: time.Now(),
+		Passed:    true,
+	}
+	run := &scenarioRun{
+		oauthService: NewOAuthService(config, s.historyService),
+		config:       config,
+		tokens:       make(map[string]string),
+	}
+	for _, step := range scenario.Steps {
+		result := s.runStep(ctx, run, step)
+		if result.Outcome != models.ScenarioStepPassed && result.Outcome != models.ScenarioStepSkipped {
+			report.Passed = false
+		}
+		report.Steps = append(report.Steps, result)
+	}
+	report.DurationMs = time.Since(report.StartedAt).Milliseconds()
+
+	return report, nil
+}
+
+// clientConfig builds the client configuration of a scenario, from a saved
+// profile or from the inline client
+func (s *ScenarioService) clientConfig(scenario *models.Scenario) (*models.OAuthConfig, int64, error) {
+	client := scenario.Client
+	config := &models.OAuthConfig{
+		ClientID:     client.ClientID,
+		ClientSecret: client.ClientSecret,
+		RedirectURI:  client.RedirectURI,
+		Scopes:       client.Scopes,
+		BaseURL:      s.baseURL,
+	}
+
+	var profileID int64
+	if client.Profile != "" {
+		profile, err := s.profileService.Find(client.Profile)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to fetch profile: %w", err)
+		}
+		if profile == nil {
+			return nil, 0, fmt.Errorf("client profile %q not found", client.Profile)
+		}
+		profileID = profile.ID
+		config.ClientID = profile.ClientID
+		config.ClientSecret = profile.ClientSecret
+		config.RedirectURI = profile.RedirectURI
+		config.Scopes = profile.Scopes
+		if profile.BaseURL != "" {
+			config.BaseURL = profile.BaseURL
+		}
+	}
+	if scenario.Issuer != "" {
+		config.BaseURL = scenario.Issuer
+	}
+	if len(config.Scopes) == 0 {
+		config.Scopes = []string{"openid"}
+	}
+
+	baseURL, err := models.NormalizeBaseURL(config.BaseURL)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid issuer: %w", err)
+	}
+	config.BaseURL = baseURL
+
+	return config, profileID, nil
+}
+
+// runStep executes a step and checks its expectations against the last
+// response it got
+func (s *ScenarioService) runStep(ctx context.Context, run *scenarioRun, step models.ScenarioStep) models.ScenarioStepResult {
+	result := models.ScenarioStepResult{Name: step.Name, Action: step.Action}
+
+	// The token the step sends, if it needs one
+	tokenName := ""
+	switch step.Action {
+	case models.ScenarioActionRefresh:
+		tokenName = "refresh_token"
+	case models.ScenarioActionUserInfo:
+		tokenName = "access_token"
+	case models.ScenarioActionRevoke, models.ScenarioActionIntrospect:
+		tokenName = step.Token
+		if tokenName == "" {
+			tokenName = "access_token"
+		}
+	}
+	token := run.tokens[tokenName]
+	if tokenName != "" && token == "" {
+		result.Outcome = models.ScenarioStepSkipped
+		result.Error = "no " + tokenName + " was obtained by the previous steps"
+		return result
+	}
+
+	var last *Exchange
+	ctx = WithExchangeRecorder(ctx, func(exchange Exchange) {
+		last = &exchange
+	})
+	oauthService := run.oauthService.WithContext(ctx)
+
+	start := time.Now()
+	var document map[string]interface{}
+	var err error
+	switch step.Action {
+	case models.ScenarioActionDiscovery:
+		document, err = oauthService.FetchDiscovery()
+	case models.ScenarioActionLogin:
+		var issued *oauth2.Token
+		if issued, err = s.login(ctx, oauthService, run.config.RedirectURI, step); err == nil {
+			document = run.storeTokens(issued)
+		}
+	case models.ScenarioActionRefresh:
+		var issued *oauth2.Token
+		if issued, err = oauthService.RefreshToken(token); err == nil {
+			document = run.storeTokens(issued)
+		}
+	case models.ScenarioActionRevoke:
+		err = oauthService.RevokeToken(token)
+	case models.ScenarioActionIntrospect:
+		hint := tokenName
+		if hint == "id_token" {
+			hint = "" // not a token type hint of RFC 7662
+		}
+		document, err = oauthService.IntrospectToken(token, hint)
+	case models.ScenarioActionUserInfo:
+		// Check the raw document, which may hold claims models.UserInfo drops
+		if _, err = oauthService.GetUserInfo(token); err == nil && last != nil {
+			json.Unmarshal(last.Body, &document)
+		}
+	}
+	result.DurationMs = time.Since(start).Milliseconds()
+
+	status := 0
+	header := http.Header{}
+	if last != nil {
+		status = last.Status
+		header = last.Header
+		result.HTTPStatus = status
+	}
+	if err != nil {
+		result.Error = err.Error()
+	}
+
+	// Assertions
+	if step.Expect.Status != 0 {
+		result.Assertions = append(result.Assertions, models.ScenarioAssertion{
+			Target:   "status",
+			Expected: fmt.Sprint(step.Expect.Status),
+			Actual:   fmt.Sprint(status),
+			Passed:   status == step.Expect.Status,
+		})
+	}
+	for _, name := range sortedKeys(step.Expect.Headers) {
+		values, present := header[http.CanonicalHeaderKey(name)]
+		var actual interface{}
+		if present {
+			actual = strings.Join(values, ", ")
+		}
+		result.Assertions = append(result.Assertions, checkScenarioMatcher("header "+name, step.Expect.Headers[name], actual, present))
+	}
+	for _, path := range sortedKeys(step.Expect.Claims) {
+		actual, present := lookupClaim(document, path)
+		result.Assertions = append(result.Assertions, checkScenarioMatcher("claim "+path, step.Expect.Claims[path], actual, present))
+	}
+
+	// A failed call is fine when the step expects its status, e.g. a refresh
+	// rejected after a revocation
+	result.Outcome = models.ScenarioStepPassed
+	for _, assertion := range result.Assertions {
+		if !assertion.Passed {
+			result.Outcome = models.ScenarioStepFailed
+		}
+	}
+	if result.Outcome == models.ScenarioStepPassed && err != nil && step.Expect.Status == 0 {
+		result.Outcome = models.ScenarioStepError
+	}
+
+	return result
+}
+
+// storeTokens keeps the tokens of a token response for the next steps and
+// returns the claims of its ID token. Refresh responses may omit the refresh
+// and ID tokens, in which case the previous ones are kept.
+func (run *scenarioRun) storeTokens(token *oauth2.Token) map[string]interface{} {
+	run.tokens["access_token"] = token.AccessToken
+	if token.RefreshToken != "" {
+		run.tokens["refresh_token"] = token.RefreshToken
+	}
+
+	idToken, _ := token.Extra("id_token").(string)
+	if idToken == "" {
+		return nil
+	}
+	run.tokens["id_token"] = idToken
+	claims, err := ParseTokenWithoutValidation(idToken)
+	if err != nil {
+		return nil
+	}
+	return claims
+}
+
+// login exchanges the code of a step or, without one, obtains a code by
+// following the authorization redirects without user interaction, as mock
+// servers allow
+func (s *ScenarioService) login(ctx context.Context, oauthService *OAuthService, redirectURI string, step models.ScenarioStep) (*oauth2.Token, error) {
+	if step.Code != "" {
+		return oauthService.ExchangeCode(step.Code, step.CodeVerifier)
+	}
+	return s.loginUnattended(ctx, oauthService, redirectURI, "")
+}
+
+// loginUnattended obtains a code by following the authorization redirects
+// without user interaction and exchanges it. A cookie, if given, is sent to
+// the authorization endpoint, e.g. a user session whose consent is stored.
+func (s *ScenarioService) loginUnattended(ctx context.Context, oauthService *OAuthService, redirectURI, cookie string) (*oauth2.Token, error) {
+	if redirectURI == "" {
+		return nil, errors.New("login without a code needs the client redirect_uri")
+	}
+
+	state, err := GenerateRandomState()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate state: %w", err)
+	}
+	authURL, verifier, err := oauthService.GenerateAuthURL(state)
+	if err != nil {
+		return nil, err
+	}
+
+	code, err := s.authorizeUnattended(ctx, authURL, redirectURI, state, cookie)
+	if err != nil {
+		return nil, err
+	}
+	return oauthService.ExchangeCode(code, verifier)
+}
+
+// authorizeUnattended follows the redirects of the authorization endpoint
+// until one reaches the redirect URI and returns the code it carries
+func (s *ScenarioService) authorizeUnattended(ctx context.Context, authURL, redirectURI, state, cookie string) (string, error) {
+	client := NewHTTPClient(s.historyService, "authorize")
+	client.Jar, _ = cookiejar.New(nil)
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if strings.HasPrefix(req.URL.String(), redirectURI) {
+			return http.ErrUseLastResponse
+		}
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		return nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", authURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create authorization request: %w", err)
+	}
+	if cookie != "" {
+		req.Header.Set("Cookie", cookie)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("authorization request failed: %w", err)
+	}
+	resp.Body.Close()
+
+	location := resp.Header.Get("Location")
+	if resp.StatusCode < 300 || resp.StatusCode >= 400 || !strings.HasPrefix(location, redirectURI) {
+		return "", fmt.Errorf("the authorization endpoint answered %d instead of redirecting to %s; login without a code only works with servers that authorize without user interaction", resp.StatusCode, redirectURI)
+	}
+
+	redirect, err := url.Parse(location)
+	if err != nil {
+		return "", fmt.Errorf("invalid redirect: %w", err)
+	}
+	query := redirect.Query()
+	if errorCode := query.Get("error"); errorCode != "" {
+		return "", fmt.Errorf("authorization failed: %s %s", errorCode, query.Get("error_description"))
+	}
+	if query.Get("state") != state {
+		return "", errors.New("invalid state parameter in the redirect")
+	}
+	if query.Get("code") == "" {
+		return "", errors.New("authorization code not found in the redirect")
+	}
+	return query.Get("code"), nil
+}
+
+// lookupClaim returns the field of a document at a dotted path
+func lookupClaim(document map[string]interface{}, path string) (interface{}, bool) {
+	var current interface{} = document
+	for _, key := range strings.Split(path, ".") {
+		object, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if current, ok = object[key]; !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// checkScenarioMatcher checks a value against a matcher: a plain value compared
+// for equality, or a map of equals, present, contains and matches that must all hold
+func checkScenarioMatcher(target string, matcher, actual interface{}, present bool) models.ScenarioAssertion {
+	assertion := models.ScenarioAssertion{Target: target, Actual: "(absent)", Passed: true}
+	if present {
+		assertion.Actual = scenarioString(actual)
+	}
+
+	ops, ok := matcher.(map[string]interface{})
+	if !ok {
+		ops = map[string]interface{}{"equals": matcher}
+	}
+
+	var expected []string
+	for _, op := range sortedKeys(ops) {
+		value := ops[op]
+		var holds bool
+		switch op {
+		case "equals":
+			expected = append(expected, scenarioString(value))
+			holds = present && scenarioString(value) == scenarioString(actual)
+		case "present":
+			want, _ := value.(bool)
+			if want {
+				expected = append(expected, "present")
+			} else {
+				expected = append(expected, "absent")
+			}
+			holds = present == want
+		case "contains":
+			expected = append(expected, "contains "+scenarioString(value))
+			holds = present && scenarioContains(actual, value)
+		case "matches":
+			expected = append(expected, "matches "+fmt.Sprint(value))
+			re, err := regexp.Compile(fmt.Sprint(value))
+			holds = err == nil && present && re.MatchString(scenarioString(actual))
+		}
+		assertion.Passed = assertion.Passed && holds
+	}
+	assertion.Expected = strings.Join(expected, ", ")
+
+	return assertion
+}
+
+// scenarioContains reports whether a list holds an element, or a string a substring
+func scenarioContains(actual, element interface{}) bool {
+	if list, ok := actual.([]interface{}); ok {
+		for _, item := range list {
+			if scenarioString(item) == scenarioString(element) {
+				return true
+			}
+		}
+		return false
+	}
+	return strings.Contains(scenarioString(actual), scenarioString(element))
+}
+
+// scenarioString renders a YAML or JSON value for comparison: strings as they
+// are, anything else as compact JSON, so 200 from YAML equals 200 from JSON
+func scenarioString(value interface{}) string {
+	if s, ok := value.(string); ok {
+		return s
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
+
+// sortedKeys returns the keys of a map in order, so assertions are reported stably
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,130 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseScenarioVariables(t *testing.T) {
+	const source = `
+name: Variables
+client:
+  client_id: ${TEST_CLIENT_ID}
+  client_secret: ${TEST_CLIENT_SECRET}
+  redirect_uri: ${TEST_REDIRECT_URI:-http://localhost/callback}
+steps:
+  - action: discovery
+    expect:
+      status: 200
+`
+
+	tests := []struct {
+		name   string
+		secret string
+	}{
+		{"plain", "s3cr3t"},
+		{"comment", "abc #def"},
+		{"mapping", "key: value"},
+		{"newline", "line1\nline2"},
+		{"alias", "*alias"},
+		{"anchor", "&anchor"},
+		{"flow mapping", "{a: b}"},
+		{"quote", `it's "quoted"`},
+		{"null", "null"},
+		{"number", "0123"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TEST_CLIENT_ID", "client")
+			t.Setenv("TEST_CLIENT_SECRET", tt.secret)
+
+			scenario, err := ParseScenario([]byte(source), TrustedVariables)
+			if err != nil {
+				t.Fatalf("ParseScenario() error = %v", err)
+			}
+			if scenario.Client.ClientSecret != tt.secret {
+				t.Errorf("client_secret = %q, want %q", scenario.Client.ClientSecret, tt.secret)
+			}
+			if scenario.Client.ClientID != "client" {
+				t.Errorf("client_id = %q, want %q", scenario.Client.ClientID, "client")
+			}
+			if scenario.Client.RedirectURI != "http://localhost/callback" {
+				t.Errorf("redirect_uri = %q, want the default", scenario.Client.RedirectURI)
+			}
+			if len(scenario.Steps) != 1 || scenario.Steps[0].Expect.Status != 200 {
+				t.Errorf("steps = %+v, want one discovery step expecting 200", scenario.Steps)
+			}
+		})
+	}
+}
+
+func TestParseScenarioUndefinedVariables(t *testing.T) {
+	const source = `
+name: Undefined
+client:
+  client_id: ${TEST_UNDEFINED_B}
+  client_secret: ${TEST_UNDEFINED_A}
+  redirect_uri: ${TEST_UNDEFINED_B}
+steps:
+  - action: discovery
+`
+
+	_, err := ParseScenario([]byte(source), TrustedVariables)
+	if err == nil {
+		t.Fatal("ParseScenario() succeeded with undefined variables")
+	}
+	if !strings.Contains(err.Error(), "TEST_UNDEFINED_A, TEST_UNDEFINED_B") {
+		t.Errorf("error = %q, want the undefined variables named once each", err)
+	}
+}
+
+func TestParseScenarioEmptyVariable(t *testing.T) {
+	t.Setenv("TEST_EMPTY", "")
+
+	scenario, err := ParseScenario([]byte("name: Empty\nclient:\n  client_id: ${TEST_EMPTY}\n  redirect_uri: ${TEST_EMPTY:-fallback}\nsteps:\n  - action: discovery\n"), TrustedVariables)
+	if err != nil {
+		t.Fatalf("ParseScenario() error = %v", err)
+	}
+	if scenario.Client.ClientID != "" {
+		t.Errorf("client_id = %q, want empty", scenario.Client.ClientID)
+	}
+	if scenario.Client.RedirectURI != "fallback" {
+		t.Errorf("redirect_uri = %q, want the default of an empty variable", scenario.Client.RedirectURI)
+	}
+}
+
+func TestParseScenarioPastedVariables(t *testing.T) {
+	t.Setenv("TEST_SERVER_SECRET", "server-secret")
+	t.Setenv("SCENARIO_CLIENT_ID", "client")
+
+	tests := []struct {
+		name     string
+		clientID string
+		want     string
+		err      string
+	}{
+		{"prefixed variable", "${SCENARIO_CLIENT_ID}", "client", ""},
+		{"server variable", "${TEST_SERVER_SECRET}", "", "undefined environment variables: TEST_SERVER_SECRET"},
+		{"server variable with a default", "${TEST_SERVER_SECRET:-none}", "none", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := "name: Pasted\nclient:\n  client_id: " + tt.clientID + "\nsteps:\n  - action: discovery\n"
+			scenario, err := ParseScenario([]byte(source), PastedVariables)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("ParseScenario() error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseScenario() error = %v", err)
+			}
+			if scenario.Client.ClientID != tt.want {
+				t.Errorf("client_id = %q, want %q", scenario.Client.ClientID, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,279 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/pericles-luz/oauth2-test/internal/models"
+)
+
+// matrixDir is the subdirectory of the scenario directory holding scope matrix files
+const matrixDir = "matrix"
+
+// maxExhaustiveScopes bounds the scopes of an exhaustive matrix, which logs
+// in 2^n times
+const maxExhaustiveScopes = 10
+
+// ParseScopeMatrix decodes and validates a YAML scope matrix. ${NAME}
+// references in its values are replaced by the variables of lookup, as in
+// scenarios.
+func ParseScopeMatrix(data []byte, lookup VariableLookup) (*models.ScopeMatrix, error) {
+	var matrix models.ScopeMatrix
+	if err := decodeYAML(data, &matrix, lookup); err != nil {
+		return nil, fmt.Errorf("invalid scope matrix: %w", err)
+	}
+
+	if matrix.Name == "" {
+		return nil, errors.New("invalid scope matrix: name is required")
+	}
+	if len(matrix.Scopes) == 0 {
+		matrix.Scopes = models.DefaultScopeClaims
+	}
+
+	known := make(map[string]bool, len(matrix.Scopes))
+	for i, scope := range matrix.Scopes {
+		if scope.Scope == "" {
+			return nil, fmt.Errorf("invalid scope matrix: scope %d has no name", i+1)
+		}
+		if known[scope.Scope] {
+			return nil, fmt.Errorf("invalid scope matrix: scope %s is mapped twice", scope.Scope)
+		}
+		known[scope.Scope] = true
+	}
+
+	if matrix.Exhaustive && len(matrix.Combinations) > 0 {
+		return nil, errors.New("invalid scope matrix: combinations and exhaustive are exclusive")
+	}
+	if matrix.Exhaustive && len(matrix.Scopes) > maxExhaustiveScopes {
+		return nil, fmt.Errorf("invalid scope matrix: exhaustive runs allow at most %d scopes", maxExhaustiveScopes)
+	}
+	for i, combination := range matrix.Combinations {
+		for _, scope := range combination {
+			if !known[scope] {
+				return nil, fmt.Errorf("invalid scope matrix: combination %d: scope %s is not mapped", i+1, scope)
+			}
+		}
+	}
+
+	return &matrix, nil
+}
+
+// MatrixFiles lists the scope matrix files, kept in the matrix subdirectory
+// of the scenario directory
+func (s *ScenarioService) MatrixFiles() ([]string, error) {
+	return yamlFiles(filepath.Join(s.dir, matrixDir))
+}
+
+// LoadMatrixFile reads and parses a scope matrix file
+func (s *ScenarioService) LoadMatrixFile(name string) (*models.ScopeMatrix, error) {
+	if name != filepath.Base(name) {
+		return nil, fmt.Errorf("invalid scope matrix file name %q", name)
+	}
+	data, err := os.ReadFile(filepath.Join(s.dir, matrixDir, name))
+	if err != nil {
+		return nil, err
+	}
+	return ParseScopeMatrix(data, TrustedVariables)
+}
+
+// RunMatrix logs in with each scope combination of a matrix, without user
+// interaction, and classifies the userinfo fields returned against the
+// claims mapped to the requested scopes. The requests are tagged with a new
+// flow ID. An error is returned only when the client cannot be set up.
+func (s *ScenarioService) RunMatrix(ctx context.Context, matrix *models.ScopeMatrix) (*models.ScopeMatrixReport, error) {
+	config, profileID, err := s.clientConfig(&models.Scenario{Issuer: matrix.Issuer, Client: matrix.Client})
+	if err != nil {
+		return nil, err
+	}
+	if config.RedirectURI == "" {
+		return nil, errors.New("the scope matrix client needs a redirect_uri")
+	}
+
+	flowID, err := GenerateFlowID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate flow ID: %w", err)
+	}
+	ctx = WithProfileID(WithFlowID(ctx, flowID), profileID)
+	config.Endpoints = s.issuerService.Endpoints(ctx, config.BaseURL)
+
+	report := &models.ScopeMatrixReport{
+		Name:      matrix.Name,
+		FlowID:    flowID,
+		StartedAt: time.Now(),
+		Passed:    true,
+	}
+	for _, scopes := range scopeCombinations(matrix) {
+		row := s.runMatrixRow(ctx, *config, matrix, scopes)
+		report.Passed = report.Passed && row.Passed
+		report.Rows = append(report.Rows, row)
+	}
+	report.Fields = matrixColumns(matrix.Scopes, report.Rows)
+	report.DurationMs = time.Since(report.StartedAt).Milliseconds()
+
+	return report, nil
+}
+
+// runMatrixRow logs in with a scope combination and classifies the userinfo
+// fields returned
+func (s *ScenarioService) runMatrixRow(ctx context.Context, config models.OAuthConfig, matrix *models.ScopeMatrix, scopes []string) models.ScopeMatrixRow {
+	start := time.Now()
+	row := models.ScopeMatrixRow{
+		Scopes:      scopes,
+		Granted:     []string{},
+		Fields:      []string{},
+		Disclosures: make(map[string]string),
+		Over:        []string{},
+		Under:       []string{},
+	}
+
+	config.Scopes = scopes
+	oauthService := NewOAuthService(&config, s.historyService).WithContext(ctx)
+
+	token, err := s.loginUnattended(ctx, oauthService, config.RedirectURI, matrix.Cookie)
+	if err != nil {
+		row.Error = err.Error()
+		row.DurationMs = time.Since(start).Milliseconds()
+		return row
+	}
+	tokenScope, _ := token.Extra("scope").(string)
+	row.Granted = GrantedScopes(scopes, tokenScope)
+
+	userInfo, err := oauthService.UserInfoClaims(token.AccessToken)
+	row.DurationMs = time.Since(start).Milliseconds()
+	if err != nil {
+		row.Error = err.Error()
+		return row
+	}
+	classifyDisclosures(&row, matrix.Scopes, userInfo)
+	return row
+}
+
+// classifyDisclosures classifies the userinfo fields of a row, whose Scopes
+// and Granted are set, against the claims each granted scope releases
+func classifyDisclosures(row *models.ScopeMatrixRow, mapping []models.ScopeClaims, userInfo map[string]interface{}) {
+	row.Fields = sortedKeys(userInfo)
+
+	// Claims the granted scopes release. A scope the server refused releases
+	// nothing, so its claims coming back are over-disclosure.
+	requested := stringSet(row.Scopes)
+	granted := stringSet(row.Granted)
+	expected := make(map[string]bool)
+	allowed := make(map[string]bool)
+	for _, scope := range mapping {
+		if !requested[scope.Scope] || !granted[scope.Scope] {
+			continue
+		}
+		for _, claim := range scope.Expected {
+			expected[claim] = true
+		}
+		for _, claim := range scope.Optional {
+			allowed[claim] = true
+		}
+	}
+
+	for _, field := range row.Fields {
+		switch {
+		case expected[field]:
+			row.Disclosures[field] = models.DisclosureExpected
+		case allowed[field]:
+			row.Disclosures[field] = models.DisclosureAllowed
+		default:
+			row.Disclosures[field] = models.DisclosureOver
+			row.Over = append(row.Over, field)
+		}
+	}
+
+	// A granted scope must release all its expected claims
+	for claim := range expected {
+		if _, ok := userInfo[claim]; !ok {
+			row.Disclosures[claim] = models.DisclosureUnder
+			row.Under = append(row.Under, claim)
+		}
+	}
+	sort.Strings(row.Under)
+
+	row.Passed = len(row.Over) == 0 && len(row.Under) == 0
+}
+
+// scopeCombinations returns the scope combinations a matrix logs in with,
+// each starting with openid
+func scopeCombinations(matrix *models.ScopeMatrix) [][]string {
+	var scopes []string
+	for _, scope := range matrix.Scopes {
+		if scope.Scope != "openid" {
+			scopes = append(scopes, scope.Scope)
+		}
+	}
+	withOpenID := func(combination []string) []string {
+		result := []string{"openid"}
+		for _, scope := range combination {
+			if scope != "openid" && !containsString(result, scope) {
+				result = append(result, scope)
+			}
+		}
+		return result
+	}
+
+	var combinations [][]string
+	switch {
+	case len(matrix.Combinations) > 0:
+		for _, combination := range matrix.Combinations {
+			combinations = append(combinations, withOpenID(combination))
+		}
+	case matrix.Exhaustive:
+		for mask := 0; mask < 1<<len(scopes); mask++ {
+			var combination []string
+			for i, scope := range scopes {
+				if mask&(1<<i) != 0 {
+					combination = append(combination, scope)
+				}
+			}
+			combinations = append(combinations, withOpenID(combination))
+		}
+		sort.SliceStable(combinations, func(i, j int) bool { return len(combinations[i]) < len(combinations[j]) })
+	default:
+		combinations = append(combinations, withOpenID(nil))
+		for _, scope := range scopes {
+			combinations = append(combinations, withOpenID([]string{scope}))
+		}
+		if len(scopes) > 1 {
+			combinations = append(combinations, withOpenID(scopes))
+		}
+	}
+	return combinations
+}
+
+// matrixColumns orders the fields of the rows as the mapping lists them,
+// followed by the unmapped ones
+func matrixColumns(mapping []models.ScopeClaims, rows []models.ScopeMatrixRow) []string {
+	present := make(map[string]bool)
+	for _, row := range rows {
+		for field := range row.Disclosures {
+			present[field] = true
+		}
+	}
+
+	columns := []string{}
+	for _, scope := range mapping {
+		for _, claims := range [][]string{scope.Expected, scope.Optional} {
+			for _, claim := range claims {
+				if present[claim] {
+					columns = append(columns, claim)
+					delete(present, claim)
+				}
+			}
+		}
+	}
+
+	var unmapped []string
+	for field := range present {
+		unmapped = append(unmapped, field)
+	}
+	sort.Strings(unmapped)
+	return append(columns, unmapped...)
+}
@@ -0,0 +1,156 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/pericles-luz/oauth2-test/internal/models"
+)
+
+func TestClassifyDisclosures(t *testing.T) {
+	mapping := []models.ScopeClaims{
+		{Scope: "openid", Expected: []string{"sub"}},
+		{Scope: "profile", Expected: []string{"name"}, Optional: []string{"nickname"}},
+		{Scope: "phone", Expected: []string{"phone_number"}},
+	}
+
+	tests := []struct {
+		name        string
+		scopes      []string
+		granted     []string
+		userInfo    map[string]interface{}
+		disclosures map[string]string
+		over        []string
+		under       []string
+	}{
+		{
+			name:     "conforming",
+			scopes:   []string{"openid", "profile"},
+			granted:  []string{"openid", "profile"},
+			userInfo: map[string]interface{}{"sub": "1", "name": "Ana", "nickname": "ana"},
+			disclosures: map[string]string{
+				"sub":      models.DisclosureExpected,
+				"name":     models.DisclosureExpected,
+				"nickname": models.DisclosureAllowed,
+			},
+		},
+		{
+			name:     "claim of a scope not requested",
+			scopes:   []string{"openid"},
+			granted:  []string{"openid"},
+			userInfo: map[string]interface{}{"sub": "1", "name": "Ana"},
+			disclosures: map[string]string{
+				"sub":  models.DisclosureExpected,
+				"name": models.DisclosureOver,
+			},
+			over: []string{"name"},
+		},
+		{
+			name:     "claim of a refused scope",
+			scopes:   []string{"openid", "phone"},
+			granted:  []string{"openid"},
+			userInfo: map[string]interface{}{"sub": "1", "phone_number": "+55"},
+			disclosures: map[string]string{
+				"sub":          models.DisclosureExpected,
+				"phone_number": models.DisclosureOver,
+			},
+			over: []string{"phone_number"},
+		},
+		{
+			name:     "refused scope releasing nothing",
+			scopes:   []string{"openid", "phone"},
+			granted:  []string{"openid"},
+			userInfo: map[string]interface{}{"sub": "1"},
+			disclosures: map[string]string{
+				"sub": models.DisclosureExpected,
+			},
+		},
+		{
+			name:     "claim missing from a granted scope",
+			scopes:   []string{"openid", "profile"},
+			granted:  []string{"openid", "profile"},
+			userInfo: map[string]interface{}{"sub": "1"},
+			disclosures: map[string]string{
+				"sub":  models.DisclosureExpected,
+				"name": models.DisclosureUnder,
+			},
+			under: []string{"name"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			row := models.ScopeMatrixRow{
+				Scopes:      tt.scopes,
+				Granted:     tt.granted,
+				Disclosures: make(map[string]string),
+			}
+			classifyDisclosures(&row, mapping, tt.userInfo)
+
+			if !reflect.DeepEqual(row.Disclosures, tt.disclosures) {
+				t.Errorf("disclosures = %v, want %v", row.Disclosures, tt.disclosures)
+			}
+			if !equalStrings(row.Over, tt.over) {
+				t.Errorf("over = %v, want %v", row.Over, tt.over)
+			}
+			if !equalStrings(row.Under, tt.under) {
+				t.Errorf("under = %v, want %v", row.Under, tt.under)
+			}
+			if want := len(tt.over) == 0 && len(tt.under) == 0; row.Passed != want {
+				t.Errorf("passed = %v, want %v", row.Passed, want)
+			}
+		})
+	}
+}
+
+func TestScopeCombinations(t *testing.T) {
+	mapping := []models.ScopeClaims{{Scope: "openid"}, {Scope: "profile"}, {Scope: "email"}}
+
+	tests := []struct {
+		name   string
+		matrix models.ScopeMatrix
+		want   [][]string
+	}{
+		{
+			name:   "default",
+			matrix: models.ScopeMatrix{Scopes: mapping},
+			want: [][]string{
+				{"openid"},
+				{"openid", "profile"},
+				{"openid", "email"},
+				{"openid", "profile", "email"},
+			},
+		},
+		{
+			name:   "listed",
+			matrix: models.ScopeMatrix{Scopes: mapping, Combinations: [][]string{{"email", "openid", "email"}}},
+			want:   [][]string{{"openid", "email"}},
+		},
+		{
+			name:   "exhaustive",
+			matrix: models.ScopeMatrix{Scopes: mapping, Exhaustive: true},
+			want: [][]string{
+				{"openid"},
+				{"openid", "profile"},
+				{"openid", "email"},
+				{"openid", "profile", "email"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := scopeCombinations(&tt.matrix); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("scopeCombinations() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// equalStrings compares two string slices, nil and empty being equal
+func equalStrings(a, b []string) bool {
+	if len(a) == 0 && len(b) == 0 {
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
@@ -0,0 +1,330 @@
+package services
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/sessions"
+
+	"github.com/pericles-luz/oauth2-test/internal/models"
+	"github.com/pericles-luz/oauth2-test/internal/storage"
+)
+
+// sessionTouchInterval limits how often reading a session records activity
+const sessionTouchInterval = time.Minute
+
+// SessionStore is a gorilla sessions.Store keeping session values in the
+// database. The cookie holds only a random token; the database keeps an
+// HMAC of it, so a copy of the database cannot be used to hijack sessions.
+// Sessions end after IdleTimeout without requests, or AbsoluteTimeout after
+// they were created, whichever comes first.
+type SessionStore struct {
+	db              storage.Store
+	secret          []byte
+	Options         *sessions.Options
+	IdleTimeout     time.Duration
+	AbsoluteTimeout time.Duration
+
+	mu    sync.Mutex
+	onEnd []func(values map[interface{}]interface{}) // called with the values of each session that ends
+
+	stop    chan struct{}
+	stopped sync.WaitGroup
+}
+
+// NewSessionStore creates a new SessionStore. secret keys the token HMAC.
+func NewSessionStore(db storage.Store, secret string, idleTimeout, absoluteTimeout time.Duration) *SessionStore {
+	return &SessionStore{
+		db:     db,
+		secret: []byte(secret),
+		Options: &sessions.Options{
+			Path:     "/",
+			MaxAge:   int(absoluteTimeout.Seconds()),
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		},
+		IdleTimeout:     idleTimeout,
+		AbsoluteTimeout: absoluteTimeout,
+	}
+}
+
+// Get returns a session for the given name, cached for the request
+func (s *SessionStore) Get(r *http.Request, name string) (*sessions.Session, error) {
+	return sessions.GetRegistry(r).Get(s, name)
+}
+
+// New loads the session referenced by the request cookie, or returns a new
+// one when there is none or it expired
+func (s *SessionStore) New(r *http.Request, name string) (*sessions.Session, error) {
+	session := sessions.NewSession(s, name)
+	options := *s.Options
+	session.Options = &options
+	session.IsNew = true
+
+	cookie, err := r.Cookie(name)
+	if err != nil || cookie.Value == "" {
+		return session, nil
+	}
+
+	stored, err := s.db.GetSessionByToken(s.hashToken(cookie.Value))
+	if err != nil {
+		return session, err
+	}
+	if stored == nil {
+		return session, nil
+	}
+
+	now := time.Now()
+	if s.expired(stored, now) {
+		if err := s.end(stored); err != nil {
+			log.Printf("Failed to delete expired session: %v", err)
+		}
+		return session, nil
+	}
+
+	if err := decodeSessionValues(stored.Data, &session.Values); err != nil {
+		// Values written by an older version cannot be read; start over
+		log.Printf("Discarding undecodable session %d: %v", stored.ID, err)
+		return session, nil
+	}
+
+	if now.Sub(stored.LastSeenAt) > sessionTouchInterval {
+		if err := s.db.TouchSession(stored.ID, now); err != nil {
+			log.Printf("Failed to touch session: %v", err)
+		}
+	}
+
+	session.ID = cookie.Value
+	session.IsNew = false
+	return session, nil
+}
+
+// Save stores the session values and sets the cookie. A negative MaxAge
+// deletes the session.
+func (s *SessionStore) Save(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	if session.Options.MaxAge < 0 {
+		if session.ID != "" {
+			if stored, err := s.db.GetSessionByToken(s.hashToken(session.ID)); err == nil && stored != nil {
+				if err := s.end(stored); err != nil {
+					return err
+				}
+			}
+		}
+		http.SetCookie(w, sessions.NewCookie(session.Name(), "", session.Options))
+		return nil
+	}
+
+	now := time.Now()
+	if session.ID == "" {
+		token, err := generateSessionToken()
+		if err != nil {
+			return err
+		}
+		session.ID = token
+	}
+
+	data, err := encodeSessionValues(session.Values)
+	if err != nil {
+		return err
+	}
+
+	err = s.db.SaveSession(&models.Session{
+		TokenHash:  s.hashToken(session.ID),
+		Data:       data,
+		UserAgent:  r.UserAgent(),
+		RemoteAddr: r.RemoteAddr,
+		CreatedAt:  now,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(s.AbsoluteTimeout),
+	})
+	if err != nil {
+		return err
+	}
+
+	http.SetCookie(w, sessions.NewCookie(session.Name(), session.ID, session.Options))
+	return nil
+}
+
+// List returns the active sessions, most recently used first
+func (s *SessionStore) List() ([]models.Session, error) {
+	all, err := s.db.GetSessions()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var active []models.Session
+	for _, session := range all {
+		if !s.expired(&session, now) {
+			active = append(active, session)
+		}
+	}
+	return active, nil
+}
+
+// Values decodes the values of a stored session
+func (s *SessionStore) Values(session *models.Session) (map[interface{}]interface{}, error) {
+	values := make(map[interface{}]interface{})
+	if err := decodeSessionValues(session.Data, &values); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// Lookup returns the stored session with the given ID, or nil
+func (s *SessionStore) Lookup(id int64) (*models.Session, error) {
+	return s.db.GetSession(id)
+}
+
+// Terminate ends a session; its cookie no longer authenticates
+func (s *SessionStore) Terminate(id int64) error {
+	stored, err := s.db.GetSession(id)
+	if err != nil || stored == nil {
+		return err
+	}
+	return s.end(stored)
+}
+
+// OnEnd registers fn to be called with the values of every session that
+// ends: signed out, terminated, or removed past its timeouts
+func (s *SessionStore) OnEnd(fn func(values map[interface{}]interface{})) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onEnd = append(s.onEnd, fn)
+}
+
+// end deletes a stored session and calls the OnEnd hooks with its values
+func (s *SessionStore) end(stored *models.Session) error {
+	if err := s.db.DeleteSession(stored.ID); err != nil {
+		return err
+	}
+
+	values := make(map[interface{}]interface{})
+	if err := decodeSessionValues(stored.Data, &values); err != nil {
+		log.Printf("Ended undecodable session %d: %v", stored.ID, err)
+		return nil
+	}
+
+	s.mu.Lock()
+	onEnd := s.onEnd
+	s.mu.Unlock()
+	for _, fn := range onEnd {
+		fn(values)
+	}
+	return nil
+}
+
+// Cleanup removes the sessions past their idle or absolute timeout,
+// returning how many were removed
+func (s *SessionStore) Cleanup() (int, error) {
+	all, err := s.db.GetSessions()
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	removed := 0
+	for i := range all {
+		if !s.expired(&all[i], now) {
+			continue
+		}
+		if err := s.end(&all[i]); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// IsCurrent reports whether a stored session is the one referenced by a session's cookie
+func (s *SessionStore) IsCurrent(stored models.Session, session *sessions.Session) bool {
+	return session.ID != "" && hmac.Equal([]byte(stored.TokenHash), []byte(s.hashToken(session.ID)))
+}
+
+// Start launches the background removal of expired sessions
+func (s *SessionStore) Start(interval time.Duration) {
+	if interval <= 0 || s.stop != nil {
+		return
+	}
+
+	s.stop = make(chan struct{})
+	s.stopped.Add(1)
+
+	go func() {
+		defer s.stopped.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			if _, err := s.Cleanup(); err != nil {
+				log.Printf("Session cleanup failed: %v", err)
+			}
+
+			select {
+			case <-ticker.C:
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop terminates the background cleanup and waits for it to finish
+func (s *SessionStore) Stop() {
+	if s.stop == nil {
+		return
+	}
+	close(s.stop)
+	s.stopped.Wait()
+	s.stop = nil
+}
+
+// expired reports whether a session passed its idle or absolute timeout
+func (s *SessionStore) expired(session *models.Session, now time.Time) bool {
+	return now.After(session.ExpiresAt) || now.Sub(session.LastSeenAt) > s.IdleTimeout
+}
+
+// hashToken returns the HMAC stored in place of a session token
+func (s *SessionStore) hashToken(token string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(token))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// generateSessionToken generates the random token sent in the session cookie
+func generateSessionToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate session token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// encodeSessionValues serializes session values with gob, like the cookie store did
+func encodeSessionValues(values map[interface{}]interface{}) (string, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(values); err != nil {
+		return "", fmt.Errorf("failed to encode session: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// decodeSessionValues deserializes values encoded by encodeSessionValues
+func decodeSessionValues(data string, values *map[interface{}]interface{}) error {
+	raw, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return fmt.Errorf("failed to decode session: %w", err)
+	}
+	return gob.NewDecoder(bytes.NewReader(raw)).Decode(values)
+}
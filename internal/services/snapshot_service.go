@@ -0,0 +1,265 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pericles-luz/oauth2-test/internal/models"
+	"github.com/pericles-luz/oauth2-test/internal/storage"
+)
+
+// SnapshotService keeps a version of every discovery document and key set
+// fetched, so that silent changes of the provider show up in a change log
+type SnapshotService struct {
+	db storage.Store
+	mu sync.Mutex // serializes Record, so concurrent fetches agree on versions
+}
+
+// NewSnapshotService creates a new SnapshotService
+func NewSnapshotService(db storage.Store) *SnapshotService {
+	return &SnapshotService{db: db}
+}
+
+// SnapshotVersion is a stored version with its differences to the previous one
+type SnapshotVersion struct {
+	models.ProviderSnapshot
+	Diffs []FieldDiff `json:"diffs"`
+}
+
+// Record stores a document fetched from source. Content equal to the latest
+// version only moves its last seen time; anything else becomes a new version.
+func (s *SnapshotService) Record(kind, source string, document []byte) (*models.ProviderSnapshot, error) {
+	var decoded interface{}
+	if err := json.Unmarshal(document, &decoded); err != nil {
+		return nil, fmt.Errorf("failed to decode %s document: %w", kind, err)
+	}
+	canonical, err := json.MarshalIndent(decoded, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s document: %w", kind, err)
+	}
+	fingerprint := Fingerprint(string(canonical))
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	latest, err := s.db.GetLatestSnapshot(source)
+	if err != nil {
+		return nil, err
+	}
+	if latest != nil && latest.Fingerprint == fingerprint {
+		if err := s.db.TouchSnapshot(latest.ID, now); err != nil {
+			return nil, err
+		}
+		latest.LastSeenAt = now
+		return latest, nil
+	}
+
+	snapshot := &models.ProviderSnapshot{
+		Kind:        kind,
+		Source:      source,
+		Version:     1,
+		Fingerprint: fingerprint,
+		Document:    string(canonical),
+		FirstSeenAt: now,
+		LastSeenAt:  now,
+	}
+	if latest != nil {
+		var previous interface{}
+		if err := json.Unmarshal([]byte(latest.Document), &previous); err != nil {
+			return nil, fmt.Errorf("snapshot %d: failed to decode document: %w", latest.ID, err)
+		}
+
+		var diffs []FieldDiff
+		diffJSON("$", previous, decoded, &diffs)
+		sortDiffs(diffs)
+		changes, err := json.Marshal(diffs)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode snapshot changes: %w", err)
+		}
+
+		snapshot.Version = latest.Version + 1
+		snapshot.Changes = string(changes)
+		snapshot.Summary = summarizeSnapshot(kind, latest.Document, string(canonical))
+	}
+
+	if err := s.db.SaveSnapshot(snapshot); err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// Versions returns the most recent versions, of every document or only of
+// the one fetched from source, newest first
+func (s *SnapshotService) Versions(source string, limit int) ([]SnapshotVersion, error) {
+	snapshots, err := s.db.GetSnapshots(source, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	versions := make([]SnapshotVersion, len(snapshots))
+	for i, snapshot := range snapshots {
+		versions[i].ProviderSnapshot = snapshot
+		if err := json.Unmarshal([]byte(snapshot.Changes), &versions[i].Diffs); err != nil {
+			return nil, fmt.Errorf("snapshot %d: failed to decode changes: %w", snapshot.ID, err)
+		}
+	}
+	return versions, nil
+}
+
+// IssuerChanges returns the changes since a given time of the discovery
+// document of an issuer and of the key set it advertises, newest first.
+// Only the latest change of each field or key is kept.
+func (s *SnapshotService) IssuerChanges(baseURL string, since time.Time) ([]models.ProviderChange, error) {
+	discoveryURL := baseURL + "/.well-known/openid-configuration"
+	jwksURL := models.DefaultEndpoints(baseURL).JWKS
+	latest, err := s.db.GetLatestSnapshot(discoveryURL)
+	if err != nil {
+		return nil, err
+	}
+	if latest != nil {
+		var discovery map[string]interface{}
+		if json.Unmarshal([]byte(latest.Document), &discovery) == nil {
+			if advertised := EndpointsFromDiscovery(discovery).JWKS; advertised != "" {
+				jwksURL = advertised
+			}
+		}
+	}
+
+	var changes []models.ProviderChange
+	for _, source := range []string{discoveryURL, jwksURL} {
+		sourceChanges, err := s.changes(source, func(snapshot *models.ProviderSnapshot) bool {
+			return !snapshot.FirstSeenAt.Before(since)
+		})
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, sourceChanges...)
+	}
+
+	sort.SliceStable(changes, func(i, j int) bool { return changes[i].ChangedAt.After(changes[j].ChangedAt) })
+	return changes, nil
+}
+
+// Latest returns the latest version of the document fetched from source, or nil
+func (s *SnapshotService) Latest(source string) (*models.ProviderSnapshot, error) {
+	return s.db.GetLatestSnapshot(source)
+}
+
+// ChangesSince returns the changes of the document fetched from source in the
+// versions stored after the snapshot afterID, newest first. Only the latest
+// change of each field or key is kept.
+func (s *SnapshotService) ChangesSince(source string, afterID int64) ([]models.ProviderChange, error) {
+	return s.changes(source, func(snapshot *models.ProviderSnapshot) bool {
+		return snapshot.ID > afterID
+	})
+}
+
+// changesLimit bounds the versions of each document read for changes
+const changesLimit = 50
+
+// changes lists the changes of the latest versions of the document fetched
+// from source, newest first, as long as include accepts the version. Only the
+// latest change of each field or key is kept.
+func (s *SnapshotService) changes(source string, include func(snapshot *models.ProviderSnapshot) bool) ([]models.ProviderChange, error) {
+	snapshots, err := s.db.GetSnapshots(source, changesLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []models.ProviderChange
+	seen := make(map[string]bool)
+	for i := range snapshots {
+		snapshot := &snapshots[i]
+		if !include(snapshot) {
+			break
+		}
+		for _, change := range snapshot.Summary {
+			if seen[change.Field] {
+				continue
+			}
+			seen[change.Field] = true
+			changes = append(changes, models.ProviderChange{
+				SnapshotChange: change,
+				Kind:           snapshot.Kind,
+				Source:         snapshot.Source,
+				Version:        snapshot.Version,
+				SnapshotID:     snapshot.ID,
+				ChangedAt:      snapshot.FirstSeenAt,
+			})
+		}
+	}
+	return changes, nil
+}
+
+// summarizeSnapshot lists the fields of a discovery document, or the keys of
+// a key set, that differ between two versions
+func summarizeSnapshot(kind, previous, current string) []models.SnapshotChange {
+	if kind == models.SnapshotJWKS {
+		oldKeys, errOld := ParseJWKS([]byte(previous))
+		newKeys, errNew := ParseJWKS([]byte(current))
+		if errOld == nil && errNew == nil {
+			if changes := keyChanges(oldKeys, newKeys); len(changes) > 0 {
+				return changes
+			}
+		}
+	}
+
+	var oldFields, newFields map[string]interface{}
+	json.Unmarshal([]byte(previous), &oldFields)
+	json.Unmarshal([]byte(current), &newFields)
+
+	var changes []models.SnapshotChange
+	for field, value := range newFields {
+		old, ok := oldFields[field]
+		switch {
+		case !ok:
+			changes = append(changes, models.SnapshotChange{Field: field, Change: DiffAdded})
+		case !jsonEqual(old, value):
+			changes = append(changes, models.SnapshotChange{Field: field, Change: DiffChanged})
+		}
+	}
+	for field := range oldFields {
+		if _, ok := newFields[field]; !ok {
+			changes = append(changes, models.SnapshotChange{Field: field, Change: DiffRemoved})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Field < changes[j].Field })
+	return changes
+}
+
+// jsonEqual reports whether two decoded JSON values are the same
+func jsonEqual(a, b interface{}) bool {
+	encodedA, _ := json.Marshal(a)
+	encodedB, _ := json.Marshal(b)
+	return bytes.Equal(encodedA, encodedB)
+}
+
+// keyChanges lists the keys added, removed or replaced between two key sets
+func keyChanges(previous, current *JWKSet) []models.SnapshotChange {
+	old := make(map[string]JWK, len(previous.Keys))
+	for _, key := range previous.Keys {
+		old[key.Kid] = key
+	}
+
+	var changes []models.SnapshotChange
+	for _, key := range current.Keys {
+		previousKey, ok := old[key.Kid]
+		switch {
+		case !ok:
+			changes = append(changes, models.SnapshotChange{Field: "kid " + key.Kid, Change: DiffAdded})
+		case previousKey != key:
+			changes = append(changes, models.SnapshotChange{Field: "kid " + key.Kid, Change: DiffChanged})
+		}
+		delete(old, key.Kid)
+	}
+	for kid := range old {
+		changes = append(changes, models.SnapshotChange{Field: "kid " + kid, Change: DiffRemoved})
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Field < changes[j].Field })
+	return changes
+}
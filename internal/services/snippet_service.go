@@ -0,0 +1,458 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pericles-luz/oauth2-test/internal/models"
+)
+
+// Snippet is a copyable reproduction of a logged HTTP request
+type Snippet struct {
+	Language string   `json:"language"`
+	Label    string   `json:"label"`
+	Code     string   `json:"code"`
+	EnvVars  []string `json:"env_vars,omitempty"`
+}
+
+// SnippetOptions controls how snippets are generated
+type SnippetOptions struct {
+	// UsePlaceholders replaces secrets with environment variable references
+	UsePlaceholders bool
+}
+
+// secretFields maps form/query fields holding secrets to environment variables
+var secretFields = map[string]string{
+	"client_secret": "OAUTH2_CLIENT_SECRET",
+	"code":          "OAUTH2_CODE",
+	"code_verifier": "OAUTH2_CODE_VERIFIER",
+	"refresh_token": "OAUTH2_REFRESH_TOKEN",
+	"access_token":  "OAUTH2_ACCESS_TOKEN",
+	"id_token_hint": "OAUTH2_ID_TOKEN",
+	"token":         "OAUTH2_TOKEN",
+	"password":      "OAUTH2_PASSWORD",
+}
+
+// skippedHeaders are set automatically by every HTTP client
+var skippedHeaders = map[string]bool{
+	"Content-Length":    true,
+	"Accept-Encoding":   true,
+	"Connection":        true,
+	"Host":              true,
+	"Transfer-Encoding": true,
+}
+
+// snippetPart is either a literal text or an environment variable reference
+type snippetPart struct {
+	text string
+	env  string
+}
+
+// snippetValue is a string made of literal and environment variable parts
+type snippetValue []snippetPart
+
+func literal(s string) snippetValue {
+	return snippetValue{{text: s}}
+}
+
+// snippetField is an ordered name/value pair from a form body or query string
+type snippetField struct {
+	name  string
+	value snippetValue
+}
+
+// snippetRequest is the language-independent representation of a request
+type snippetRequest struct {
+	method  string
+	url     snippetValue
+	headers []snippetField
+	form    []snippetField
+	rawBody string
+	isForm  bool
+	envVars []string
+}
+
+// GenerateSnippets builds curl, HTTPie, Go, PHP and Node reproductions of a history entry
+func GenerateSnippets(entry *models.HistoryEntry, opts SnippetOptions) ([]Snippet, error) {
+	req, err := buildSnippetRequest(entry, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return []Snippet{
+		{Language: "curl", Label: "cURL", Code: renderCurl(req), EnvVars: req.envVars},
+		{Language: "httpie", Label: "HTTPie", Code: renderHTTPie(req), EnvVars: req.envVars},
+		{Language: "go", Label: "Go (net/http)", Code: renderGo(req), EnvVars: req.envVars},
+		{Language: "php", Label: "PHP (cURL)", Code: renderPHP(req), EnvVars: req.envVars},
+		{Language: "node", Label: "Node.js (fetch)", Code: renderNode(req), EnvVars: req.envVars},
+	}, nil
+}
+
+// buildSnippetRequest parses the stored headers and body of a history entry
+func buildSnippetRequest(entry *models.HistoryEntry, opts SnippetOptions) (*snippetRequest, error) {
+	req := &snippetRequest{method: entry.RequestMethod}
+	envSeen := map[string]bool{}
+	useEnv := func(name string) {
+		if !envSeen[name] {
+			envSeen[name] = true
+			req.envVars = append(req.envVars, name)
+		}
+	}
+
+	// URL with query string secrets replaced
+	base, rawQuery, hasQuery := strings.Cut(entry.RequestURL, "?")
+	req.url = literal(base)
+	if hasQuery {
+		req.url = append(req.url, snippetPart{text: "?"})
+		for i, field := range parseOrderedFields(rawQuery, opts, useEnv) {
+			if i > 0 {
+				req.url = append(req.url, snippetPart{text: "&"})
+			}
+			req.url = append(req.url, snippetPart{text: url.QueryEscape(field.name) + "="})
+			for _, part := range field.value {
+				if part.env != "" {
+					req.url = append(req.url, part)
+				} else {
+					req.url = append(req.url, snippetPart{text: url.QueryEscape(part.text)})
+				}
+			}
+		}
+	}
+
+	// Headers in a stable order
+	var headers map[string][]string
+	if entry.RequestHeaders != "" {
+		if err := json.Unmarshal([]byte(entry.RequestHeaders), &headers); err != nil {
+			return nil, fmt.Errorf("failed to parse request headers: %w", err)
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if skippedHeaders[name] {
+			continue
+		}
+		for _, value := range headers[name] {
+			req.headers = append(req.headers, snippetField{
+				name:  name,
+				value: headerValue(name, value, opts, useEnv),
+			})
+		}
+		if strings.EqualFold(name, "Content-Type") && len(headers[name]) > 0 {
+			req.isForm = strings.HasPrefix(headers[name][0], "application/x-www-form-urlencoded")
+		}
+	}
+
+	// Body
+	if entry.RequestBody != "" {
+		if req.isForm {
+			req.form = parseOrderedFields(entry.RequestBody, opts, useEnv)
+		} else {
+			req.rawBody = entry.RequestBody
+		}
+	}
+
+	return req, nil
+}
+
+// headerValue replaces credentials in a header value with placeholders
+func headerValue(name, value string, opts SnippetOptions, useEnv func(string)) snippetValue {
+	if !opts.UsePlaceholders {
+		return literal(value)
+	}
+
+	switch strings.ToLower(name) {
+	case "authorization":
+		scheme, _, _ := strings.Cut(value, " ")
+		switch strings.ToLower(scheme) {
+		case "bearer":
+			useEnv("OAUTH2_ACCESS_TOKEN")
+			return snippetValue{{text: scheme + " "}, {env: "OAUTH2_ACCESS_TOKEN"}}
+		case "basic":
+			useEnv("OAUTH2_BASIC_CREDENTIALS")
+			return snippetValue{{text: scheme + " "}, {env: "OAUTH2_BASIC_CREDENTIALS"}}
+		}
+		useEnv("OAUTH2_AUTHORIZATION")
+		return snippetValue{{env: "OAUTH2_AUTHORIZATION"}}
+	case "cookie":
+		useEnv("OAUTH2_COOKIE")
+		return snippetValue{{env: "OAUTH2_COOKIE"}}
+	}
+
+	return literal(value)
+}
+
+// parseOrderedFields decodes a urlencoded string keeping the original field order
+func parseOrderedFields(raw string, opts SnippetOptions, useEnv func(string)) []snippetField {
+	var fields []snippetField
+	for _, pair := range strings.Split(raw, "&") {
+		if pair == "" {
+			continue
+		}
+		name, value, _ := strings.Cut(pair, "=")
+		if decoded, err := url.QueryUnescape(name); err == nil {
+			name = decoded
+		}
+		if decoded, err := url.QueryUnescape(value); err == nil {
+			value = decoded
+		}
+
+		field := snippetField{name: name, value: literal(value)}
+		if env, ok := secretFields[name]; ok && opts.UsePlaceholders {
+			useEnv(env)
+			field.value = snippetValue{{env: env}}
+		}
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+// merged joins adjacent literal parts so they render as a single string
+func (v snippetValue) merged() snippetValue {
+	var out snippetValue
+	for _, part := range v {
+		if part.env == "" && len(out) > 0 && out[len(out)-1].env == "" {
+			out[len(out)-1].text += part.text
+			continue
+		}
+		out = append(out, part)
+	}
+	return out
+}
+
+// shellQuote renders a value for POSIX shells
+func (v snippetValue) shellQuote() string {
+	var b strings.Builder
+	for _, part := range v.merged() {
+		if part.env != "" {
+			b.WriteString(`"$` + part.env + `"`)
+			continue
+		}
+		if part.text == "" {
+			continue
+		}
+		b.WriteString("'" + strings.ReplaceAll(part.text, "'", `'\''`) + "'")
+	}
+	if b.Len() == 0 {
+		return "''"
+	}
+	return b.String()
+}
+
+// join renders a value as a concatenation expression of a programming language
+func (v snippetValue) join(quote func(string) string, env func(string) string, sep string) string {
+	var parts []string
+	for _, part := range v.merged() {
+		if part.env != "" {
+			parts = append(parts, env(part.env))
+		} else if part.text != "" {
+			parts = append(parts, quote(part.text))
+		}
+	}
+	if len(parts) == 0 {
+		return quote("")
+	}
+	return strings.Join(parts, sep)
+}
+
+func (v snippetValue) goExpr() string {
+	return v.join(strconv.Quote, func(name string) string {
+		return `os.Getenv("` + name + `")`
+	}, " + ")
+}
+
+func (v snippetValue) phpExpr() string {
+	return v.join(phpQuote, func(name string) string {
+		return "getenv('" + name + "')"
+	}, " . ")
+}
+
+func (v snippetValue) jsExpr() string {
+	return v.join(jsQuote, func(name string) string {
+		return "process.env." + name
+	}, " + ")
+}
+
+func phpQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return "'" + strings.ReplaceAll(s, "'", `\'`) + "'"
+}
+
+func jsQuote(s string) string {
+	var b strings.Builder
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	_ = enc.Encode(s)
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// prefixed prepends a literal to a value
+func prefixed(prefix string, v snippetValue) snippetValue {
+	return append(snippetValue{{text: prefix}}, v...)
+}
+
+// renderCurl renders the request as a curl command
+func renderCurl(req *snippetRequest) string {
+	lines := []string{"curl -X " + req.method + " " + req.url.shellQuote()}
+	for _, h := range req.headers {
+		lines = append(lines, "  -H "+prefixed(h.name+": ", h.value).shellQuote())
+	}
+	for _, f := range req.form {
+		lines = append(lines, "  --data-urlencode "+prefixed(f.name+"=", f.value).shellQuote())
+	}
+	if req.rawBody != "" {
+		lines = append(lines, "  --data-raw "+literal(req.rawBody).shellQuote())
+	}
+	return strings.Join(lines, " \\\n")
+}
+
+// renderHTTPie renders the request as an HTTPie command
+func renderHTTPie(req *snippetRequest) string {
+	cmd := "http"
+	if req.isForm {
+		cmd += " --form"
+	}
+	lines := []string{cmd + " " + req.method + " " + req.url.shellQuote()}
+	for _, h := range req.headers {
+		if req.isForm && strings.EqualFold(h.name, "Content-Type") {
+			continue
+		}
+		lines = append(lines, "  "+prefixed(h.name+":", h.value).shellQuote())
+	}
+	for _, f := range req.form {
+		lines = append(lines, "  "+prefixed(f.name+"=", f.value).shellQuote())
+	}
+	if req.rawBody != "" {
+		lines = append(lines, "  --raw "+literal(req.rawBody).shellQuote())
+	}
+	return strings.Join(lines, " \\\n")
+}
+
+// renderGo renders the request as a Go net/http program
+func renderGo(req *snippetRequest) string {
+	var b strings.Builder
+	imports := []string{"fmt", "io", "net/http"}
+	if len(req.form) > 0 {
+		imports = append(imports, "net/url")
+	}
+	if len(req.envVars) > 0 {
+		imports = append(imports, "os")
+	}
+	if len(req.form) > 0 || req.rawBody != "" {
+		imports = append(imports, "strings")
+	}
+	sort.Strings(imports)
+
+	b.WriteString("package main\n\nimport (\n")
+	for _, imp := range imports {
+		b.WriteString("\t\"" + imp + "\"\n")
+	}
+	b.WriteString(")\n\nfunc main() {\n")
+
+	body := "nil"
+	if len(req.form) > 0 {
+		b.WriteString("\tform := url.Values{}\n")
+		for _, f := range req.form {
+			b.WriteString("\tform.Add(" + strconv.Quote(f.name) + ", " + f.value.goExpr() + ")\n")
+		}
+		b.WriteString("\n")
+		body = "strings.NewReader(form.Encode())"
+	} else if req.rawBody != "" {
+		body = "strings.NewReader(" + strconv.Quote(req.rawBody) + ")"
+	}
+
+	b.WriteString("\treq, err := http.NewRequest(" + strconv.Quote(req.method) + ", " + req.url.goExpr() + ", " + body + ")\n")
+	b.WriteString("\tif err != nil {\n\t\tpanic(err)\n\t}\n")
+	for _, h := range req.headers {
+		b.WriteString("\treq.Header.Add(" + strconv.Quote(h.name) + ", " + h.value.goExpr() + ")\n")
+	}
+	b.WriteString("\n\tresp, err := http.DefaultClient.Do(req)\n")
+	b.WriteString("\tif err != nil {\n\t\tpanic(err)\n\t}\n")
+	b.WriteString("\tdefer resp.Body.Close()\n\n")
+	b.WriteString("\tdata, _ := io.ReadAll(resp.Body)\n")
+	b.WriteString("\tfmt.Println(resp.Status)\n")
+	b.WriteString("\tfmt.Println(string(data))\n")
+	b.WriteString("}\n")
+
+	return b.String()
+}
+
+// renderPHP renders the request with the PHP cURL extension, like the integration manual
+func renderPHP(req *snippetRequest) string {
+	var b strings.Builder
+	b.WriteString("<?php\n")
+
+	if len(req.form) > 0 {
+		// Joined by hand: http_build_query would keep one value per repeated field
+		b.WriteString("$postData = implode('&', [\n")
+		for _, f := range req.form {
+			b.WriteString("    " + phpQuote(url.QueryEscape(f.name)+"=") + " . urlencode(" + f.value.phpExpr() + "),\n")
+		}
+		b.WriteString("]);\n\n")
+	}
+
+	b.WriteString("$ch = curl_init(" + req.url.phpExpr() + ");\n")
+	b.WriteString("curl_setopt($ch, CURLOPT_RETURNTRANSFER, true);\n")
+	switch req.method {
+	case "GET":
+	case "POST":
+		b.WriteString("curl_setopt($ch, CURLOPT_POST, true);\n")
+	default:
+		b.WriteString("curl_setopt($ch, CURLOPT_CUSTOMREQUEST, " + phpQuote(req.method) + ");\n")
+	}
+	if len(req.form) > 0 {
+		b.WriteString("curl_setopt($ch, CURLOPT_POSTFIELDS, $postData);\n")
+	} else if req.rawBody != "" {
+		b.WriteString("curl_setopt($ch, CURLOPT_POSTFIELDS, " + phpQuote(req.rawBody) + ");\n")
+	}
+	if len(req.headers) > 0 {
+		b.WriteString("curl_setopt($ch, CURLOPT_HTTPHEADER, [\n")
+		for _, h := range req.headers {
+			b.WriteString("    " + prefixed(h.name+": ", h.value).phpExpr() + ",\n")
+		}
+		b.WriteString("]);\n")
+	}
+	b.WriteString("\n$response = curl_exec($ch);\n")
+	b.WriteString("$httpCode = curl_getinfo($ch, CURLINFO_HTTP_CODE);\n")
+	b.WriteString("curl_close($ch);\n\n")
+	b.WriteString("echo $httpCode . PHP_EOL . $response;\n")
+
+	return b.String()
+}
+
+// renderNode renders the request with fetch, like the Next.js examples of the manual
+func renderNode(req *snippetRequest) string {
+	var b strings.Builder
+	b.WriteString("const response = await fetch(" + req.url.jsExpr() + ", {\n")
+	b.WriteString("  method: " + jsQuote(req.method) + ",\n")
+	if len(req.headers) > 0 {
+		b.WriteString("  headers: {\n")
+		for _, h := range req.headers {
+			b.WriteString("    " + jsQuote(h.name) + ": " + h.value.jsExpr() + ",\n")
+		}
+		b.WriteString("  },\n")
+	}
+	if len(req.form) > 0 {
+		// Pairs rather than an object, which would keep one value per repeated field
+		b.WriteString("  body: new URLSearchParams([\n")
+		for _, f := range req.form {
+			b.WriteString("    [" + jsQuote(f.name) + ", " + f.value.jsExpr() + "],\n")
+		}
+		b.WriteString("  ]),\n")
+	} else if req.rawBody != "" {
+		b.WriteString("  body: " + jsQuote(req.rawBody) + ",\n")
+	}
+	b.WriteString("});\n\n")
+	b.WriteString("console.log(response.status);\n")
+	b.WriteString("console.log(await response.text());\n")
+
+	return b.String()
+}
@@ -0,0 +1,39 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pericles-luz/oauth2-test/internal/models"
+)
+
+func TestGenerateSnippetsRepeatedFormFields(t *testing.T) {
+	entry := &models.HistoryEntry{
+		RequestMethod:  "POST",
+		RequestURL:     "https://idp.example/token",
+		RequestHeaders: `{"Content-Type":["application/x-www-form-urlencoded"]}`,
+		RequestBody:    "grant_type=client_credentials&resource=https%3A%2F%2Fa.example&resource=https%3A%2F%2Fb.example",
+	}
+	snippets, err := GenerateSnippets(entry, SnippetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every renderer sends both values of the repeated field
+	want := map[string][]string{
+		"node": {`["resource", "https://a.example"],`, `["resource", "https://b.example"],`},
+		"php":  {`'resource=' . urlencode('https://a.example'),`, `'resource=' . urlencode('https://b.example'),`},
+		"go":   {`form.Add("resource", "https://a.example")`, `form.Add("resource", "https://b.example")`},
+	}
+	for _, snippet := range snippets {
+		for _, line := range want[snippet.Language] {
+			if !strings.Contains(snippet.Code, line) {
+				t.Errorf("%s snippet lacks %s:\n%s", snippet.Language, line, snippet.Code)
+			}
+		}
+		delete(want, snippet.Language)
+	}
+	for language := range want {
+		t.Errorf("no %s snippet", language)
+	}
+}
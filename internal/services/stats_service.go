@@ -0,0 +1,142 @@
+package services
+
+import (
+	"sort"
+	"time"
+
+	"github.com/pericles-luz/oauth2-test/internal/models"
+	"github.com/pericles-luz/oauth2-test/internal/storage"
+)
+
+// StatsWindow is a selectable time window of the statistics page
+type StatsWindow struct {
+	Key        string
+	Label      string
+	Duration   time.Duration
+	BucketSize time.Duration
+}
+
+// StatsWindows lists the windows offered by the statistics page
+var StatsWindows = []StatsWindow{
+	{Key: "1h", Label: "Última hora", Duration: time.Hour, BucketSize: 5 * time.Minute},
+	{Key: "24h", Label: "Últimas 24 horas", Duration: 24 * time.Hour, BucketSize: time.Hour},
+	{Key: "7d", Label: "Últimos 7 dias", Duration: 7 * 24 * time.Hour, BucketSize: 6 * time.Hour},
+	{Key: "30d", Label: "Últimos 30 dias", Duration: 30 * 24 * time.Hour, BucketSize: 24 * time.Hour},
+}
+
+// FindStatsWindow returns the window with the given key, defaulting to 24h
+func FindStatsWindow(key string) StatsWindow {
+	for _, window := range StatsWindows {
+		if window.Key == key {
+			return window
+		}
+	}
+	return StatsWindows[1]
+}
+
+// StatsService aggregates latency and error statistics from the history
+type StatsService struct {
+	db storage.Store
+}
+
+// NewStatsService creates a new StatsService
+func NewStatsService(db storage.Store) *StatsService {
+	return &StatsService{db: db}
+}
+
+// GetStats computes statistics for the given window, ending now
+func (s *StatsService) GetStats(window StatsWindow) (*models.HistoryStats, error) {
+	now := time.Now()
+	since := now.Add(-window.Duration)
+
+	samples, err := s.db.GetHistorySamples(since)
+	if err != nil {
+		return nil, err
+	}
+
+	return ComputeStats(samples, since, now, window.BucketSize), nil
+}
+
+// ComputeStats aggregates samples per endpoint type and per time bucket
+func ComputeStats(samples []models.HistorySample, since, until time.Time, bucketSize time.Duration) *models.HistoryStats {
+	stats := &models.HistoryStats{
+		Window:     until.Sub(since),
+		Since:      since,
+		BucketSize: bucketSize,
+	}
+
+	// Per endpoint type
+	byType := map[string][]models.HistorySample{}
+	for _, sample := range samples {
+		byType[sample.EndpointType] = append(byType[sample.EndpointType], sample)
+	}
+	for endpointType, typeSamples := range byType {
+		stats.Endpoints = append(stats.Endpoints, aggregateSamples(endpointType, typeSamples))
+	}
+	sort.Slice(stats.Endpoints, func(i, j int) bool {
+		return stats.Endpoints[i].EndpointType < stats.Endpoints[j].EndpointType
+	})
+	stats.Total = aggregateSamples("total", samples)
+
+	// Per time bucket
+	if bucketSize <= 0 {
+		return stats
+	}
+	start := since.Truncate(bucketSize)
+	bucketSamples := map[int][]models.HistorySample{}
+	for _, sample := range samples {
+		index := int(sample.CreatedAt.Sub(start) / bucketSize)
+		bucketSamples[index] = append(bucketSamples[index], sample)
+	}
+	for i := 0; !start.Add(time.Duration(i) * bucketSize).After(until); i++ {
+		aggregate := aggregateSamples("", bucketSamples[i])
+		stats.Buckets = append(stats.Buckets, models.StatsBucket{
+			Start:  start.Add(time.Duration(i) * bucketSize),
+			Count:  aggregate.Count,
+			Errors: aggregate.Errors,
+			P95:    aggregate.P95,
+		})
+	}
+
+	return stats
+}
+
+// aggregateSamples computes count, error rate and latency percentiles
+func aggregateSamples(endpointType string, samples []models.HistorySample) models.EndpointStats {
+	result := models.EndpointStats{EndpointType: endpointType, Count: len(samples)}
+	if len(samples) == 0 {
+		return result
+	}
+
+	durations := make([]int64, 0, len(samples))
+	var sum int64
+	for _, sample := range samples {
+		if sample.IsError() {
+			result.Errors++
+		}
+		durations = append(durations, sample.DurationMs)
+		sum += sample.DurationMs
+	}
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+
+	result.ErrorRate = float64(result.Errors) * 100 / float64(result.Count)
+	result.P50 = percentile(durations, 50)
+	result.P95 = percentile(durations, 95)
+	result.P99 = percentile(durations, 99)
+	result.Avg = sum / int64(len(durations))
+	result.Max = durations[len(durations)-1]
+
+	return result
+}
+
+// percentile returns the nearest-rank percentile of sorted values
+func percentile(sorted []int64, p int) int64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := (p*len(sorted) + 99) / 100 // ceil(p/100 * n)
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
@@ -1,51 +1,269 @@
 package services
 
 import (
+	"encoding/json"
+	"log"
+	"strconv"
 	"sync"
 	"time"
 
 	"golang.org/x/oauth2"
+
+	"github.com/pericles-luz/oauth2-test/internal/models"
 )
 
+// TokenPersistence is a durable backend for the TokenStore. storage.Store
+// implements it with the session_tokens table, encrypted at rest.
+type TokenPersistence interface {
+	SaveToken(token *models.StoredToken) error
+	GetTokens(now time.Time) ([]models.StoredToken, error)
+	DeleteToken(sessionID string) error
+	DeleteExpiredTokens(now time.Time) (int64, error)
+}
+
 // TokenData holds token and user info with expiration
 type TokenData struct {
-	Token      *oauth2.Token
-	UserInfo   interface{}
-	ExpiresAt  time.Time
+	Token     *oauth2.Token
+	UserInfo  interface{}
+	IssuedAt  time.Time // when the tokens were obtained
+	ExpiresAt time.Time
+
+	AutoRefresh          *AutoRefresh // nil unless the session opted in to background refresh
+	RetiredRefreshTokens []string     // fingerprints of the refresh tokens rotated out
 }
 
-// TokenStore provides thread-safe in-memory token storage
+// AutoRefresh holds what the background worker needs to refresh a session's
+// tokens without a request: the client and the flow to tag the calls with
+type AutoRefresh struct {
+	Client    models.OAuthConfig `json:"client"`
+	FlowID    string             `json:"flow_id,omitempty"`
+	ProfileID int64              `json:"profile_id,omitempty"`
+}
+
+// TokenStore provides thread-safe token storage, cached in memory and
+// written through to an optional persistence backend
 type TokenStore struct {
 	tokens map[string]*TokenData
 	mu     sync.RWMutex
+
+	persistence     TokenPersistence // nil keeps tokens in memory only
+	persistMu       sync.Mutex       // one write to the backend at a time, so none lands out of order
+	refreshLifetime time.Duration    // assumed lifetime of refresh tokens the server does not announce
+	now             func() time.Time
+	onRemove        []func(sessionID string) // called when the tokens of a session are deleted or expire
+
+	stop    chan struct{}
+	stopped sync.WaitGroup
 }
 
-var (
-	globalTokenStore *TokenStore
-	tokenStoreOnce   sync.Once
-)
+// persistedExtras are the fields of the token response read after the
+// exchange, kept across restarts
+var persistedExtras = []string{"id_token", "scope", "expires_in", "refresh_expires_in"}
 
-// GetTokenStore returns the singleton token store instance
-func GetTokenStore() *TokenStore {
-	tokenStoreOnce.Do(func() {
-		globalTokenStore = &TokenStore{
-			tokens: make(map[string]*TokenData),
-		}
-		// Start cleanup goroutine
-		go globalTokenStore.cleanup()
-	})
-	return globalTokenStore
+// persistedToken is the JSON stored for each session. oauth2.Token does not
+// serialize its extra fields, so the ones in persistedExtras are kept apart.
+type persistedToken struct {
+	AccessToken  string                 `json:"access_token"`
+	TokenType    string                 `json:"token_type,omitempty"`
+	RefreshToken string                 `json:"refresh_token,omitempty"`
+	Expiry       time.Time              `json:"expiry,omitempty"`
+	IssuedAt     time.Time              `json:"issued_at,omitempty"`
+	Extra        map[string]interface{} `json:"extra,omitempty"`
+	UserInfo     *models.UserInfo       `json:"user_info,omitempty"`
+	AutoRefresh  *AutoRefresh           `json:"auto_refresh,omitempty"`
+	Retired      []string               `json:"retired_refresh_tokens,omitempty"`
 }
 
-// Store saves token and user info for a session ID
-func (ts *TokenStore) Store(sessionID string, token *oauth2.Token, userInfo interface{}) {
+// NewTokenStore creates a new TokenStore. persistence may be nil.
+func NewTokenStore(persistence TokenPersistence, refreshLifetime time.Duration) *TokenStore {
+	return &TokenStore{
+		tokens:          make(map[string]*TokenData),
+		persistence:     persistence,
+		refreshLifetime: refreshLifetime,
+		now:             time.Now,
+	}
+}
+
+// Load reads the persisted tokens that did not expire yet, returning how many were loaded
+func (ts *TokenStore) Load() (int, error) {
+	if ts.persistence == nil {
+		return 0, nil
+	}
+
+	stored, err := ts.persistence.GetTokens(ts.now())
+	if err != nil {
+		return 0, err
+	}
+
 	ts.mu.Lock()
 	defer ts.mu.Unlock()
 
-	ts.tokens[sessionID] = &TokenData{
+	loaded := 0
+	for _, record := range stored {
+		var p persistedToken
+		if err := json.Unmarshal([]byte(record.Data), &p); err != nil {
+			log.Printf("Skipping unreadable token of session %s: %v", record.SessionID, err)
+			continue
+		}
+		data := &TokenData{
+			Token:                p.token(),
+			IssuedAt:             p.IssuedAt,
+			ExpiresAt:            record.ExpiresAt,
+			AutoRefresh:          p.AutoRefresh,
+			RetiredRefreshTokens: p.Retired,
+		}
+		if p.UserInfo != nil {
+			data.UserInfo = p.UserInfo
+		}
+		ts.tokens[record.SessionID] = data
+		loaded++
+	}
+
+	return loaded, nil
+}
+
+// Store saves token and user info for a session ID. The auto-refresh
+// settings of the session are kept.
+func (ts *TokenStore) Store(sessionID string, token *oauth2.Token, userInfo interface{}) {
+	ts.mu.Lock()
+	data := &TokenData{
 		Token:     token,
 		UserInfo:  userInfo,
-		ExpiresAt: time.Now().Add(24 * time.Hour), // Expire after 24 hours
+		IssuedAt:  ts.now(),
+		ExpiresAt: ts.expiresAt(token),
+	}
+	if previous, exists := ts.tokens[sessionID]; exists {
+		data.AutoRefresh = previous.AutoRefresh
+		data.RetiredRefreshTokens = previous.RetiredRefreshTokens
+	}
+	ts.tokens[sessionID] = data
+	ts.mu.Unlock()
+
+	ts.persist(sessionID)
+}
+
+// StoreRefreshed replaces the tokens of a session after a refresh, keeping
+// its user info and expiry and retiring the fingerprint of a rotated refresh
+// token
+func (ts *TokenStore) StoreRefreshed(sessionID string, token *oauth2.Token, retiredFingerprint string) {
+	ts.mu.Lock()
+	previous, exists := ts.tokens[sessionID]
+	if !exists {
+		ts.mu.Unlock()
+		return
+	}
+	// Refreshing never extends the session: the refresh token obtained at
+	// login bounds it, however many times it is rotated
+	expiresAt := ts.expiresAt(token)
+	if previous.ExpiresAt.Before(expiresAt) {
+		expiresAt = previous.ExpiresAt
+	}
+	data := &TokenData{
+		Token:                token,
+		UserInfo:             previous.UserInfo,
+		IssuedAt:             ts.now(),
+		ExpiresAt:            expiresAt,
+		AutoRefresh:          previous.AutoRefresh,
+		RetiredRefreshTokens: previous.RetiredRefreshTokens,
+	}
+	if retiredFingerprint != "" {
+		data.RetiredRefreshTokens = append(append([]string(nil), previous.RetiredRefreshTokens...), retiredFingerprint)
+	}
+	ts.tokens[sessionID] = data
+	ts.mu.Unlock()
+
+	ts.persist(sessionID)
+}
+
+// SetAutoRefresh enables background refresh for a session, or disables it
+// when settings is nil. It reports false if the session has no tokens.
+func (ts *TokenStore) SetAutoRefresh(sessionID string, settings *AutoRefresh) bool {
+	ts.mu.Lock()
+	previous, exists := ts.tokens[sessionID]
+	if !exists {
+		ts.mu.Unlock()
+		return false
+	}
+	data := *previous
+	data.AutoRefresh = settings
+	ts.tokens[sessionID] = &data
+	ts.mu.Unlock()
+
+	ts.persist(sessionID)
+	return true
+}
+
+// Data returns a copy of the token data of a session
+func (ts *TokenStore) Data(sessionID string) (TokenData, bool) {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+
+	data, exists := ts.tokens[sessionID]
+	if !exists || ts.now().After(data.ExpiresAt) {
+		return TokenData{}, false
+	}
+	return *data, true
+}
+
+// Due returns the sessions with auto-refresh enabled whose access token
+// expires within lead
+func (ts *TokenStore) Due(lead time.Duration) []string {
+	now := ts.now()
+
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+
+	var due []string
+	for sessionID, data := range ts.tokens {
+		if data.AutoRefresh == nil || data.Token.RefreshToken == "" || now.After(data.ExpiresAt) {
+			continue
+		}
+		if !data.Token.Expiry.IsZero() && data.Token.Expiry.Sub(now) <= lead {
+			due = append(due, sessionID)
+		}
+	}
+	return due
+}
+
+// persist writes the current token data of a session to the backend, or
+// deletes it when the session has none. Each write reads the data under the
+// write lock, so concurrent changes cannot leave an older version stored.
+func (ts *TokenStore) persist(sessionID string) {
+	if ts.persistence == nil {
+		return
+	}
+
+	ts.persistMu.Lock()
+	defer ts.persistMu.Unlock()
+
+	ts.mu.RLock()
+	data, exists := ts.tokens[sessionID]
+	ts.mu.RUnlock()
+
+	if !exists {
+		if err := ts.persistence.DeleteToken(sessionID); err != nil {
+			log.Printf("Failed to delete persisted token of session %s: %v", sessionID, err)
+		}
+		return
+	}
+
+	p := newPersistedToken(data.Token, data.UserInfo)
+	p.IssuedAt = data.IssuedAt
+	p.AutoRefresh = data.AutoRefresh
+	p.Retired = data.RetiredRefreshTokens
+
+	encoded, err := json.Marshal(p)
+	if err != nil {
+		log.Printf("Failed to encode token of session %s: %v", sessionID, err)
+		return
+	}
+	err = ts.persistence.SaveToken(&models.StoredToken{
+		SessionID: sessionID,
+		Data:      string(encoded),
+		ExpiresAt: data.ExpiresAt,
+	})
+	if err != nil {
+		log.Printf("Failed to persist token of session %s: %v", sessionID, err)
 	}
 }
 
@@ -55,34 +273,167 @@ func (ts *TokenStore) Get(sessionID string) (*oauth2.Token, interface{}, bool) {
 	defer ts.mu.RUnlock()
 
 	data, exists := ts.tokens[sessionID]
-	if !exists || time.Now().After(data.ExpiresAt) {
+	if !exists || ts.now().After(data.ExpiresAt) {
 		return nil, nil, false
 	}
 
 	return data.Token, data.UserInfo, true
 }
 
-// Delete removes token data for a session ID
-func (ts *TokenStore) Delete(sessionID string) {
+// OnRemove registers fn to be called with the session ID whenever the tokens
+// of a session are deleted or removed as expired
+func (ts *TokenStore) OnRemove(fn func(sessionID string)) {
 	ts.mu.Lock()
 	defer ts.mu.Unlock()
+	ts.onRemove = append(ts.onRemove, fn)
+}
 
+// Delete removes token data for a session ID
+func (ts *TokenStore) Delete(sessionID string) {
+	ts.mu.Lock()
 	delete(ts.tokens, sessionID)
+	onRemove := ts.onRemove
+	ts.mu.Unlock()
+
+	for _, fn := range onRemove {
+		fn(sessionID)
+	}
+
+	ts.persist(sessionID)
 }
 
-// cleanup periodically removes expired tokens
-func (ts *TokenStore) cleanup() {
-	ticker := time.NewTicker(1 * time.Hour)
-	defer ticker.Stop()
+// Cleanup removes expired tokens from memory and from the backend,
+// returning how many were removed from memory
+func (ts *TokenStore) Cleanup() int {
+	now := ts.now()
+
+	ts.mu.Lock()
+	var removed []string
+	for sessionID, data := range ts.tokens {
+		if now.After(data.ExpiresAt) {
+			delete(ts.tokens, sessionID)
+			removed = append(removed, sessionID)
+		}
+	}
+	onRemove := ts.onRemove
+	ts.mu.Unlock()
+
+	for _, sessionID := range removed {
+		for _, fn := range onRemove {
+			fn(sessionID)
+		}
+	}
+
+	if ts.persistence != nil {
+		if _, err := ts.persistence.DeleteExpiredTokens(now); err != nil {
+			log.Printf("Failed to delete expired tokens: %v", err)
+		}
+	}
 
-	for range ticker.C {
-		ts.mu.Lock()
-		now := time.Now()
-		for sessionID, data := range ts.tokens {
-			if now.After(data.ExpiresAt) {
-				delete(ts.tokens, sessionID)
+	return len(removed)
+}
+
+// Start launches the periodic cleanup of expired tokens
+func (ts *TokenStore) Start(interval time.Duration) {
+	if interval <= 0 || ts.stop != nil {
+		return
+	}
+
+	ts.stop = make(chan struct{})
+	ts.stopped.Add(1)
+
+	go func() {
+		defer ts.stopped.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				ts.Cleanup()
+			case <-ts.stop:
+				return
 			}
 		}
-		ts.mu.Unlock()
+	}()
+}
+
+// Stop terminates the periodic cleanup and waits for it to finish
+func (ts *TokenStore) Stop() {
+	if ts.stop == nil {
+		return
+	}
+	close(ts.stop)
+	ts.stopped.Wait()
+	ts.stop = nil
+}
+
+// expiresAt returns until when a token is worth keeping: while its refresh
+// token can still be used or, without one, until the access token expires.
+// The refresh lifetime comes from refresh_expires_in when the server sends it.
+func (ts *TokenStore) expiresAt(token *oauth2.Token) time.Time {
+	now := ts.now()
+	expiry := token.Expiry
+
+	if token.RefreshToken != "" || expiry.IsZero() {
+		lifetime := ts.refreshLifetime
+		if seconds, ok := extraSeconds(token, "refresh_expires_in"); ok && seconds > 0 {
+			lifetime = time.Duration(seconds) * time.Second
+		}
+		if refreshExpiry := now.Add(lifetime); refreshExpiry.After(expiry) {
+			expiry = refreshExpiry
+		}
+	}
+
+	return expiry
+}
+
+// extraSeconds reads a numeric extra field of a token response
+func extraSeconds(token *oauth2.Token, key string) (int64, bool) {
+	switch v := token.Extra(key).(type) {
+	case float64:
+		return int64(v), true
+	case string:
+		seconds, err := strconv.ParseInt(v, 10, 64)
+		return seconds, err == nil
+	}
+	return 0, false
+}
+
+// newPersistedToken captures what must survive a restart
+func newPersistedToken(token *oauth2.Token, userInfo interface{}) persistedToken {
+	p := persistedToken{
+		AccessToken:  token.AccessToken,
+		TokenType:    token.TokenType,
+		RefreshToken: token.RefreshToken,
+		Expiry:       token.Expiry,
+	}
+	for _, key := range persistedExtras {
+		if value := token.Extra(key); value != nil {
+			if p.Extra == nil {
+				p.Extra = make(map[string]interface{})
+			}
+			p.Extra[key] = value
+		}
+	}
+	if info, ok := userInfo.(*models.UserInfo); ok {
+		p.UserInfo = info
+	}
+	return p
+}
+
+// token rebuilds the oauth2.Token, with its extra fields
+func (p persistedToken) token() *oauth2.Token {
+	token := &oauth2.Token{
+		AccessToken:  p.AccessToken,
+		TokenType:    p.TokenType,
+		RefreshToken: p.RefreshToken,
+		Expiry:       p.Expiry,
+	}
+
+	if len(p.Extra) > 0 {
+		token = token.WithExtra(p.Extra)
 	}
+	return token
 }
@@ -0,0 +1,338 @@
+package services
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+
+	"github.com/pericles-luz/oauth2-test/internal/models"
+)
+
+// memoryTokens is a TokenPersistence kept in memory
+type memoryTokens struct {
+	mu       sync.Mutex
+	tokens   map[string]models.StoredToken
+	cleanups int
+}
+
+func newMemoryTokens() *memoryTokens {
+	return &memoryTokens{tokens: make(map[string]models.StoredToken)}
+}
+
+func (m *memoryTokens) SaveToken(token *models.StoredToken) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tokens[token.SessionID] = *token
+	return nil
+}
+
+func (m *memoryTokens) GetTokens(now time.Time) ([]models.StoredToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var tokens []models.StoredToken
+	for _, token := range m.tokens {
+		if token.ExpiresAt.After(now) {
+			tokens = append(tokens, token)
+		}
+	}
+	return tokens, nil
+}
+
+func (m *memoryTokens) DeleteToken(sessionID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.tokens, sessionID)
+	return nil
+}
+
+func (m *memoryTokens) DeleteExpiredTokens(now time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.cleanups++
+	var removed int64
+	for sessionID, token := range m.tokens {
+		if !token.ExpiresAt.After(now) {
+			delete(m.tokens, sessionID)
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+func (m *memoryTokens) cleanupCount() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.cleanups
+}
+
+// fakeClock is a settable time source
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func newTestTokenStore(persistence TokenPersistence) (*TokenStore, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)}
+	ts := NewTokenStore(persistence, 24*time.Hour)
+	ts.now = clock.Now
+	return ts, clock
+}
+
+func TestTokenStoreExpiresAt(t *testing.T) {
+	ts, clock := newTestTokenStore(nil)
+	now := clock.Now()
+	accessExpiry := now.Add(5 * time.Minute)
+
+	tests := []struct {
+		name  string
+		token *oauth2.Token
+		want  time.Time
+	}{
+		{
+			name:  "no refresh token",
+			token: &oauth2.Token{AccessToken: "a", Expiry: accessExpiry},
+			want:  accessExpiry,
+		},
+		{
+			name:  "refresh token with the assumed lifetime",
+			token: &oauth2.Token{AccessToken: "a", RefreshToken: "r", Expiry: accessExpiry},
+			want:  now.Add(24 * time.Hour),
+		},
+		{
+			name: "refresh_expires_in",
+			token: (&oauth2.Token{AccessToken: "a", RefreshToken: "r", Expiry: accessExpiry}).
+				WithExtra(map[string]interface{}{"refresh_expires_in": float64(3600)}),
+			want: now.Add(time.Hour),
+		},
+		{
+			name: "refresh_expires_in as text",
+			token: (&oauth2.Token{AccessToken: "a", RefreshToken: "r", Expiry: accessExpiry}).
+				WithExtra(map[string]interface{}{"refresh_expires_in": "7200"}),
+			want: now.Add(2 * time.Hour),
+		},
+		{
+			name: "refresh token outliving the access token only",
+			token: (&oauth2.Token{AccessToken: "a", RefreshToken: "r", Expiry: now.Add(2 * time.Hour)}).
+				WithExtra(map[string]interface{}{"refresh_expires_in": float64(60)}),
+			want: now.Add(2 * time.Hour),
+		},
+		{
+			name:  "no expires_in",
+			token: &oauth2.Token{AccessToken: "a"},
+			want:  now.Add(24 * time.Hour),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ts.expiresAt(tt.token); !got.Equal(tt.want) {
+				t.Errorf("expiresAt() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTokenStoreRoundTrip(t *testing.T) {
+	persistence := newMemoryTokens()
+	ts, clock := newTestTokenStore(persistence)
+
+	token := (&oauth2.Token{
+		AccessToken:  "access",
+		TokenType:    "Bearer",
+		RefreshToken: "refresh",
+		Expiry:       clock.Now().Add(5 * time.Minute),
+	}).WithExtra(map[string]interface{}{
+		"id_token":           "header.claims.signature",
+		"scope":              "openid profile",
+		"refresh_expires_in": float64(3600),
+		"session_state":      "not kept",
+	})
+	userInfo := &models.UserInfo{Sub: "123", Name: "Ana"}
+	ts.Store("session", token, userInfo)
+	ts.SetAutoRefresh("session", &AutoRefresh{FlowID: "flow"})
+
+	restarted, _ := newTestTokenStore(persistence)
+	restarted.now = clock.Now
+	loaded, err := restarted.Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if loaded != 1 {
+		t.Fatalf("Load() = %d, want 1", loaded)
+	}
+
+	data, ok := restarted.Data("session")
+	if !ok {
+		t.Fatal("session not loaded")
+	}
+	got := data.Token
+	if got.AccessToken != "access" || got.TokenType != "Bearer" || got.RefreshToken != "refresh" || !got.Expiry.Equal(token.Expiry) {
+		t.Errorf("token = %+v, want %+v", got, token)
+	}
+	for _, key := range []string{"id_token", "scope", "refresh_expires_in"} {
+		if got.Extra(key) != token.Extra(key) {
+			t.Errorf("extra %s = %v, want %v", key, got.Extra(key), token.Extra(key))
+		}
+	}
+	if got.Extra("session_state") != nil {
+		t.Errorf("extra session_state = %v, want it dropped", got.Extra("session_state"))
+	}
+	if info, ok := data.UserInfo.(*models.UserInfo); !ok || info.Sub != "123" || info.Name != "Ana" {
+		t.Errorf("user info = %+v, want %+v", data.UserInfo, userInfo)
+	}
+	if !data.IssuedAt.Equal(clock.Now()) {
+		t.Errorf("issued at = %s, want %s", data.IssuedAt, clock.Now())
+	}
+	if !data.ExpiresAt.Equal(clock.Now().Add(time.Hour)) {
+		t.Errorf("expires at = %s, want %s", data.ExpiresAt, clock.Now().Add(time.Hour))
+	}
+	if data.AutoRefresh == nil || data.AutoRefresh.FlowID != "flow" {
+		t.Errorf("auto refresh = %+v, want flow", data.AutoRefresh)
+	}
+}
+
+func TestTokenStoreRefreshKeepsExpiry(t *testing.T) {
+	ts, clock := newTestTokenStore(nil)
+	expiresIn := func(seconds float64) *oauth2.Token {
+		return (&oauth2.Token{AccessToken: "a", RefreshToken: "r", Expiry: clock.Now().Add(time.Minute)}).
+			WithExtra(map[string]interface{}{"refresh_expires_in": seconds})
+	}
+	ts.Store("session", expiresIn(3600), nil)
+	loginExpiry := clock.Now().Add(time.Hour)
+
+	// Each refresh announces a full lifetime again; the session keeps its own
+	clock.Advance(30 * time.Minute)
+	ts.StoreRefreshed("session", expiresIn(3600), "")
+	if data, _ := ts.Data("session"); !data.ExpiresAt.Equal(loginExpiry) {
+		t.Errorf("expires at after a refresh = %s, want %s", data.ExpiresAt, loginExpiry)
+	}
+
+	// A refresh token granted for less shortens it
+	ts.StoreRefreshed("session", expiresIn(60), "")
+	if data, _ := ts.Data("session"); !data.ExpiresAt.Equal(clock.Now().Add(time.Minute)) {
+		t.Errorf("expires at after a shorter refresh = %s, want %s", data.ExpiresAt, clock.Now().Add(time.Minute))
+	}
+}
+
+func TestTokenStoreConcurrentWrites(t *testing.T) {
+	persistence := newMemoryTokens()
+	ts, clock := newTestTokenStore(persistence)
+
+	// Whatever order the writes end in, the backend keeps the last version
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			token := &oauth2.Token{AccessToken: fmt.Sprintf("access-%d", i), RefreshToken: "r", Expiry: clock.Now().Add(time.Minute)}
+			if i%2 == 0 {
+				ts.Store("session", token, nil)
+			} else {
+				ts.StoreRefreshed("session", token, "")
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	token, _, _ := ts.Get("session")
+	restarted, _ := newTestTokenStore(persistence)
+	restarted.now = clock.Now
+	if _, err := restarted.Load(); err != nil {
+		t.Fatal(err)
+	}
+	persisted, _, ok := restarted.Get("session")
+	if !ok || persisted.AccessToken != token.AccessToken {
+		t.Errorf("persisted access token = %v, want %s", persisted, token.AccessToken)
+	}
+
+	ts.Delete("session")
+	if len(persistence.tokens) != 0 {
+		t.Errorf("persisted tokens after Delete() = %d, want 0", len(persistence.tokens))
+	}
+}
+
+func TestTokenStoreCleanup(t *testing.T) {
+	persistence := newMemoryTokens()
+	ts, clock := newTestTokenStore(persistence)
+
+	ts.Store("short", &oauth2.Token{AccessToken: "a", Expiry: clock.Now().Add(time.Minute)}, nil)
+	ts.Store("long", &oauth2.Token{AccessToken: "a", RefreshToken: "r", Expiry: clock.Now().Add(time.Minute)}, nil)
+
+	if removed := ts.Cleanup(); removed != 0 {
+		t.Errorf("Cleanup() before expiry = %d, want 0", removed)
+	}
+
+	clock.Advance(2 * time.Minute)
+	if _, _, ok := ts.Get("short"); ok {
+		t.Error("expired session still returned")
+	}
+	if removed := ts.Cleanup(); removed != 1 {
+		t.Errorf("Cleanup() = %d, want 1", removed)
+	}
+	if _, ok := persistence.tokens["short"]; ok {
+		t.Error("expired session still persisted")
+	}
+	if _, _, ok := ts.Get("long"); !ok {
+		t.Error("session with a refresh token removed")
+	}
+
+	clock.Advance(24 * time.Hour)
+	if removed := ts.Cleanup(); removed != 1 {
+		t.Errorf("Cleanup() after the refresh lifetime = %d, want 1", removed)
+	}
+	if len(persistence.tokens) != 0 {
+		t.Errorf("persisted tokens = %d, want 0", len(persistence.tokens))
+	}
+}
+
+func TestTokenStoreStartStop(t *testing.T) {
+	persistence := newMemoryTokens()
+	ts, _ := newTestTokenStore(persistence)
+
+	ts.Start(time.Millisecond)
+	deadline := time.Now().Add(5 * time.Second)
+	for persistence.cleanupCount() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("cleanup never ran")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		ts.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stop() did not return")
+	}
+
+	// No cleanup runs once Stop returned
+	count := persistence.cleanupCount()
+	time.Sleep(20 * time.Millisecond)
+	if persistence.cleanupCount() != count {
+		t.Error("cleanup ran after Stop()")
+	}
+
+	// Stopping twice is harmless, and the store can start again
+	ts.Stop()
+	ts.Start(time.Millisecond)
+	ts.Stop()
+}
@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pericles-luz/oauth2-test/internal/secrets"
+)
+
+// dialect holds what differs between the supported SQL databases
+type dialect interface {
+	// name identifies the dialect, selecting its migration set
+	name() string
+	// rebind converts ? placeholders to the dialect's syntax
+	rebind(query string) string
+	// timeArg converts a time to a value comparable with timestamp columns
+	timeArg(t time.Time) interface{}
+	// unlimited is the LIMIT value meaning "no limit"
+	unlimited() string
+	tableExists(db *sql.DB, table string) (bool, error)
+	// legacySchemaVersion detects databases created before schema_migrations existed
+	legacySchemaVersion(db *sql.DB) (int, error)
+	databaseSize(db *sql.DB) (int64, error)
+	vacuum(db *sql.DB) error
+}
+
+// sqlDB implements Store on top of database/sql. Queries are written with ?
+// placeholders and portable SQL; the dialect covers the rest.
+type sqlDB struct {
+	db      *sql.DB
+	dialect dialect
+	keyring *secrets.Keyring // nil stores sensitive columns in clear text
+}
+
+// Driver returns the name of the database driver, "sqlite" or "postgres"
+func (s *sqlDB) Driver() string {
+	return s.dialect.name()
+}
+
+// Close closes the database connection
+func (s *sqlDB) Close() error {
+	return s.db.Close()
+}
+
+func (s *sqlDB) exec(query string, args ...interface{}) (sql.Result, error) {
+	return s.db.Exec(s.dialect.rebind(query), args...)
+}
+
+func (s *sqlDB) query(query string, args ...interface{}) (*sql.Rows, error) {
+	return s.db.Query(s.dialect.rebind(query), args...)
+}
+
+func (s *sqlDB) queryRow(query string, args ...interface{}) *sql.Row {
+	return s.db.QueryRow(s.dialect.rebind(query), args...)
+}
+
+// insert runs an INSERT and returns the generated id
+func (s *sqlDB) insert(query string, args ...interface{}) (int64, error) {
+	var id int64
+	query = strings.TrimSpace(query) + " RETURNING id"
+	if err := s.queryRow(query, args...).Scan(&id); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// inTransaction runs fn in a transaction, committing only if it succeeds
+func (s *sqlDB) inTransaction(fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// rebindNumbered converts ? placeholders to $1, $2, ...
+func rebindNumbered(query string) string {
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
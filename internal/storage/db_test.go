@@ -0,0 +1,106 @@
+package storage
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pericles-luz/oauth2-test/internal/models"
+)
+
+func TestTimeComparisons(t *testing.T) {
+	// Times in other zones compare by instant, in the database as in Go
+	saoPaulo := time.FixedZone("-03", -3*60*60)
+	kolkata := time.FixedZone("+0530", 5*60*60+30*60)
+
+	tests := []struct {
+		name      string
+		expiresAt time.Time
+		now       time.Time
+		active    bool
+	}{
+		{"second before", testTime, testTime.Add(-time.Second), true},
+		{"same second", testTime, testTime, false},
+		{"second after", testTime, testTime.Add(time.Second), false},
+		{"stored in another zone", testTime.In(saoPaulo), testTime.Add(-time.Second), true},
+		{"compared in another zone", testTime, testTime.Add(-time.Second).In(kolkata), true},
+		{"same instant in other zones", testTime.In(saoPaulo), testTime.In(kolkata), false},
+		{"hours apart in wall clock", testTime.In(kolkata), testTime.Add(time.Hour).In(saoPaulo), false},
+		{"across midnight", time.Date(2026, 3, 4, 23, 30, 0, 0, saoPaulo), time.Date(2026, 3, 5, 2, 0, 0, 0, time.UTC), true},
+	}
+
+	forEachMigratedBackend(t, func(t *testing.T, db *sqlDB) {
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				if err := db.SaveToken(&models.StoredToken{SessionID: tt.name, ExpiresAt: tt.expiresAt}); err != nil {
+					t.Fatal(err)
+				}
+				defer db.DeleteToken(tt.name)
+
+				tokens, err := db.GetTokens(tt.now)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if active := len(tokens) == 1; active != tt.active {
+					t.Errorf("GetTokens() = %+v, want active %v", tokens, tt.active)
+				}
+				for _, token := range tokens {
+					if !token.ExpiresAt.Equal(tt.expiresAt) {
+						t.Errorf("expires at = %s, want %s", token.ExpiresAt, tt.expiresAt)
+					}
+				}
+			})
+		}
+	})
+}
+
+func TestConcurrentWrites(t *testing.T) {
+	const workers, writes = 8, 25
+
+	forEachMigratedBackend(t, func(t *testing.T, db *sqlDB) {
+		// Each worker stops at its first error
+		write := func(w, i int) error {
+			sessionID := fmt.Sprintf("session-%d", w)
+			if err := db.SaveHistoryEntry(&models.HistoryEntry{EndpointType: "token"}); err != nil {
+				return err
+			}
+			if err := db.SaveToken(&models.StoredToken{SessionID: sessionID, ExpiresAt: testTime}); err != nil {
+				return err
+			}
+			if err := db.SetMonitorState(sessionID, fmt.Sprint(i)); err != nil {
+				return err
+			}
+			_, err := db.TrimHistory("token", workers*writes)
+			return err
+		}
+
+		var wg sync.WaitGroup
+		errs := make(chan error, workers)
+		for w := 0; w < workers; w++ {
+			wg.Add(1)
+			go func(w int) {
+				defer wg.Done()
+				for i := 0; i < writes; i++ {
+					if err := write(w, i); err != nil {
+						errs <- err
+						return
+					}
+				}
+			}(w)
+		}
+		wg.Wait()
+		close(errs)
+
+		for err := range errs {
+			t.Fatal(err)
+		}
+		counts, err := db.GetHistoryCounts()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(counts) != 1 || counts[0].Total != workers*writes {
+			t.Errorf("GetHistoryCounts() = %+v, want %d entries", counts, workers*writes)
+		}
+	})
+}
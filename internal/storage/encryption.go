@@ -0,0 +1,137 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/pericles-luz/oauth2-test/internal/secrets"
+)
+
+// encryptedColumns lists the columns encrypted at rest, by table
+var encryptedColumns = []struct {
+	table   string
+	columns []string
+}{
+	{"client_profiles", []string{"client_secret"}},
+	{"http_history", []string{"request_headers", "request_body", "response_headers", "response_body"}},
+	{"monitor_state", []string{"value"}},
+	{"sessions", []string{"data"}},
+	{"session_tokens", []string{"data"}},
+}
+
+// rotationBatchSize is the number of rows re-encrypted per transaction
+const rotationBatchSize = 200
+
+// SetKeyring sets the master keys used to encrypt sensitive columns.
+// A nil keyring stores new values in clear text.
+func (s *sqlDB) SetKeyring(keyring *secrets.Keyring) {
+	s.keyring = keyring
+}
+
+// RotateKeys re-encrypts every sensitive value not yet encrypted with the
+// primary key, including values stored in clear text. Old keys must still
+// be in the keyring. It returns the number of rows updated.
+func (s *sqlDB) RotateKeys() (int64, error) {
+	if s.keyring == nil {
+		return 0, fmt.Errorf("no master key configured")
+	}
+
+	var total int64
+	for _, target := range encryptedColumns {
+		lastID := int64(0)
+		for {
+			updated, nextID, err := s.rotateBatch(target.table, target.columns, lastID)
+			if err != nil {
+				return total, fmt.Errorf("failed to rotate %s: %w", target.table, err)
+			}
+			total += updated
+			if nextID == lastID {
+				break
+			}
+			lastID = nextID
+		}
+	}
+
+	return total, nil
+}
+
+// rotateBatch re-encrypts the rows of a batch with id greater than afterID,
+// returning the number of rows updated and the last id seen
+func (s *sqlDB) rotateBatch(table string, columns []string, afterID int64) (int64, int64, error) {
+	selected := make([]string, len(columns))
+	assignments := make([]string, len(columns))
+	for i, column := range columns {
+		selected[i] = "COALESCE(" + column + ", '')"
+		assignments[i] = column + " = ?"
+	}
+
+	var updated int64
+	lastID := afterID
+	err := s.inTransaction(func(tx *sql.Tx) error {
+		rows, err := tx.Query(s.dialect.rebind(`
+			SELECT id, `+strings.Join(selected, ", ")+`
+			FROM `+table+`
+			WHERE id > ?
+			ORDER BY id
+			LIMIT ?
+		`), afterID, rotationBatchSize)
+		if err != nil {
+			return err
+		}
+
+		type row struct {
+			id     int64
+			values []string
+		}
+		var pending []row
+		for rows.Next() {
+			r := row{values: make([]string, len(columns))}
+			dest := []interface{}{&r.id}
+			for i := range r.values {
+				dest = append(dest, &r.values[i])
+			}
+			if err := rows.Scan(dest...); err != nil {
+				rows.Close()
+				return err
+			}
+			lastID = r.id
+
+			needed := false
+			for _, value := range r.values {
+				needed = needed || s.keyring.NeedsRotation(value)
+			}
+			if needed {
+				pending = append(pending, r)
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		update := s.dialect.rebind(`UPDATE ` + table + ` SET ` + strings.Join(assignments, ", ") + ` WHERE id = ?`)
+		for _, r := range pending {
+			args := make([]interface{}, 0, len(columns)+1)
+			for _, value := range r.values {
+				plaintext, err := s.keyring.Decrypt(value)
+				if err != nil {
+					return fmt.Errorf("row %d: %w", r.id, err)
+				}
+				encrypted, err := s.keyring.Encrypt(plaintext)
+				if err != nil {
+					return fmt.Errorf("row %d: %w", r.id, err)
+				}
+				args = append(args, encrypted)
+			}
+			args = append(args, r.id)
+			if _, err := tx.Exec(update, args...); err != nil {
+				return fmt.Errorf("row %d: %w", r.id, err)
+			}
+			updated++
+		}
+		return nil
+	})
+
+	return updated, lastID, err
+}
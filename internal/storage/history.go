@@ -0,0 +1,300 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pericles-luz/oauth2-test/internal/models"
+)
+
+// historyColumns is the column list shared by all http_history queries
+const historyColumns = `id, request_method, request_url, request_headers, request_body,
+		       response_status, response_headers, response_body,
+		       duration_ms, endpoint_type, COALESCE(flow_id, ''),
+		       COALESCE(profile_id, 0),
+		       COALESCE((SELECT name FROM client_profiles WHERE client_profiles.id = http_history.profile_id), ''),
+		       pinned, created_at`
+
+// rowScanner is implemented by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanHistoryEntry scans a row selected with historyColumns, decrypting its sensitive fields
+func (s *sqlDB) scanHistoryEntry(row rowScanner) (*models.HistoryEntry, error) {
+	var entry models.HistoryEntry
+	err := row.Scan(
+		&entry.ID,
+		&entry.RequestMethod,
+		&entry.RequestURL,
+		&entry.RequestHeaders,
+		&entry.RequestBody,
+		&entry.ResponseStatus,
+		&entry.ResponseHeaders,
+		&entry.ResponseBody,
+		&entry.DurationMs,
+		&entry.EndpointType,
+		&entry.FlowID,
+		&entry.ProfileID,
+		&entry.ProfileName,
+		&entry.Pinned,
+		&entry.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, field := range []*string{&entry.RequestHeaders, &entry.RequestBody, &entry.ResponseHeaders, &entry.ResponseBody} {
+		if *field, err = s.keyring.Decrypt(*field); err != nil {
+			return nil, fmt.Errorf("history entry %d: %w", entry.ID, err)
+		}
+	}
+	return &entry, nil
+}
+
+// SaveHistoryEntry saves an HTTP request/response to the database
+func (s *sqlDB) SaveHistoryEntry(entry *models.HistoryEntry) error {
+	// Headers and bodies carry secrets and tokens; the entry itself stays in clear text
+	sensitive := []string{entry.RequestHeaders, entry.RequestBody, entry.ResponseHeaders, entry.ResponseBody}
+	for i := range sensitive {
+		encrypted, err := s.keyring.Encrypt(sensitive[i])
+		if err != nil {
+			return fmt.Errorf("failed to encrypt history entry: %w", err)
+		}
+		sensitive[i] = encrypted
+	}
+
+	query := `
+		INSERT INTO http_history (
+			request_method, request_url, request_headers, request_body,
+			response_status, response_headers, response_body,
+			duration_ms, endpoint_type, flow_id, profile_id
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	id, err := s.insert(
+		query,
+		entry.RequestMethod,
+		entry.RequestURL,
+		sensitive[0],
+		sensitive[1],
+		entry.ResponseStatus,
+		sensitive[2],
+		sensitive[3],
+		entry.DurationMs,
+		entry.EndpointType,
+		nullableString(entry.FlowID),
+		nullableInt(entry.ProfileID),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save history entry: %w", err)
+	}
+
+	entry.ID = id
+	return nil
+}
+
+// GetHistoryEntries retrieves history entries with pagination
+func (s *sqlDB) GetHistoryEntries(limit, offset int) ([]models.HistoryEntry, error) {
+	query := `
+		SELECT ` + historyColumns + `
+		FROM http_history
+		ORDER BY created_at DESC
+		LIMIT ? OFFSET ?
+	`
+
+	rows, err := s.query(query, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query history: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []models.HistoryEntry
+	for rows.Next() {
+		entry, err := s.scanHistoryEntry(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		entries = append(entries, *entry)
+	}
+
+	return entries, nil
+}
+
+// GetHistoryEntry retrieves a single history entry by ID
+func (s *sqlDB) GetHistoryEntry(id int64) (*models.HistoryEntry, error) {
+	query := `
+		SELECT ` + historyColumns + `
+		FROM http_history
+		WHERE id = ?
+	`
+
+	entry, err := s.scanHistoryEntry(s.queryRow(query, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get history entry: %w", err)
+	}
+
+	return entry, nil
+}
+
+// GetHistoryEntriesByType retrieves history entries filtered by endpoint type
+func (s *sqlDB) GetHistoryEntriesByType(endpointType string, limit, offset int) ([]models.HistoryEntry, error) {
+	query := `
+		SELECT ` + historyColumns + `
+		FROM http_history
+		WHERE endpoint_type = ?
+		ORDER BY created_at DESC
+		LIMIT ? OFFSET ?
+	`
+
+	rows, err := s.query(query, endpointType, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query history by type: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []models.HistoryEntry
+	for rows.Next() {
+		entry, err := s.scanHistoryEntry(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		entries = append(entries, *entry)
+	}
+
+	return entries, nil
+}
+
+// GetHistoryEntriesFiltered retrieves history entries matching a filter
+func (s *sqlDB) GetHistoryEntriesFiltered(filter models.HistoryFilter, limit, offset int) ([]models.HistoryEntry, error) {
+	where := []string{"1 = 1"}
+	args := []interface{}{}
+	if filter.EndpointType != "" {
+		where = append(where, "endpoint_type = ?")
+		args = append(args, filter.EndpointType)
+	}
+	if filter.FlowID != "" {
+		where = append(where, "flow_id = ?")
+		args = append(args, filter.FlowID)
+	}
+	if filter.ProfileID != 0 {
+		where = append(where, "profile_id = ?")
+		args = append(args, filter.ProfileID)
+	}
+	args = append(args, limit, offset)
+
+	query := `
+		SELECT ` + historyColumns + `
+		FROM http_history
+		WHERE ` + strings.Join(where, " AND ") + `
+		ORDER BY created_at DESC, id DESC
+		LIMIT ? OFFSET ?
+	`
+
+	rows, err := s.query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query filtered history: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []models.HistoryEntry
+	for rows.Next() {
+		entry, err := s.scanHistoryEntry(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		entries = append(entries, *entry)
+	}
+
+	return entries, nil
+}
+
+// GetEndpointTypes returns the distinct endpoint types present in the history
+func (s *sqlDB) GetEndpointTypes() ([]string, error) {
+	rows, err := s.query(`
+		SELECT DISTINCT endpoint_type FROM http_history
+		WHERE endpoint_type IS NOT NULL AND endpoint_type != ''
+		ORDER BY endpoint_type
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query endpoint types: %w", err)
+	}
+	defer rows.Close()
+
+	var types []string
+	for rows.Next() {
+		var endpointType string
+		if err := rows.Scan(&endpointType); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		types = append(types, endpointType)
+	}
+
+	return types, rows.Err()
+}
+
+// nullableString stores empty strings as NULL
+func nullableString(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// nullableInt stores zero IDs as NULL
+func nullableInt(i int64) interface{} {
+	if i == 0 {
+		return nil
+	}
+	return i
+}
+
+// Helper function to serialize headers to JSON
+func SerializeHeaders(headers map[string][]string) (string, error) {
+	data, err := json.Marshal(headers)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// Helper function to deserialize headers from JSON
+func DeserializeHeaders(data string) (map[string][]string, error) {
+	var headers map[string][]string
+	if err := json.Unmarshal([]byte(data), &headers); err != nil {
+		return nil, err
+	}
+	return headers, nil
+}
+
+// GetHistorySamples retrieves endpoint type, status and duration of entries created since a given time
+func (s *sqlDB) GetHistorySamples(since time.Time) ([]models.HistorySample, error) {
+	rows, err := s.query(`
+		SELECT COALESCE(endpoint_type, ''), COALESCE(response_status, 0),
+		       COALESCE(duration_ms, 0), created_at
+		FROM http_history
+		WHERE created_at >= ?
+		ORDER BY created_at
+	`, s.dialect.timeArg(since))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query history samples: %w", err)
+	}
+	defer rows.Close()
+
+	var samples []models.HistorySample
+	for rows.Next() {
+		var sample models.HistorySample
+		if err := rows.Scan(&sample.EndpointType, &sample.ResponseStatus, &sample.DurationMs, &sample.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		samples = append(samples, sample)
+	}
+
+	return samples, rows.Err()
+}
@@ -0,0 +1,185 @@
+package storage
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pericles-luz/oauth2-test/internal/models"
+	"github.com/pericles-luz/oauth2-test/internal/secrets"
+)
+
+// saveTestEntries saves history entries created a minute apart from testTime
+// on, and returns their IDs in the same order
+func saveTestEntries(t *testing.T, db *sqlDB, entries ...models.HistoryEntry) []int64 {
+	t.Helper()
+
+	ids := make([]int64, len(entries))
+	for i := range entries {
+		entry := entries[i]
+		if err := db.SaveHistoryEntry(&entry); err != nil {
+			t.Fatal(err)
+		}
+		createdAt := testTime.Add(time.Duration(i) * time.Minute)
+		if _, err := db.exec(`UPDATE http_history SET created_at = ? WHERE id = ?`, db.dialect.timeArg(createdAt), entry.ID); err != nil {
+			t.Fatal(err)
+		}
+		ids[i] = entry.ID
+	}
+	return ids
+}
+
+// historyIDs returns the IDs of entries, in order
+func historyIDs(entries []models.HistoryEntry) []int64 {
+	ids := []int64{}
+	for _, entry := range entries {
+		ids = append(ids, entry.ID)
+	}
+	return ids
+}
+
+func TestHistoryEntries(t *testing.T) {
+	forEachMigratedBackend(t, func(t *testing.T, db *sqlDB) {
+		db.SetKeyring(newTestKeyring(t))
+
+		ids := saveTestEntries(t, db,
+			models.HistoryEntry{
+				RequestMethod:   "POST",
+				RequestURL:      "https://idp.example/token",
+				RequestHeaders:  `{"Authorization":["Basic c2VjcmV0"]}`,
+				RequestBody:     "grant_type=authorization_code&code=abc",
+				ResponseStatus:  200,
+				ResponseHeaders: `{"Content-Type":["application/json"]}`,
+				ResponseBody:    `{"access_token":"token"}`,
+				DurationMs:      120,
+				EndpointType:    "token",
+				FlowID:          "flow-1",
+				ProfileID:       1,
+			},
+			models.HistoryEntry{RequestMethod: "GET", ResponseStatus: 200, DurationMs: 40, EndpointType: "userinfo", FlowID: "flow-1"},
+			models.HistoryEntry{RequestMethod: "POST", ResponseStatus: 400, DurationMs: 80, EndpointType: "token", FlowID: "flow-2", ProfileID: 2},
+			models.HistoryEntry{RequestMethod: "GET", ResponseStatus: 500, DurationMs: 10},
+		)
+
+		t.Run("get", func(t *testing.T) {
+			entry, err := db.GetHistoryEntry(ids[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := models.HistoryEntry{
+				ID:              ids[0],
+				RequestMethod:   "POST",
+				RequestURL:      "https://idp.example/token",
+				RequestHeaders:  `{"Authorization":["Basic c2VjcmV0"]}`,
+				RequestBody:     "grant_type=authorization_code&code=abc",
+				ResponseStatus:  200,
+				ResponseHeaders: `{"Content-Type":["application/json"]}`,
+				ResponseBody:    `{"access_token":"token"}`,
+				DurationMs:      120,
+				EndpointType:    "token",
+				FlowID:          "flow-1",
+				ProfileID:       1,
+				CreatedAt:       entry.CreatedAt,
+			}
+			if !reflect.DeepEqual(*entry, want) {
+				t.Errorf("entry = %+v, want %+v", *entry, want)
+			}
+			if !entry.CreatedAt.Equal(testTime) {
+				t.Errorf("created at = %s, want %s", entry.CreatedAt, testTime)
+			}
+
+			missing, err := db.GetHistoryEntry(ids[3] + 1)
+			if err != nil || missing != nil {
+				t.Errorf("GetHistoryEntry(missing) = %v, %v, want nil, nil", missing, err)
+			}
+		})
+
+		t.Run("encrypted at rest", func(t *testing.T) {
+			var body string
+			if err := db.queryRow(`SELECT request_body FROM http_history WHERE id = ?`, ids[0]).Scan(&body); err != nil {
+				t.Fatal(err)
+			}
+			if !secrets.IsEncrypted(body) {
+				t.Errorf("request body stored as %q, want it encrypted", body)
+			}
+		})
+
+		t.Run("filters", func(t *testing.T) {
+			tests := []struct {
+				name          string
+				filter        models.HistoryFilter
+				limit, offset int
+				want          []int64
+			}{
+				{"everything", models.HistoryFilter{}, 10, 0, []int64{ids[3], ids[2], ids[1], ids[0]}},
+				{"page", models.HistoryFilter{}, 2, 1, []int64{ids[2], ids[1]}},
+				{"endpoint type", models.HistoryFilter{EndpointType: "token"}, 10, 0, []int64{ids[2], ids[0]}},
+				{"flow", models.HistoryFilter{FlowID: "flow-1"}, 10, 0, []int64{ids[1], ids[0]}},
+				{"profile", models.HistoryFilter{ProfileID: 2}, 10, 0, []int64{ids[2]}},
+				{"combined", models.HistoryFilter{EndpointType: "token", FlowID: "flow-1"}, 10, 0, []int64{ids[0]}},
+				{"no match", models.HistoryFilter{FlowID: "unknown"}, 10, 0, []int64{}},
+			}
+
+			for _, tt := range tests {
+				t.Run(tt.name, func(t *testing.T) {
+					entries, err := db.GetHistoryEntriesFiltered(tt.filter, tt.limit, tt.offset)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if got := historyIDs(entries); !reflect.DeepEqual(got, tt.want) {
+						t.Errorf("GetHistoryEntriesFiltered() = %v, want %v", got, tt.want)
+					}
+				})
+			}
+		})
+
+		t.Run("by type", func(t *testing.T) {
+			entries, err := db.GetHistoryEntriesByType("token", 10, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := historyIDs(entries), []int64{ids[2], ids[0]}; !reflect.DeepEqual(got, want) {
+				t.Errorf("GetHistoryEntriesByType() = %v, want %v", got, want)
+			}
+
+			entries, err = db.GetHistoryEntries(1, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := historyIDs(entries), []int64{ids[3]}; !reflect.DeepEqual(got, want) {
+				t.Errorf("GetHistoryEntries() = %v, want %v", got, want)
+			}
+		})
+
+		t.Run("endpoint types", func(t *testing.T) {
+			types, err := db.GetEndpointTypes()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := []string{"token", "userinfo"}; !reflect.DeepEqual(types, want) {
+				t.Errorf("GetEndpointTypes() = %v, want %v", types, want)
+			}
+		})
+
+		t.Run("samples", func(t *testing.T) {
+			samples, err := db.GetHistorySamples(testTime.Add(2 * time.Minute))
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := []models.HistorySample{
+				{EndpointType: "token", ResponseStatus: 400, DurationMs: 80, CreatedAt: testTime.Add(2 * time.Minute)},
+				{EndpointType: "", ResponseStatus: 500, DurationMs: 10, CreatedAt: testTime.Add(3 * time.Minute)},
+			}
+			if len(samples) != len(want) {
+				t.Fatalf("GetHistorySamples() = %+v, want %+v", samples, want)
+			}
+			for i := range want {
+				got := samples[i]
+				if got.EndpointType != want[i].EndpointType || got.ResponseStatus != want[i].ResponseStatus ||
+					got.DurationMs != want[i].DurationMs || !got.CreatedAt.Equal(want[i].CreatedAt) {
+					t.Errorf("sample %d = %+v, want %+v", i, got, want[i])
+				}
+			}
+		})
+	})
+}
@@ -0,0 +1,191 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pericles-luz/oauth2-test/internal/models"
+)
+
+// SetHistoryPinned pins or unpins a history entry. Pinned entries are never pruned.
+func (s *sqlDB) SetHistoryPinned(id int64, pinned bool) error {
+	result, err := s.exec(`UPDATE http_history SET pinned = ? WHERE id = ?`, pinned, id)
+	if err != nil {
+		return fmt.Errorf("failed to update pinned flag: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %w", err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("history entry %d not found", id)
+	}
+
+	return nil
+}
+
+// DeleteHistoryOlderThan removes unpinned entries created before the cutoff
+func (s *sqlDB) DeleteHistoryOlderThan(cutoff time.Time) (int64, error) {
+	result, err := s.exec(
+		`DELETE FROM http_history WHERE NOT pinned AND created_at < ?`,
+		s.dialect.timeArg(cutoff),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete old history entries: %w", err)
+	}
+
+	return result.RowsAffected()
+}
+
+// TrimHistory keeps only the newest unpinned entries, optionally for a single endpoint type.
+// An empty endpointType applies the limit to the whole table.
+func (s *sqlDB) TrimHistory(endpointType string, keep int) (int64, error) {
+	filter := ""
+	args := []interface{}{}
+	if endpointType != "" {
+		filter = "AND endpoint_type = ?"
+		args = append(args, endpointType)
+	}
+	args = append(args, keep)
+
+	query := `
+		DELETE FROM http_history
+		WHERE id IN (
+			SELECT id FROM http_history
+			WHERE NOT pinned ` + filter + `
+			ORDER BY created_at DESC, id DESC
+			LIMIT ` + s.dialect.unlimited() + ` OFFSET ?
+		)
+	`
+
+	result, err := s.exec(query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to trim history: %w", err)
+	}
+
+	return result.RowsAffected()
+}
+
+// PurgeHistory deletes all history entries, keeping pinned ones unless includePinned is set
+func (s *sqlDB) PurgeHistory(includePinned bool) (int64, error) {
+	query := `DELETE FROM http_history WHERE NOT pinned`
+	if includePinned {
+		query = `DELETE FROM http_history`
+	}
+
+	result, err := s.exec(query)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge history: %w", err)
+	}
+
+	return result.RowsAffected()
+}
+
+// Vacuum rebuilds the database file, reclaiming the space of deleted rows
+func (s *sqlDB) Vacuum() error {
+	if err := s.dialect.vacuum(s.db); err != nil {
+		return fmt.Errorf("failed to vacuum database: %w", err)
+	}
+	return nil
+}
+
+// HistoryCount holds the number of stored entries for an endpoint type
+type HistoryCount struct {
+	EndpointType string `json:"endpoint_type"`
+	Total        int64  `json:"total"`
+	Pinned       int64  `json:"pinned"`
+}
+
+// GetHistoryCounts returns the number of stored entries per endpoint type
+func (s *sqlDB) GetHistoryCounts() ([]HistoryCount, error) {
+	rows, err := s.query(`
+		SELECT COALESCE(endpoint_type, ''), COUNT(*), COALESCE(SUM(CASE WHEN pinned THEN 1 ELSE 0 END), 0)
+		FROM http_history
+		GROUP BY endpoint_type
+		ORDER BY endpoint_type
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count history: %w", err)
+	}
+	defer rows.Close()
+
+	var counts []HistoryCount
+	for rows.Next() {
+		var count HistoryCount
+		if err := rows.Scan(&count.EndpointType, &count.Total, &count.Pinned); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		counts = append(counts, count)
+	}
+
+	return counts, rows.Err()
+}
+
+// GetDatabaseSize returns the size of the database in bytes
+func (s *sqlDB) GetDatabaseSize() (int64, error) {
+	size, err := s.dialect.databaseSize(s.db)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read database size: %w", err)
+	}
+	return size, nil
+}
+
+// SaveMaintenanceRun records an execution of the maintenance job
+func (s *sqlDB) SaveMaintenanceRun(run *models.MaintenanceRun) error {
+	id, err := s.insert(`
+		INSERT INTO maintenance_runs (
+			kind, trigger_type, deleted_rows, details, error, duration_ms, started_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?)
+	`,
+		run.Kind,
+		run.Trigger,
+		run.DeletedRows,
+		run.Details,
+		run.Error,
+		run.DurationMs,
+		s.dialect.timeArg(run.StartedAt),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save maintenance run: %w", err)
+	}
+
+	run.ID = id
+	return nil
+}
+
+// GetMaintenanceRuns retrieves the most recent maintenance runs
+func (s *sqlDB) GetMaintenanceRuns(limit int) ([]models.MaintenanceRun, error) {
+	rows, err := s.query(`
+		SELECT id, kind, trigger_type, deleted_rows, COALESCE(details, ''),
+		       COALESCE(error, ''), duration_ms, started_at
+		FROM maintenance_runs
+		ORDER BY started_at DESC, id DESC
+		LIMIT ?
+	`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query maintenance runs: %w", err)
+	}
+	defer rows.Close()
+
+	var runs []models.MaintenanceRun
+	for rows.Next() {
+		var run models.MaintenanceRun
+		err := rows.Scan(
+			&run.ID,
+			&run.Kind,
+			&run.Trigger,
+			&run.DeletedRows,
+			&run.Details,
+			&run.Error,
+			&run.DurationMs,
+			&run.StartedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		runs = append(runs, run)
+	}
+
+	return runs, rows.Err()
+}
@@ -0,0 +1,176 @@
+package storage
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pericles-luz/oauth2-test/internal/models"
+)
+
+func TestHistoryRetention(t *testing.T) {
+	// Oldest first; the first entry is pinned
+	seed := []models.HistoryEntry{
+		{EndpointType: "token"},
+		{EndpointType: "token"},
+		{EndpointType: "token"},
+		{EndpointType: "userinfo"},
+		{EndpointType: "userinfo"},
+	}
+
+	tests := []struct {
+		name    string
+		run     func(db *sqlDB) (int64, error)
+		deleted int64
+		kept    []int // indexes in seed
+	}{
+		{
+			name:    "older than",
+			run:     func(db *sqlDB) (int64, error) { return db.DeleteHistoryOlderThan(testTime.Add(2 * time.Minute)) },
+			deleted: 1,
+			kept:    []int{0, 2, 3, 4},
+		},
+		{
+			name:    "older than nothing",
+			run:     func(db *sqlDB) (int64, error) { return db.DeleteHistoryOlderThan(testTime) },
+			deleted: 0,
+			kept:    []int{0, 1, 2, 3, 4},
+		},
+		{
+			name:    "trim endpoint type",
+			run:     func(db *sqlDB) (int64, error) { return db.TrimHistory("token", 1) },
+			deleted: 1,
+			kept:    []int{0, 2, 3, 4},
+		},
+		{
+			name:    "trim everything",
+			run:     func(db *sqlDB) (int64, error) { return db.TrimHistory("", 2) },
+			deleted: 2,
+			kept:    []int{0, 3, 4},
+		},
+		{
+			name:    "trim under the limit",
+			run:     func(db *sqlDB) (int64, error) { return db.TrimHistory("", 10) },
+			deleted: 0,
+			kept:    []int{0, 1, 2, 3, 4},
+		},
+		{
+			name:    "purge",
+			run:     func(db *sqlDB) (int64, error) { return db.PurgeHistory(false) },
+			deleted: 4,
+			kept:    []int{0},
+		},
+		{
+			name:    "purge pinned",
+			run:     func(db *sqlDB) (int64, error) { return db.PurgeHistory(true) },
+			deleted: 5,
+			kept:    []int{},
+		},
+	}
+
+	forEachMigratedBackend(t, func(t *testing.T, db *sqlDB) {
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				if _, err := db.PurgeHistory(true); err != nil {
+					t.Fatal(err)
+				}
+				ids := saveTestEntries(t, db, seed...)
+				if err := db.SetHistoryPinned(ids[0], true); err != nil {
+					t.Fatal(err)
+				}
+
+				deleted, err := tt.run(db)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if deleted != tt.deleted {
+					t.Errorf("deleted = %d, want %d", deleted, tt.deleted)
+				}
+
+				entries, err := db.GetHistoryEntriesFiltered(models.HistoryFilter{}, 100, 0)
+				if err != nil {
+					t.Fatal(err)
+				}
+				want := []int64{}
+				for i := len(tt.kept) - 1; i >= 0; i-- {
+					want = append(want, ids[tt.kept[i]])
+				}
+				if got := historyIDs(entries); !reflect.DeepEqual(got, want) {
+					t.Errorf("kept = %v, want %v", got, want)
+				}
+			})
+		}
+	})
+}
+
+func TestHistoryPinning(t *testing.T) {
+	forEachMigratedBackend(t, func(t *testing.T, db *sqlDB) {
+		ids := saveTestEntries(t, db,
+			models.HistoryEntry{EndpointType: "token"},
+			models.HistoryEntry{EndpointType: "token"},
+			models.HistoryEntry{EndpointType: "userinfo"},
+		)
+		for _, id := range ids[:2] {
+			if err := db.SetHistoryPinned(id, true); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := db.SetHistoryPinned(ids[1], false); err != nil {
+			t.Fatal(err)
+		}
+
+		entry, err := db.GetHistoryEntry(ids[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !entry.Pinned {
+			t.Error("entry not pinned")
+		}
+
+		counts, err := db.GetHistoryCounts()
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []HistoryCount{
+			{EndpointType: "token", Total: 2, Pinned: 1},
+			{EndpointType: "userinfo", Total: 1, Pinned: 0},
+		}
+		if !reflect.DeepEqual(counts, want) {
+			t.Errorf("GetHistoryCounts() = %+v, want %+v", counts, want)
+		}
+
+		if err := db.SetHistoryPinned(ids[2]+1, true); err == nil {
+			t.Error("SetHistoryPinned() of a missing entry succeeded")
+		}
+	})
+}
+
+func TestMaintenanceRuns(t *testing.T) {
+	forEachMigratedBackend(t, func(t *testing.T, db *sqlDB) {
+		for i, kind := range []string{"retention", "vacuum"} {
+			run := &models.MaintenanceRun{
+				Kind:        kind,
+				Trigger:     "manual",
+				DeletedRows: int64(i),
+				StartedAt:   testTime.Add(time.Duration(i) * time.Minute),
+			}
+			if err := db.SaveMaintenanceRun(run); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := db.Vacuum(); err != nil {
+			t.Fatal(err)
+		}
+		if size, err := db.GetDatabaseSize(); err != nil || size <= 0 {
+			t.Errorf("GetDatabaseSize() = %d, %v, want a positive size", size, err)
+		}
+
+		runs, err := db.GetMaintenanceRuns(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(runs) != 1 || runs[0].Kind != "vacuum" || !runs[0].StartedAt.Equal(testTime.Add(time.Minute)) {
+			t.Errorf("GetMaintenanceRuns() = %+v, want the vacuum run", runs)
+		}
+	})
+}
@@ -0,0 +1,275 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Migration is a versioned schema change
+type Migration struct {
+	Version  int
+	Name     string
+	Up       string
+	Down     string // empty when the migration cannot be reverted
+	Checksum string // SHA-256 of Up
+}
+
+// MigrationStatus describes a known migration and whether it is applied
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+	Modified  bool // the file changed after it was applied
+}
+
+// migrationFile matches NNN_name.sql and NNN_name.down.sql
+var migrationFile = regexp.MustCompile(`^(\d+)_(.+?)(\.down)?\.sql$`)
+
+// LoadMigrations reads every NNN_name.sql migration (and its optional
+// NNN_name.down.sql) from fsys, sorted by version
+func LoadMigrations(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list migrations: %w", err)
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		match := migrationFile.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+
+		version, _ := strconv.Atoi(match[1])
+		content, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", entry.Name(), err)
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		} else if migration.Name != match[2] {
+			return nil, fmt.Errorf("duplicate migration version %d: %s and %s", version, migration.Name, match[2])
+		}
+
+		if match[3] != "" {
+			migration.Down = string(content)
+		} else {
+			migration.Up = string(content)
+			sum := sha256.Sum256(content)
+			migration.Checksum = hex.EncodeToString(sum[:])
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up script", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
+
+// appliedMigration is a row of schema_migrations
+type appliedMigration struct {
+	name      string
+	checksum  string
+	appliedAt time.Time
+}
+
+// ensureMigrationsTable creates schema_migrations, adopting databases created
+// before versioned migrations existed
+func (s *sqlDB) ensureMigrationsTable(migrations []Migration) error {
+	exists, err := s.dialect.tableExists(s.db, "schema_migrations")
+	if err != nil || exists {
+		return err
+	}
+
+	legacyVersion, err := s.dialect.legacySchemaVersion(s.db)
+	if err != nil {
+		return err
+	}
+
+	return s.inTransaction(func(tx *sql.Tx) error {
+		_, err := tx.Exec(`
+			CREATE TABLE schema_migrations (
+				version INTEGER PRIMARY KEY,
+				name TEXT NOT NULL,
+				checksum TEXT NOT NULL,
+				applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			)
+		`)
+		if err != nil {
+			return fmt.Errorf("failed to create schema_migrations: %w", err)
+		}
+
+		// Record the migrations already reflected in a legacy schema as applied
+		for _, migration := range migrations {
+			if migration.Version > legacyVersion {
+				break
+			}
+			if err := s.recordMigration(tx, migration); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// appliedMigrations returns the rows of schema_migrations by version
+func (s *sqlDB) appliedMigrations() (map[int]appliedMigration, error) {
+	rows, err := s.db.Query(`SELECT version, name, checksum, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := map[int]appliedMigration{}
+	for rows.Next() {
+		var version int
+		var row appliedMigration
+		if err := rows.Scan(&version, &row.name, &row.checksum, &row.appliedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		applied[version] = row
+	}
+
+	return applied, rows.Err()
+}
+
+// Migrate applies every pending migration in version order, each one in its own
+// transaction. It fails without applying anything if an applied migration was edited.
+func (s *sqlDB) Migrate(migrations []Migration) error {
+	if err := s.ensureMigrationsTable(migrations); err != nil {
+		return err
+	}
+
+	applied, err := s.appliedMigrations()
+	if err != nil {
+		return err
+	}
+
+	for _, migration := range migrations {
+		if row, ok := applied[migration.Version]; ok && row.checksum != migration.Checksum {
+			return fmt.Errorf("migration %d_%s was modified after being applied (checksum mismatch)",
+				migration.Version, migration.Name)
+		}
+	}
+
+	for _, migration := range migrations {
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+
+		err := s.inTransaction(func(tx *sql.Tx) error {
+			if _, err := tx.Exec(migration.Up); err != nil {
+				return err
+			}
+			return s.recordMigration(tx, migration)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to apply migration %d_%s: %w", migration.Version, migration.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// MigrateDown reverts the last steps applied migrations, newest first
+func (s *sqlDB) MigrateDown(migrations []Migration, steps int) error {
+	if err := s.ensureMigrationsTable(migrations); err != nil {
+		return err
+	}
+
+	applied, err := s.appliedMigrations()
+	if err != nil {
+		return err
+	}
+
+	known := map[int]Migration{}
+	for _, migration := range migrations {
+		known[migration.Version] = migration
+	}
+
+	versions := make([]int, 0, len(applied))
+	for version := range applied {
+		versions = append(versions, version)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(versions)))
+
+	for i := 0; i < steps && i < len(versions); i++ {
+		version := versions[i]
+		migration, ok := known[version]
+		if !ok {
+			return fmt.Errorf("applied migration %d_%s is unknown to this binary", version, applied[version].name)
+		}
+		if strings.TrimSpace(migration.Down) == "" {
+			return fmt.Errorf("migration %d_%s has no down script", version, migration.Name)
+		}
+
+		err := s.inTransaction(func(tx *sql.Tx) error {
+			if _, err := tx.Exec(migration.Down); err != nil {
+				return err
+			}
+			_, err := tx.Exec(s.dialect.rebind(`DELETE FROM schema_migrations WHERE version = ?`), version)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to revert migration %d_%s: %w", version, migration.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// MigrationStatus lists the known migrations and whether they are applied
+func (s *sqlDB) MigrationStatus(migrations []Migration) ([]MigrationStatus, error) {
+	if err := s.ensureMigrationsTable(migrations); err != nil {
+		return nil, err
+	}
+
+	applied, err := s.appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(migrations))
+	for _, migration := range migrations {
+		status := MigrationStatus{Version: migration.Version, Name: migration.Name}
+		if row, ok := applied[migration.Version]; ok {
+			status.Applied = true
+			status.AppliedAt = row.appliedAt
+			status.Modified = row.checksum != migration.Checksum
+		}
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
+
+// recordMigration inserts a migration into schema_migrations
+func (s *sqlDB) recordMigration(tx *sql.Tx, migration Migration) error {
+	_, err := tx.Exec(
+		s.dialect.rebind(`INSERT INTO schema_migrations (version, name, checksum) VALUES (?, ?, ?)`),
+		migration.Version, migration.Name, migration.Checksum,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record migration %d: %w", migration.Version, err)
+	}
+	return nil
+}
@@ -0,0 +1,377 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/pericles-luz/oauth2-test/migrations"
+)
+
+// testMigrations is a schema in portable SQL, run by both backends
+var testMigrations = fstest.MapFS{
+	"001_items.sql":      {Data: []byte("CREATE TABLE items (id INTEGER PRIMARY KEY, name TEXT NOT NULL);")},
+	"001_items.down.sql": {Data: []byte("DROP TABLE items;")},
+	"002_tags.sql":       {Data: []byte("CREATE TABLE tags (id INTEGER PRIMARY KEY);\nCREATE INDEX idx_tags ON tags(id);")},
+	"002_tags.down.sql":  {Data: []byte("DROP TABLE tags;")},
+}
+
+// withMigrationFiles returns a copy of fsys with files replaced or added
+func withMigrationFiles(fsys fstest.MapFS, files map[string]string) fstest.MapFS {
+	result := fstest.MapFS{}
+	for name, file := range fsys {
+		result[name] = file
+	}
+	for name, content := range files {
+		result[name] = &fstest.MapFile{Data: []byte(content)}
+	}
+	return result
+}
+
+func loadTestMigrations(t *testing.T, fsys fstest.MapFS) []Migration {
+	t.Helper()
+
+	loaded, err := LoadMigrations(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loaded
+}
+
+// assertTables checks which of the named tables exist
+func assertTables(t *testing.T, db *sqlDB, want map[string]bool) {
+	t.Helper()
+
+	for table, exists := range want {
+		got, err := db.dialect.tableExists(db.db, table)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != exists {
+			t.Errorf("table %s exists = %v, want %v", table, got, exists)
+		}
+	}
+}
+
+// appliedVersions returns the versions recorded in schema_migrations
+func appliedVersions(t *testing.T, db *sqlDB) []int {
+	t.Helper()
+
+	applied, err := db.appliedMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	versions := []int{}
+	for version := range applied {
+		versions = append(versions, version)
+	}
+	sort.Ints(versions)
+	return versions
+}
+
+func TestLoadMigrations(t *testing.T) {
+	tests := []struct {
+		name     string
+		fsys     fstest.MapFS
+		versions []int
+		err      string
+	}{
+		{
+			name: "sorted by version",
+			fsys: withMigrationFiles(testMigrations, map[string]string{
+				"010_late.sql":     "SELECT 1;",
+				"README.md":        "not a migration",
+				"postgres/001.sql": "in a subdirectory",
+			}),
+			versions: []int{1, 2, 10},
+		},
+		{
+			name:     "down script optional",
+			fsys:     fstest.MapFS{"001_items.sql": testMigrations["001_items.sql"]},
+			versions: []int{1},
+		},
+		{
+			name: "duplicate version",
+			fsys: withMigrationFiles(testMigrations, map[string]string{"002_labels.sql": "SELECT 1;"}),
+			err:  "duplicate migration version 2",
+		},
+		{
+			name: "down script without up",
+			fsys: fstest.MapFS{"001_items.down.sql": testMigrations["001_items.down.sql"]},
+			err:  "migration 1_items has no up script",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loaded, err := LoadMigrations(tt.fsys)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("LoadMigrations() error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			versions := []int{}
+			for _, migration := range loaded {
+				versions = append(versions, migration.Version)
+			}
+			if !reflect.DeepEqual(versions, tt.versions) {
+				t.Errorf("versions = %v, want %v", versions, tt.versions)
+			}
+		})
+	}
+
+	loaded := loadTestMigrations(t, testMigrations)
+	sum := sha256.Sum256(testMigrations["001_items.sql"].Data)
+	if loaded[0].Name != "items" || loaded[0].Down != "DROP TABLE items;" || loaded[0].Checksum != hex.EncodeToString(sum[:]) {
+		t.Errorf("migration 1 = %+v, want items with its down script and the checksum of its up script", loaded[0])
+	}
+}
+
+func TestSchemaMigrationsMatchAcrossDrivers(t *testing.T) {
+	// Every version exists for both drivers, with the same name, and is
+	// revertible on both or neither
+	outline := func(driver string) []string {
+		loaded, err := LoadMigrations(migrations.For(driver))
+		if err != nil {
+			t.Fatalf("LoadMigrations(%s) error = %v", driver, err)
+		}
+		result := []string{}
+		for _, migration := range loaded {
+			result = append(result, fmt.Sprintf("%03d_%s down=%v", migration.Version, migration.Name, migration.Down != ""))
+		}
+		return result
+	}
+
+	sqlite, postgres := outline("sqlite"), outline("postgres")
+	if len(sqlite) == 0 {
+		t.Fatal("no SQLite migrations embedded")
+	}
+	if !reflect.DeepEqual(sqlite, postgres) {
+		t.Errorf("migrations differ between drivers:\nsqlite   %v\npostgres %v", sqlite, postgres)
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, db *sqlDB) {
+		loaded := loadTestMigrations(t, testMigrations)
+		if err := db.Migrate(loaded); err != nil {
+			t.Fatal(err)
+		}
+		assertTables(t, db, map[string]bool{"items": true, "tags": true})
+
+		// Applied migrations are not run again
+		if err := db.Migrate(loaded); err != nil {
+			t.Fatalf("Migrate() again error = %v", err)
+		}
+		if got := appliedVersions(t, db); !reflect.DeepEqual(got, []int{1, 2}) {
+			t.Errorf("applied = %v, want [1 2]", got)
+		}
+
+		statuses, err := db.MigrationStatus(loaded)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, status := range statuses {
+			if !status.Applied || status.Modified || status.AppliedAt.IsZero() {
+				t.Errorf("status of %d = %+v, want applied and unmodified", status.Version, status)
+			}
+		}
+	})
+}
+
+func TestMigrateRefusesModifiedMigrations(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, db *sqlDB) {
+		initial := fstest.MapFS{"001_items.sql": testMigrations["001_items.sql"]}
+		if err := db.Migrate(loadTestMigrations(t, initial)); err != nil {
+			t.Fatal(err)
+		}
+
+		// Editing the applied file refuses to migrate, pending migrations included
+		edited := withMigrationFiles(testMigrations, map[string]string{
+			"001_items.sql": "CREATE TABLE items (id INTEGER PRIMARY KEY, name TEXT NOT NULL, price INTEGER);",
+		})
+		loaded := loadTestMigrations(t, edited)
+		err := db.Migrate(loaded)
+		if err == nil || !strings.Contains(err.Error(), "migration 1_items was modified after being applied (checksum mismatch)") {
+			t.Fatalf("Migrate() error = %v, want a checksum mismatch", err)
+		}
+		assertTables(t, db, map[string]bool{"items": true, "tags": false})
+
+		statuses, err := db.MigrationStatus(loaded)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []MigrationStatus{
+			{Version: 1, Name: "items", Applied: true, Modified: true},
+			{Version: 2, Name: "tags"},
+		}
+		for i := range statuses {
+			statuses[i].AppliedAt = want[i].AppliedAt
+		}
+		if !reflect.DeepEqual(statuses, want) {
+			t.Errorf("MigrationStatus() = %+v, want %+v", statuses, want)
+		}
+
+		// Restoring the file lets the pending migrations run
+		if err := db.Migrate(loadTestMigrations(t, testMigrations)); err != nil {
+			t.Fatalf("Migrate() after restoring the file error = %v", err)
+		}
+		assertTables(t, db, map[string]bool{"tags": true})
+	})
+}
+
+func TestMigrateRollsBackFailedMigrations(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, db *sqlDB) {
+		broken := withMigrationFiles(testMigrations, map[string]string{
+			"003_broken.sql": "CREATE TABLE partial (id INTEGER PRIMARY KEY);\nINSERT INTO missing_table (id) VALUES (1);",
+		})
+		err := db.Migrate(loadTestMigrations(t, broken))
+		if err == nil || !strings.Contains(err.Error(), "failed to apply migration 3_broken") {
+			t.Fatalf("Migrate() error = %v, want migration 3 to fail", err)
+		}
+
+		// The migrations before it stay applied; none of the failed one remains
+		assertTables(t, db, map[string]bool{"items": true, "tags": true, "partial": false})
+		if got := appliedVersions(t, db); !reflect.DeepEqual(got, []int{1, 2}) {
+			t.Errorf("applied = %v, want [1 2]", got)
+		}
+
+		// Unrecorded, the fixed migration applies without a checksum mismatch
+		fixed := withMigrationFiles(testMigrations, map[string]string{
+			"003_broken.sql": "CREATE TABLE partial (id INTEGER PRIMARY KEY);",
+		})
+		if err := db.Migrate(loadTestMigrations(t, fixed)); err != nil {
+			t.Fatalf("Migrate() after the fix error = %v", err)
+		}
+		assertTables(t, db, map[string]bool{"partial": true})
+	})
+}
+
+func TestMigrateDown(t *testing.T) {
+	withoutDown := withMigrationFiles(testMigrations, map[string]string{
+		"003_notes.sql": "CREATE TABLE notes (id INTEGER PRIMARY KEY);",
+	})
+
+	tests := []struct {
+		name    string
+		applied fstest.MapFS
+		known   fstest.MapFS
+		steps   int
+		err     string
+		tables  map[string]bool
+		remain  []int
+	}{
+		{
+			name:    "latest",
+			applied: testMigrations,
+			known:   testMigrations,
+			steps:   1,
+			tables:  map[string]bool{"items": true, "tags": false},
+			remain:  []int{1},
+		},
+		{
+			name:    "more steps than applied",
+			applied: testMigrations,
+			known:   testMigrations,
+			steps:   5,
+			tables:  map[string]bool{"items": false, "tags": false},
+			remain:  []int{},
+		},
+		{
+			name:    "no down script",
+			applied: withoutDown,
+			known:   withoutDown,
+			steps:   2,
+			err:     "migration 3_notes has no down script",
+			tables:  map[string]bool{"tags": true, "notes": true},
+			remain:  []int{1, 2, 3},
+		},
+		{
+			name:    "unknown to this binary",
+			applied: withoutDown,
+			known:   testMigrations,
+			steps:   1,
+			err:     "applied migration 3_notes is unknown to this binary",
+			tables:  map[string]bool{"notes": true},
+			remain:  []int{1, 2, 3},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			forEachBackend(t, func(t *testing.T, db *sqlDB) {
+				if err := db.Migrate(loadTestMigrations(t, tt.applied)); err != nil {
+					t.Fatal(err)
+				}
+
+				err := db.MigrateDown(loadTestMigrations(t, tt.known), tt.steps)
+				if tt.err == "" && err != nil {
+					t.Fatal(err)
+				}
+				if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+					t.Fatalf("MigrateDown() error = %v, want %q", err, tt.err)
+				}
+
+				assertTables(t, db, tt.tables)
+				if got := appliedVersions(t, db); !reflect.DeepEqual(got, tt.remain) {
+					t.Errorf("applied = %v, want %v", got, tt.remain)
+				}
+			})
+		})
+	}
+}
+
+func TestMigrateAdoptsLegacySchema(t *testing.T) {
+	schemaMigrations, err := LoadMigrations(migrations.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Before schema_migrations existed, every boot ran the SQL files up to
+	// the one of its release
+	tests := []struct {
+		name    string
+		release int
+		adopted []int
+	}{
+		{"empty database", 0, []int{}},
+		{"initial schema", 1, []int{1}},
+		{"pinned history", 2, []int{1, 2}},
+		{"history flows", 3, []int{1, 2, 3}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTestSQLite(t)
+			for _, migration := range schemaMigrations[:tt.release] {
+				if _, err := db.db.Exec(migration.Up); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := db.ensureMigrationsTable(schemaMigrations); err != nil {
+				t.Fatal(err)
+			}
+			if got := appliedVersions(t, db); !reflect.DeepEqual(got, tt.adopted) {
+				t.Errorf("adopted = %v, want %v", got, tt.adopted)
+			}
+
+			if err := db.Migrate(schemaMigrations); err != nil {
+				t.Fatalf("Migrate() error = %v", err)
+			}
+			if got := appliedVersions(t, db); len(got) != len(schemaMigrations) {
+				t.Errorf("applied = %v, want all %d migrations", got, len(schemaMigrations))
+			}
+		})
+	}
+}
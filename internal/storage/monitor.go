@@ -0,0 +1,112 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/pericles-luz/oauth2-test/internal/models"
+)
+
+// SaveMonitorCheck records the result of a monitor check
+func (s *sqlDB) SaveMonitorCheck(check *models.MonitorCheck) error {
+	id, err := s.insert(`
+		INSERT INTO monitor_checks (
+			check_name, trigger_type, success, changed, fingerprint,
+			details, error, duration_ms, flow_id, created_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`,
+		check.Check,
+		check.Trigger,
+		check.Success,
+		check.Changed,
+		check.Fingerprint,
+		check.Details,
+		check.Error,
+		check.DurationMs,
+		nullableString(check.FlowID),
+		s.dialect.timeArg(check.CreatedAt),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save monitor check: %w", err)
+	}
+
+	check.ID = id
+	return nil
+}
+
+// GetMonitorChecks retrieves the most recent monitor check results
+func (s *sqlDB) GetMonitorChecks(limit int) ([]models.MonitorCheck, error) {
+	rows, err := s.query(`
+		SELECT id, check_name, trigger_type, success, changed, fingerprint,
+		       details, error, duration_ms, COALESCE(flow_id, ''), created_at
+		FROM monitor_checks
+		ORDER BY created_at DESC, id DESC
+		LIMIT ?
+	`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query monitor checks: %w", err)
+	}
+	defer rows.Close()
+
+	var checks []models.MonitorCheck
+	for rows.Next() {
+		var check models.MonitorCheck
+		err := rows.Scan(
+			&check.ID,
+			&check.Check,
+			&check.Trigger,
+			&check.Success,
+			&check.Changed,
+			&check.Fingerprint,
+			&check.Details,
+			&check.Error,
+			&check.DurationMs,
+			&check.FlowID,
+			&check.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		checks = append(checks, check)
+	}
+
+	return checks, rows.Err()
+}
+
+// GetMonitorState retrieves a value kept by the monitor between runs,
+// or "" when it was never set
+func (s *sqlDB) GetMonitorState(name string) (string, error) {
+	var value string
+	err := s.queryRow(`SELECT value FROM monitor_state WHERE name = ?`, name).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get monitor state: %w", err)
+	}
+
+	if value, err = s.keyring.Decrypt(value); err != nil {
+		return "", fmt.Errorf("monitor state %s: %w", name, err)
+	}
+	return value, nil
+}
+
+// SetMonitorState inserts or replaces a value kept by the monitor between runs
+func (s *sqlDB) SetMonitorState(name, value string) error {
+	encrypted, err := s.keyring.Encrypt(value)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt monitor state: %w", err)
+	}
+
+	if _, err := s.exec(`
+		INSERT INTO monitor_state (name, value, updated_at)
+		VALUES (?, ?, ?)
+		ON CONFLICT (name) DO UPDATE
+		SET value = excluded.value, updated_at = excluded.updated_at
+	`, name, encrypted, s.dialect.timeArg(time.Now())); err != nil {
+		return fmt.Errorf("failed to set monitor state: %w", err)
+	}
+	return nil
+}
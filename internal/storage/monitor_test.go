@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pericles-luz/oauth2-test/internal/models"
+	"github.com/pericles-luz/oauth2-test/internal/secrets"
+)
+
+func TestMonitorState(t *testing.T) {
+	forEachMigratedBackend(t, func(t *testing.T, db *sqlDB) {
+		db.SetKeyring(newTestKeyring(t))
+
+		if value, err := db.GetMonitorState("refresh_token"); err != nil || value != "" {
+			t.Errorf("GetMonitorState() before set = %q, %v, want empty", value, err)
+		}
+
+		for _, value := range []string{"first", "second"} {
+			if err := db.SetMonitorState("refresh_token", value); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := db.SetMonitorState("snapshot.https://idp.example/jwks", "3"); err != nil {
+			t.Fatal(err)
+		}
+
+		tests := []struct {
+			name  string
+			value string
+		}{
+			{"refresh_token", "second"},
+			{"snapshot.https://idp.example/jwks", "3"},
+		}
+		for _, tt := range tests {
+			if value, err := db.GetMonitorState(tt.name); err != nil || value != tt.value {
+				t.Errorf("GetMonitorState(%s) = %q, %v, want %q", tt.name, value, err, tt.value)
+			}
+		}
+
+		var stored string
+		if err := db.queryRow(`SELECT value FROM monitor_state WHERE name = ?`, "refresh_token").Scan(&stored); err != nil {
+			t.Fatal(err)
+		}
+		if !secrets.IsEncrypted(stored) {
+			t.Errorf("state stored as %q, want it encrypted", stored)
+		}
+	})
+}
+
+func TestMonitorChecks(t *testing.T) {
+	forEachMigratedBackend(t, func(t *testing.T, db *sqlDB) {
+		for i, name := range []string{"discovery", "jwks"} {
+			check := &models.MonitorCheck{
+				Check:       name,
+				Trigger:     "scheduled",
+				Success:     true,
+				Changed:     i == 1,
+				Fingerprint: "abc",
+				FlowID:      "flow",
+				CreatedAt:   testTime.Add(time.Duration(i) * time.Minute),
+			}
+			if err := db.SaveMonitorCheck(check); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		checks, err := db.GetMonitorChecks(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(checks) != 1 || checks[0].Check != "jwks" || !checks[0].Changed || checks[0].FlowID != "flow" ||
+			!checks[0].CreatedAt.Equal(testTime.Add(time.Minute)) {
+			t.Errorf("GetMonitorChecks() = %+v, want the jwks check", checks)
+		}
+	})
+}
@@ -0,0 +1,153 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pericles-luz/oauth2-test/internal/models"
+)
+
+// profileColumns is the column list shared by all client_profiles queries
+const profileColumns = `id, name, client_id, client_secret, redirect_uri, scopes, base_url, created_at, updated_at`
+
+// scanClientProfile scans a row selected with profileColumns, decrypting the client secret
+func (s *sqlDB) scanClientProfile(row rowScanner) (*models.ClientProfile, error) {
+	var profile models.ClientProfile
+	var scopes string
+	err := row.Scan(
+		&profile.ID,
+		&profile.Name,
+		&profile.ClientID,
+		&profile.ClientSecret,
+		&profile.RedirectURI,
+		&scopes,
+		&profile.BaseURL,
+		&profile.CreatedAt,
+		&profile.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	profile.Scopes = strings.Fields(scopes)
+	if profile.ClientSecret, err = s.keyring.Decrypt(profile.ClientSecret); err != nil {
+		return nil, fmt.Errorf("client profile %d: %w", profile.ID, err)
+	}
+	return &profile, nil
+}
+
+// SaveClientProfile inserts a new profile, or updates it when it has an ID
+func (s *sqlDB) SaveClientProfile(profile *models.ClientProfile) error {
+	now := time.Now()
+
+	secret, err := s.keyring.Encrypt(profile.ClientSecret)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt client secret: %w", err)
+	}
+
+	if profile.ID == 0 {
+		id, err := s.insert(`
+			INSERT INTO client_profiles (
+				name, client_id, client_secret, redirect_uri, scopes, base_url, created_at, updated_at
+			) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		`,
+			profile.Name,
+			profile.ClientID,
+			secret,
+			profile.RedirectURI,
+			profile.ScopeString(),
+			profile.BaseURL,
+			s.dialect.timeArg(now),
+			s.dialect.timeArg(now),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to save client profile: %w", err)
+		}
+
+		profile.ID = id
+		profile.CreatedAt = now
+		profile.UpdatedAt = now
+		return nil
+	}
+
+	result, err := s.exec(`
+		UPDATE client_profiles
+		SET name = ?, client_id = ?, client_secret = ?, redirect_uri = ?, scopes = ?, base_url = ?, updated_at = ?
+		WHERE id = ?
+	`,
+		profile.Name,
+		profile.ClientID,
+		secret,
+		profile.RedirectURI,
+		profile.ScopeString(),
+		profile.BaseURL,
+		s.dialect.timeArg(now),
+		profile.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update client profile: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %w", err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("client profile %d not found", profile.ID)
+	}
+
+	profile.UpdatedAt = now
+	return nil
+}
+
+// GetClientProfile retrieves a profile by ID, or nil if it does not exist
+func (s *sqlDB) GetClientProfile(id int64) (*models.ClientProfile, error) {
+	profile, err := s.scanClientProfile(s.queryRow(`SELECT `+profileColumns+` FROM client_profiles WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client profile: %w", err)
+	}
+
+	return profile, nil
+}
+
+// GetClientProfiles retrieves all profiles ordered by name
+func (s *sqlDB) GetClientProfiles() ([]models.ClientProfile, error) {
+	rows, err := s.query(`SELECT ` + profileColumns + ` FROM client_profiles ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query client profiles: %w", err)
+	}
+	defer rows.Close()
+
+	var profiles []models.ClientProfile
+	for rows.Next() {
+		profile, err := s.scanClientProfile(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		profiles = append(profiles, *profile)
+	}
+
+	return profiles, rows.Err()
+}
+
+// DeleteClientProfile removes a profile. History entries keep its ID.
+func (s *sqlDB) DeleteClientProfile(id int64) error {
+	result, err := s.exec(`DELETE FROM client_profiles WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete client profile: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %w", err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("client profile %d not found", id)
+	}
+
+	return nil
+}
@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/pericles-luz/oauth2-test/internal/models"
+)
+
+// SaveRefreshLogEntry records a refresh token grant
+func (s *sqlDB) SaveRefreshLogEntry(entry *models.RefreshLogEntry) error {
+	var accessExpiry interface{}
+	if !entry.AccessExpiry.IsZero() {
+		accessExpiry = s.dialect.timeArg(entry.AccessExpiry)
+	}
+
+	id, err := s.insert(`
+		INSERT INTO token_refresh_log (
+			session_id, trigger_type, success, rotated, reused,
+			old_fingerprint, new_fingerprint, access_expiry, error, flow_id, created_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`,
+		entry.SessionID,
+		entry.Trigger,
+		entry.Success,
+		entry.Rotated,
+		entry.Reused,
+		entry.OldFingerprint,
+		entry.NewFingerprint,
+		accessExpiry,
+		entry.Error,
+		nullableString(entry.FlowID),
+		s.dialect.timeArg(entry.CreatedAt),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save refresh log entry: %w", err)
+	}
+
+	entry.ID = id
+	return nil
+}
+
+// GetRefreshLog retrieves the most recent refresh token grants of a session
+func (s *sqlDB) GetRefreshLog(sessionID string, limit int) ([]models.RefreshLogEntry, error) {
+	rows, err := s.query(`
+		SELECT id, session_id, trigger_type, success, rotated, reused,
+		       old_fingerprint, new_fingerprint, access_expiry, error, COALESCE(flow_id, ''), created_at
+		FROM token_refresh_log
+		WHERE session_id = ?
+		ORDER BY created_at DESC, id DESC
+		LIMIT ?
+	`, sessionID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query refresh log: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []models.RefreshLogEntry
+	for rows.Next() {
+		var entry models.RefreshLogEntry
+		var accessExpiry sql.NullTime
+		err := rows.Scan(
+			&entry.ID,
+			&entry.SessionID,
+			&entry.Trigger,
+			&entry.Success,
+			&entry.Rotated,
+			&entry.Reused,
+			&entry.OldFingerprint,
+			&entry.NewFingerprint,
+			&accessExpiry,
+			&entry.Error,
+			&entry.FlowID,
+			&entry.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		entry.AccessExpiry = accessExpiry.Time
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
@@ -0,0 +1,126 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/pericles-luz/oauth2-test/internal/models"
+)
+
+// sessionColumns is the column list shared by all sessions queries
+const sessionColumns = `id, token_hash, data, user_agent, remote_addr, created_at, last_seen_at, expires_at`
+
+// scanSession scans a row selected with sessionColumns, decrypting its data
+func (s *sqlDB) scanSession(row rowScanner) (*models.Session, error) {
+	var session models.Session
+	err := row.Scan(
+		&session.ID,
+		&session.TokenHash,
+		&session.Data,
+		&session.UserAgent,
+		&session.RemoteAddr,
+		&session.CreatedAt,
+		&session.LastSeenAt,
+		&session.ExpiresAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if session.Data, err = s.keyring.Decrypt(session.Data); err != nil {
+		return nil, fmt.Errorf("session %d: %w", session.ID, err)
+	}
+	return &session, nil
+}
+
+// SaveSession inserts a session, or updates its data and activity when the token already exists
+func (s *sqlDB) SaveSession(session *models.Session) error {
+	data, err := s.keyring.Encrypt(session.Data)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt session: %w", err)
+	}
+
+	id, err := s.insert(`
+		INSERT INTO sessions (
+			token_hash, data, user_agent, remote_addr, created_at, last_seen_at, expires_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (token_hash) DO UPDATE
+		SET data = excluded.data, last_seen_at = excluded.last_seen_at
+	`,
+		session.TokenHash,
+		data,
+		session.UserAgent,
+		session.RemoteAddr,
+		s.dialect.timeArg(session.CreatedAt),
+		s.dialect.timeArg(session.LastSeenAt),
+		s.dialect.timeArg(session.ExpiresAt),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save session: %w", err)
+	}
+
+	session.ID = id
+	return nil
+}
+
+// GetSessionByToken retrieves a session by its token hash, or nil if it does not exist
+func (s *sqlDB) GetSessionByToken(tokenHash string) (*models.Session, error) {
+	session, err := s.scanSession(s.queryRow(`SELECT `+sessionColumns+` FROM sessions WHERE token_hash = ?`, tokenHash))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session: %w", err)
+	}
+
+	return session, nil
+}
+
+// GetSession retrieves a session by ID, or nil if it does not exist
+func (s *sqlDB) GetSession(id int64) (*models.Session, error) {
+	session, err := s.scanSession(s.queryRow(`SELECT `+sessionColumns+` FROM sessions WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session: %w", err)
+	}
+
+	return session, nil
+}
+
+// GetSessions retrieves all sessions, most recently active first
+func (s *sqlDB) GetSessions() ([]models.Session, error) {
+	rows, err := s.query(`SELECT ` + sessionColumns + ` FROM sessions ORDER BY last_seen_at DESC, id DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var sessions []models.Session
+	for rows.Next() {
+		session, err := s.scanSession(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		sessions = append(sessions, *session)
+	}
+
+	return sessions, rows.Err()
+}
+
+// TouchSession records activity on a session
+func (s *sqlDB) TouchSession(id int64, lastSeen time.Time) error {
+	if _, err := s.exec(`UPDATE sessions SET last_seen_at = ? WHERE id = ?`, s.dialect.timeArg(lastSeen), id); err != nil {
+		return fmt.Errorf("failed to touch session: %w", err)
+	}
+	return nil
+}
+
+// DeleteSession removes a session, ending it
+func (s *sqlDB) DeleteSession(id int64) error {
+	if _, err := s.exec(`DELETE FROM sessions WHERE id = ?`, id); err != nil {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pericles-luz/oauth2-test/internal/models"
+)
+
+func TestSessions(t *testing.T) {
+	forEachMigratedBackend(t, func(t *testing.T, db *sqlDB) {
+		db.SetKeyring(newTestKeyring(t))
+
+		first := &models.Session{
+			TokenHash:  "hash-1",
+			Data:       `{"state":"abc"}`,
+			UserAgent:  "test",
+			RemoteAddr: "127.0.0.1",
+			CreatedAt:  testTime,
+			LastSeenAt: testTime,
+			ExpiresAt:  testTime.Add(time.Hour),
+		}
+		second := &models.Session{TokenHash: "hash-2", CreatedAt: testTime, LastSeenAt: testTime.Add(time.Minute), ExpiresAt: testTime.Add(time.Hour)}
+		for _, session := range []*models.Session{first, second} {
+			if err := db.SaveSession(session); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		got, err := db.GetSessionByToken("hash-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got == nil || got.ID != first.ID || got.Data != first.Data || got.UserAgent != "test" || got.RemoteAddr != "127.0.0.1" ||
+			!got.CreatedAt.Equal(testTime) || !got.ExpiresAt.Equal(first.ExpiresAt) {
+			t.Errorf("GetSessionByToken() = %+v, want %+v", got, first)
+		}
+		if got, err := db.GetSessionByToken("unknown"); err != nil || got != nil {
+			t.Errorf("GetSessionByToken(unknown) = %v, %v, want nil, nil", got, err)
+		}
+
+		// Saving the same token updates the data and activity, not the expiry
+		update := *first
+		update.Data = `{"state":"def"}`
+		update.LastSeenAt = testTime.Add(2 * time.Minute)
+		update.ExpiresAt = testTime.Add(48 * time.Hour)
+		if err := db.SaveSession(&update); err != nil {
+			t.Fatal(err)
+		}
+		if update.ID != first.ID {
+			t.Errorf("saved again with ID %d, want %d", update.ID, first.ID)
+		}
+		got, err = db.GetSession(first.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Data != update.Data || !got.LastSeenAt.Equal(update.LastSeenAt) || !got.ExpiresAt.Equal(first.ExpiresAt) {
+			t.Errorf("GetSession() = %+v, want the data and activity of %+v", got, update)
+		}
+
+		// Most recently active first
+		if err := db.TouchSession(second.ID, testTime.Add(3*time.Minute)); err != nil {
+			t.Fatal(err)
+		}
+		sessions, err := db.GetSessions()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(sessions) != 2 || sessions[0].ID != second.ID || sessions[1].ID != first.ID {
+			t.Errorf("GetSessions() = %+v, want sessions %d and %d", sessions, second.ID, first.ID)
+		}
+
+		if err := db.DeleteSession(first.ID); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := db.GetSession(first.ID); err != nil || got != nil {
+			t.Errorf("GetSession() after delete = %v, %v, want nil, nil", got, err)
+		}
+	})
+}
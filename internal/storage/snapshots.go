@@ -0,0 +1,137 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/pericles-luz/oauth2-test/internal/models"
+)
+
+// snapshotColumns are the columns scanned by scanSnapshot
+const snapshotColumns = `id, kind, source, version, fingerprint, document, summary, changes, first_seen_at, last_seen_at`
+
+// SaveSnapshot records a new version of a provider document
+func (s *sqlDB) SaveSnapshot(snapshot *models.ProviderSnapshot) error {
+	summary, err := json.Marshal(snapshot.Summary)
+	if err != nil {
+		return fmt.Errorf("failed to encode snapshot summary: %w", err)
+	}
+	if snapshot.Summary == nil {
+		summary = []byte("[]")
+	}
+	changes := snapshot.Changes
+	if changes == "" {
+		changes = "[]"
+	}
+
+	id, err := s.insert(`
+		INSERT INTO provider_snapshots (
+			kind, source, version, fingerprint, document, summary, changes,
+			first_seen_at, last_seen_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`,
+		snapshot.Kind,
+		snapshot.Source,
+		snapshot.Version,
+		snapshot.Fingerprint,
+		snapshot.Document,
+		string(summary),
+		changes,
+		s.dialect.timeArg(snapshot.FirstSeenAt),
+		s.dialect.timeArg(snapshot.LastSeenAt),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save snapshot: %w", err)
+	}
+
+	snapshot.ID = id
+	return nil
+}
+
+// TouchSnapshot records that a version was fetched again at seenAt
+func (s *sqlDB) TouchSnapshot(id int64, seenAt time.Time) error {
+	if _, err := s.exec(`UPDATE provider_snapshots SET last_seen_at = ? WHERE id = ?`, s.dialect.timeArg(seenAt), id); err != nil {
+		return fmt.Errorf("failed to update snapshot: %w", err)
+	}
+	return nil
+}
+
+// GetLatestSnapshot retrieves the latest version of the document fetched
+// from source, or nil when it was never fetched
+func (s *sqlDB) GetLatestSnapshot(source string) (*models.ProviderSnapshot, error) {
+	row := s.queryRow(`
+		SELECT `+snapshotColumns+`
+		FROM provider_snapshots
+		WHERE source = ?
+		ORDER BY version DESC
+		LIMIT 1
+	`, source)
+
+	snapshot, err := s.scanSnapshot(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get snapshot: %w", err)
+	}
+	return snapshot, nil
+}
+
+// GetSnapshots retrieves the most recent versions, of every document or
+// only of the one fetched from source
+func (s *sqlDB) GetSnapshots(source string, limit int) ([]models.ProviderSnapshot, error) {
+	query := `SELECT ` + snapshotColumns + ` FROM provider_snapshots`
+	var args []interface{}
+	if source != "" {
+		query += ` WHERE source = ?`
+		args = append(args, source)
+	}
+	query += ` ORDER BY first_seen_at DESC, id DESC LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := s.query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query snapshots: %w", err)
+	}
+	defer rows.Close()
+
+	var snapshots []models.ProviderSnapshot
+	for rows.Next() {
+		snapshot, err := s.scanSnapshot(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		snapshots = append(snapshots, *snapshot)
+	}
+
+	return snapshots, rows.Err()
+}
+
+// scanSnapshot scans a row selected with snapshotColumns
+func (s *sqlDB) scanSnapshot(row rowScanner) (*models.ProviderSnapshot, error) {
+	var snapshot models.ProviderSnapshot
+	var summary string
+	err := row.Scan(
+		&snapshot.ID,
+		&snapshot.Kind,
+		&snapshot.Source,
+		&snapshot.Version,
+		&snapshot.Fingerprint,
+		&snapshot.Document,
+		&summary,
+		&snapshot.Changes,
+		&snapshot.FirstSeenAt,
+		&snapshot.LastSeenAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(summary), &snapshot.Summary); err != nil {
+		return nil, fmt.Errorf("snapshot %d: failed to decode summary: %w", snapshot.ID, err)
+	}
+	return &snapshot, nil
+}
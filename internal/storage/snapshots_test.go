@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pericles-luz/oauth2-test/internal/models"
+)
+
+func TestSnapshots(t *testing.T) {
+	const (
+		discovery = "https://idp.example/.well-known/openid-configuration"
+		jwks      = "https://idp.example/jwks"
+	)
+
+	forEachMigratedBackend(t, func(t *testing.T, db *sqlDB) {
+		snapshots := []*models.ProviderSnapshot{
+			{Kind: models.SnapshotDiscovery, Source: discovery, Version: 1, Fingerprint: "d1", Document: `{"issuer":"a"}`},
+			{Kind: models.SnapshotJWKS, Source: jwks, Version: 1, Fingerprint: "j1", Document: `{"keys":[]}`},
+			{
+				Kind:        models.SnapshotDiscovery,
+				Source:      discovery,
+				Version:     2,
+				Fingerprint: "d2",
+				Document:    `{"issuer":"b"}`,
+				Summary:     []models.SnapshotChange{{Field: "issuer", Change: "changed"}},
+				Changes:     `[{"field":"issuer","change":"changed","old":"a","new":"b"}]`,
+			},
+		}
+		for i, snapshot := range snapshots {
+			snapshot.FirstSeenAt = testTime.Add(time.Duration(i) * time.Minute)
+			snapshot.LastSeenAt = snapshot.FirstSeenAt
+			if err := db.SaveSnapshot(snapshot); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := db.TouchSnapshot(snapshots[2].ID, testTime.Add(time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+
+		latest, err := db.GetLatestSnapshot(discovery)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if latest == nil || latest.ID != snapshots[2].ID || latest.Version != 2 || latest.Document != `{"issuer":"b"}` ||
+			latest.Changes != snapshots[2].Changes || !reflect.DeepEqual(latest.Summary, snapshots[2].Summary) ||
+			!latest.FirstSeenAt.Equal(testTime.Add(2*time.Minute)) || !latest.LastSeenAt.Equal(testTime.Add(time.Hour)) {
+			t.Errorf("GetLatestSnapshot() = %+v, want %+v touched", latest, snapshots[2])
+		}
+		if missing, err := db.GetLatestSnapshot("https://other.example/jwks"); err != nil || missing != nil {
+			t.Errorf("GetLatestSnapshot(unknown) = %v, %v, want nil, nil", missing, err)
+		}
+
+		// A first version has an empty summary and no changes
+		first, err := db.GetLatestSnapshot(jwks)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if first == nil || len(first.Summary) != 0 || first.Changes != "[]" {
+			t.Errorf("GetLatestSnapshot(jwks) = %+v, want no summary and no changes", first)
+		}
+
+		tests := []struct {
+			name   string
+			source string
+			limit  int
+			want   []int64
+		}{
+			{"every source", "", 10, []int64{snapshots[2].ID, snapshots[1].ID, snapshots[0].ID}},
+			{"one source", discovery, 10, []int64{snapshots[2].ID, snapshots[0].ID}},
+			{"limited", "", 1, []int64{snapshots[2].ID}},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				list, err := db.GetSnapshots(tt.source, tt.limit)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got := []int64{}
+				for _, snapshot := range list {
+					got = append(got, snapshot.ID)
+				}
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("GetSnapshots() = %v, want %v", got, tt.want)
+				}
+			})
+		}
+	})
+}
@@ -2,19 +2,27 @@ package storage
 
 import (
 	"database/sql"
-	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	_ "modernc.org/sqlite"
-
-	"github.com/pericles-luz/oauth2-test/internal/models"
 )
 
+// sqliteTimeFormat matches the format of CURRENT_TIMESTAMP
+const sqliteTimeFormat = "2006-01-02 15:04:05"
+
+// sqliteOptions are applied to every connection of the pool. The background
+// jobs write while requests are served, so writers wait for the lock instead
+// of failing with SQLITE_BUSY, WAL keeps readers from blocking them, and
+// transactions take the write lock up front so they cannot deadlock on upgrade.
+const sqliteOptions = "_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_txlock=immediate"
+
 // SQLiteDB represents a SQLite database connection
 type SQLiteDB struct {
-	db *sql.DB
+	*sqlDB
 }
 
 // NewSQLiteDB creates a new SQLite database connection
@@ -25,7 +33,11 @@ func NewSQLiteDB(dbPath string) (*SQLiteDB, error) {
 		return nil, fmt.Errorf("failed to create database directory: %w", err)
 	}
 
-	db, err := sql.Open("sqlite", dbPath)
+	dsn := dbPath + "?" + sqliteOptions
+	if strings.Contains(dbPath, "?") {
+		dsn = dbPath + "&" + sqliteOptions
+	}
+	db, err := sql.Open("sqlite", dsn)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
@@ -35,196 +47,102 @@ func NewSQLiteDB(dbPath string) (*SQLiteDB, error) {
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
-	return &SQLiteDB{db: db}, nil
+	return &SQLiteDB{&sqlDB{db: db, dialect: sqliteDialect{}}}, nil
 }
 
-// RunMigrations executes the SQL migration file
-func (s *SQLiteDB) RunMigrations(migrationPath string) error {
-	content, err := os.ReadFile(migrationPath)
-	if err != nil {
-		return fmt.Errorf("failed to read migration file: %w", err)
-	}
+// sqliteDialect implements dialect for SQLite
+type sqliteDialect struct{}
 
-	if _, err := s.db.Exec(string(content)); err != nil {
-		return fmt.Errorf("failed to execute migration: %w", err)
-	}
+func (sqliteDialect) name() string { return "sqlite" }
+
+func (sqliteDialect) rebind(query string) string { return query }
 
-	return nil
+// timeArg formats times like CURRENT_TIMESTAMP, which stores UTC text
+func (sqliteDialect) timeArg(t time.Time) interface{} {
+	return t.UTC().Format(sqliteTimeFormat)
 }
 
-// SaveHistoryEntry saves an HTTP request/response to the database
-func (s *SQLiteDB) SaveHistoryEntry(entry *models.HistoryEntry) error {
-	query := `
-		INSERT INTO http_history (
-			request_method, request_url, request_headers, request_body,
-			response_status, response_headers, response_body,
-			duration_ms, endpoint_type
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
-	`
-
-	result, err := s.db.Exec(
-		query,
-		entry.RequestMethod,
-		entry.RequestURL,
-		entry.RequestHeaders,
-		entry.RequestBody,
-		entry.ResponseStatus,
-		entry.ResponseHeaders,
-		entry.ResponseBody,
-		entry.DurationMs,
-		entry.EndpointType,
-	)
-	if err != nil {
-		return fmt.Errorf("failed to save history entry: %w", err)
-	}
+func (sqliteDialect) unlimited() string { return "-1" }
 
-	id, err := result.LastInsertId()
+func (sqliteDialect) tableExists(db *sql.DB, table string) (bool, error) {
+	var count int
+	err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?`, table).Scan(&count)
 	if err != nil {
-		return fmt.Errorf("failed to get last insert ID: %w", err)
+		return false, fmt.Errorf("failed to inspect table %s: %w", table, err)
 	}
-
-	entry.ID = id
-	return nil
+	return count > 0, nil
 }
 
-// GetHistoryEntries retrieves history entries with pagination
-func (s *SQLiteDB) GetHistoryEntries(limit, offset int) ([]models.HistoryEntry, error) {
-	query := `
-		SELECT id, request_method, request_url, request_headers, request_body,
-		       response_status, response_headers, response_body,
-		       duration_ms, endpoint_type, created_at
-		FROM http_history
-		ORDER BY created_at DESC
-		LIMIT ? OFFSET ?
-	`
-
-	rows, err := s.db.Query(query, limit, offset)
-	if err != nil {
-		return nil, fmt.Errorf("failed to query history: %w", err)
+// legacySchemaVersion detects the schema of databases migrated by re-running
+// SQL files on every boot, before schema_migrations existed
+func (d sqliteDialect) legacySchemaVersion(db *sql.DB) (int, error) {
+	exists, err := d.tableExists(db, "http_history")
+	if err != nil || !exists {
+		return 0, err
 	}
-	defer rows.Close()
 
-	var entries []models.HistoryEntry
-	for rows.Next() {
-		var entry models.HistoryEntry
-		err := rows.Scan(
-			&entry.ID,
-			&entry.RequestMethod,
-			&entry.RequestURL,
-			&entry.RequestHeaders,
-			&entry.RequestBody,
-			&entry.ResponseStatus,
-			&entry.ResponseHeaders,
-			&entry.ResponseBody,
-			&entry.DurationMs,
-			&entry.EndpointType,
-			&entry.CreatedAt,
-		)
+	checks := []struct {
+		version int
+		column  string
+	}{
+		{3, "flow_id"},
+		{2, "pinned"},
+	}
+	for _, check := range checks {
+		hasColumn, err := columnExists(db, "http_history", check.column)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan row: %w", err)
+			return 0, err
+		}
+		if hasColumn {
+			return check.version, nil
 		}
-		entries = append(entries, entry)
 	}
 
-	return entries, nil
+	return 1, nil
 }
 
-// GetHistoryEntry retrieves a single history entry by ID
-func (s *SQLiteDB) GetHistoryEntry(id int64) (*models.HistoryEntry, error) {
-	query := `
-		SELECT id, request_method, request_url, request_headers, request_body,
-		       response_status, response_headers, response_body,
-		       duration_ms, endpoint_type, created_at
-		FROM http_history
-		WHERE id = ?
-	`
-
-	var entry models.HistoryEntry
-	err := s.db.QueryRow(query, id).Scan(
-		&entry.ID,
-		&entry.RequestMethod,
-		&entry.RequestURL,
-		&entry.RequestHeaders,
-		&entry.RequestBody,
-		&entry.ResponseStatus,
-		&entry.ResponseHeaders,
-		&entry.ResponseBody,
-		&entry.DurationMs,
-		&entry.EndpointType,
-		&entry.CreatedAt,
-	)
-	if err == sql.ErrNoRows {
-		return nil, nil
+// databaseSize returns the size of the database file
+func (sqliteDialect) databaseSize(db *sql.DB) (int64, error) {
+	var pageCount, pageSize int64
+	if err := db.QueryRow(`PRAGMA page_count`).Scan(&pageCount); err != nil {
+		return 0, err
 	}
-	if err != nil {
-		return nil, fmt.Errorf("failed to get history entry: %w", err)
+	if err := db.QueryRow(`PRAGMA page_size`).Scan(&pageSize); err != nil {
+		return 0, err
 	}
+	return pageCount * pageSize, nil
+}
 
-	return &entry, nil
+// vacuum rebuilds the database file, reclaiming the space of deleted rows
+func (sqliteDialect) vacuum(db *sql.DB) error {
+	_, err := db.Exec(`VACUUM`)
+	return err
 }
 
-// GetHistoryEntriesByType retrieves history entries filtered by endpoint type
-func (s *SQLiteDB) GetHistoryEntriesByType(endpointType string, limit, offset int) ([]models.HistoryEntry, error) {
-	query := `
-		SELECT id, request_method, request_url, request_headers, request_body,
-		       response_status, response_headers, response_body,
-		       duration_ms, endpoint_type, created_at
-		FROM http_history
-		WHERE endpoint_type = ?
-		ORDER BY created_at DESC
-		LIMIT ? OFFSET ?
-	`
-
-	rows, err := s.db.Query(query, endpointType, limit, offset)
+// columnExists checks whether a table has the given column
+func columnExists(db *sql.DB, table, column string) (bool, error) {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
 	if err != nil {
-		return nil, fmt.Errorf("failed to query history by type: %w", err)
+		return false, fmt.Errorf("failed to inspect table %s: %w", table, err)
 	}
 	defer rows.Close()
 
-	var entries []models.HistoryEntry
 	for rows.Next() {
-		var entry models.HistoryEntry
-		err := rows.Scan(
-			&entry.ID,
-			&entry.RequestMethod,
-			&entry.RequestURL,
-			&entry.RequestHeaders,
-			&entry.RequestBody,
-			&entry.ResponseStatus,
-			&entry.ResponseHeaders,
-			&entry.ResponseBody,
-			&entry.DurationMs,
-			&entry.EndpointType,
-			&entry.CreatedAt,
+		var (
+			cid        int
+			name       string
+			columnType string
+			notNull    int
+			defaultVal sql.NullString
+			primaryKey int
 		)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan row: %w", err)
+		if err := rows.Scan(&cid, &name, &columnType, &notNull, &defaultVal, &primaryKey); err != nil {
+			return false, fmt.Errorf("failed to scan table info: %w", err)
+		}
+		if name == column {
+			return true, nil
 		}
-		entries = append(entries, entry)
-	}
-
-	return entries, nil
-}
-
-// Close closes the database connection
-func (s *SQLiteDB) Close() error {
-	return s.db.Close()
-}
-
-// Helper function to serialize headers to JSON
-func SerializeHeaders(headers map[string][]string) (string, error) {
-	data, err := json.Marshal(headers)
-	if err != nil {
-		return "", err
 	}
-	return string(data), nil
-}
 
-// Helper function to deserialize headers from JSON
-func DeserializeHeaders(data string) (map[string][]string, error) {
-	var headers map[string][]string
-	if err := json.Unmarshal([]byte(data), &headers); err != nil {
-		return nil, err
-	}
-	return headers, nil
+	return false, rows.Err()
 }
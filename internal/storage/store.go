@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/pericles-luz/oauth2-test/internal/models"
+	"github.com/pericles-luz/oauth2-test/internal/secrets"
+)
+
+// Store is the persistence layer used by the services. SQLiteDB and
+// PostgresDB implement it with the same schema.
+type Store interface {
+	// History
+	SaveHistoryEntry(entry *models.HistoryEntry) error
+	GetHistoryEntries(limit, offset int) ([]models.HistoryEntry, error)
+	GetHistoryEntry(id int64) (*models.HistoryEntry, error)
+	GetHistoryEntriesByType(endpointType string, limit, offset int) ([]models.HistoryEntry, error)
+	GetHistoryEntriesFiltered(filter models.HistoryFilter, limit, offset int) ([]models.HistoryEntry, error)
+	GetEndpointTypes() ([]string, error)
+	GetHistorySamples(since time.Time) ([]models.HistorySample, error)
+
+	// Retention and maintenance
+	SetHistoryPinned(id int64, pinned bool) error
+	DeleteHistoryOlderThan(cutoff time.Time) (int64, error)
+	TrimHistory(endpointType string, keep int) (int64, error)
+	PurgeHistory(includePinned bool) (int64, error)
+	Vacuum() error
+	GetHistoryCounts() ([]HistoryCount, error)
+	GetDatabaseSize() (int64, error)
+	SaveMaintenanceRun(run *models.MaintenanceRun) error
+	GetMaintenanceRuns(limit int) ([]models.MaintenanceRun, error)
+
+	// Client profiles
+	SaveClientProfile(profile *models.ClientProfile) error
+	GetClientProfile(id int64) (*models.ClientProfile, error)
+	GetClientProfiles() ([]models.ClientProfile, error)
+	DeleteClientProfile(id int64) error
+
+	// Server-side sessions
+	SaveSession(session *models.Session) error
+	GetSession(id int64) (*models.Session, error)
+	GetSessionByToken(tokenHash string) (*models.Session, error)
+	GetSessions() ([]models.Session, error)
+	TouchSession(id int64, lastSeen time.Time) error
+	DeleteSession(id int64) error
+
+	// Session tokens
+	SaveToken(token *models.StoredToken) error
+	GetTokens(now time.Time) ([]models.StoredToken, error)
+	DeleteToken(sessionID string) error
+	DeleteExpiredTokens(now time.Time) (int64, error)
+	SaveRefreshLogEntry(entry *models.RefreshLogEntry) error
+	GetRefreshLog(sessionID string, limit int) ([]models.RefreshLogEntry, error)
+
+	// Synthetic monitoring
+	SaveMonitorCheck(check *models.MonitorCheck) error
+	GetMonitorChecks(limit int) ([]models.MonitorCheck, error)
+	GetMonitorState(name string) (string, error)
+	SetMonitorState(name, value string) error
+
+	// Provider snapshots
+	SaveSnapshot(snapshot *models.ProviderSnapshot) error
+	TouchSnapshot(id int64, seenAt time.Time) error
+	GetLatestSnapshot(source string) (*models.ProviderSnapshot, error)
+	GetSnapshots(source string, limit int) ([]models.ProviderSnapshot, error)
+
+	// Encryption at rest
+	SetKeyring(keyring *secrets.Keyring)
+	RotateKeys() (int64, error)
+
+	// Schema
+	Migrate(migrations []Migration) error
+	MigrateDown(migrations []Migration, steps int) error
+	MigrationStatus(migrations []Migration) ([]MigrationStatus, error)
+
+	Driver() string
+	Close() error
+}
+
+// Open connects to PostgreSQL when databaseURL is set, and to the SQLite
+// database at sqlitePath otherwise
+func Open(databaseURL, sqlitePath string) (Store, error) {
+	if databaseURL != "" {
+		db, err := NewPostgresDB(databaseURL)
+		if err != nil {
+			return nil, err
+		}
+		return db, nil
+	}
+
+	db, err := NewSQLiteDB(sqlitePath)
+	if err != nil {
+		return nil, err
+	}
+	return db, nil
+}
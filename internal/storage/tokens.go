@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pericles-luz/oauth2-test/internal/models"
+)
+
+// SaveToken inserts or replaces the tokens of a session
+func (s *sqlDB) SaveToken(token *models.StoredToken) error {
+	data, err := s.keyring.Encrypt(token.Data)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt token: %w", err)
+	}
+
+	now := time.Now()
+	id, err := s.insert(`
+		INSERT INTO session_tokens (session_id, data, expires_at, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (session_id) DO UPDATE
+		SET data = excluded.data, expires_at = excluded.expires_at, updated_at = excluded.updated_at
+	`,
+		token.SessionID,
+		data,
+		s.dialect.timeArg(token.ExpiresAt),
+		s.dialect.timeArg(now),
+		s.dialect.timeArg(now),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save token: %w", err)
+	}
+
+	token.ID = id
+	token.UpdatedAt = now
+	return nil
+}
+
+// GetTokens retrieves the tokens that expire after now
+func (s *sqlDB) GetTokens(now time.Time) ([]models.StoredToken, error) {
+	rows, err := s.query(`
+		SELECT id, session_id, data, expires_at, created_at, updated_at
+		FROM session_tokens
+		WHERE expires_at > ?
+	`, s.dialect.timeArg(now))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query tokens: %w", err)
+	}
+	defer rows.Close()
+
+	var tokens []models.StoredToken
+	for rows.Next() {
+		var token models.StoredToken
+		if err := rows.Scan(&token.ID, &token.SessionID, &token.Data, &token.ExpiresAt, &token.CreatedAt, &token.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		if token.Data, err = s.keyring.Decrypt(token.Data); err != nil {
+			return nil, fmt.Errorf("token %d: %w", token.ID, err)
+		}
+		tokens = append(tokens, token)
+	}
+
+	return tokens, rows.Err()
+}
+
+// DeleteToken removes the tokens of a session
+func (s *sqlDB) DeleteToken(sessionID string) error {
+	if _, err := s.exec(`DELETE FROM session_tokens WHERE session_id = ?`, sessionID); err != nil {
+		return fmt.Errorf("failed to delete token: %w", err)
+	}
+	return nil
+}
+
+// DeleteExpiredTokens removes the tokens that expired before now, along with
+// the refresh log of sessions that no longer have tokens
+func (s *sqlDB) DeleteExpiredTokens(now time.Time) (int64, error) {
+	result, err := s.exec(`DELETE FROM session_tokens WHERE expires_at <= ?`, s.dialect.timeArg(now))
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired tokens: %w", err)
+	}
+
+	if _, err := s.exec(`
+		DELETE FROM token_refresh_log
+		WHERE session_id NOT IN (SELECT session_id FROM session_tokens)
+	`); err != nil {
+		return 0, fmt.Errorf("failed to delete refresh log: %w", err)
+	}
+
+	return result.RowsAffected()
+}
@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pericles-luz/oauth2-test/internal/models"
+)
+
+func TestSessionTokens(t *testing.T) {
+	forEachMigratedBackend(t, func(t *testing.T, db *sqlDB) {
+		db.SetKeyring(newTestKeyring(t))
+
+		for _, token := range []*models.StoredToken{
+			{SessionID: "expired", Data: `{"access_token":"a"}`, ExpiresAt: testTime.Add(-time.Second)},
+			{SessionID: "active", Data: `{"access_token":"b"}`, ExpiresAt: testTime.Add(time.Hour)},
+		} {
+			if err := db.SaveToken(token); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// Saving a session again replaces its tokens
+		replaced := &models.StoredToken{SessionID: "active", Data: `{"access_token":"c"}`, ExpiresAt: testTime.Add(2 * time.Hour)}
+		if err := db.SaveToken(replaced); err != nil {
+			t.Fatal(err)
+		}
+
+		tokens, err := db.GetTokens(testTime)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(tokens) != 1 || tokens[0].SessionID != "active" || tokens[0].Data != replaced.Data || !tokens[0].ExpiresAt.Equal(replaced.ExpiresAt) {
+			t.Errorf("GetTokens() = %+v, want %+v", tokens, replaced)
+		}
+
+		for _, sessionID := range []string{"expired", "active"} {
+			entry := &models.RefreshLogEntry{SessionID: sessionID, Trigger: "manual", Success: true, CreatedAt: testTime}
+			if err := db.SaveRefreshLogEntry(entry); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// Expired tokens go with the refresh log of their session
+		deleted, err := db.DeleteExpiredTokens(testTime)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if deleted != 1 {
+			t.Errorf("DeleteExpiredTokens() = %d, want 1", deleted)
+		}
+		for sessionID, want := range map[string]int{"expired": 0, "active": 1} {
+			entries, err := db.GetRefreshLog(sessionID, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != want {
+				t.Errorf("refresh log of %s = %d entries, want %d", sessionID, len(entries), want)
+			}
+		}
+
+		if err := db.DeleteToken("active"); err != nil {
+			t.Fatal(err)
+		}
+		if tokens, err := db.GetTokens(testTime); err != nil || len(tokens) != 0 {
+			t.Errorf("GetTokens() after delete = %+v, %v, want none", tokens, err)
+		}
+	})
+}
+
+func TestRefreshLog(t *testing.T) {
+	forEachMigratedBackend(t, func(t *testing.T, db *sqlDB) {
+		entries := []*models.RefreshLogEntry{
+			{SessionID: "session", Trigger: "auto", Success: true, Rotated: true, OldFingerprint: "old", NewFingerprint: "new",
+				AccessExpiry: testTime.Add(time.Hour), FlowID: "flow", CreatedAt: testTime},
+			{SessionID: "session", Trigger: "manual", Reused: true, OldFingerprint: "new", Error: "invalid_grant",
+				CreatedAt: testTime.Add(time.Minute)},
+			{SessionID: "other", Trigger: "manual", CreatedAt: testTime},
+		}
+		for _, entry := range entries {
+			if err := db.SaveRefreshLogEntry(entry); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		log, err := db.GetRefreshLog("session", 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(log) != 2 {
+			t.Fatalf("GetRefreshLog() = %d entries, want 2", len(log))
+		}
+		// Newest first
+		for i, want := range []*models.RefreshLogEntry{entries[1], entries[0]} {
+			got := log[i]
+			if got.ID != want.ID || got.Trigger != want.Trigger || got.Success != want.Success || got.Rotated != want.Rotated ||
+				got.Reused != want.Reused || got.OldFingerprint != want.OldFingerprint || got.NewFingerprint != want.NewFingerprint ||
+				!got.AccessExpiry.Equal(want.AccessExpiry) || got.Error != want.Error || got.FlowID != want.FlowID ||
+				!got.CreatedAt.Equal(want.CreatedAt) {
+				t.Errorf("entry %d = %+v, want %+v", i, got, *want)
+			}
+		}
+
+		if log, err := db.GetRefreshLog("session", 1); err != nil || len(log) != 1 || log[0].ID != entries[1].ID {
+			t.Errorf("GetRefreshLog(limit 1) = %+v, %v, want the newest entry", log, err)
+		}
+	})
+}
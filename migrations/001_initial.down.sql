@@ -0,0 +1,6 @@
+-- migrations/001_initial.down.sql
+-- Reverts 001_initial.sql
+
+DROP INDEX IF EXISTS idx_history_endpoint;
+DROP INDEX IF EXISTS idx_history_created;
+DROP TABLE IF EXISTS http_history;
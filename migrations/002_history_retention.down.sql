@@ -0,0 +1,6 @@
+-- migrations/002_history_retention.down.sql
+-- Reverts 002_history_retention.sql
+
+DROP INDEX IF EXISTS idx_maintenance_started;
+DROP TABLE IF EXISTS maintenance_runs;
+ALTER TABLE http_history DROP COLUMN pinned;
@@ -0,0 +1,17 @@
+-- migrations/002_history_retention.sql
+-- History retention: pinned entries and maintenance job log
+
+ALTER TABLE http_history ADD COLUMN pinned INTEGER NOT NULL DEFAULT 0;
+
+CREATE TABLE maintenance_runs (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    kind TEXT NOT NULL,                -- prune/purge/vacuum
+    trigger_type TEXT NOT NULL,        -- scheduled/manual
+    deleted_rows INTEGER DEFAULT 0,
+    details TEXT,
+    error TEXT,
+    duration_ms INTEGER,
+    started_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_maintenance_started ON maintenance_runs(started_at DESC);
@@ -0,0 +1,6 @@
+-- migrations/003_history_flow.sql
+-- Groups the requests of one OAuth flow in the history
+
+ALTER TABLE http_history ADD COLUMN flow_id TEXT;
+
+CREATE INDEX idx_history_flow ON http_history(flow_id);
@@ -0,0 +1,17 @@
+-- migrations/004_client_profiles.sql
+-- Named OAuth2 client configurations, and the profile behind each history entry
+
+CREATE TABLE client_profiles (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL UNIQUE,
+    client_id TEXT NOT NULL,
+    client_secret TEXT NOT NULL,
+    redirect_uri TEXT NOT NULL,
+    scopes TEXT NOT NULL,              -- space separated
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE http_history ADD COLUMN profile_id INTEGER;
+
+CREATE INDEX idx_history_profile ON http_history(profile_id);
@@ -0,0 +1,4 @@
+-- migrations/005_profile_issuer.down.sql
+-- Reverts 005_profile_issuer.sql
+
+ALTER TABLE client_profiles DROP COLUMN base_url;
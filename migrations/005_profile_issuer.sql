@@ -0,0 +1,4 @@
+-- migrations/005_profile_issuer.sql
+-- Issuer base URL of each client profile (empty uses OAUTH2_BASE_URL)
+
+ALTER TABLE client_profiles ADD COLUMN base_url TEXT NOT NULL DEFAULT '';
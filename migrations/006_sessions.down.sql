@@ -0,0 +1,5 @@
+-- migrations/006_sessions.down.sql
+-- Reverts 006_sessions.sql
+
+DROP INDEX IF EXISTS idx_sessions_last_seen;
+DROP TABLE IF EXISTS sessions;
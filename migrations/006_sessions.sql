@@ -0,0 +1,15 @@
+-- migrations/006_sessions.sql
+-- Server-side sessions; the cookie only carries an opaque token
+
+CREATE TABLE sessions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    token_hash TEXT NOT NULL UNIQUE,   -- HMAC of the cookie token, never the token itself
+    data TEXT NOT NULL,                -- encoded session values (encrypted at rest)
+    user_agent TEXT NOT NULL DEFAULT '',
+    remote_addr TEXT NOT NULL DEFAULT '',
+    created_at DATETIME NOT NULL,
+    last_seen_at DATETIME NOT NULL,
+    expires_at DATETIME NOT NULL       -- absolute timeout
+);
+
+CREATE INDEX idx_sessions_last_seen ON sessions(last_seen_at);
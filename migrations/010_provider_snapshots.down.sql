@@ -0,0 +1,5 @@
+-- migrations/010_provider_snapshots.down.sql
+-- Reverts 010_provider_snapshots.sql
+
+DROP INDEX IF EXISTS idx_provider_snapshots_seen;
+DROP TABLE IF EXISTS provider_snapshots;
@@ -0,0 +1,18 @@
+-- migrations/010_provider_snapshots.sql
+-- Versions of the discovery documents and key sets fetched from each issuer
+
+CREATE TABLE provider_snapshots (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    kind TEXT NOT NULL,                -- discovery/jwks
+    source TEXT NOT NULL,              -- URL the document was fetched from
+    version INTEGER NOT NULL,
+    fingerprint TEXT NOT NULL,
+    document TEXT NOT NULL,            -- canonical JSON
+    summary TEXT NOT NULL DEFAULT '[]', -- changed fields or keys, JSON array
+    changes TEXT NOT NULL DEFAULT '[]', -- differences to the previous version, JSON array
+    first_seen_at DATETIME NOT NULL,
+    last_seen_at DATETIME NOT NULL,
+    UNIQUE (source, version)
+);
+
+CREATE INDEX idx_provider_snapshots_seen ON provider_snapshots(first_seen_at);
@@ -0,0 +1,5 @@
+-- migrations/011_monitor_state_per_source.down.sql
+-- Reverts 011_monitor_state_per_source.sql: nothing to restore, the next
+-- monitor run starts over from the current versions
+
+DELETE FROM monitor_state WHERE name LIKE 'snapshot.%';
@@ -0,0 +1,5 @@
+-- migrations/011_monitor_state_per_source.sql
+-- The monitor keeps the last version seen of each document per source URL;
+-- drop the values it kept for whatever issuer was monitored last
+
+DELETE FROM monitor_state WHERE name IN ('discovery', 'jwks');
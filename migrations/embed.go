@@ -0,0 +1,31 @@
+// Package migrations embeds the versioned SQL schema migrations in the binary.
+//
+// Each migration is a NNN_name.sql file applied in version order, with an
+// optional NNN_name.down.sql file that reverts it. The files of this directory
+// target SQLite; postgres/ holds the same versions written for PostgreSQL.
+package migrations
+
+import (
+	"embed"
+	"io/fs"
+)
+
+// FS holds every SQLite migration file of this directory
+//
+//go:embed *.sql
+var FS embed.FS
+
+//go:embed postgres/*.sql
+var postgresFS embed.FS
+
+// For returns the migrations of a storage driver ("sqlite" or "postgres")
+func For(driver string) fs.FS {
+	if driver == "postgres" {
+		sub, err := fs.Sub(postgresFS, "postgres")
+		if err != nil {
+			panic(err) // the directory is embedded at build time
+		}
+		return sub
+	}
+	return FS
+}
@@ -0,0 +1,4 @@
+-- migrations/postgres/001_initial.down.sql
+-- Reverts 001_initial.sql
+
+DROP TABLE IF EXISTS http_history;
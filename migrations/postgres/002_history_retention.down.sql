@@ -0,0 +1,5 @@
+-- migrations/postgres/002_history_retention.down.sql
+-- Reverts 002_history_retention.sql
+
+DROP TABLE IF EXISTS maintenance_runs;
+ALTER TABLE http_history DROP COLUMN pinned;
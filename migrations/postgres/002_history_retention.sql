@@ -0,0 +1,17 @@
+-- migrations/postgres/002_history_retention.sql
+-- History retention: pinned entries and maintenance job log
+
+ALTER TABLE http_history ADD COLUMN pinned BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE TABLE maintenance_runs (
+    id BIGSERIAL PRIMARY KEY,
+    kind TEXT NOT NULL,                -- prune/purge/vacuum
+    trigger_type TEXT NOT NULL,        -- scheduled/manual
+    deleted_rows BIGINT DEFAULT 0,
+    details TEXT,
+    error TEXT,
+    duration_ms BIGINT,
+    started_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_maintenance_started ON maintenance_runs(started_at DESC);
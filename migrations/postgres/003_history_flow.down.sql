@@ -0,0 +1,5 @@
+-- migrations/postgres/003_history_flow.down.sql
+-- Reverts 003_history_flow.sql
+
+DROP INDEX IF EXISTS idx_history_flow;
+ALTER TABLE http_history DROP COLUMN flow_id;
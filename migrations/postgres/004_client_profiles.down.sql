@@ -0,0 +1,6 @@
+-- migrations/postgres/004_client_profiles.down.sql
+-- Reverts 004_client_profiles.sql
+
+DROP INDEX IF EXISTS idx_history_profile;
+ALTER TABLE http_history DROP COLUMN profile_id;
+DROP TABLE IF EXISTS client_profiles;
@@ -0,0 +1,5 @@
+-- migrations/postgres/007_session_tokens.down.sql
+-- Reverts 007_session_tokens.sql
+
+DROP INDEX IF EXISTS idx_session_tokens_expires;
+DROP TABLE IF EXISTS session_tokens;
@@ -0,0 +1,13 @@
+-- migrations/postgres/007_session_tokens.sql
+-- Tokens obtained by each session, kept across restarts
+
+CREATE TABLE session_tokens (
+    id BIGSERIAL PRIMARY KEY,
+    session_id TEXT NOT NULL UNIQUE,
+    data TEXT NOT NULL,                -- JSON tokens and user info (encrypted at rest)
+    expires_at TIMESTAMPTZ NOT NULL,   -- refresh token lifetime, or access token when there is none
+    created_at TIMESTAMPTZ NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX idx_session_tokens_expires ON session_tokens(expires_at);
@@ -0,0 +1,5 @@
+-- migrations/postgres/008_token_refresh_log.down.sql
+-- Reverts 008_token_refresh_log.sql
+
+DROP INDEX IF EXISTS idx_refresh_log_session;
+DROP TABLE IF EXISTS token_refresh_log;
@@ -0,0 +1,19 @@
+-- migrations/postgres/008_token_refresh_log.sql
+-- Refresh token grants made for each session, manual or automatic
+
+CREATE TABLE token_refresh_log (
+    id BIGSERIAL PRIMARY KEY,
+    session_id TEXT NOT NULL,
+    trigger_type TEXT NOT NULL,        -- auto/manual
+    success BOOLEAN NOT NULL,
+    rotated BOOLEAN NOT NULL,          -- the server issued a new refresh token
+    reused BOOLEAN NOT NULL,           -- the server returned a refresh token it had rotated out
+    old_fingerprint TEXT NOT NULL,     -- truncated SHA-256 of the refresh tokens, never the tokens
+    new_fingerprint TEXT NOT NULL DEFAULT '',
+    access_expiry TIMESTAMPTZ,
+    error TEXT NOT NULL DEFAULT '',
+    flow_id TEXT,
+    created_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX idx_refresh_log_session ON token_refresh_log(session_id, created_at);
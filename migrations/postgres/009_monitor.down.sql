@@ -0,0 +1,6 @@
+-- migrations/postgres/009_monitor.down.sql
+-- Reverts 009_monitor.sql
+
+DROP TABLE IF EXISTS monitor_state;
+DROP INDEX IF EXISTS idx_monitor_checks_created;
+DROP TABLE IF EXISTS monitor_checks;
@@ -0,0 +1,25 @@
+-- migrations/postgres/009_monitor.sql
+-- Synthetic monitoring of the provider: check results and state kept between runs
+
+CREATE TABLE monitor_checks (
+    id BIGSERIAL PRIMARY KEY,
+    check_name TEXT NOT NULL,          -- discovery/jwks/grant
+    trigger_type TEXT NOT NULL,        -- scheduled/manual
+    success BOOLEAN NOT NULL,
+    changed BOOLEAN NOT NULL,          -- the content differs from the previous run
+    fingerprint TEXT NOT NULL DEFAULT '',
+    details TEXT NOT NULL DEFAULT '',
+    error TEXT NOT NULL DEFAULT '',
+    duration_ms BIGINT NOT NULL,
+    flow_id TEXT,
+    created_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX idx_monitor_checks_created ON monitor_checks(created_at);
+
+CREATE TABLE monitor_state (
+    id BIGSERIAL PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE,
+    value TEXT NOT NULL,               -- last documents, check status, refresh token (encrypted at rest)
+    updated_at TIMESTAMPTZ NOT NULL
+);
@@ -0,0 +1,13 @@
+// Package openapi embeds the OpenAPI description of the JSON API in the binary.
+//
+// openapi.json is the source of truth for the /api/v1 routes: the server
+// serves it at /api/openapi.json and the client package is generated from it.
+// Change it together with the handlers, then run go generate ./client.
+package openapi
+
+import _ "embed"
+
+// Spec is the OpenAPI 3.1 document of the JSON API
+//
+//go:embed openapi.json
+var Spec []byte